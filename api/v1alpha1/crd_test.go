@@ -0,0 +1,38 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// maxCRDSize is the max size of a CRD in JSON. etcd refuses the requests larger than 1.5MiB by default, and
+// kubectl apply, used by make install, saves the whole CRD in an annotation, which is limited to 256KiB.
+const maxCRDSize = 256 * 1024
+
+func TestCRDSize(t *testing.T) {
+	for _, dir := range []string{"../../config/crd/bases", "../../chart/templates/crd"} {
+		files, err := filepath.Glob(filepath.Join(dir, "rainbond.io_*.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no crd found in %s", dir)
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crd, err := yaml.YAMLToJSON(data)
+			if err != nil {
+				t.Fatalf("parse %s: %v", file, err)
+			}
+			if len(crd) > maxCRDSize {
+				t.Errorf("%s is %d bytes, larger than %d bytes", file, len(crd), maxCRDSize)
+			}
+		}
+	}
+}
@@ -57,6 +57,29 @@ const (
 	RainbondClusterConditionTypeContainerNetwork  = "ContainerNetwork"
 	RainbondClusterConditionTypeRunning           = "Running"
 	RainbondClusterConditionTypeMemory            = "Memory"
+	RainbondClusterConditionTypeDisk              = "Disk"
+	RainbondClusterConditionTypeTimeSync          = "TimeSync"
+	RainbondClusterConditionTypeClusterDNS        = "ClusterDNS"
+	RainbondClusterConditionTypeWildcardDNS       = "WildcardDNS"
+)
+
+// RainbondClusterPhase is a label for the condition of a rainbondcluster at the current time.
+type RainbondClusterPhase string
+
+// These are the valid phases of rainbondcluster.
+const (
+	// RainbondClusterPhasePrechecking means the cluster is waiting for the configuration and the prechecks.
+	RainbondClusterPhasePrechecking RainbondClusterPhase = "Prechecking"
+	// RainbondClusterPhaseInstalling means the rbdcomponents are being installed for the first time.
+	RainbondClusterPhaseInstalling RainbondClusterPhase = "Installing"
+	// RainbondClusterPhaseRunning means all the rbdcomponents expected by the cluster are ready.
+	RainbondClusterPhaseRunning RainbondClusterPhase = "Running"
+	// RainbondClusterPhaseUpgrading means the rbdcomponents are being upgraded to a new install version.
+	RainbondClusterPhaseUpgrading RainbondClusterPhase = "Upgrading"
+	// RainbondClusterPhaseDegraded means some expected rbdcomponents are not ready after the cluster has been running.
+	RainbondClusterPhaseDegraded RainbondClusterPhase = "Degraded"
+	// RainbondClusterPhaseFailed means the cluster can not be installed, because some prechecks failed.
+	RainbondClusterPhaseFailed RainbondClusterPhase = "Failed"
 )
 
 // RainbondClusterCondition contains condition information for rainbondcluster.
@@ -65,6 +88,9 @@ type RainbondClusterCondition struct {
 	Type RainbondClusterConditionType `json:"type" `
 	// Status of the condition, one of True, False, Unknown.
 	Status corev1.ConditionStatus `json:"status" `
+	// ObservedGeneration is the generation of the rainbondcluster the condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time we got an update on a given condition.
 	// +optional
 	LastHeartbeatTime metav1.Time `json:"lastHeartbeatTime,omitempty" `
@@ -79,12 +105,103 @@ type RainbondClusterCondition struct {
 	Message string `json:"message,omitempty"`
 }
 
+// PrecheckSeverity is the severity of a failed precheck.
+type PrecheckSeverity string
+
+// These are valid severities of prechecks.
+const (
+	// PrecheckSeverityBlocking means the rainbondcluster can not be installed or upgraded if the precheck fails.
+	PrecheckSeverityBlocking PrecheckSeverity = "Blocking"
+	// PrecheckSeverityWarning means the failure of the precheck is only reported in the conditions.
+	PrecheckSeverityWarning PrecheckSeverity = "Warning"
+)
+
+// PrecheckConfig overrides the default configuration of a precheck.
+type PrecheckConfig struct {
+	// Name of the precheck, which is the type of the condition it reports, such as Memory.
+	Name string `json:"name"`
+	// Enabled enables or disables the precheck. Defaults to the default of the precheck.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// Severity of the failure of the precheck. Defaults to the default of the precheck.
+	// +kubebuilder:validation:Enum=Blocking;Warning
+	// +optional
+	Severity PrecheckSeverity `json:"severity,omitempty"`
+	// Interval to re-run the precheck after it passed. Zero means it is never re-run once passed.
+	// Defaults to the default of the precheck.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Parameters of the precheck, such as memoryRequest of Memory and minVersion of KubernetesVersion.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// UpgradePhase is the phase of an upgrade of the install version.
+type UpgradePhase string
+
+// These are valid phases of an upgrade.
+const (
+	// UpgradePhasePrechecking means the upgrade is waiting for the pre-upgrade checks.
+	UpgradePhasePrechecking UpgradePhase = "Prechecking"
+	// UpgradePhaseSnapshotting means rbd-db and rbd-etcd are being snapshotted.
+	UpgradePhaseSnapshotting UpgradePhase = "Snapshotting"
+	// UpgradePhaseRolling means the rbdcomponents are being upgraded one by one, in dependency order.
+	UpgradePhaseRolling UpgradePhase = "Rolling"
+	// UpgradePhaseRollingBack means the upgraded rbdcomponents are being rolled back to their previous images.
+	UpgradePhaseRollingBack UpgradePhase = "RollingBack"
+	// UpgradePhaseSucceeded means all the rbdcomponents have been upgraded and are ready.
+	UpgradePhaseSucceeded UpgradePhase = "Succeeded"
+	// UpgradePhaseRolledBack means a rbdcomponent failed to become ready, and the upgraded ones have been rolled back.
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+	// UpgradePhaseFailed means the upgrade failed before any rbdcomponent was changed,
+	// or the rolled back rbdcomponents failed to become ready.
+	UpgradePhaseFailed UpgradePhase = "Failed"
+)
+
+// TeardownStep is a step of the cleanup after a resource is deleted.
+type TeardownStep string
+
+// These are valid steps of the teardown of rainbondcluster and rainbondvolume.
+const (
+	// TeardownStepRbdComponents deletes the rbdcomponents and waits for their pods to be gone.
+	TeardownStepRbdComponents TeardownStep = "RbdComponents"
+	// TeardownStepPersistentVolumeClaims deletes the PersistentVolumeClaims created for rainbond.
+	TeardownStepPersistentVolumeClaims TeardownStep = "PersistentVolumeClaims"
+	// TeardownStepHostPathData deletes the hostPath data of the released PersistentVolumes on nodes.
+	TeardownStepHostPathData TeardownStep = "HostPathData"
+	// TeardownStepPersistentVolumes deletes the released PersistentVolumes.
+	TeardownStepPersistentVolumes TeardownStep = "PersistentVolumes"
+	// TeardownStepRainbondVolumes deletes the rainbondvolumes in the namespace.
+	TeardownStepRainbondVolumes TeardownStep = "RainbondVolumes"
+	// TeardownStepStorageClass deletes the StorageClass created for the rainbondvolume.
+	TeardownStepStorageClass TeardownStep = "StorageClass"
+	// TeardownStepClusterScopedResources deletes the cluster-scoped resources, such as APIServices and CSIDrivers.
+	TeardownStepClusterScopedResources TeardownStep = "ClusterScopedResources"
+)
+
+// TeardownStatus is the progress of the cleanup after a resource is deleted.
+type TeardownStatus struct {
+	// Step is the current step of the teardown.
+	Step TeardownStep `json:"step"`
+	// Remaining are the objects the current step is waiting for to be gone, such as PersistentVolume/rbd-db.
+	// +optional
+	Remaining []string `json:"remaining,omitempty"`
+	// Human readable message about the teardown.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // ImageHub image hub
 type ImageHub struct {
 	Domain    string `json:"domain,omitempty"`
 	Namespace string `json:"namespace,omitempty"`
 	Username  string `json:"username,omitempty"`
-	Password  string `json:"password,omitempty"`
+	// Deprecated: Use PasswordSecretRef instead.
+	Password string `json:"password,omitempty"`
+	// PasswordSecretRef selects the key of a secret in the cluster's namespace
+	// that holds the password. Takes precedence over Password.
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
 }
 
 // Database defines the connection information of database.
@@ -92,8 +209,13 @@ type Database struct {
 	Host     string `json:"host,omitempty"`
 	Port     int    `json:"port,omitempty"`
 	Username string `json:"username,omitempty"`
+	// Deprecated: Use PasswordSecretRef instead.
 	Password string `json:"password,omitempty"`
-	Name     string `json:"name,omitempty"`
+	// PasswordSecretRef selects the key of a secret in the cluster's namespace
+	// that holds the password. Takes precedence over Password.
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	Name              string                    `json:"name,omitempty"`
 }
 
 // EtcdConfig defines the configuration of etcd client.
@@ -136,6 +258,21 @@ type RainbondClusterSpec struct {
 	InstallVersion string `json:"installVersion,omitempty"`
 	// CIVersion define builder and runner version
 	CIVersion string `json:"ciVersion,omitempty"`
+	// UpgradeTimeout is how long to wait for each rbdcomponent to become ready when the install version changes,
+	// before rolling back the upgraded rbdcomponents. Defaults to 10 minutes.
+	// +optional
+	UpgradeTimeout *metav1.Duration `json:"upgradeTimeout,omitempty"`
+	// RetainData keeps the data of rainbond when the rainbondcluster is deleted, including the PersistentVolumeClaims,
+	// the PersistentVolumes bound to them, and the hostPath data of the PersistentVolumes on nodes.
+	// +optional
+	RetainData bool `json:"retainData,omitempty"`
+	// Prechecks overrides the default configurations of the prechecks, such as disabling one or changing its thresholds.
+	// The prechecks are re-run if the rainbondcluster is annotated with rainbond.io/rerun-prechecks,
+	// whose value is a comma-separated list of the prechecks, or empty for all of them.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Prechecks []PrecheckConfig `json:"prechecks,omitempty"`
 	// Whether the configuration has been completed
 	ConfigCompleted bool `json:"configCompleted,omitempty"`
 	// PrometheusURL Prometheus access address, which will be automatically populated if the Monitor addon is installed.
@@ -155,26 +292,70 @@ type RainbondClusterSpec struct {
 	AddonComponent AddonComponent `json:"addonComponent,omitempty"`
 }
 
+// RbdComponentOverride is the part of RbdComponentSpec which can be set for a component in the RainbondCluster.
+// The volumes, scheduling constraints other than the node selector, probes, security contexts and autoscaling
+// are set on the RbdComponent itself, the schema of RainbondCluster would be too large to be created otherwise.
+type RbdComponentOverride struct {
+	// Number of desired pods. This is a pointer to distinguish between explicit
+	// zero and not specified. Defaults to 1.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Docker image name.
+	Image string `json:"image,omitempty"`
+	// Image pull policy.
+	// One of Always, Never, IfNotPresent.
+	// Defaults to Always if :latest tag is specified, or IfNotPresent otherwise.
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Arguments to the entrypoint.
+	// The docker image's CMD is used if this is not provided.
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Deprecated: see RbdComponentSpec.PriorityComponent.
+	PriorityComponent bool `json:"priorityComponent"`
+	// List of environment variables to set in the container.
+	// +optional
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	Env []corev1.EnvVar `json:"env,omitempty" patchStrategy:"merge" patchMergeKey:"name"`
+	// Compute Resources required by this container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector is a selector which must be true for the pod to fit on a node.
+	// It is merged over the default node selector of the component by key.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// If specified, indicates the pod's priority.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// Annotations merged over the default annotations of the pods.
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// Labels merged over the default labels of the pods, which can not be overridden.
+	// +optional
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+}
+
 //CoreComponent Define deployment parameters for Rainbond region core components
 type CoreComponent struct {
-	RegionAPI RbdComponentSpec `json:"regionAPI"`
-	Worker    RbdComponentSpec `json:"worker"`
-	Chaos     RbdComponentSpec `json:"chaos"`
-	MQ        RbdComponentSpec `json:"mq"`
-	NodeProxy RbdComponentSpec `json:"nodeProxy"`
-	DB        RbdComponentSpec `json:"db"`
-	Gateway   RbdComponentSpec `json:"gateway"`
-	EventLog  RbdComponentSpec `json:"eventLog"`
+	RegionAPI RbdComponentOverride `json:"regionAPI"`
+	Worker    RbdComponentOverride `json:"worker"`
+	Chaos     RbdComponentOverride `json:"chaos"`
+	MQ        RbdComponentOverride `json:"mq"`
+	NodeProxy RbdComponentOverride `json:"nodeProxy"`
+	DB        RbdComponentOverride `json:"db"`
+	Gateway   RbdComponentOverride `json:"gateway"`
+	EventLog  RbdComponentOverride `json:"eventLog"`
 }
 
 //AddonComponent Define deployment parameters for Rainbond region addon components
 type AddonComponent struct {
-	Monitor                 RbdComponentSpec `json:"monitor,omitempty"`
-	ImageHub                RbdComponentSpec `json:"imageHub,omitempty"`
-	KubeDashboard           RbdComponentSpec `json:"kubeDashboard,omitempty"`
-	DashboardMetricsScraper RbdComponentSpec `json:"dashboardMetricsScraper,omitempty"`
-	MetricsServer           RbdComponentSpec `json:"metricsServer,omitempty"`
-	ResourceProxy           RbdComponentSpec `json:"resourceProxy,omitempty"`
+	Monitor                 RbdComponentOverride `json:"monitor,omitempty"`
+	ImageHub                RbdComponentOverride `json:"imageHub,omitempty"`
+	KubeDashboard           RbdComponentOverride `json:"kubeDashboard,omitempty"`
+	DashboardMetricsScraper RbdComponentOverride `json:"dashboardMetricsScraper,omitempty"`
+	MetricsServer           RbdComponentOverride `json:"metricsServer,omitempty"`
+	ResourceProxy           RbdComponentOverride `json:"resourceProxy,omitempty"`
 }
 
 // StorageClass storage class
@@ -200,6 +381,76 @@ type AvailableNodes struct {
 	MasterNodes []*K8sNode `json:"masterNodes,omitempty"`
 }
 
+// RbdComponentSummary is the summary of the status of a rbdcomponent.
+type RbdComponentSummary struct {
+	// Name of the rbdcomponent.
+	Name string `json:"name"`
+	// Number of desired pods.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// Number of ready pods.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// Whether all pods of the rbdcomponent are ready.
+	Ready bool `json:"ready"`
+	// Brief reason why the rbdcomponent is not ready.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Human readable message indicating why the rbdcomponent is not ready.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// UpgradedComponent records the image of a rbdcomponent changed by an upgrade.
+type UpgradedComponent struct {
+	// Name of the rbdcomponent.
+	Name string `json:"name"`
+	// PreviousImage is the image before the upgrade, to which the rbdcomponent is rolled back.
+	PreviousImage string `json:"previousImage"`
+	// Image is the image of the install version upgraded to.
+	Image string `json:"image"`
+	// StartTime is the time the image of the rbdcomponent was changed.
+	// +optional
+	StartTime metav1.Time `json:"startTime,omitempty"`
+	// Whether the rbdcomponent has been rolled out with the image and is ready.
+	Ready bool `json:"ready"`
+}
+
+// RainbondClusterUpgrade records an upgrade of the install version of the rainbondcluster.
+type RainbondClusterUpgrade struct {
+	// FromVersion is the install version before the upgrade.
+	FromVersion string `json:"fromVersion"`
+	// ToVersion is the install version upgraded to.
+	ToVersion string `json:"toVersion"`
+	// Phase of the upgrade.
+	Phase UpgradePhase `json:"phase"`
+	// StartTime is the time the upgrade started.
+	// +optional
+	StartTime metav1.Time `json:"startTime,omitempty"`
+	// LastTransitionTime is the last time the upgrade transitioned from one phase to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// CompletionTime is the time the upgrade succeeded, failed or was rolled back.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Snapshots are the paths of the snapshots of rbd-db and rbd-etcd in the grdata volume, taken before the upgrade.
+	// +optional
+	Snapshots []string `json:"snapshots,omitempty"`
+	// Components are the rbdcomponents upgraded, in the order they were upgraded.
+	// +optional
+	Components []UpgradedComponent `json:"components,omitempty"`
+	// SkippedComponents are the rbdcomponents left unchanged, because the tags of their images are not
+	// the install version upgraded from.
+	// +optional
+	SkippedComponents []string `json:"skippedComponents,omitempty"`
+	// Brief reason for the last transition of the upgrade.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Human readable message about the progress of the upgrade.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // RainbondClusterStatus defines the observed state of RainbondCluster
 type RainbondClusterStatus struct {
 	// Versoin of Kubernetes
@@ -219,12 +470,46 @@ type RainbondClusterStatus struct {
 	ImagePullPassword string `json:"imagePullPassword,omitempty"`
 	// ImagePullSecret is an optional references to secret in the same namespace to use for pulling any of the images used by PodSpec.
 	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// Phase is a simple, high-level summary of where the rainbondcluster is in its lifecycle.
+	// +optional
+	Phase RainbondClusterPhase `json:"phase,omitempty"`
+	// InstalledVersion is the install version with which all the expected rbdcomponents have been ready,
+	// either after the first installation or after the latest successful upgrade.
+	// +optional
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	// ReadyComponents is the number of ready rbdcomponents out of the ones expected by the cluster, such as 8/10.
+	// +optional
+	ReadyComponents string `json:"readyComponents,omitempty"`
+	// Components are the summaries of the rbdcomponents expected by the cluster, and the other existing ones.
+	// +optional
+	Components []RbdComponentSummary `json:"components,omitempty"`
+	// InstallOrder is the order in which the rbdcomponents are installed, each one comes after its dependencies.
+	// +optional
+	InstallOrder []string `json:"installOrder,omitempty"`
+	// InstallFrontier are the rbdcomponents being installed, whose dependencies are ready but themselves are not.
+	// The rbdcomponents depending on them are waiting for them.
+	// +optional
+	InstallFrontier []string `json:"installFrontier,omitempty"`
+	// UpgradeHistory are the upgrades of the install version, the last one is the current or the latest upgrade.
+	// At most 10 upgrades are kept. An upgrade which failed or was rolled back is retried
+	// if the rainbondcluster is annotated with rainbond.io/retry-upgrade.
+	// +optional
+	UpgradeHistory []RainbondClusterUpgrade `json:"upgradeHistory,omitempty"`
+	// Teardown is the progress of the cleanup after the rainbondcluster is deleted.
+	// +optional
+	Teardown *TeardownStatus `json:"teardown,omitempty"`
 
 	Conditions []RainbondClusterCondition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.readyComponents"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.installVersion"
+// +kubebuilder:printcolumn:name="Installing",type="string",JSONPath=".status.installFrontier",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:storageversion
 
 // RainbondCluster is the Schema for the rainbondclusters API
 type RainbondCluster struct {
@@ -288,6 +573,7 @@ func (in *RainbondCluster) GatewayIngressIPs() (ips []string) {
 }
 
 // RegionDataSource returns the data source for database region.
+// PasswordSecretRef must have been resolved into Password beforehand.
 func (in *Database) RegionDataSource() string {
 	return fmt.Sprintf("--mysql=%s:%s@tcp(%s:%d)/%s", in.Username, in.Password, in.Host, in.Port, in.Name)
 }
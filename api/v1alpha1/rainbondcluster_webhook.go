@@ -0,0 +1,158 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/docker/distribution/reference"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var rainbondclusterlog = logf.Log.WithName("rainbondcluster-resource")
+
+// SetupWebhookWithManager registers the webhooks of RainbondCluster.
+func (in *RainbondCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-rainbond-io-v1alpha1-rainbondcluster,mutating=true,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rainbondclusters,verbs=create;update,versions=v1alpha1,name=mrainbondcluster.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &RainbondCluster{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (in *RainbondCluster) Default() {
+	rainbondclusterlog.Info("default", "name", in.Name)
+
+	if in.Spec.ImageHub == nil {
+		// use the rbd-hub installed by rainbond-operator, whose password is generated into the secret by the controller.
+		in.Spec.ImageHub = &ImageHub{
+			Domain:   constants.DefImageRepository,
+			Username: "admin",
+			PasswordSecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: constants.ImageHubPasswordSecretName},
+				Key:                  constants.ImageHubPasswordSecretKey,
+			},
+		}
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-rainbond-io-v1alpha1-rainbondcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rainbondclusters,verbs=create;update,versions=v1alpha1,name=vrainbondcluster.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &RainbondCluster{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondCluster) ValidateCreate() error {
+	rainbondclusterlog.Info("validate create", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondCluster) ValidateUpdate(old runtime.Object) error {
+	rainbondclusterlog.Info("validate update", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondCluster) ValidateDelete() error {
+	return nil
+}
+
+func (in *RainbondCluster) validate() error {
+	allErrs := in.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("RainbondCluster").GroupKind(), in.Name, allErrs)
+}
+
+func (in *RainbondClusterSpec) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if in.RainbondImageRepository != "" {
+		if _, err := reference.ParseNormalizedNamed(in.RainbondImageRepository); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("rainbondImageRepository"), in.RainbondImageRepository, err.Error()))
+		}
+	}
+
+	if in.SuffixHTTPHost == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("suffixHTTPHost"), ""))
+	}
+
+	switch in.InstallMode {
+	case "", InstallationModeWithoutPackage, InstallationModeFullOnline, InstallationModeOffline:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("installMode"), in.InstallMode, []string{
+			string(InstallationModeWithoutPackage), string(InstallationModeFullOnline), string(InstallationModeOffline),
+		}))
+	}
+
+	if in.EnableHA && len(in.NodesForGateway) == 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("nodesForGateway"), len(in.NodesForGateway),
+			"at least two nodes are required for rbd-gateway when enableHA is true"))
+	}
+
+	if in.ImageHub != nil && in.ImageHub.Domain == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("imageHub", "domain"), ""))
+	}
+
+	allErrs = append(allErrs, in.CoreComponent.validate(fldPath.Child("coreComponent"))...)
+	allErrs = append(allErrs, in.AddonComponent.validate(fldPath.Child("addonComponent"))...)
+
+	return allErrs
+}
+
+func (in *CoreComponent) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, in.RegionAPI.validate(fldPath.Child("regionAPI"))...)
+	allErrs = append(allErrs, in.Worker.validate(fldPath.Child("worker"))...)
+	allErrs = append(allErrs, in.Chaos.validate(fldPath.Child("chaos"))...)
+	allErrs = append(allErrs, in.MQ.validate(fldPath.Child("mq"))...)
+	allErrs = append(allErrs, in.NodeProxy.validate(fldPath.Child("nodeProxy"))...)
+	allErrs = append(allErrs, in.DB.validate(fldPath.Child("db"))...)
+	allErrs = append(allErrs, in.Gateway.validate(fldPath.Child("gateway"))...)
+	allErrs = append(allErrs, in.EventLog.validate(fldPath.Child("eventLog"))...)
+	return allErrs
+}
+
+func (in *AddonComponent) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, in.Monitor.validate(fldPath.Child("monitor"))...)
+	allErrs = append(allErrs, in.ImageHub.validate(fldPath.Child("imageHub"))...)
+	allErrs = append(allErrs, in.KubeDashboard.validate(fldPath.Child("kubeDashboard"))...)
+	allErrs = append(allErrs, in.DashboardMetricsScraper.validate(fldPath.Child("dashboardMetricsScraper"))...)
+	allErrs = append(allErrs, in.MetricsServer.validate(fldPath.Child("metricsServer"))...)
+	allErrs = append(allErrs, in.ResourceProxy.validate(fldPath.Child("resourceProxy"))...)
+	return allErrs
+}
+
+func (in *RbdComponentOverride) validate(fldPath *field.Path) field.ErrorList {
+	spec := RbdComponentSpec{
+		Replicas:        in.Replicas,
+		Image:           in.Image,
+		ImagePullPolicy: in.ImagePullPolicy,
+	}
+	return spec.validate(fldPath)
+}
@@ -0,0 +1,162 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestRainbondClusterValidate(t *testing.T) {
+	negative := int32(-1)
+	tests := []struct {
+		name    string
+		spec    RainbondClusterSpec
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost:          "foo.example.com",
+				RainbondImageRepository: "registry.cn-hangzhou.aliyuncs.com/goodrain",
+				InstallMode:             InstallationModeOffline,
+			},
+		},
+		{
+			name:    "empty suffix http host",
+			spec:    RainbondClusterSpec{},
+			wantErr: true,
+		},
+		{
+			name: "invalid image repository",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost:          "foo.example.com",
+				RainbondImageRepository: "Registry.example.com/ABC",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported install mode",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost: "foo.example.com",
+				InstallMode:    "foobar",
+			},
+			wantErr: true,
+		},
+		{
+			name: "enable ha with one gateway node",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost:  "foo.example.com",
+				EnableHA:        true,
+				NodesForGateway: []*K8sNode{{Name: "node1"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid component",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost: "foo.example.com",
+				CoreComponent: CoreComponent{
+					Gateway: RbdComponentOverride{ImagePullPolicy: "foobar"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative replicas of a component",
+			spec: RainbondClusterSpec{
+				SuffixHTTPHost: "foo.example.com",
+				AddonComponent: AddonComponent{
+					Monitor: RbdComponentOverride{Replicas: &negative},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &RainbondCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster"},
+				Spec:       tc.spec,
+			}
+			err := cluster.ValidateCreate()
+			assert.Equal(t, tc.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
+
+func TestRainbondClusterDefault(t *testing.T) {
+	cluster := &RainbondCluster{}
+	cluster.Default()
+	if assert.NotNil(t, cluster.Spec.ImageHub) {
+		assert.Equal(t, constants.DefImageRepository, cluster.Spec.ImageHub.Domain)
+		assert.Equal(t, "admin", cluster.Spec.ImageHub.Username)
+		// the password is generated into the secret, rather than the spec.
+		assert.Empty(t, cluster.Spec.ImageHub.Password)
+		assert.Equal(t, &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: constants.ImageHubPasswordSecretName},
+			Key:                  constants.ImageHubPasswordSecretKey,
+		}, cluster.Spec.ImageHub.PasswordSecretRef)
+	}
+
+	// should not overwrite the given image hub
+	imageHub := &ImageHub{Domain: "registry.example.com"}
+	cluster = &RainbondCluster{Spec: RainbondClusterSpec{ImageHub: imageHub}}
+	cluster.Default()
+	assert.Equal(t, imageHub, cluster.Spec.ImageHub)
+}
+
+func TestRbdComponentDefault(t *testing.T) {
+	cpt := &RbdComponent{}
+	cpt.Default()
+	if assert.NotNil(t, cpt.Spec.Replicas) {
+		assert.Equal(t, int32(1), *cpt.Spec.Replicas)
+	}
+	assert.Equal(t, cpt.ImagePullPolicy(), cpt.Spec.ImagePullPolicy)
+	assert.Nil(t, cpt.ValidateCreate())
+}
+
+func TestRbdComponentValidatePodDisruptionBudget(t *testing.T) {
+	one := intstr.FromInt(1)
+	cpt := &RbdComponent{Spec: RbdComponentSpec{PodDisruptionBudget: &PodDisruptionBudgetSpec{MaxUnavailable: &one}}}
+	assert.Nil(t, cpt.ValidateCreate())
+
+	cpt.Spec.PodDisruptionBudget.MinAvailable = &one
+	assert.NotNil(t, cpt.ValidateCreate())
+}
+
+func TestRbdComponentValidateAutoscaling(t *testing.T) {
+	tests := []struct {
+		name        string
+		component   string
+		autoscaling *AutoscalingSpec
+		wantErr     bool
+	}{
+		{name: "valid", autoscaling: &AutoscalingSpec{MaxReplicas: 3, TargetCPUUtilizationPercentage: int32Ptr(80)}},
+		{name: "not supported", component: "rbd-gateway", autoscaling: &AutoscalingSpec{MaxReplicas: 3}, wantErr: true},
+		{name: "max replicas less than the default min replicas", autoscaling: &AutoscalingSpec{}, wantErr: true},
+		{name: "max replicas less than min replicas", autoscaling: &AutoscalingSpec{MinReplicas: int32Ptr(3), MaxReplicas: 2}, wantErr: true},
+		{name: "zero min replicas", autoscaling: &AutoscalingSpec{MinReplicas: int32Ptr(0), MaxReplicas: 2}, wantErr: true},
+		{name: "zero target memory", autoscaling: &AutoscalingSpec{MaxReplicas: 2, TargetMemoryUtilizationPercentage: int32Ptr(0)}, wantErr: true},
+	}
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			cpt := &RbdComponent{ObjectMeta: metav1.ObjectMeta{Name: "rbd-api"}, Spec: RbdComponentSpec{Autoscaling: tc.autoscaling}}
+			if tc.component != "" {
+				cpt.Name = tc.component
+			}
+			err := cpt.ValidateCreate()
+			assert.Equal(t, tc.wantErr, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
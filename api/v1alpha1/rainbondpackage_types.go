@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -31,6 +32,7 @@ const (
 	// PackageConditionType means this package handle status
 	Init            PackageConditionType = "Init"
 	DownloadPackage PackageConditionType = "DownloadPackage"
+	Verification    PackageConditionType = "Verification"
 	UnpackPackage   PackageConditionType = "UnpackPackage"
 	PushImage       PackageConditionType = "PushImage"
 	Ready           PackageConditionType = "Ready"
@@ -56,6 +58,9 @@ type PackageCondition struct {
 	Type PackageConditionType `json:"type" `
 	// Status of the condition, one of True, False, Unknown.
 	Status PackageConditionStatus `json:"status" `
+	// ObservedGeneration is the generation of the rainbondpackage the condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time we got an update on a given condition.
 	// +optional
 	LastHeartbeatTime metav1.Time `json:"lastHeartbeatTime,omitempty" `
@@ -71,12 +76,43 @@ type PackageCondition struct {
 	// The progress of the condition
 	// +optional
 	Progress int `json:"progress,omitempty"`
+	// Throughput of the download, such as 12.5MiB/s, only for the DownloadPackage condition.
+	// +optional
+	Throughput string `json:"throughput,omitempty"`
+	// ETA is the estimated time left of the download, such as 2m30s, only for the DownloadPackage condition.
+	// +optional
+	ETA string `json:"eta,omitempty"`
 }
 
+// ImagePushStatus is the status of pushing an image to the image hub.
+type ImagePushStatus string
+
+// These are valid image push statuses.
+const (
+	// ImagePending means the image has not been pushed yet.
+	ImagePending ImagePushStatus = "Pending"
+	// ImagePushed means the image has been pushed.
+	ImagePushed ImagePushStatus = "Pushed"
+	// ImageFailed means the image failed to be pushed, and will be pushed again on the next attempt.
+	ImageFailed ImagePushStatus = "Failed"
+)
+
 //RainbondPackageImage image
 type RainbondPackageImage struct {
 	//Name image name
 	Name string `json:"name,omitempty"`
+	// Source is where the image is pushed from, the remote image or the tarball relative to the unpacked package.
+	// +optional
+	Source string `json:"source,omitempty"`
+	// Status of pushing the image.
+	// +optional
+	Status ImagePushStatus `json:"status,omitempty"`
+	// Digest of the manifest of the pushed image.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+	// Error of the last failed push.
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 // RainbondPackageSpec defines the desired state of RainbondPackage
@@ -85,8 +121,51 @@ type RainbondPackageSpec struct {
 	PkgPath string `json:"pkgPath"`
 	// install source image hub user
 	ImageHubUser string `json:"imageHubUser"`
-	// install source image hub password
-	ImageHubPass string `json:"imageHubPass"`
+	// Deprecated: install source image hub password, use ImageHubPassSecretRef instead.
+	ImageHubPass string `json:"imageHubPass,omitempty"`
+	// ImageHubPassSecretRef selects the key of a secret in the package's namespace
+	// that holds the install source image hub password. Takes precedence over ImageHubPass.
+	// +optional
+	ImageHubPassSecretRef *corev1.SecretKeySelector `json:"imageHubPassSecretRef,omitempty"`
+	// Download configures downloading the package to PkgPath, where the package is expected to be if not set.
+	// The partial package left by the failed downloads is resumed from.
+	// +optional
+	Download *PackageDownload `json:"download,omitempty"`
+	// Verification configures verifying the signed manifest shipped in the package, which lists every image
+	// tarball with its digest. The signature is verified before the package is unpacked, and the digest of every
+	// image before it is pushed. Only for the downloaded package.
+	// +optional
+	Verification *PackageVerification `json:"verification,omitempty"`
+	// PushConcurrency is the number of images pushed to the image hub at the same time. Defaults to 4.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	PushConcurrency int32 `json:"pushConcurrency,omitempty"`
+}
+
+// PackageVerification defines how to verify the package.
+type PackageVerification struct {
+	// PublicKey is the PEM encoded ed25519 or ecdsa public key, such as the cosign.pub generated by
+	// cosign generate-key-pair, to verify the signature manifest.json.sig of manifest.json in the package.
+	PublicKey string `json:"publicKey"`
+}
+
+// PackageDownload defines where and how to download the rainbond package.
+type PackageDownload struct {
+	// URLs of the package. The ones after the first are mirrors, which are tried in order once the retries
+	// of the ones before them are used up.
+	// +kubebuilder:validation:MinItems=1
+	URLs []string `json:"urls"`
+	// SHA256 is the sha256 checksum of the package in hex, which is not checked if empty.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// Retries of every url, with exponential backoff. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Retries *int32 `json:"retries,omitempty"`
+	// Proxy is the url of the http proxy to download through. The proxy of the environment of the operator,
+	// such as HTTPS_PROXY, is used if empty.
+	// +optional
+	Proxy string `json:"proxy,omitempty"`
 }
 
 // RainbondPackageStatus defines the observed state of RainbondPackage
@@ -95,12 +174,18 @@ type RainbondPackageStatus struct {
 	Conditions []PackageCondition `json:"conditions,omitempty"`
 	// The number of images that should be load and pushed.
 	ImagesNumber int32 `json:"imagesNumber"`
-	// ImagesPushed contains the images have been pushed.
+	// ImagesPushed contains the images to be pushed with the status of every push. Only the ones not pushed
+	// are pushed again on the next attempt.
 	ImagesPushed []RainbondPackageImage `json:"images,omitempty"`
+	// Version is the install version of the rainbondcluster whose images are pushed. The package is handled
+	// again once the install version changes, such as for an upgrade.
+	// +optional
+	Version string `json:"version,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // RainbondPackage is the Schema for the rainbondpackages API
 type RainbondPackage struct {
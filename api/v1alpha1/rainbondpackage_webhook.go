@@ -0,0 +1,124 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"net/url"
+
+	"github.com/goodrain/rainbond-operator/util/manifestutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var rainbondpackagelog = logf.Log.WithName("rainbondpackage-resource")
+
+// SetupWebhookWithManager registers the webhooks of RainbondPackage.
+func (in *RainbondPackage) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-rainbond-io-v1alpha1-rainbondpackage,mutating=false,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rainbondpackages,verbs=create;update,versions=v1alpha1,name=vrainbondpackage.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &RainbondPackage{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondPackage) ValidateCreate() error {
+	rainbondpackagelog.Info("validate create", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondPackage) ValidateUpdate(old runtime.Object) error {
+	rainbondpackagelog.Info("validate update", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondPackage) ValidateDelete() error {
+	return nil
+}
+
+func (in *RainbondPackage) validate() error {
+	var allErrs field.ErrorList
+	fldPath := field.NewPath("spec")
+	if in.Spec.ImageHubUser != "" && in.Spec.ImageHubPass == "" && in.Spec.ImageHubPassSecretRef == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("imageHubPassSecretRef"), "one of imageHubPassSecretRef or imageHubPass is required when imageHubUser is specified"))
+	}
+	if in.Spec.Download != nil {
+		allErrs = append(allErrs, in.validateDownload(fldPath)...)
+	}
+	if in.Spec.Verification != nil {
+		allErrs = append(allErrs, in.validateVerification(fldPath)...)
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("RainbondPackage").GroupKind(), in.Name, allErrs)
+}
+
+func (in *RainbondPackage) validateDownload(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if in.Spec.PkgPath == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("pkgPath"), "pkgPath is required when download is specified"))
+	}
+	fldPath = fldPath.Child("download")
+	download := in.Spec.Download
+	if len(download.URLs) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("urls"), "at least one url is required"))
+	}
+	for i, u := range download.URLs {
+		if !isHTTPURL(u) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("urls").Index(i), u, "must be a http or https url"))
+		}
+	}
+	if download.Proxy != "" && !isHTTPURL(download.Proxy) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("proxy"), download.Proxy, "must be a http or https url"))
+	}
+	if download.Retries != nil && *download.Retries < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retries"), *download.Retries, "must be greater than or equal to 0"))
+	}
+	return allErrs
+}
+
+func (in *RainbondPackage) validateVerification(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if in.Spec.Download == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("download"), "download is required when verification is specified"))
+	}
+	fldPath = fldPath.Child("verification", "publicKey")
+	if in.Spec.Verification.PublicKey == "" {
+		allErrs = append(allErrs, field.Required(fldPath, "public key is required"))
+	} else if _, err := manifestutil.ParsePublicKey([]byte(in.Spec.Verification.PublicKey)); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", err.Error()))
+	}
+	return allErrs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,100 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testPublicKey = `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAGb9ECWmEzf6FQbrBZ9w7lshQhqowtrbLDFw4rXAxZuE=
+-----END PUBLIC KEY-----
+`
+
+func TestRainbondPackageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    RainbondPackageSpec
+		wantErr bool
+	}{
+		{
+			name: "valid download",
+			spec: RainbondPackageSpec{
+				PkgPath: "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download: &PackageDownload{
+					URLs:  []string{"https://pkg.example.com/rainbond.tgz", "http://mirror.example.com/rainbond.tgz"},
+					Proxy: "http://proxy.example.com:3128",
+				},
+			},
+		},
+		{
+			name: "download without pkg path",
+			spec: RainbondPackageSpec{
+				Download: &PackageDownload{URLs: []string{"https://pkg.example.com/rainbond.tgz"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "download without urls",
+			spec: RainbondPackageSpec{
+				PkgPath:  "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download: &PackageDownload{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid url",
+			spec: RainbondPackageSpec{
+				PkgPath:  "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download: &PackageDownload{URLs: []string{"ftp://pkg.example.com/rainbond.tgz"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid verification",
+			spec: RainbondPackageSpec{
+				PkgPath:      "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download:     &PackageDownload{URLs: []string{"https://pkg.example.com/rainbond.tgz"}},
+				Verification: &PackageVerification{PublicKey: testPublicKey},
+			},
+		},
+		{
+			name: "verification without download",
+			spec: RainbondPackageSpec{
+				PkgPath:      "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Verification: &PackageVerification{PublicKey: testPublicKey},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid public key",
+			spec: RainbondPackageSpec{
+				PkgPath:      "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download:     &PackageDownload{URLs: []string{"https://pkg.example.com/rainbond.tgz"}},
+				Verification: &PackageVerification{PublicKey: "foobar"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid proxy",
+			spec: RainbondPackageSpec{
+				PkgPath:  "/opt/rainbond/pkg/tgz/rainbond.tgz",
+				Download: &PackageDownload{URLs: []string{"https://pkg.example.com/rainbond.tgz"}, Proxy: "proxy.example.com"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			pkg := &RainbondPackage{
+				ObjectMeta: metav1.ObjectMeta{Name: "rainbondpackage"},
+				Spec:       tc.spec,
+			}
+			err := pkg.ValidateCreate()
+			assert.Equal(t, tc.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
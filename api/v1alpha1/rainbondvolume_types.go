@@ -26,8 +26,12 @@ import (
 type AliyunCloudDiskCSIPluginSource struct {
 	// The AccessKey ID provided by Alibaba Cloud for access control.
 	AccessKeyID string `json:"accessKeyID"`
-	// The AccessKey Secret provided by Alibaba Cloud for access control
-	AccessKeySecret string `json:"accessKeySecret"`
+	// Deprecated: The AccessKey Secret provided by Alibaba Cloud for access control, use AccessKeySecretRef instead.
+	AccessKeySecret string `json:"accessKeySecret,omitempty"`
+	// AccessKeySecretRef selects the key of a secret in the volume's namespace
+	// that holds the AccessKey Secret. Takes precedence over AccessKeySecret.
+	// +optional
+	AccessKeySecretRef *v1.SecretKeySelector `json:"accessKeySecretRef,omitempty"`
 	// maxVolumePerNode
 	MaxVolumePerNode string `json:"maxVolumePerNode"`
 }
@@ -37,8 +41,12 @@ type AliyunCloudDiskCSIPluginSource struct {
 type AliyunNasCSIPluginSource struct {
 	// The AccessKey ID provided by Alibaba Cloud for access control.
 	AccessKeyID string `json:"accessKeyID"`
-	// The AccessKey Secret provided by Alibaba Cloud for access control
-	AccessKeySecret string `json:"accessKeySecret"`
+	// Deprecated: The AccessKey Secret provided by Alibaba Cloud for access control, use AccessKeySecretRef instead.
+	AccessKeySecret string `json:"accessKeySecret,omitempty"`
+	// AccessKeySecretRef selects the key of a secret in the volume's namespace
+	// that holds the AccessKey Secret. Takes precedence over AccessKeySecret.
+	// +optional
+	AccessKeySecretRef *v1.SecretKeySelector `json:"accessKeySecretRef,omitempty"`
 }
 
 // NFSCSIPluginSource represents a nfs CSI plugin.
@@ -107,6 +115,9 @@ type RainbondVolumeCondition struct {
 	Type RainbondVolumeConditionType `json:"type"`
 	// Status of the condition, one of True, False, Unknown.
 	Status v1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the generation of the rainbondvolume the condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time the condition transitioned from one status to another.
 	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 	// The reason for the condition's last transition.
@@ -119,10 +130,14 @@ type RainbondVolumeCondition struct {
 type RainbondVolumeStatus struct {
 	// Condition keeps track of all rainbondvolume conditions, if they exist.
 	Conditions []RainbondVolumeCondition `json:"conditions,omitempty"`
+	// Teardown is the progress of the cleanup after the rainbondvolume is deleted.
+	// +optional
+	Teardown *TeardownStatus `json:"teardown,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // RainbondVolume is the Schema for the rainbondvolumes API
 type RainbondVolume struct {
@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var rainbondvolumelog = logf.Log.WithName("rainbondvolume-resource")
+
+// SetupWebhookWithManager registers the webhooks of RainbondVolume.
+func (in *RainbondVolume) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-rainbond-io-v1alpha1-rainbondvolume,mutating=false,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rainbondvolumes,verbs=create;update,versions=v1alpha1,name=vrainbondvolume.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &RainbondVolume{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondVolume) ValidateCreate() error {
+	rainbondvolumelog.Info("validate create", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondVolume) ValidateUpdate(old runtime.Object) error {
+	rainbondvolumelog.Info("validate update", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (in *RainbondVolume) ValidateDelete() error {
+	return nil
+}
+
+func (in *RainbondVolume) validate() error {
+	allErrs := in.Spec.validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("RainbondVolume").GroupKind(), in.Name, allErrs)
+}
+
+func (in *RainbondVolumeSpec) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	hasStorageClassParameters := in.StorageClassParameters != nil && in.StorageClassParameters.Provisioner != ""
+	if in.StorageClassName == "" && !hasStorageClassParameters && in.CSIPlugin == nil {
+		allErrs = append(allErrs, field.Required(fldPath, "one of storageClassName, storageClassParameters.provisioner or csiPlugin is required"))
+	}
+
+	if in.StorageRequest != nil && *in.StorageRequest < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("storageRequest"), *in.StorageRequest, "must be greater than or equal to 0"))
+	}
+
+	if in.CSIPlugin != nil {
+		allErrs = append(allErrs, in.CSIPlugin.validate(fldPath.Child("csiPlugin"))...)
+	}
+
+	return allErrs
+}
+
+func (in *CSIPluginSource) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	var numSources int
+	if in.AliyunCloudDisk != nil {
+		numSources++
+		allErrs = append(allErrs, validateAccessKey(fldPath.Child("aliyunCloudDisk"),
+			in.AliyunCloudDisk.AccessKeyID, in.AliyunCloudDisk.AccessKeySecret, in.AliyunCloudDisk.AccessKeySecretRef != nil)...)
+	}
+	if in.AliyunNas != nil {
+		numSources++
+		allErrs = append(allErrs, validateAccessKey(fldPath.Child("aliyunNas"),
+			in.AliyunNas.AccessKeyID, in.AliyunNas.AccessKeySecret, in.AliyunNas.AccessKeySecretRef != nil)...)
+	}
+	if in.NFS != nil {
+		numSources++
+	}
+	if numSources != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, numSources, "exactly one csi plugin must be specified"))
+	}
+
+	return allErrs
+}
+
+func validateAccessKey(fldPath *field.Path, accessKeyID, accessKeySecret string, hasAccessKeySecretRef bool) field.ErrorList {
+	var allErrs field.ErrorList
+	if accessKeyID == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("accessKeyID"), ""))
+	}
+	if accessKeySecret == "" && !hasAccessKeySecretRef {
+		allErrs = append(allErrs, field.Required(fldPath.Child("accessKeySecretRef"), "one of accessKeySecretRef or accessKeySecret is required"))
+	}
+	return allErrs
+}
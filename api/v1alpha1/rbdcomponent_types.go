@@ -17,9 +17,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // RbdComponentSpec defines the desired state of RbdComponent
@@ -44,7 +46,9 @@ type RbdComponentSpec struct {
 	// Cannot be updated.
 	// +optional
 	Args []string `json:"args,omitempty" protobuf:"bytes,4,rep,name=args"`
-	//  Whether this component needs to be created first
+	// Deprecated: the order of installation is decided by the dependencies between the components,
+	// and the components the rainbondpackage depends on are created before it is ready.
+	// A priority component is still created without waiting for the rainbondpackage.
 	PriorityComponent bool `json:"priorityComponent"`
 	// List of environment variables to set in the container.
 	// Cannot be updated.
@@ -69,6 +73,96 @@ type RbdComponentSpec struct {
 	// +patchMergeKey=name
 	// +patchStrategy=merge,retainKeys
 	Volumes []corev1.Volume `json:"volumes,omitempty" patchStrategy:"merge,retainKeys" patchMergeKey:"name" protobuf:"bytes,1,rep,name=volumes"`
+	// NodeSelector is a selector which must be true for the pod to fit on a node.
+	// It is merged over the default node selector of the component by key.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// If specified, the pod's tolerations.
+	// They replace the default tolerations of the component, which tolerate every taint.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// If specified, the pod's scheduling constraints.
+	// Each of nodeAffinity, podAffinity and podAntiAffinity replaces the default one of the component.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints describes how the pods ought to spread across topology domains.
+	// They are merged over the default constraints of the component by topologyKey and whenUnsatisfiable.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// If specified, indicates the pod's priority.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// Periodic probe of container liveness.
+	// It replaces the default liveness probe of the component.
+	// +optional
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// Periodic probe of container service readiness.
+	// It replaces the default readiness probe of the component.
+	// +optional
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// StartupProbe indicates that the pod has successfully initialized.
+	// It replaces the default startup probe of the component.
+	// +optional
+	StartupProbe *corev1.Probe `json:"startupProbe,omitempty"`
+	// PodSecurityContext holds pod-level security attributes and common container settings.
+	// It replaces the default pod security context of the component.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext defines the security options the container should be run with.
+	// It replaces the default container security context of the component.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// Annotations to add to the pods of the component.
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// Labels to add to the pods of the component.
+	// The default labels of the component are used by the selector and can not be overridden.
+	// +optional
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+	// PodDisruptionBudget is the policy of the pod disruption budget, which is generated
+	// for the component if its effective replicas are more than one.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+	// Autoscaling enables a horizontal pod autoscaler for the component, which takes over the replicas.
+	// It is supported by the stateless components rbd-api, rbd-worker and rbd-mq.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+}
+
+// PodDisruptionBudgetSpec defines the pod disruption budget of a rbdcomponent.
+// Only one of minAvailable and maxUnavailable can be specified,
+// and minAvailable defaults to the effective replicas minus one if neither is specified.
+type PodDisruptionBudgetSpec struct {
+	// Disabled means no pod disruption budget is generated for the component.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+	// An eviction is allowed if at least "minAvailable" pods of the component
+	// will still be available after the eviction.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// An eviction is allowed if at most "maxUnavailable" pods of the component
+	// are unavailable after the eviction.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// AutoscalingSpec defines the horizontal pod autoscaler of a rbdcomponent.
+type AutoscalingSpec struct {
+	// The lower limit for the number of replicas. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// The upper limit for the number of replicas. It cannot be less than minReplicas.
+	MaxReplicas int32 `json:"maxReplicas"`
+	// The target average CPU utilization over all the pods, represented as a percentage of the requested CPU.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// The target average memory utilization over all the pods, represented as a percentage of the requested memory.
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Metrics contains the custom metric targets, which are used together with the CPU and memory targets.
+	// If no target is specified, the default CPU utilization of the autoscaler is used.
+	// +optional
+	Metrics []autoscalingv2beta2.MetricSpec `json:"metrics,omitempty"`
 }
 
 // RbdComponentConditionType is a valid value for RbdComponentCondition.Type
@@ -80,6 +174,8 @@ const (
 	ClusterConfigCompeleted RbdComponentConditionType = "ClusterConfigCompeleted"
 	// ClusterConfigCompeleted indicates whether the rainbondpackage is ready.
 	RainbondPackageReady RbdComponentConditionType = "RainbondPackageReady"
+	// DependenciesReady indicates whether the rbdcomponents this rbdcomponent depends on are ready.
+	DependenciesReady RbdComponentConditionType = "DependenciesReady"
 	// RbdComponentReady means all pods related to the rbdcomponent are ready.
 	RbdComponentReady RbdComponentConditionType = "Ready"
 )
@@ -92,6 +188,9 @@ type RbdComponentCondition struct {
 	// Can be True, False, Unknown.
 	// More info: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle#pod-conditions
 	Status corev1.ConditionStatus `json:"status" protobuf:"bytes,2,opt,name=status,casttype=ConditionStatus"`
+	// ObservedGeneration is the generation of the rbdcomponent the condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Last time the condition transitioned from one status to another.
 	// +optional
 	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty" protobuf:"bytes,4,opt,name=lastTransitionTime"`
@@ -118,10 +217,29 @@ type RbdComponentStatus struct {
 
 	// A list of pods
 	Pods []corev1.LocalObjectReference `json:"pods,omitempty"`
+
+	// DriftedResources are the sub resources whose fields applied by rainbond-operator
+	// were changed by other field managers, and have been corrected.
+	// +optional
+	DriftedResources []DriftedResource `json:"driftedResources,omitempty"`
+}
+
+// DriftedResource describes a sub resource of rbdcomponent whose managed fields drifted.
+type DriftedResource struct {
+	// Kind of the resource.
+	Kind string `json:"kind"`
+	// Name of the resource.
+	Name string `json:"name"`
+	// Fields are the paths of the drifted fields.
+	// +optional
+	Fields []string `json:"fields,omitempty"`
+	// Last time the drift was detected and corrected.
+	LastDriftTime metav1.Time `json:"lastDriftTime"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // RbdComponent is the Schema for the rbdcomponents API
 type RbdComponent struct {
@@ -145,10 +263,13 @@ func init() {
 	SchemeBuilder.Register(&RbdComponent{}, &RbdComponentList{})
 }
 
+// defaultImagePullPolicy is the image pull policy used if it is not specified.
+const defaultImagePullPolicy = corev1.PullIfNotPresent
+
 // ImagePullPolicy returns the ImagePullPolicy, or  return PullIfNotPresent if it is empty.
 func (in *RbdComponent) ImagePullPolicy() corev1.PullPolicy {
 	if in.Spec.ImagePullPolicy == "" {
-		return corev1.PullIfNotPresent
+		return defaultImagePullPolicy
 	}
 	return in.Spec.ImagePullPolicy
 }
@@ -0,0 +1,164 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var rbdcomponentlog = logf.Log.WithName("rbdcomponent-resource")
+
+// autoscalingComponents are the stateless rbdcomponents that support autoscaling.
+var autoscalingComponents = []string{"rbd-api", "rbd-worker", "rbd-mq"}
+
+// SetupWebhookWithManager registers the webhooks of RbdComponent.
+func (in *RbdComponent) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-rainbond-io-v1alpha1-rbdcomponent,mutating=true,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rbdcomponents,verbs=create;update,versions=v1alpha1,name=mrbdcomponent.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &RbdComponent{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (in *RbdComponent) Default() {
+	rbdcomponentlog.Info("default", "name", in.Name)
+
+	if in.Spec.Replicas == nil {
+		replicas := int32(1)
+		in.Spec.Replicas = &replicas
+	}
+	if in.Spec.ImagePullPolicy == "" {
+		in.Spec.ImagePullPolicy = defaultImagePullPolicy
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-rainbond-io-v1alpha1-rbdcomponent,mutating=false,failurePolicy=fail,sideEffects=None,groups=rainbond.io,resources=rbdcomponents,verbs=create;update,versions=v1alpha1,name=vrbdcomponent.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &RbdComponent{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (in *RbdComponent) ValidateCreate() error {
+	rbdcomponentlog.Info("validate create", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (in *RbdComponent) ValidateUpdate(old runtime.Object) error {
+	rbdcomponentlog.Info("validate update", "name", in.Name)
+	return in.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (in *RbdComponent) ValidateDelete() error {
+	return nil
+}
+
+func (in *RbdComponent) validate() error {
+	allErrs := in.Spec.validateComponent(in.Name, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("RbdComponent").GroupKind(), in.Name, allErrs)
+}
+
+func (in *RbdComponentSpec) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if in.Replicas != nil && *in.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("replicas"), *in.Replicas, "must be greater than or equal to 0"))
+	}
+
+	if in.Image != "" {
+		if _, err := reference.ParseNormalizedNamed(in.Image); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("image"), in.Image, err.Error()))
+		}
+	}
+
+	switch in.ImagePullPolicy {
+	case "", corev1.PullAlways, corev1.PullNever, corev1.PullIfNotPresent:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("imagePullPolicy"), in.ImagePullPolicy, []string{
+			string(corev1.PullAlways), string(corev1.PullNever), string(corev1.PullIfNotPresent),
+		}))
+	}
+
+	if pdb := in.PodDisruptionBudget; pdb != nil && pdb.MinAvailable != nil && pdb.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("podDisruptionBudget"), pdb, "minAvailable and maxUnavailable cannot be both set"))
+	}
+
+	if autoscaling := in.Autoscaling; autoscaling != nil {
+		allErrs = append(allErrs, autoscaling.validate(fldPath.Child("autoscaling"))...)
+	}
+
+	return allErrs
+}
+
+// validateComponent validates the spec of the rbdcomponent with the given name.
+func (in *RbdComponentSpec) validateComponent(name string, fldPath *field.Path) field.ErrorList {
+	allErrs := in.validate(fldPath)
+	if in.Autoscaling != nil && !autoscalingSupported(name) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("autoscaling"),
+			fmt.Sprintf("autoscaling is only supported by %s", strings.Join(autoscalingComponents, ", "))))
+	}
+	return allErrs
+}
+
+func autoscalingSupported(name string) bool {
+	for _, component := range autoscalingComponents {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *AutoscalingSpec) validate(fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	minReplicas := int32(1)
+	if in.MinReplicas != nil {
+		minReplicas = *in.MinReplicas
+		if minReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("minReplicas"), minReplicas, "must be greater than or equal to 1"))
+		}
+	}
+	if in.MaxReplicas < minReplicas {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxReplicas"), in.MaxReplicas, "must be greater than or equal to minReplicas"))
+	}
+	if in.TargetCPUUtilizationPercentage != nil && *in.TargetCPUUtilizationPercentage < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetCPUUtilizationPercentage"), *in.TargetCPUUtilizationPercentage, "must be greater than 0"))
+	}
+	if in.TargetMemoryUtilizationPercentage != nil && *in.TargetMemoryUtilizationPercentage < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("targetMemoryUtilizationPercentage"), *in.TargetMemoryUtilizationPercentage, "must be greater than 0"))
+	}
+
+	return allErrs
+}
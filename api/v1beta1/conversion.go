@@ -0,0 +1,178 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConversionDataAnnotation holds the v1alpha1 data that can not be represented in v1beta1,
+// so that converting a v1alpha1 object to v1beta1 and back again is lossless.
+const ConversionDataAnnotation = "rainbond.io/conversion-data"
+
+// marshalData stores data in the conversion annotation of obj.
+func marshalData(obj metav1.Object, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal conversion data: %v", err)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ConversionDataAnnotation] = string(b)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// unmarshalData restores data from the conversion annotation of obj, then removes the annotation.
+// It returns false if there is no conversion annotation.
+func unmarshalData(obj metav1.Object, data interface{}) (bool, error) {
+	annotations := obj.GetAnnotations()
+	value, ok := annotations[ConversionDataAnnotation]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(value), data); err != nil {
+		return false, fmt.Errorf("unmarshal conversion data: %v", err)
+	}
+	delete(annotations, ConversionDataAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+	return true, nil
+}
+
+// conditionEqual reports whether the two conditions are identical.
+func conditionEqual(a, b *metav1.Condition) bool {
+	return a.Type == b.Type &&
+		a.Status == b.Status &&
+		a.ObservedGeneration == b.ObservedGeneration &&
+		a.LastTransitionTime.Equal(&b.LastTransitionTime) &&
+		a.Reason == b.Reason &&
+		a.Message == b.Message
+}
+
+func convertTeardownStatusTo(in *TeardownStatus) *v1alpha1.TeardownStatus {
+	if in == nil {
+		return nil
+	}
+	return &v1alpha1.TeardownStatus{
+		Step:      v1alpha1.TeardownStep(in.Step),
+		Remaining: in.Remaining,
+		Message:   in.Message,
+	}
+}
+
+func convertTeardownStatusFrom(in *v1alpha1.TeardownStatus) *TeardownStatus {
+	if in == nil {
+		return nil
+	}
+	return &TeardownStatus{
+		Step:      TeardownStep(in.Step),
+		Remaining: in.Remaining,
+		Message:   in.Message,
+	}
+}
+
+func convertK8sNodesTo(in []*K8sNode) []*v1alpha1.K8sNode {
+	if in == nil {
+		return nil
+	}
+	out := make([]*v1alpha1.K8sNode, len(in))
+	for i := range in {
+		out[i] = (*v1alpha1.K8sNode)(in[i])
+	}
+	return out
+}
+
+func convertK8sNodesFrom(in []*v1alpha1.K8sNode) []*K8sNode {
+	if in == nil {
+		return nil
+	}
+	out := make([]*K8sNode, len(in))
+	for i := range in {
+		out[i] = (*K8sNode)(in[i])
+	}
+	return out
+}
+
+func convertAvailableNodesTo(in *AvailableNodes) *v1alpha1.AvailableNodes {
+	if in == nil {
+		return nil
+	}
+	return &v1alpha1.AvailableNodes{
+		SpecifiedNodes: convertK8sNodesTo(in.SpecifiedNodes),
+		MasterNodes:    convertK8sNodesTo(in.MasterNodes),
+	}
+}
+
+func convertAvailableNodesFrom(in *v1alpha1.AvailableNodes) *AvailableNodes {
+	if in == nil {
+		return nil
+	}
+	return &AvailableNodes{
+		SpecifiedNodes: convertK8sNodesFrom(in.SpecifiedNodes),
+		MasterNodes:    convertK8sNodesFrom(in.MasterNodes),
+	}
+}
+
+func convertRainbondVolumeSpecTo(in *RainbondVolumeSpec, out *v1alpha1.RainbondVolumeSpec) {
+	out.StorageClassName = in.StorageClassName
+	out.StorageClassParameters = (*v1alpha1.StorageClassParameters)(in.StorageClassParameters)
+	out.CSIPlugin = nil
+	if in.CSIPlugin != nil {
+		out.CSIPlugin = &v1alpha1.CSIPluginSource{
+			AliyunCloudDisk: (*v1alpha1.AliyunCloudDiskCSIPluginSource)(in.CSIPlugin.AliyunCloudDisk),
+			AliyunNas:       (*v1alpha1.AliyunNasCSIPluginSource)(in.CSIPlugin.AliyunNas),
+			NFS:             (*v1alpha1.NFSCSIPluginSource)(in.CSIPlugin.NFS),
+		}
+	}
+	out.StorageRequest = in.StorageRequest
+	out.ImageRepository = in.ImageRepository
+}
+
+func convertRainbondVolumeSpecFrom(in *v1alpha1.RainbondVolumeSpec, out *RainbondVolumeSpec) {
+	out.StorageClassName = in.StorageClassName
+	out.StorageClassParameters = (*StorageClassParameters)(in.StorageClassParameters)
+	out.CSIPlugin = nil
+	if in.CSIPlugin != nil {
+		out.CSIPlugin = &CSIPluginSource{
+			AliyunCloudDisk: (*AliyunCloudDiskCSIPluginSource)(in.CSIPlugin.AliyunCloudDisk),
+			AliyunNas:       (*AliyunNasCSIPluginSource)(in.CSIPlugin.AliyunNas),
+			NFS:             (*NFSCSIPluginSource)(in.CSIPlugin.NFS),
+		}
+	}
+	out.StorageRequest = in.StorageRequest
+	out.ImageRepository = in.ImageRepository
+}
+
+// convertConditionStatusTo converts the status of a metav1.Condition to the one used by v1alpha1.
+func convertConditionStatusTo(in metav1.ConditionStatus) corev1.ConditionStatus {
+	return corev1.ConditionStatus(in)
+}
+
+// convertConditionStatusFrom converts the status of a v1alpha1 condition to the one used by metav1.Condition.
+func convertConditionStatusFrom(in corev1.ConditionStatus) metav1.ConditionStatus {
+	return metav1.ConditionStatus(in)
+}
@@ -0,0 +1,114 @@
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	fuzz "github.com/google/gofuzz"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+func TestFuzzyConversion(t *testing.T) {
+	t.Run("for RainbondCluster", fuzzTestFunc(&v1alpha1.RainbondCluster{}, &RainbondCluster{}))
+	t.Run("for RainbondPackage", fuzzTestFunc(&v1alpha1.RainbondPackage{}, &RainbondPackage{}))
+	t.Run("for RainbondVolume", fuzzTestFunc(&v1alpha1.RainbondVolume{}, &RainbondVolume{}))
+	t.Run("for RbdComponent", fuzzTestFunc(&v1alpha1.RbdComponent{}, &RbdComponent{}))
+}
+
+func fuzzTestFunc(hub conversion.Hub, spoke conversion.Convertible) func(t *testing.T) {
+	return func(t *testing.T) {
+		fuzzer := fuzz.New().NilChance(0.3).NumElements(0, 3).MaxDepth(8).Funcs(
+			// the type meta is set by the conversion webhook.
+			func(in *metav1.TypeMeta, c fuzz.Continue) {},
+			// v1beta1 conditions are valid metav1.Conditions.
+			func(in *metav1.Condition, c fuzz.Continue) {
+				c.FuzzNoCustom(in)
+				in.Status = []metav1.ConditionStatus{metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionUnknown}[c.Intn(3)]
+				in.Reason = "Reason" + c.RandString()
+			},
+			// the deprecated imagePullPassword is dropped by v1beta1 on purpose.
+			func(in *v1alpha1.RainbondClusterStatus, c fuzz.Continue) {
+				c.FuzzNoCustom(in)
+				in.ImagePullPassword = ""
+			},
+		)
+
+		for i := 0; i < 500; i++ {
+			// hub -> spoke -> hub
+			hubBefore := hub.DeepCopyObject().(conversion.Hub)
+			fuzzer.Fuzz(hubBefore)
+			spokeMiddle := spoke.DeepCopyObject().(conversion.Convertible)
+			if err := spokeMiddle.ConvertFrom(hubBefore); err != nil {
+				t.Fatal(err)
+			}
+			hubAfter := hub.DeepCopyObject().(conversion.Hub)
+			if err := spokeMiddle.ConvertTo(hubAfter); err != nil {
+				t.Fatal(err)
+			}
+			if !apiequality.Semantic.DeepEqual(hubBefore, hubAfter) {
+				t.Fatalf("hub -> spoke -> hub is not lossless: %s", diff.ObjectReflectDiff(hubBefore, hubAfter))
+			}
+
+			// spoke -> hub -> spoke
+			spokeBefore := spoke.DeepCopyObject().(conversion.Convertible)
+			fuzzer.Fuzz(spokeBefore)
+			hubMiddle := hub.DeepCopyObject().(conversion.Hub)
+			if err := spokeBefore.ConvertTo(hubMiddle); err != nil {
+				t.Fatal(err)
+			}
+			spokeAfter := spoke.DeepCopyObject().(conversion.Convertible)
+			if err := spokeAfter.ConvertFrom(hubMiddle); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := unmarshalData(spokeAfter.(metav1.Object), &struct{}{}); err != nil {
+				t.Fatal(err)
+			}
+			if !apiequality.Semantic.DeepEqual(spokeBefore, spokeAfter) {
+				t.Fatalf("spoke -> hub -> spoke is not lossless: %s", diff.ObjectReflectDiff(spokeBefore, spokeAfter))
+			}
+		}
+	}
+}
+
+func TestConvertPackageCondition(t *testing.T) {
+	tests := []struct {
+		name   string
+		status v1alpha1.PackageConditionStatus
+		reason string
+		want   metav1.ConditionStatus
+		wantR  string
+	}{
+		{name: "completed", status: v1alpha1.Completed, want: metav1.ConditionTrue},
+		{name: "failed", status: v1alpha1.Failed, reason: "DownloadFailed", want: metav1.ConditionFalse, wantR: "DownloadFailed"},
+		{name: "waiting", status: v1alpha1.Waiting, want: metav1.ConditionUnknown, wantR: PackageConditionReasonWaiting},
+		{name: "running", status: v1alpha1.Running, want: metav1.ConditionUnknown, wantR: PackageConditionReasonRunning},
+		{name: "running with reason", status: v1alpha1.Running, reason: "Pushing", want: metav1.ConditionUnknown, wantR: "Pushing"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := convertPackageConditionFrom(&v1alpha1.PackageCondition{Type: v1alpha1.PushImage, Status: tc.status, Reason: tc.reason})
+			if got.Status != tc.want || got.Reason != tc.wantR {
+				t.Errorf("want status %s and reason %q, but got %s and %q", tc.want, tc.wantR, got.Status, got.Reason)
+			}
+			if tc.reason == "" {
+				// the v1alpha1 status is recoverable from the generated reason.
+				if back := convertPackageConditionTo(&got); back.Status != tc.status {
+					t.Errorf("want status %s after converting back, but got %s", tc.status, back.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertRbdComponentConditionType(t *testing.T) {
+	got := convertRbdComponentConditionFrom(&v1alpha1.RbdComponentCondition{Type: v1alpha1.ClusterConfigCompeleted})
+	if got.Type != ClusterConfigCompleted {
+		t.Errorf("want type %s, but got %s", ClusterConfigCompleted, got.Type)
+	}
+	if back := convertRbdComponentConditionTo(&got); back.Type != v1alpha1.ClusterConfigCompeleted {
+		t.Errorf("want type %s, but got %s", v1alpha1.ClusterConfigCompeleted, back.Type)
+	}
+}
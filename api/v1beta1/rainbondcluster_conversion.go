@@ -0,0 +1,365 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// rainbondClusterConversionData holds the v1alpha1 fields of RainbondCluster that are dropped in v1beta1.
+// The deprecated ImagePullPassword is not kept, so that no password ends up in the annotations.
+type rainbondClusterConversionData struct {
+	ImagePullUsername string `json:"imagePullUsername,omitempty"`
+	// Conditions are the original v1alpha1 conditions, which carry LastHeartbeatTime.
+	Conditions []v1alpha1.RainbondClusterCondition `json:"conditions,omitempty"`
+}
+
+var _ conversion.Convertible = &RainbondCluster{}
+
+// ConvertTo converts this RainbondCluster to the Hub version (v1alpha1).
+func (in *RainbondCluster) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.RainbondCluster)
+	src := in.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	convertRainbondClusterSpecTo(&src.Spec, &dst.Spec)
+	convertRainbondClusterStatusTo(&src.Status, &dst.Status)
+
+	data := &rainbondClusterConversionData{}
+	ok, err := unmarshalData(dst, data)
+	if err != nil || !ok {
+		return err
+	}
+	dst.Status.ImagePullUsername = data.ImagePullUsername
+	for i := range src.Status.Conditions {
+		for j := range data.Conditions {
+			// restore the original condition only if it has not been changed since.
+			origin := convertRainbondClusterConditionFrom(&data.Conditions[j])
+			if conditionEqual(&origin, &src.Status.Conditions[i]) {
+				dst.Status.Conditions[i] = data.Conditions[j]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (in *RainbondCluster) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.RainbondCluster).DeepCopy()
+
+	in.ObjectMeta = src.ObjectMeta
+	convertRainbondClusterSpecFrom(&src.Spec, &in.Spec)
+	convertRainbondClusterStatusFrom(&src.Status, &in.Status)
+
+	data := &rainbondClusterConversionData{
+		ImagePullUsername: src.Status.ImagePullUsername,
+		Conditions:        src.Status.Conditions,
+	}
+	if data.ImagePullUsername == "" && len(data.Conditions) == 0 {
+		return nil
+	}
+	return marshalData(in, data)
+}
+
+func convertRainbondClusterSpecTo(in *RainbondClusterSpec, out *v1alpha1.RainbondClusterSpec) {
+	out.EnableHA = in.EnableHA
+	out.RainbondImageRepository = in.RainbondImageRepository
+	out.SuffixHTTPHost = in.SuffixHTTPHost
+	out.GatewayIngressIPs = in.GatewayIngressIPs
+	out.GatewayVIP = in.GatewayVIP
+	out.NodesForGateway = convertK8sNodesTo(in.NodesForGateway)
+	out.NodesForChaos = convertK8sNodesTo(in.NodesForChaos)
+	out.InstallMode = v1alpha1.InstallMode(in.InstallMode)
+	out.ImageHub = (*v1alpha1.ImageHub)(in.ImageHub)
+	out.RegionDatabase = (*v1alpha1.Database)(in.RegionDatabase)
+	out.EtcdConfig = (*v1alpha1.EtcdConfig)(in.EtcdConfig)
+	out.InstallVersion = in.InstallVersion
+	out.CIVersion = in.CIVersion
+	out.UpgradeTimeout = in.UpgradeTimeout
+	out.RetainData = in.RetainData
+	out.Prechecks = convertPrecheckConfigsTo(in.Prechecks)
+	out.ConfigCompleted = in.ConfigCompleted
+	out.PrometheusURL = in.PrometheusURL
+	out.RainbondVolumeSpecRWX = nil
+	if in.RainbondVolumeSpecRWX != nil {
+		out.RainbondVolumeSpecRWX = &v1alpha1.RainbondVolumeSpec{}
+		convertRainbondVolumeSpecTo(in.RainbondVolumeSpecRWX, out.RainbondVolumeSpecRWX)
+	}
+	out.RainbondVolumeSpecRWO = nil
+	if in.RainbondVolumeSpecRWO != nil {
+		out.RainbondVolumeSpecRWO = &v1alpha1.RainbondVolumeSpec{}
+		convertRainbondVolumeSpecTo(in.RainbondVolumeSpecRWO, out.RainbondVolumeSpecRWO)
+	}
+	out.SentinelImage = in.SentinelImage
+	out.CacheMode = in.CacheMode
+	out.CoreComponent = v1alpha1.CoreComponent{
+		RegionAPI: v1alpha1.RbdComponentOverride(in.CoreComponent.RegionAPI),
+		Worker:    v1alpha1.RbdComponentOverride(in.CoreComponent.Worker),
+		Chaos:     v1alpha1.RbdComponentOverride(in.CoreComponent.Chaos),
+		MQ:        v1alpha1.RbdComponentOverride(in.CoreComponent.MQ),
+		NodeProxy: v1alpha1.RbdComponentOverride(in.CoreComponent.NodeProxy),
+		DB:        v1alpha1.RbdComponentOverride(in.CoreComponent.DB),
+		Gateway:   v1alpha1.RbdComponentOverride(in.CoreComponent.Gateway),
+		EventLog:  v1alpha1.RbdComponentOverride(in.CoreComponent.EventLog),
+	}
+	out.AddonComponent = v1alpha1.AddonComponent{
+		Monitor:                 v1alpha1.RbdComponentOverride(in.AddonComponent.Monitor),
+		ImageHub:                v1alpha1.RbdComponentOverride(in.AddonComponent.ImageHub),
+		KubeDashboard:           v1alpha1.RbdComponentOverride(in.AddonComponent.KubeDashboard),
+		DashboardMetricsScraper: v1alpha1.RbdComponentOverride(in.AddonComponent.DashboardMetricsScraper),
+		MetricsServer:           v1alpha1.RbdComponentOverride(in.AddonComponent.MetricsServer),
+		ResourceProxy:           v1alpha1.RbdComponentOverride(in.AddonComponent.ResourceProxy),
+	}
+}
+
+func convertRainbondClusterSpecFrom(in *v1alpha1.RainbondClusterSpec, out *RainbondClusterSpec) {
+	out.EnableHA = in.EnableHA
+	out.RainbondImageRepository = in.RainbondImageRepository
+	out.SuffixHTTPHost = in.SuffixHTTPHost
+	out.GatewayIngressIPs = in.GatewayIngressIPs
+	out.GatewayVIP = in.GatewayVIP
+	out.NodesForGateway = convertK8sNodesFrom(in.NodesForGateway)
+	out.NodesForChaos = convertK8sNodesFrom(in.NodesForChaos)
+	out.InstallMode = InstallMode(in.InstallMode)
+	out.ImageHub = (*ImageHub)(in.ImageHub)
+	out.RegionDatabase = (*Database)(in.RegionDatabase)
+	out.EtcdConfig = (*EtcdConfig)(in.EtcdConfig)
+	out.InstallVersion = in.InstallVersion
+	out.CIVersion = in.CIVersion
+	out.UpgradeTimeout = in.UpgradeTimeout
+	out.RetainData = in.RetainData
+	out.Prechecks = convertPrecheckConfigsFrom(in.Prechecks)
+	out.ConfigCompleted = in.ConfigCompleted
+	out.PrometheusURL = in.PrometheusURL
+	out.RainbondVolumeSpecRWX = nil
+	if in.RainbondVolumeSpecRWX != nil {
+		out.RainbondVolumeSpecRWX = &RainbondVolumeSpec{}
+		convertRainbondVolumeSpecFrom(in.RainbondVolumeSpecRWX, out.RainbondVolumeSpecRWX)
+	}
+	out.RainbondVolumeSpecRWO = nil
+	if in.RainbondVolumeSpecRWO != nil {
+		out.RainbondVolumeSpecRWO = &RainbondVolumeSpec{}
+		convertRainbondVolumeSpecFrom(in.RainbondVolumeSpecRWO, out.RainbondVolumeSpecRWO)
+	}
+	out.SentinelImage = in.SentinelImage
+	out.CacheMode = in.CacheMode
+	out.CoreComponent = CoreComponent{
+		RegionAPI: RbdComponentOverride(in.CoreComponent.RegionAPI),
+		Worker:    RbdComponentOverride(in.CoreComponent.Worker),
+		Chaos:     RbdComponentOverride(in.CoreComponent.Chaos),
+		MQ:        RbdComponentOverride(in.CoreComponent.MQ),
+		NodeProxy: RbdComponentOverride(in.CoreComponent.NodeProxy),
+		DB:        RbdComponentOverride(in.CoreComponent.DB),
+		Gateway:   RbdComponentOverride(in.CoreComponent.Gateway),
+		EventLog:  RbdComponentOverride(in.CoreComponent.EventLog),
+	}
+	out.AddonComponent = AddonComponent{
+		Monitor:                 RbdComponentOverride(in.AddonComponent.Monitor),
+		ImageHub:                RbdComponentOverride(in.AddonComponent.ImageHub),
+		KubeDashboard:           RbdComponentOverride(in.AddonComponent.KubeDashboard),
+		DashboardMetricsScraper: RbdComponentOverride(in.AddonComponent.DashboardMetricsScraper),
+		MetricsServer:           RbdComponentOverride(in.AddonComponent.MetricsServer),
+		ResourceProxy:           RbdComponentOverride(in.AddonComponent.ResourceProxy),
+	}
+}
+
+func convertRainbondClusterStatusTo(in *RainbondClusterStatus, out *v1alpha1.RainbondClusterStatus) {
+	out.KubernetesVersoin = in.KubernetesVersion
+	out.StorageClasses = nil
+	if in.StorageClasses != nil {
+		out.StorageClasses = make([]*v1alpha1.StorageClass, len(in.StorageClasses))
+		for i := range in.StorageClasses {
+			out.StorageClasses[i] = (*v1alpha1.StorageClass)(in.StorageClasses[i])
+		}
+	}
+	out.MasterRoleLabel = in.MasterRoleLabel
+	out.GatewayAvailableNodes = convertAvailableNodesTo(in.GatewayAvailableNodes)
+	out.ChaosAvailableNodes = convertAvailableNodesTo(in.ChaosAvailableNodes)
+	out.ImagePullSecret = in.ImagePullSecret
+	out.Phase = v1alpha1.RainbondClusterPhase(in.Phase)
+	out.InstalledVersion = in.InstalledVersion
+	out.ReadyComponents = in.ReadyComponents
+	out.Components = nil
+	if in.Components != nil {
+		out.Components = make([]v1alpha1.RbdComponentSummary, len(in.Components))
+		for i := range in.Components {
+			out.Components[i] = v1alpha1.RbdComponentSummary(in.Components[i])
+		}
+	}
+	out.InstallOrder = in.InstallOrder
+	out.InstallFrontier = in.InstallFrontier
+	out.UpgradeHistory = nil
+	if in.UpgradeHistory != nil {
+		out.UpgradeHistory = make([]v1alpha1.RainbondClusterUpgrade, len(in.UpgradeHistory))
+		for i := range in.UpgradeHistory {
+			out.UpgradeHistory[i] = convertRainbondClusterUpgradeTo(&in.UpgradeHistory[i])
+		}
+	}
+	out.Teardown = convertTeardownStatusTo(in.Teardown)
+	out.Conditions = nil
+	if in.Conditions != nil {
+		out.Conditions = make([]v1alpha1.RainbondClusterCondition, len(in.Conditions))
+		for i := range in.Conditions {
+			out.Conditions[i] = convertRainbondClusterConditionTo(&in.Conditions[i])
+		}
+	}
+}
+
+func convertRainbondClusterStatusFrom(in *v1alpha1.RainbondClusterStatus, out *RainbondClusterStatus) {
+	out.KubernetesVersion = in.KubernetesVersoin
+	out.StorageClasses = nil
+	if in.StorageClasses != nil {
+		out.StorageClasses = make([]*StorageClass, len(in.StorageClasses))
+		for i := range in.StorageClasses {
+			out.StorageClasses[i] = (*StorageClass)(in.StorageClasses[i])
+		}
+	}
+	out.MasterRoleLabel = in.MasterRoleLabel
+	out.GatewayAvailableNodes = convertAvailableNodesFrom(in.GatewayAvailableNodes)
+	out.ChaosAvailableNodes = convertAvailableNodesFrom(in.ChaosAvailableNodes)
+	out.ImagePullSecret = in.ImagePullSecret
+	out.Phase = RainbondClusterPhase(in.Phase)
+	out.InstalledVersion = in.InstalledVersion
+	out.ReadyComponents = in.ReadyComponents
+	out.Components = nil
+	if in.Components != nil {
+		out.Components = make([]RbdComponentSummary, len(in.Components))
+		for i := range in.Components {
+			out.Components[i] = RbdComponentSummary(in.Components[i])
+		}
+	}
+	out.InstallOrder = in.InstallOrder
+	out.InstallFrontier = in.InstallFrontier
+	out.UpgradeHistory = nil
+	if in.UpgradeHistory != nil {
+		out.UpgradeHistory = make([]RainbondClusterUpgrade, len(in.UpgradeHistory))
+		for i := range in.UpgradeHistory {
+			out.UpgradeHistory[i] = convertRainbondClusterUpgradeFrom(&in.UpgradeHistory[i])
+		}
+	}
+	out.Teardown = convertTeardownStatusFrom(in.Teardown)
+	out.Conditions = nil
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			out.Conditions[i] = convertRainbondClusterConditionFrom(&in.Conditions[i])
+		}
+	}
+}
+
+func convertRainbondClusterUpgradeTo(in *RainbondClusterUpgrade) v1alpha1.RainbondClusterUpgrade {
+	out := v1alpha1.RainbondClusterUpgrade{
+		FromVersion:        in.FromVersion,
+		ToVersion:          in.ToVersion,
+		Phase:              v1alpha1.UpgradePhase(in.Phase),
+		StartTime:          in.StartTime,
+		LastTransitionTime: in.LastTransitionTime,
+		CompletionTime:     in.CompletionTime,
+		Snapshots:          in.Snapshots,
+		SkippedComponents:  in.SkippedComponents,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+	if in.Components != nil {
+		out.Components = make([]v1alpha1.UpgradedComponent, len(in.Components))
+		for i := range in.Components {
+			out.Components[i] = v1alpha1.UpgradedComponent(in.Components[i])
+		}
+	}
+	return out
+}
+
+func convertRainbondClusterUpgradeFrom(in *v1alpha1.RainbondClusterUpgrade) RainbondClusterUpgrade {
+	out := RainbondClusterUpgrade{
+		FromVersion:        in.FromVersion,
+		ToVersion:          in.ToVersion,
+		Phase:              UpgradePhase(in.Phase),
+		StartTime:          in.StartTime,
+		LastTransitionTime: in.LastTransitionTime,
+		CompletionTime:     in.CompletionTime,
+		Snapshots:          in.Snapshots,
+		SkippedComponents:  in.SkippedComponents,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+	if in.Components != nil {
+		out.Components = make([]UpgradedComponent, len(in.Components))
+		for i := range in.Components {
+			out.Components[i] = UpgradedComponent(in.Components[i])
+		}
+	}
+	return out
+}
+
+func convertRainbondClusterConditionTo(in *metav1.Condition) v1alpha1.RainbondClusterCondition {
+	return v1alpha1.RainbondClusterCondition{
+		Type:               v1alpha1.RainbondClusterConditionType(in.Type),
+		Status:             convertConditionStatusTo(in.Status),
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+}
+
+func convertRainbondClusterConditionFrom(in *v1alpha1.RainbondClusterCondition) metav1.Condition {
+	return metav1.Condition{
+		Type:               string(in.Type),
+		Status:             convertConditionStatusFrom(in.Status),
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+}
+
+func convertPrecheckConfigsTo(in []PrecheckConfig) []v1alpha1.PrecheckConfig {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1alpha1.PrecheckConfig, 0, len(in))
+	for _, config := range in {
+		out = append(out, v1alpha1.PrecheckConfig{
+			Name:       config.Name,
+			Enabled:    config.Enabled,
+			Severity:   v1alpha1.PrecheckSeverity(config.Severity),
+			Interval:   config.Interval,
+			Parameters: config.Parameters,
+		})
+	}
+	return out
+}
+
+func convertPrecheckConfigsFrom(in []v1alpha1.PrecheckConfig) []PrecheckConfig {
+	if in == nil {
+		return nil
+	}
+	out := make([]PrecheckConfig, 0, len(in))
+	for _, config := range in {
+		out = append(out, PrecheckConfig{
+			Name:       config.Name,
+			Enabled:    config.Enabled,
+			Severity:   PrecheckSeverity(config.Severity),
+			Interval:   config.Interval,
+			Parameters: config.Parameters,
+		})
+	}
+	return out
+}
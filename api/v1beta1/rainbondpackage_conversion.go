@@ -0,0 +1,210 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// rainbondPackageConversionData holds the v1alpha1 fields of RainbondPackage that are dropped in v1beta1.
+type rainbondPackageConversionData struct {
+	// Conditions are the original v1alpha1 conditions, which carry Progress,
+	// LastHeartbeatTime and a status other than True, False or Unknown.
+	Conditions []v1alpha1.PackageCondition `json:"conditions,omitempty"`
+}
+
+var _ conversion.Convertible = &RainbondPackage{}
+
+// ConvertTo converts this RainbondPackage to the Hub version (v1alpha1).
+func (in *RainbondPackage) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.RainbondPackage)
+	src := in.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = convertPackageSpecTo(&src.Spec)
+	dst.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]v1alpha1.PackageCondition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			dst.Status.Conditions[i] = convertPackageConditionTo(&src.Status.Conditions[i])
+		}
+	}
+	dst.Status.ImagesNumber = src.Status.ImagesNumber
+	dst.Status.Version = src.Status.Version
+	dst.Status.ImagesPushed = nil
+	if src.Status.ImagesPushed != nil {
+		dst.Status.ImagesPushed = make([]v1alpha1.RainbondPackageImage, len(src.Status.ImagesPushed))
+		for i := range src.Status.ImagesPushed {
+			dst.Status.ImagesPushed[i] = convertPackageImageTo(&src.Status.ImagesPushed[i])
+		}
+	}
+
+	data := &rainbondPackageConversionData{}
+	ok, err := unmarshalData(dst, data)
+	if err != nil || !ok {
+		return err
+	}
+	for i := range src.Status.Conditions {
+		for j := range data.Conditions {
+			// restore the original condition only if it has not been changed since.
+			origin := convertPackageConditionFrom(&data.Conditions[j])
+			if conditionEqual(&origin, &src.Status.Conditions[i]) {
+				dst.Status.Conditions[i] = data.Conditions[j]
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (in *RainbondPackage) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.RainbondPackage).DeepCopy()
+
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec = convertPackageSpecFrom(&src.Spec)
+	in.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		in.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			in.Status.Conditions[i] = convertPackageConditionFrom(&src.Status.Conditions[i])
+		}
+	}
+	in.Status.ImagesNumber = src.Status.ImagesNumber
+	in.Status.Version = src.Status.Version
+	in.Status.ImagesPushed = nil
+	if src.Status.ImagesPushed != nil {
+		in.Status.ImagesPushed = make([]RainbondPackageImage, len(src.Status.ImagesPushed))
+		for i := range src.Status.ImagesPushed {
+			in.Status.ImagesPushed[i] = convertPackageImageFrom(&src.Status.ImagesPushed[i])
+		}
+	}
+
+	if len(src.Status.Conditions) == 0 {
+		return nil
+	}
+	return marshalData(in, &rainbondPackageConversionData{Conditions: src.Status.Conditions})
+}
+
+func convertPackageSpecTo(in *RainbondPackageSpec) v1alpha1.RainbondPackageSpec {
+	out := v1alpha1.RainbondPackageSpec{
+		PkgPath:               in.PkgPath,
+		ImageHubUser:          in.ImageHubUser,
+		ImageHubPass:          in.ImageHubPass,
+		ImageHubPassSecretRef: in.ImageHubPassSecretRef,
+		PushConcurrency:       in.PushConcurrency,
+	}
+	if in.Download != nil {
+		download := v1alpha1.PackageDownload(*in.Download)
+		out.Download = &download
+	}
+	if in.Verification != nil {
+		verification := v1alpha1.PackageVerification(*in.Verification)
+		out.Verification = &verification
+	}
+	return out
+}
+
+func convertPackageSpecFrom(in *v1alpha1.RainbondPackageSpec) RainbondPackageSpec {
+	out := RainbondPackageSpec{
+		PkgPath:               in.PkgPath,
+		ImageHubUser:          in.ImageHubUser,
+		ImageHubPass:          in.ImageHubPass,
+		ImageHubPassSecretRef: in.ImageHubPassSecretRef,
+		PushConcurrency:       in.PushConcurrency,
+	}
+	if in.Download != nil {
+		download := PackageDownload(*in.Download)
+		out.Download = &download
+	}
+	if in.Verification != nil {
+		verification := PackageVerification(*in.Verification)
+		out.Verification = &verification
+	}
+	return out
+}
+
+func convertPackageImageTo(in *RainbondPackageImage) v1alpha1.RainbondPackageImage {
+	return v1alpha1.RainbondPackageImage{
+		Name:   in.Name,
+		Source: in.Source,
+		Status: v1alpha1.ImagePushStatus(in.Status),
+		Digest: in.Digest,
+		Error:  in.Error,
+	}
+}
+
+func convertPackageImageFrom(in *v1alpha1.RainbondPackageImage) RainbondPackageImage {
+	return RainbondPackageImage{
+		Name:   in.Name,
+		Source: in.Source,
+		Status: ImagePushStatus(in.Status),
+		Digest: in.Digest,
+		Error:  in.Error,
+	}
+}
+
+// convertPackageConditionTo converts a metav1.Condition to a v1alpha1 package condition.
+// True means Completed, False means Failed, and Unknown means Waiting or Running, depending on the reason.
+func convertPackageConditionTo(in *metav1.Condition) v1alpha1.PackageCondition {
+	var status v1alpha1.PackageConditionStatus
+	switch in.Status {
+	case metav1.ConditionTrue:
+		status = v1alpha1.Completed
+	case metav1.ConditionFalse:
+		status = v1alpha1.Failed
+	default:
+		status = v1alpha1.Running
+		if in.Reason == PackageConditionReasonWaiting {
+			status = v1alpha1.Waiting
+		}
+	}
+	return v1alpha1.PackageCondition{
+		Type:               v1alpha1.PackageConditionType(in.Type),
+		Status:             status,
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+}
+
+// convertPackageConditionFrom converts a v1alpha1 package condition to a metav1.Condition.
+// The v1alpha1 status is used as the reason if there is no reason for the Unknown status.
+func convertPackageConditionFrom(in *v1alpha1.PackageCondition) metav1.Condition {
+	status, reason := metav1.ConditionUnknown, in.Reason
+	switch in.Status {
+	case v1alpha1.Completed:
+		status = metav1.ConditionTrue
+	case v1alpha1.Failed:
+		status = metav1.ConditionFalse
+	default:
+		if reason == "" {
+			reason = string(in.Status)
+		}
+	}
+	return metav1.Condition{
+		Type:               string(in.Type),
+		Status:             status,
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             reason,
+		Message:            in.Message,
+	}
+}
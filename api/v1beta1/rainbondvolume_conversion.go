@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+var _ conversion.Convertible = &RainbondVolume{}
+
+// ConvertTo converts this RainbondVolume to the Hub version (v1alpha1).
+func (in *RainbondVolume) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.RainbondVolume)
+	src := in.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	convertRainbondVolumeSpecTo(&src.Spec, &dst.Spec)
+	dst.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]v1alpha1.RainbondVolumeCondition, len(src.Status.Conditions))
+		for i, c := range src.Status.Conditions {
+			dst.Status.Conditions[i] = v1alpha1.RainbondVolumeCondition{
+				Type:               v1alpha1.RainbondVolumeConditionType(c.Type),
+				Status:             convertConditionStatusTo(c.Status),
+				ObservedGeneration: c.ObservedGeneration,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	dst.Status.Teardown = convertTeardownStatusTo(src.Status.Teardown)
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (in *RainbondVolume) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.RainbondVolume).DeepCopy()
+
+	in.ObjectMeta = src.ObjectMeta
+	convertRainbondVolumeSpecFrom(&src.Spec, &in.Spec)
+	in.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		in.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i, c := range src.Status.Conditions {
+			in.Status.Conditions[i] = metav1.Condition{
+				Type:               string(c.Type),
+				Status:             convertConditionStatusFrom(c.Status),
+				ObservedGeneration: c.ObservedGeneration,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	in.Status.Teardown = convertTeardownStatusFrom(src.Status.Teardown)
+	return nil
+}
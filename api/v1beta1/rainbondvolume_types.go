@@ -0,0 +1,145 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AliyunCloudDiskCSIPluginSource represents a aliyun cloud disk CSI plugin.
+// More info: https://github.com/kubernetes-sigs/alibaba-cloud-csi-driver/blob/master/docs/disk.md
+type AliyunCloudDiskCSIPluginSource struct {
+	// The AccessKey ID provided by Alibaba Cloud for access control.
+	AccessKeyID string `json:"accessKeyID"`
+	// Deprecated: The AccessKey Secret provided by Alibaba Cloud for access control, use AccessKeySecretRef instead.
+	AccessKeySecret string `json:"accessKeySecret,omitempty"`
+	// AccessKeySecretRef selects the key of a secret in the volume's namespace
+	// that holds the AccessKey Secret. Takes precedence over AccessKeySecret.
+	// +optional
+	AccessKeySecretRef *v1.SecretKeySelector `json:"accessKeySecretRef,omitempty"`
+	// maxVolumePerNode
+	MaxVolumePerNode string `json:"maxVolumePerNode"`
+}
+
+// AliyunNasCSIPluginSource represents a aliyun cloud nas CSI plugin.
+// More info: https://github.com/GLYASAI/alibaba-cloud-csi-driver/blob/master/docs/nas.md
+type AliyunNasCSIPluginSource struct {
+	// The AccessKey ID provided by Alibaba Cloud for access control.
+	AccessKeyID string `json:"accessKeyID"`
+	// Deprecated: The AccessKey Secret provided by Alibaba Cloud for access control, use AccessKeySecretRef instead.
+	AccessKeySecret string `json:"accessKeySecret,omitempty"`
+	// AccessKeySecretRef selects the key of a secret in the volume's namespace
+	// that holds the AccessKey Secret. Takes precedence over AccessKeySecret.
+	// +optional
+	AccessKeySecretRef *v1.SecretKeySelector `json:"accessKeySecretRef,omitempty"`
+}
+
+// NFSCSIPluginSource represents a nfs CSI plugin.
+// More info: https://github.com/kubernetes-incubator/external-storage/tree/master/nfs
+type NFSCSIPluginSource struct {
+}
+
+// StorageClassParameters describes the parameters for a class of storage for
+// which PersistentVolumes can be dynamically provisioned.
+type StorageClassParameters struct {
+	// Dynamically provisioned PersistentVolumes of this storage class are
+	// created with these mountOptions, e.g. ["ro", "soft"]. Not validated -
+	// mount of the PVs will simply fail if one is invalid.
+	// +optional
+	MountOptions []string `json:"mountOptions,omitempty" protobuf:"bytes,5,opt,name=mountOptions"`
+
+	// Provisioner indicates the type of the provisioner.
+	Provisioner string `json:"provisioner,omitempty" protobuf:"bytes,2,opt,name=provisioner"`
+
+	// Parameters holds the parameters for the provisioner that should
+	// create volumes of this storage class.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty" protobuf:"bytes,3,rep,name=parameters"`
+}
+
+// CSIPluginSource represents the source of a csi driver to create.
+// Only one of its members may be specified.
+type CSIPluginSource struct {
+	// AliyunCloudDiskCSIPluginSource represents a aliyun cloud disk CSI plugin.
+	// More info: https://github.com/kubernetes-sigs/alibaba-cloud-csi-driver/blob/master/docs/disk.md
+	AliyunCloudDisk *AliyunCloudDiskCSIPluginSource `json:"aliyunCloudDisk,omitempty"`
+	// AliyunNasCSIPluginSource represents a aliyun cloud nas CSI plugin.
+	// More info: https://github.com/GLYASAI/alibaba-cloud-csi-driver/blob/master/docs/nas.md
+	AliyunNas *AliyunNasCSIPluginSource `json:"aliyunNas,omitempty"`
+	// NFSCSIPluginSource represents a nfs CSI plugin.
+	// More info: https://github.com/kubernetes-incubator/external-storage/tree/master/nfs
+	NFS *NFSCSIPluginSource `json:"nfs,omitempty"`
+}
+
+// RainbondVolumeSpec defines the desired state of RainbondVolume
+type RainbondVolumeSpec struct {
+	// The name of StorageClass, which is a kind of kubernetes resource.
+	// It will used to create pvc for rainbond components.
+	// More info: https://kubernetes.io/docs/concepts/storage/storage-classes/
+	StorageClassName       string                  `json:"storageClassName,omitempty"`
+	StorageClassParameters *StorageClassParameters `json:"storageClassParameters,omitempty"`
+	// CSIPlugin holds the image
+	CSIPlugin       *CSIPluginSource `json:"csiPlugin,omitempty"`
+	StorageRequest  *int32           `json:"storageRequest,omitempty"`
+	ImageRepository string           `json:"imageRepository"`
+}
+
+// These are valid condition types of rainbondvolume.
+const (
+	// RainbondVolumeReady means the raionbondvolume is ready.
+	RainbondVolumeReady = "Ready"
+	// RainbondVolumeProgressing means the raionbondvolume is progressing.
+	RainbondVolumeProgressing = "Progressing"
+)
+
+// RainbondVolumeStatus defines the observed state of RainbondVolume
+type RainbondVolumeStatus struct {
+	// Condition keeps track of all rainbondvolume conditions, if they exist.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Teardown is the progress of the cleanup after the rainbondvolume is deleted.
+	// +optional
+	Teardown *TeardownStatus `json:"teardown,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// RainbondVolume is the Schema for the rainbondvolumes API
+type RainbondVolume struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RainbondVolumeSpec   `json:"spec,omitempty"`
+	Status RainbondVolumeStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RainbondVolumeList contains a list of RainbondVolume
+type RainbondVolumeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RainbondVolume `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RainbondVolume{}, &RainbondVolumeList{})
+}
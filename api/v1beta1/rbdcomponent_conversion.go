@@ -0,0 +1,164 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/goodrain/rainbond-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+var _ conversion.Convertible = &RbdComponent{}
+
+// ConvertTo converts this RbdComponent to the Hub version (v1alpha1).
+func (in *RbdComponent) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.RbdComponent)
+	src := in.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = convertRbdComponentSpecTo(&src.Spec)
+	dst.Status.Replicas = src.Status.Replicas
+	dst.Status.ReadyReplicas = src.Status.ReadyReplicas
+	dst.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		dst.Status.Conditions = make([]v1alpha1.RbdComponentCondition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			dst.Status.Conditions[i] = convertRbdComponentConditionTo(&src.Status.Conditions[i])
+		}
+	}
+	dst.Status.Pods = src.Status.Pods
+	dst.Status.DriftedResources = nil
+	if src.Status.DriftedResources != nil {
+		dst.Status.DriftedResources = make([]v1alpha1.DriftedResource, len(src.Status.DriftedResources))
+		for i := range src.Status.DriftedResources {
+			dst.Status.DriftedResources[i] = v1alpha1.DriftedResource(src.Status.DriftedResources[i])
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (in *RbdComponent) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.RbdComponent).DeepCopy()
+
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec = convertRbdComponentSpecFrom(&src.Spec)
+	in.Status.Replicas = src.Status.Replicas
+	in.Status.ReadyReplicas = src.Status.ReadyReplicas
+	in.Status.Conditions = nil
+	if src.Status.Conditions != nil {
+		in.Status.Conditions = make([]metav1.Condition, len(src.Status.Conditions))
+		for i := range src.Status.Conditions {
+			in.Status.Conditions[i] = convertRbdComponentConditionFrom(&src.Status.Conditions[i])
+		}
+	}
+	in.Status.Pods = src.Status.Pods
+	in.Status.DriftedResources = nil
+	if src.Status.DriftedResources != nil {
+		in.Status.DriftedResources = make([]DriftedResource, len(src.Status.DriftedResources))
+		for i := range src.Status.DriftedResources {
+			in.Status.DriftedResources[i] = DriftedResource(src.Status.DriftedResources[i])
+		}
+	}
+	return nil
+}
+
+func convertRbdComponentSpecTo(in *RbdComponentSpec) v1alpha1.RbdComponentSpec {
+	return v1alpha1.RbdComponentSpec{
+		Replicas:                  in.Replicas,
+		Image:                     in.Image,
+		ImagePullPolicy:           in.ImagePullPolicy,
+		Args:                      in.Args,
+		PriorityComponent:         in.PriorityComponent,
+		Env:                       in.Env,
+		Resources:                 in.Resources,
+		VolumeMounts:              in.VolumeMounts,
+		Volumes:                   in.Volumes,
+		NodeSelector:              in.NodeSelector,
+		Tolerations:               in.Tolerations,
+		Affinity:                  in.Affinity,
+		TopologySpreadConstraints: in.TopologySpreadConstraints,
+		PriorityClassName:         in.PriorityClassName,
+		LivenessProbe:             in.LivenessProbe,
+		ReadinessProbe:            in.ReadinessProbe,
+		StartupProbe:              in.StartupProbe,
+		PodSecurityContext:        in.PodSecurityContext,
+		SecurityContext:           in.SecurityContext,
+		PodAnnotations:            in.PodAnnotations,
+		PodLabels:                 in.PodLabels,
+		PodDisruptionBudget:       (*v1alpha1.PodDisruptionBudgetSpec)(in.PodDisruptionBudget),
+		Autoscaling:               (*v1alpha1.AutoscalingSpec)(in.Autoscaling),
+	}
+}
+
+func convertRbdComponentSpecFrom(in *v1alpha1.RbdComponentSpec) RbdComponentSpec {
+	return RbdComponentSpec{
+		Replicas:                  in.Replicas,
+		Image:                     in.Image,
+		ImagePullPolicy:           in.ImagePullPolicy,
+		Args:                      in.Args,
+		PriorityComponent:         in.PriorityComponent,
+		Env:                       in.Env,
+		Resources:                 in.Resources,
+		VolumeMounts:              in.VolumeMounts,
+		Volumes:                   in.Volumes,
+		NodeSelector:              in.NodeSelector,
+		Tolerations:               in.Tolerations,
+		Affinity:                  in.Affinity,
+		TopologySpreadConstraints: in.TopologySpreadConstraints,
+		PriorityClassName:         in.PriorityClassName,
+		LivenessProbe:             in.LivenessProbe,
+		ReadinessProbe:            in.ReadinessProbe,
+		StartupProbe:              in.StartupProbe,
+		PodSecurityContext:        in.PodSecurityContext,
+		SecurityContext:           in.SecurityContext,
+		PodAnnotations:            in.PodAnnotations,
+		PodLabels:                 in.PodLabels,
+		PodDisruptionBudget:       (*PodDisruptionBudgetSpec)(in.PodDisruptionBudget),
+		Autoscaling:               (*AutoscalingSpec)(in.Autoscaling),
+	}
+}
+
+func convertRbdComponentConditionTo(in *metav1.Condition) v1alpha1.RbdComponentCondition {
+	typ3 := v1alpha1.RbdComponentConditionType(in.Type)
+	if in.Type == ClusterConfigCompleted {
+		typ3 = v1alpha1.ClusterConfigCompeleted
+	}
+	return v1alpha1.RbdComponentCondition{
+		Type:               typ3,
+		Status:             convertConditionStatusTo(in.Status),
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+}
+
+func convertRbdComponentConditionFrom(in *v1alpha1.RbdComponentCondition) metav1.Condition {
+	typ3 := string(in.Type)
+	if in.Type == v1alpha1.ClusterConfigCompeleted {
+		typ3 = ClusterConfigCompleted
+	}
+	return metav1.Condition{
+		Type:               typ3,
+		Status:             convertConditionStatusFrom(in.Status),
+		ObservedGeneration: in.ObservedGeneration,
+		LastTransitionTime: in.LastTransitionTime,
+		Reason:             in.Reason,
+		Message:            in.Message,
+	}
+}
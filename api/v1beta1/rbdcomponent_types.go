@@ -0,0 +1,240 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// RbdComponentSpec defines the desired state of RbdComponent
+type RbdComponentSpec struct {
+	// Number of desired pods. This is a pointer to distinguish between explicit
+	// zero and not specified. Defaults to 1.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Docker image name.
+	Image string `json:"image,omitempty"`
+	// Image pull policy.
+	// One of Always, Never, IfNotPresent.
+	// Defaults to Always if :latest tag is specified, or IfNotPresent otherwise.
+	// Cannot be updated.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Arguments to the entrypoint.
+	// The docker image's CMD is used if this is not provided.
+	// Variable references $(VAR_NAME) are expanded using the container's environment. If a variable
+	// cannot be resolved, the reference in the input string will be unchanged. The $(VAR_NAME) syntax
+	// can be escaped with a double $$, ie: $$(VAR_NAME). Escaped references will never be expanded,
+	// regardless of whether the variable exists or not.
+	// Cannot be updated.
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Deprecated: the order of installation is decided by the dependencies between the components,
+	// and the components the rainbondpackage depends on are created before it is ready.
+	// A priority component is still created without waiting for the rainbondpackage.
+	PriorityComponent bool `json:"priorityComponent"`
+	// List of environment variables to set in the container.
+	// Cannot be updated.
+	// +optional
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	Env []corev1.EnvVar `json:"env,omitempty" patchStrategy:"merge" patchMergeKey:"name"`
+	// Compute Resources required by this container.
+	// Cannot be updated.
+	// More info: https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Pod volumes to mount into the container's filesystem.
+	// Cannot be updated.
+	// +optional
+	// +patchMergeKey=mountPath
+	// +patchStrategy=merge
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty" patchStrategy:"merge" patchMergeKey:"mountPath"`
+	// List of volumes that can be mounted by containers belonging to the pod.
+	// More info: https://kubernetes.io/docs/concepts/storage/volumes
+	// +optional
+	// +patchMergeKey=name
+	// +patchStrategy=merge,retainKeys
+	Volumes []corev1.Volume `json:"volumes,omitempty" patchStrategy:"merge,retainKeys" patchMergeKey:"name"`
+	// NodeSelector is a selector which must be true for the pod to fit on a node.
+	// It is merged over the default node selector of the component by key.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// If specified, the pod's tolerations.
+	// They replace the default tolerations of the component, which tolerate every taint.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// If specified, the pod's scheduling constraints.
+	// Each of nodeAffinity, podAffinity and podAntiAffinity replaces the default one of the component.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints describes how the pods ought to spread across topology domains.
+	// They are merged over the default constraints of the component by topologyKey and whenUnsatisfiable.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// If specified, indicates the pod's priority.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// Periodic probe of container liveness.
+	// It replaces the default liveness probe of the component.
+	// +optional
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// Periodic probe of container service readiness.
+	// It replaces the default readiness probe of the component.
+	// +optional
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// StartupProbe indicates that the pod has successfully initialized.
+	// It replaces the default startup probe of the component.
+	// +optional
+	StartupProbe *corev1.Probe `json:"startupProbe,omitempty"`
+	// PodSecurityContext holds pod-level security attributes and common container settings.
+	// It replaces the default pod security context of the component.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext defines the security options the container should be run with.
+	// It replaces the default container security context of the component.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// Annotations to add to the pods of the component.
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// Labels to add to the pods of the component.
+	// The default labels of the component are used by the selector and can not be overridden.
+	// +optional
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+	// PodDisruptionBudget is the policy of the pod disruption budget, which is generated
+	// for the component if its effective replicas are more than one.
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+	// Autoscaling enables a horizontal pod autoscaler for the component, which takes over the replicas.
+	// It is supported by the stateless components rbd-api, rbd-worker and rbd-mq.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+}
+
+// PodDisruptionBudgetSpec defines the pod disruption budget of a rbdcomponent.
+// Only one of minAvailable and maxUnavailable can be specified,
+// and minAvailable defaults to the effective replicas minus one if neither is specified.
+type PodDisruptionBudgetSpec struct {
+	// Disabled means no pod disruption budget is generated for the component.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+	// An eviction is allowed if at least "minAvailable" pods of the component
+	// will still be available after the eviction.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// An eviction is allowed if at most "maxUnavailable" pods of the component
+	// are unavailable after the eviction.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// AutoscalingSpec defines the horizontal pod autoscaler of a rbdcomponent.
+type AutoscalingSpec struct {
+	// The lower limit for the number of replicas. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// The upper limit for the number of replicas. It cannot be less than minReplicas.
+	MaxReplicas int32 `json:"maxReplicas"`
+	// The target average CPU utilization over all the pods, represented as a percentage of the requested CPU.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// The target average memory utilization over all the pods, represented as a percentage of the requested memory.
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Metrics contains the custom metric targets, which are used together with the CPU and memory targets.
+	// If no target is specified, the default CPU utilization of the autoscaler is used.
+	// +optional
+	Metrics []autoscalingv2beta2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// These are valid condition types of rbdcomponent.
+const (
+	// ClusterConfigCompleted indicates whether the configuration of the rainbondcluster cluster is complete.
+	ClusterConfigCompleted = "ClusterConfigCompleted"
+	// RainbondPackageReady indicates whether the rainbondpackage is ready.
+	RainbondPackageReady = "RainbondPackageReady"
+	// DependenciesReady indicates whether the rbdcomponents this rbdcomponent depends on are ready.
+	DependenciesReady = "DependenciesReady"
+	// RbdComponentReady means all pods related to the rbdcomponent are ready.
+	RbdComponentReady = "Ready"
+)
+
+// RbdComponentStatus defines the observed state of RbdComponent
+type RbdComponentStatus struct {
+	// Total number of non-terminated pods targeted by this deployment (their labels match the selector).
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Total number of ready pods targeted by this deployment.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Current state of rainbond component.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// A list of pods
+	Pods []corev1.LocalObjectReference `json:"pods,omitempty"`
+
+	// DriftedResources are the sub resources whose fields applied by rainbond-operator
+	// were changed by other field managers, and have been corrected.
+	// +optional
+	DriftedResources []DriftedResource `json:"driftedResources,omitempty"`
+}
+
+// DriftedResource describes a sub resource of rbdcomponent whose managed fields drifted.
+type DriftedResource struct {
+	// Kind of the resource.
+	Kind string `json:"kind"`
+	// Name of the resource.
+	Name string `json:"name"`
+	// Fields are the paths of the drifted fields.
+	// +optional
+	Fields []string `json:"fields,omitempty"`
+	// Last time the drift was detected and corrected.
+	LastDriftTime metav1.Time `json:"lastDriftTime"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// RbdComponent is the Schema for the rbdcomponents API
+type RbdComponent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RbdComponentSpec   `json:"spec,omitempty"`
+	Status RbdComponentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RbdComponentList contains a list of RbdComponent
+type RbdComponentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RbdComponent `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RbdComponent{}, &RbdComponentList{})
+}
@@ -0,0 +1,1289 @@
+// +build !ignore_autogenerated
+
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2021 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonComponent) DeepCopyInto(out *AddonComponent) {
+	*out = *in
+	in.Monitor.DeepCopyInto(&out.Monitor)
+	in.ImageHub.DeepCopyInto(&out.ImageHub)
+	in.KubeDashboard.DeepCopyInto(&out.KubeDashboard)
+	in.DashboardMetricsScraper.DeepCopyInto(&out.DashboardMetricsScraper)
+	in.MetricsServer.DeepCopyInto(&out.MetricsServer)
+	in.ResourceProxy.DeepCopyInto(&out.ResourceProxy)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonComponent.
+func (in *AddonComponent) DeepCopy() *AddonComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AliyunCloudDiskCSIPluginSource) DeepCopyInto(out *AliyunCloudDiskCSIPluginSource) {
+	*out = *in
+	if in.AccessKeySecretRef != nil {
+		in, out := &in.AccessKeySecretRef, &out.AccessKeySecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AliyunCloudDiskCSIPluginSource.
+func (in *AliyunCloudDiskCSIPluginSource) DeepCopy() *AliyunCloudDiskCSIPluginSource {
+	if in == nil {
+		return nil
+	}
+	out := new(AliyunCloudDiskCSIPluginSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AliyunNasCSIPluginSource) DeepCopyInto(out *AliyunNasCSIPluginSource) {
+	*out = *in
+	if in.AccessKeySecretRef != nil {
+		in, out := &in.AccessKeySecretRef, &out.AccessKeySecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AliyunNasCSIPluginSource.
+func (in *AliyunNasCSIPluginSource) DeepCopy() *AliyunNasCSIPluginSource {
+	if in == nil {
+		return nil
+	}
+	out := new(AliyunNasCSIPluginSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingSpec) DeepCopyInto(out *AutoscalingSpec) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilizationPercentage != nil {
+		in, out := &in.TargetMemoryUtilizationPercentage, &out.TargetMemoryUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]v2beta2.MetricSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingSpec.
+func (in *AutoscalingSpec) DeepCopy() *AutoscalingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AvailableNodes) DeepCopyInto(out *AvailableNodes) {
+	*out = *in
+	if in.SpecifiedNodes != nil {
+		in, out := &in.SpecifiedNodes, &out.SpecifiedNodes
+		*out = make([]*K8sNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(K8sNode)
+				**out = **in
+			}
+		}
+	}
+	if in.MasterNodes != nil {
+		in, out := &in.MasterNodes, &out.MasterNodes
+		*out = make([]*K8sNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(K8sNode)
+				**out = **in
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AvailableNodes.
+func (in *AvailableNodes) DeepCopy() *AvailableNodes {
+	if in == nil {
+		return nil
+	}
+	out := new(AvailableNodes)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSIPluginSource) DeepCopyInto(out *CSIPluginSource) {
+	*out = *in
+	if in.AliyunCloudDisk != nil {
+		in, out := &in.AliyunCloudDisk, &out.AliyunCloudDisk
+		*out = new(AliyunCloudDiskCSIPluginSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AliyunNas != nil {
+		in, out := &in.AliyunNas, &out.AliyunNas
+		*out = new(AliyunNasCSIPluginSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NFS != nil {
+		in, out := &in.NFS, &out.NFS
+		*out = new(NFSCSIPluginSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSIPluginSource.
+func (in *CSIPluginSource) DeepCopy() *CSIPluginSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CSIPluginSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CoreComponent) DeepCopyInto(out *CoreComponent) {
+	*out = *in
+	in.RegionAPI.DeepCopyInto(&out.RegionAPI)
+	in.Worker.DeepCopyInto(&out.Worker)
+	in.Chaos.DeepCopyInto(&out.Chaos)
+	in.MQ.DeepCopyInto(&out.MQ)
+	in.NodeProxy.DeepCopyInto(&out.NodeProxy)
+	in.DB.DeepCopyInto(&out.DB)
+	in.Gateway.DeepCopyInto(&out.Gateway)
+	in.EventLog.DeepCopyInto(&out.EventLog)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CoreComponent.
+func (in *CoreComponent) DeepCopy() *CoreComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(CoreComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Database) DeepCopyInto(out *Database) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Database.
+func (in *Database) DeepCopy() *Database {
+	if in == nil {
+		return nil
+	}
+	out := new(Database)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftedResource) DeepCopyInto(out *DriftedResource) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastDriftTime.DeepCopyInto(&out.LastDriftTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftedResource.
+func (in *DriftedResource) DeepCopy() *DriftedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdConfig) DeepCopyInto(out *EtcdConfig) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdConfig.
+func (in *EtcdConfig) DeepCopy() *EtcdConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageHub) DeepCopyInto(out *ImageHub) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageHub.
+func (in *ImageHub) DeepCopy() *ImageHub {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageHub)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *K8sNode) DeepCopyInto(out *K8sNode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new K8sNode.
+func (in *K8sNode) DeepCopy() *K8sNode {
+	if in == nil {
+		return nil
+	}
+	out := new(K8sNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NFSCSIPluginSource) DeepCopyInto(out *NFSCSIPluginSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NFSCSIPluginSource.
+func (in *NFSCSIPluginSource) DeepCopy() *NFSCSIPluginSource {
+	if in == nil {
+		return nil
+	}
+	out := new(NFSCSIPluginSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageDownload) DeepCopyInto(out *PackageDownload) {
+	*out = *in
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageDownload.
+func (in *PackageDownload) DeepCopy() *PackageDownload {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageDownload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageVerification) DeepCopyInto(out *PackageVerification) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageVerification.
+func (in *PackageVerification) DeepCopy() *PackageVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDisruptionBudgetSpec) DeepCopyInto(out *PodDisruptionBudgetSpec) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDisruptionBudgetSpec.
+func (in *PodDisruptionBudgetSpec) DeepCopy() *PodDisruptionBudgetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDisruptionBudgetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrecheckConfig) DeepCopyInto(out *PrecheckConfig) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrecheckConfig.
+func (in *PrecheckConfig) DeepCopy() *PrecheckConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PrecheckConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondCluster) DeepCopyInto(out *RainbondCluster) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondCluster.
+func (in *RainbondCluster) DeepCopy() *RainbondCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondClusterList) DeepCopyInto(out *RainbondClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]RainbondCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondClusterList.
+func (in *RainbondClusterList) DeepCopy() *RainbondClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondClusterSpec) DeepCopyInto(out *RainbondClusterSpec) {
+	*out = *in
+	if in.GatewayIngressIPs != nil {
+		in, out := &in.GatewayIngressIPs, &out.GatewayIngressIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodesForGateway != nil {
+		in, out := &in.NodesForGateway, &out.NodesForGateway
+		*out = make([]*K8sNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(K8sNode)
+				**out = **in
+			}
+		}
+	}
+	if in.NodesForChaos != nil {
+		in, out := &in.NodesForChaos, &out.NodesForChaos
+		*out = make([]*K8sNode, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(K8sNode)
+				**out = **in
+			}
+		}
+	}
+	if in.ImageHub != nil {
+		in, out := &in.ImageHub, &out.ImageHub
+		*out = new(ImageHub)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RegionDatabase != nil {
+		in, out := &in.RegionDatabase, &out.RegionDatabase
+		*out = new(Database)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EtcdConfig != nil {
+		in, out := &in.EtcdConfig, &out.EtcdConfig
+		*out = new(EtcdConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UpgradeTimeout != nil {
+		in, out := &in.UpgradeTimeout, &out.UpgradeTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Prechecks != nil {
+		in, out := &in.Prechecks, &out.Prechecks
+		*out = make([]PrecheckConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RainbondVolumeSpecRWX != nil {
+		in, out := &in.RainbondVolumeSpecRWX, &out.RainbondVolumeSpecRWX
+		*out = new(RainbondVolumeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RainbondVolumeSpecRWO != nil {
+		in, out := &in.RainbondVolumeSpecRWO, &out.RainbondVolumeSpecRWO
+		*out = new(RainbondVolumeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.CoreComponent.DeepCopyInto(&out.CoreComponent)
+	in.AddonComponent.DeepCopyInto(&out.AddonComponent)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondClusterSpec.
+func (in *RainbondClusterSpec) DeepCopy() *RainbondClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondClusterStatus) DeepCopyInto(out *RainbondClusterStatus) {
+	*out = *in
+	if in.StorageClasses != nil {
+		in, out := &in.StorageClasses, &out.StorageClasses
+		*out = make([]*StorageClass, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(StorageClass)
+				**out = **in
+			}
+		}
+	}
+	if in.GatewayAvailableNodes != nil {
+		in, out := &in.GatewayAvailableNodes, &out.GatewayAvailableNodes
+		*out = new(AvailableNodes)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ChaosAvailableNodes != nil {
+		in, out := &in.ChaosAvailableNodes, &out.ChaosAvailableNodes
+		*out = new(AvailableNodes)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecret != nil {
+		in, out := &in.ImagePullSecret, &out.ImagePullSecret
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]RbdComponentSummary, len(*in))
+		copy(*out, *in)
+	}
+	if in.InstallOrder != nil {
+		in, out := &in.InstallOrder, &out.InstallOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InstallFrontier != nil {
+		in, out := &in.InstallFrontier, &out.InstallFrontier
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UpgradeHistory != nil {
+		in, out := &in.UpgradeHistory, &out.UpgradeHistory
+		*out = make([]RainbondClusterUpgrade, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = new(TeardownStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondClusterStatus.
+func (in *RainbondClusterStatus) DeepCopy() *RainbondClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondClusterUpgrade) DeepCopyInto(out *RainbondClusterUpgrade) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]UpgradedComponent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SkippedComponents != nil {
+		in, out := &in.SkippedComponents, &out.SkippedComponents
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondClusterUpgrade.
+func (in *RainbondClusterUpgrade) DeepCopy() *RainbondClusterUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondClusterUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondPackage) DeepCopyInto(out *RainbondPackage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondPackage.
+func (in *RainbondPackage) DeepCopy() *RainbondPackage {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondPackage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondPackage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondPackageImage) DeepCopyInto(out *RainbondPackageImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondPackageImage.
+func (in *RainbondPackageImage) DeepCopy() *RainbondPackageImage {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondPackageImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondPackageList) DeepCopyInto(out *RainbondPackageList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]RainbondPackage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondPackageList.
+func (in *RainbondPackageList) DeepCopy() *RainbondPackageList {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondPackageList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondPackageList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondPackageSpec) DeepCopyInto(out *RainbondPackageSpec) {
+	*out = *in
+	if in.ImageHubPassSecretRef != nil {
+		in, out := &in.ImageHubPassSecretRef, &out.ImageHubPassSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Download != nil {
+		in, out := &in.Download, &out.Download
+		*out = new(PackageDownload)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(PackageVerification)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondPackageSpec.
+func (in *RainbondPackageSpec) DeepCopy() *RainbondPackageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondPackageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondPackageStatus) DeepCopyInto(out *RainbondPackageStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImagesPushed != nil {
+		in, out := &in.ImagesPushed, &out.ImagesPushed
+		*out = make([]RainbondPackageImage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondPackageStatus.
+func (in *RainbondPackageStatus) DeepCopy() *RainbondPackageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondPackageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondVolume) DeepCopyInto(out *RainbondVolume) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondVolume.
+func (in *RainbondVolume) DeepCopy() *RainbondVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondVolume) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondVolumeList) DeepCopyInto(out *RainbondVolumeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]RainbondVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondVolumeList.
+func (in *RainbondVolumeList) DeepCopy() *RainbondVolumeList {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondVolumeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RainbondVolumeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondVolumeSpec) DeepCopyInto(out *RainbondVolumeSpec) {
+	*out = *in
+	if in.StorageClassParameters != nil {
+		in, out := &in.StorageClassParameters, &out.StorageClassParameters
+		*out = new(StorageClassParameters)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CSIPlugin != nil {
+		in, out := &in.CSIPlugin, &out.CSIPlugin
+		*out = new(CSIPluginSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StorageRequest != nil {
+		in, out := &in.StorageRequest, &out.StorageRequest
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondVolumeSpec.
+func (in *RainbondVolumeSpec) DeepCopy() *RainbondVolumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondVolumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RainbondVolumeStatus) DeepCopyInto(out *RainbondVolumeStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = new(TeardownStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RainbondVolumeStatus.
+func (in *RainbondVolumeStatus) DeepCopy() *RainbondVolumeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RainbondVolumeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponent) DeepCopyInto(out *RbdComponent) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponent.
+func (in *RbdComponent) DeepCopy() *RbdComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RbdComponent) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponentList) DeepCopyInto(out *RbdComponentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]RbdComponent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponentList.
+func (in *RbdComponentList) DeepCopy() *RbdComponentList {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *RbdComponentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponentOverride) DeepCopyInto(out *RbdComponentOverride) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponentOverride.
+func (in *RbdComponentOverride) DeepCopy() *RbdComponentOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponentOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponentSpec) DeepCopyInto(out *RbdComponentSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]corev1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]corev1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StartupProbe != nil {
+		in, out := &in.StartupProbe, &out.StartupProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodDisruptionBudget != nil {
+		in, out := &in.PodDisruptionBudget, &out.PodDisruptionBudget
+		*out = new(PodDisruptionBudgetSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponentSpec.
+func (in *RbdComponentSpec) DeepCopy() *RbdComponentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponentStatus) DeepCopyInto(out *RbdComponentStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.DriftedResources != nil {
+		in, out := &in.DriftedResources, &out.DriftedResources
+		*out = make([]DriftedResource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponentStatus.
+func (in *RbdComponentStatus) DeepCopy() *RbdComponentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RbdComponentSummary) DeepCopyInto(out *RbdComponentSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RbdComponentSummary.
+func (in *RbdComponentSummary) DeepCopy() *RbdComponentSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(RbdComponentSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageClass) DeepCopyInto(out *StorageClass) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClass.
+func (in *StorageClass) DeepCopy() *StorageClass {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageClassParameters) DeepCopyInto(out *StorageClassParameters) {
+	*out = *in
+	if in.MountOptions != nil {
+		in, out := &in.MountOptions, &out.MountOptions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClassParameters.
+func (in *StorageClassParameters) DeepCopy() *StorageClassParameters {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageClassParameters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TeardownStatus) DeepCopyInto(out *TeardownStatus) {
+	*out = *in
+	if in.Remaining != nil {
+		in, out := &in.Remaining, &out.Remaining
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TeardownStatus.
+func (in *TeardownStatus) DeepCopy() *TeardownStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TeardownStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradedComponent) DeepCopyInto(out *UpgradedComponent) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradedComponent.
+func (in *UpgradedComponent) DeepCopy() *UpgradedComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradedComponent)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The sentinel runs on every node, and reports the diagnostics of the node to the operator.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+)
+
+var setupLog = ctrl.Log.WithName("setup")
+
+func main() {
+	var addr string
+	var hostRoot string
+	flag.StringVar(&addr, "bind-address", fmt.Sprintf(":%d", sentinelutil.Port), "The address the sentinel binds to.")
+	flag.StringVar(&hostRoot, "host-root", sentinelutil.HostRoot, "Where the root of the host is mounted.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	collector := &sentinelutil.Collector{
+		Root: hostRoot,
+		Node: os.Getenv("NODE_NAME"),
+	}
+	handler := sentinelutil.NewHandler(ctrl.Log.WithName("sentinel"), collector)
+	setupLog.Info("starting sentinel", "address", addr, "node", collector.Node)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		setupLog.Error(err, "problem running sentinel")
+		os.Exit(1)
+	}
+}
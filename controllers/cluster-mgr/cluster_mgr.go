@@ -5,15 +5,18 @@ import (
 	"encoding/base64"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
-	"github.com/goodrain/rainbond-operator/controllers/cluster-mgr/precheck"
+	"github.com/goodrain/rainbond-operator/controllers/handler"
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/goodrain/rainbond-operator/util/uuidutil"
 	"github.com/pquerna/ffjson/ffjson"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
@@ -21,6 +24,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -28,6 +33,9 @@ import (
 const (
 	// RdbHubCredentialsName name for rbd-hub-credentials
 	RdbHubCredentialsName = "rbd-hub-credentials"
+
+	// chaosMinFreeDisk is the free disk of docker required by rbd-chaos to build, in bytes.
+	chaosMinFreeDisk = 10 << 30
 )
 
 var provisionerAccessModes = map[string]corev1.PersistentVolumeAccessMode{
@@ -72,18 +80,32 @@ type RainbondClusteMgr struct {
 	client client.Client
 	scheme *runtime.Scheme
 	log    logr.Logger
+	// recorder records the events of the cluster, such as the failed paths of the container network.
+	recorder record.EventRecorder
 
 	cluster *rainbondv1alpha1.RainbondCluster
+	// nextPrecheck is how long until a passed precheck is due to re-run.
+	nextPrecheck time.Duration
+	// serverVersion gets the version of the api server, the in-cluster one is used if nil.
+	serverVersion discovery.ServerVersionInterface
+	// diagnoser gets the diagnostics of the nodes, the sentinels are requested if nil.
+	diagnoser sentinelutil.Diagnoser
+	// nodeDiagnostics are the diagnostics of the nodes, got once per reconcile.
+	nodeDiagnostics map[string]*sentinelutil.NodeDiagnostics
+	diagnosed       bool
+	// leftData describes the hostPath data failed to be deleted by the teardown.
+	leftData []string
 }
 
 //NewClusterMgr new Cluster Mgr
-func NewClusterMgr(ctx context.Context, client client.Client, log logr.Logger, cluster *rainbondv1alpha1.RainbondCluster, scheme *runtime.Scheme) *RainbondClusteMgr {
+func NewClusterMgr(ctx context.Context, client client.Client, recorder record.EventRecorder, log logr.Logger, cluster *rainbondv1alpha1.RainbondCluster, scheme *runtime.Scheme) *RainbondClusteMgr {
 	mgr := &RainbondClusteMgr{
-		ctx:     ctx,
-		client:  client,
-		log:     log,
-		cluster: cluster,
-		scheme:  scheme,
+		ctx:      ctx,
+		client:   client,
+		recorder: recorder,
+		log:      log,
+		cluster:  cluster,
+		scheme:   scheme,
 	}
 	return mgr
 }
@@ -136,7 +158,7 @@ func (r *RainbondClusteMgr) GenerateRainbondClusterStatus() (*rainbondv1alpha1.R
 	var masterNodesForChaos []*rainbondv1alpha1.K8sNode
 	if masterRoleLabel != "" {
 		masterNodesForGateway = r.listMasterNodesForGateway(masterRoleLabel)
-		masterNodesForChaos = r.listMasterNodes(masterRoleLabel)
+		masterNodesForChaos = r.filterNodesForChaos(r.listMasterNodes(masterRoleLabel))
 	}
 	s.GatewayAvailableNodes = &rainbondv1alpha1.AvailableNodes{
 		SpecifiedNodes: r.listSpecifiedGatewayNodes(),
@@ -147,8 +169,24 @@ func (r *RainbondClusteMgr) GenerateRainbondClusterStatus() (*rainbondv1alpha1.R
 		MasterNodes:    masterNodesForChaos,
 	}
 
+	rbdcomponents, err := r.listRbdComponents()
+	if err != nil {
+		return nil, fmt.Errorf("list rbdcomponents: %v", err)
+	}
+	s.InstallOrder, s.InstallFrontier = r.installProgress(rbdcomponents)
+	var ready bool
+	s.Components, s.ReadyComponents, ready = r.componentSummaries(rbdcomponents)
+
 	// conditions for rainbond cluster status
 	s.Conditions = r.generateConditions()
+
+	s.Phase = r.phase(s.Conditions, ready)
+	// the installed version is changed by upgrades after the first installation.
+	s.InstalledVersion = r.cluster.Status.InstalledVersion
+	if s.InstalledVersion == "" && s.Phase == rainbondv1alpha1.RainbondClusterPhaseRunning {
+		s.InstalledVersion = r.cluster.Spec.InstallVersion
+	}
+	s.UpgradeHistory = r.cluster.Status.UpgradeHistory
 	r.log.V(6).Info("generating status success")
 	return s, nil
 }
@@ -179,13 +217,89 @@ func (r *RainbondClusteMgr) listSpecifiedGatewayNodes() []*rainbondv1alpha1.K8sN
 	})
 	// Filtering nodes with port conflicts
 	// check gateway ports
-	return rbdutil.FilterNodesWithPortConflicts(nodes)
+	return r.filterNodesForGateway(nodes)
 }
 
 func (r *RainbondClusteMgr) listSpecifiedChaosNodes() []*rainbondv1alpha1.K8sNode {
-	return r.listNodesByLabels(map[string]string{
+	nodes := r.listNodesByLabels(map[string]string{
 		constants.SpecialChaosLabelKey: "",
 	})
+	return r.filterNodesForChaos(nodes)
+}
+
+// getNodeDiagnostics returns the diagnostics of the nodes reported by the sentinels, or nil if they are not available.
+func (r *RainbondClusteMgr) getNodeDiagnostics() map[string]*sentinelutil.NodeDiagnostics {
+	if r.diagnosed {
+		return r.nodeDiagnostics
+	}
+	r.diagnosed = true
+	if r.cluster.Spec.SentinelImage == "" {
+		return nil
+	}
+	diagnoser := r.diagnoser
+	if diagnoser == nil {
+		diagnoser = sentinelutil.NewDiagnoser(r.client)
+	}
+	diagnostics, errs, err := diagnoser.Diagnose(r.ctx, r.cluster.Namespace)
+	if err != nil {
+		r.log.Error(err, "get diagnostics of the nodes")
+		return nil
+	}
+	for node, err := range errs {
+		if sentinelutil.IsOutdated(err) {
+			r.log.Info("The sentinel image is outdated, update it for the diagnostics of the node", "node", node, "image", r.cluster.Spec.SentinelImage)
+			continue
+		}
+		r.log.V(4).Info("get diagnostics", "node", node, "error", err.Error())
+	}
+	r.nodeDiagnostics = diagnostics
+	return diagnostics
+}
+
+// filterNodesForGateway filters out the nodes with the gateway ports in use.
+// The ports are reported by the sentinels, the nodes without diagnostics are dialed instead.
+func (r *RainbondClusteMgr) filterNodesForGateway(nodes []*rainbondv1alpha1.K8sNode) []*rainbondv1alpha1.K8sNode {
+	diagnostics := r.getNodeDiagnostics()
+	var result, undiagnosed []*rainbondv1alpha1.K8sNode
+	for _, node := range nodes {
+		diagnostic, ok := diagnostics[node.Name]
+		if !ok {
+			undiagnosed = append(undiagnosed, node)
+			continue
+		}
+		if ports := diagnostic.PortsInUse(rbdutil.GatewayPorts...); len(ports) > 0 {
+			r.log.V(6).Info("ports in use, not available for rbd-gateway", "node", node.Name, "ports", ports)
+			continue
+		}
+		result = append(result, node)
+	}
+	result = append(result, rbdutil.FilterNodesWithPortConflicts(undiagnosed)...)
+	sort.Sort(k8sNodesSortByName(result))
+	return result
+}
+
+// filterNodesForChaos filters out the nodes where rbd-chaos can not build, because docker is not found
+// or its disk is insufficient. The nodes without diagnostics are kept.
+func (r *RainbondClusteMgr) filterNodesForChaos(nodes []*rainbondv1alpha1.K8sNode) []*rainbondv1alpha1.K8sNode {
+	diagnostics := r.getNodeDiagnostics()
+	var result []*rainbondv1alpha1.K8sNode
+	for _, node := range nodes {
+		diagnostic, ok := diagnostics[node.Name]
+		if !ok {
+			result = append(result, node)
+			continue
+		}
+		if diagnostic.ContainerRuntime != sentinelutil.ContainerRuntimeDocker {
+			r.log.V(6).Info("docker not found, not available for rbd-chaos", "node", node.Name, "runtime", diagnostic.ContainerRuntime)
+			continue
+		}
+		if disk := diagnostic.Disk("/var/lib/docker"); disk != nil && disk.Free < chaosMinFreeDisk {
+			r.log.V(6).Info("insufficient disk, not available for rbd-chaos", "node", node.Name, "free", disk.Free)
+			continue
+		}
+		result = append(result, node)
+	}
+	return result
 }
 
 func (r *RainbondClusteMgr) listNodesByLabels(labels map[string]string) []*rainbondv1alpha1.K8sNode {
@@ -228,7 +342,7 @@ func (r *RainbondClusteMgr) listMasterNodesForGateway(masterLabel string) []*rai
 	nodes := r.listMasterNodes(masterLabel)
 	// Filtering nodes with port conflicts
 	// check gateway ports
-	return rbdutil.FilterNodesWithPortConflicts(nodes)
+	return r.filterNodesForGateway(nodes)
 }
 
 func (r *RainbondClusteMgr) listMasterNodes(masterRoleLabelKey string) []*rainbondv1alpha1.K8sNode {
@@ -244,7 +358,11 @@ func (r *RainbondClusteMgr) CreateImagePullSecret() error {
 			return err
 		}
 	}
-	if config, exist := secret.Data[".dockerconfigjson"]; exist && string(config) == string(r.generateDockerConfig()) {
+	dockerConfig, err := r.generateDockerConfig()
+	if err != nil {
+		return fmt.Errorf("generate docker config: %v", err)
+	}
+	if config, exist := secret.Data[".dockerconfigjson"]; exist && string(config) == string(dockerConfig) {
 		r.log.V(5).Info("dockerconfig not change")
 		return nil
 	}
@@ -254,7 +372,7 @@ func (r *RainbondClusteMgr) CreateImagePullSecret() error {
 			Namespace: r.cluster.Namespace,
 		},
 		Data: map[string][]byte{
-			".dockerconfigjson": r.generateDockerConfig(),
+			".dockerconfigjson": dockerConfig,
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
 	}
@@ -263,7 +381,7 @@ func (r *RainbondClusteMgr) CreateImagePullSecret() error {
 		return fmt.Errorf("set controller reference for secret %s: %v", RdbHubCredentialsName, err)
 	}
 
-	err := r.client.Create(r.ctx, &secret)
+	err = r.client.Create(r.ctx, &secret)
 	if err != nil {
 		if k8sErrors.IsAlreadyExists(err) {
 			r.log.V(7).Info("update image pull secret", "name", RdbHubCredentialsName)
@@ -278,6 +396,40 @@ func (r *RainbondClusteMgr) CreateImagePullSecret() error {
 	return nil
 }
 
+// CreateImageHubPasswordSecretIfNotExists generates the password of the default image hub into the secret
+// referenced by the defaulted spec, so that the password is not kept in the spec in plaintext.
+func (r *RainbondClusteMgr) CreateImageHubPasswordSecretIfNotExists() error {
+	imageHub := r.cluster.Spec.ImageHub
+	if imageHub == nil || imageHub.PasswordSecretRef == nil || imageHub.PasswordSecretRef.Name != constants.ImageHubPasswordSecretName {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: constants.ImageHubPasswordSecretName}, secret)
+	if err == nil {
+		return nil
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("get secret %s: %v", constants.ImageHubPasswordSecretName, err)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.ImageHubPasswordSecretName,
+			Namespace: r.cluster.Namespace,
+		},
+		Data: map[string][]byte{
+			imageHub.PasswordSecretRef.Key: []byte(uuidutil.NewUUID()[0:16]),
+		},
+	}
+	if err := controllerutil.SetControllerReference(r.cluster, secret, r.scheme); err != nil {
+		return fmt.Errorf("set controller reference for secret %s: %v", constants.ImageHubPasswordSecretName, err)
+	}
+	if err := r.client.Create(r.ctx, secret); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create secret %s: %v", constants.ImageHubPasswordSecretName, err)
+	}
+	return nil
+}
+
 func (r *RainbondClusteMgr) checkIfImagePullSecretExists() bool {
 	secret := &corev1.Secret{}
 	err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: RdbHubCredentialsName}, secret)
@@ -290,12 +442,16 @@ func (r *RainbondClusteMgr) checkIfImagePullSecretExists() bool {
 	return true
 }
 
-func (r *RainbondClusteMgr) generateDockerConfig() []byte {
+func (r *RainbondClusteMgr) generateDockerConfig() ([]byte, error) {
 	type dockerConfig struct {
 		Auths map[string]map[string]string `json:"auths"`
 	}
 
-	username, password := r.cluster.Spec.ImageHub.Username, r.cluster.Spec.ImageHub.Password
+	password, err := rbdutil.GetImageHubPassword(r.ctx, r.client, r.cluster)
+	if err != nil {
+		return nil, err
+	}
+	username := r.cluster.Spec.ImageHub.Username
 	auth := map[string]string{
 		"username": username,
 		"password": password,
@@ -309,7 +465,7 @@ func (r *RainbondClusteMgr) generateDockerConfig() []byte {
 	}
 
 	bytes, _ := ffjson.Marshal(dockercfg)
-	return bytes
+	return bytes, nil
 }
 
 func (r *RainbondClusteMgr) checkIfRbdNodeReady() error {
@@ -318,7 +474,7 @@ func (r *RainbondClusteMgr) checkIfRbdNodeReady() error {
 		return err
 	}
 
-	if cpt.Status.ReadyReplicas == 0 || cpt.Status.ReadyReplicas != cpt.Status.Replicas {
+	if cpt.Status.ReadyReplicas == 0 || cpt.Status.ReadyReplicas < cpt.Status.Replicas {
 		return fmt.Errorf("no ready replicas for rbdcomponent rbd-node")
 	}
 
@@ -326,52 +482,7 @@ func (r *RainbondClusteMgr) checkIfRbdNodeReady() error {
 }
 
 func (r *RainbondClusteMgr) generateConditions() []rainbondv1alpha1.RainbondClusterCondition {
-	// region database
-	spec := r.cluster.Spec
-	if spec.RegionDatabase != nil && !r.isConditionTrue(rainbondv1alpha1.RainbondClusterConditionTypeDatabaseRegion) {
-		preChecker := precheck.NewDatabasePrechecker(rainbondv1alpha1.RainbondClusterConditionTypeDatabaseRegion, spec.RegionDatabase)
-		condition := preChecker.Check()
-		r.cluster.Status.UpdateCondition(&condition)
-	}
-
-	// image repository
-	if spec.ImageHub != nil && !r.isConditionTrue(rainbondv1alpha1.RainbondClusterConditionTypeImageRepository) {
-		preChecker := precheck.NewImageRepoPrechecker(r.ctx, r.log, r.cluster)
-		condition := preChecker.Check()
-		r.cluster.Status.UpdateCondition(&condition)
-	}
-
-	// kubernetes version
-	if !r.isConditionTrue(rainbondv1alpha1.RainbondClusterConditionTypeKubernetesVersion) {
-		k8sVersion := precheck.NewK8sVersionPrechecker(r.ctx, r.log, r.client)
-		condition := k8sVersion.Check()
-		r.cluster.Status.UpdateCondition(&condition)
-	}
-
-	storagePreChecker := precheck.NewStorage(r.ctx, r.client, r.cluster.GetNamespace(), r.cluster.Spec.RainbondVolumeSpecRWX)
-	storageCondition := storagePreChecker.Check()
-	r.cluster.Status.UpdateCondition(&storageCondition)
-
-	if r.cluster.Spec.InstallMode != rainbondv1alpha1.InstallationModeOffline {
-		dnsPrechecker := precheck.NewDNSPrechecker(r.cluster, r.log)
-		dnsCondition := dnsPrechecker.Check()
-		r.cluster.Status.UpdateCondition(&dnsCondition)
-	}
-	// disable kube-system namespace pod check
-	// k8sStatusPrechecker := precheck.NewK8sStatusPrechecker(r.ctx, r.cluster, r.client, r.log)
-	// k8sStatusCondition := k8sStatusPrechecker.Check()
-	// r.cluster.Status.UpdateCondition(&k8sStatusCondition)
-
-	memory := precheck.NewMemory(r.ctx, r.log, r.client)
-	memoryCondition := memory.Check()
-	r.cluster.Status.UpdateCondition(&memoryCondition)
-
-	// container network
-	if r.cluster.Spec.SentinelImage != "" {
-		containerNetworkPrechecker := precheck.NewContainerNetworkPrechecker(r.ctx, r.client, r.scheme, r.log, r.cluster)
-		containerNetworkCondition := containerNetworkPrechecker.Check()
-		r.cluster.Status.UpdateCondition(&containerNetworkCondition)
-	}
+	r.runPrechecks()
 
 	if idx, condition := r.cluster.Status.GetCondition(rainbondv1alpha1.RainbondClusterConditionTypeRunning); idx == -1 || condition.Status != corev1.ConditionTrue {
 		running := r.runningCondition()
@@ -381,16 +492,6 @@ func (r *RainbondClusteMgr) generateConditions() []rainbondv1alpha1.RainbondClus
 	return r.cluster.Status.Conditions
 }
 
-func (r *RainbondClusteMgr) isConditionTrue(typ3 rainbondv1alpha1.RainbondClusterConditionType) bool {
-
-	_, condition := r.cluster.Status.GetCondition(typ3)
-
-	if condition != nil && condition.Status == corev1.ConditionTrue {
-		return true
-	}
-	return false
-}
-
 //CreateFoobarPVCIfNotExists -
 func (r *RainbondClusteMgr) CreateFoobarPVCIfNotExists() error {
 	var storageClassName string
@@ -465,24 +566,168 @@ func (r *RainbondClusteMgr) runningCondition() rainbondv1alpha1.RainbondClusterC
 		return rbdutil.FailCondition(condition, "ListRbdComponentFailed", err.Error())
 	}
 
-	if len(rbdcomponents) < 10 {
+	existing := make(map[string]*rainbondv1alpha1.RbdComponent, len(rbdcomponents))
+	for i := range rbdcomponents {
+		existing[rbdcomponents[i].Name] = &rbdcomponents[i]
+	}
+	var missing, notReady []string
+	for _, name := range handler.ExpectedComponents(r.cluster) {
+		cpt, ok := existing[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		if !handler.IsRbdComponentReady(cpt) {
+			notReady = append(notReady, name)
+		}
+	}
+	if len(missing) > 0 {
 		return rbdutil.FailCondition(condition, "InsufficientRbdComponent",
-			fmt.Sprintf("insufficient number of rbdcomponents. expect %d rbdcomponents, but got %d", 10, len(rbdcomponents)))
+			fmt.Sprintf("rbdcomponents not found: %s", strings.Join(missing, ", ")))
+	}
+	if len(notReady) > 0 {
+		return rbdutil.FailCondition(condition, "RbdComponentNotReady",
+			fmt.Sprintf("rbdcomponents not ready: %s", strings.Join(notReady, ", ")))
+	}
+
+	return condition
+}
+
+// installProgress returns the order in which the rbdcomponents are installed, and the ones being installed.
+func (r *RainbondClusteMgr) installProgress(rbdcomponents []rainbondv1alpha1.RbdComponent) (order []string, frontier []string) {
+	names := make([]string, 0, len(rbdcomponents))
+	ready := make(map[string]bool, len(rbdcomponents))
+	for i := range rbdcomponents {
+		names = append(names, rbdcomponents[i].Name)
+		ready[rbdcomponents[i].Name] = handler.IsRbdComponentReady(&rbdcomponents[i])
+	}
+	order, err := handler.InstallOrder(names, r.cluster)
+	if err != nil {
+		r.log.Error(err, "sort rbdcomponents")
+		return nil, nil
 	}
 
+	for _, name := range order {
+		if ready[name] {
+			continue
+		}
+		dependenciesReady := true
+		for _, dep := range handler.Dependencies(name, r.cluster) {
+			if !ready[dep] {
+				dependenciesReady = false
+				break
+			}
+		}
+		if dependenciesReady {
+			frontier = append(frontier, name)
+		}
+	}
+	return order, frontier
+}
+
+// componentSummaries summarizes the rbdcomponents expected by the cluster and the other existing ones.
+// It also returns the number of ready rbdcomponents out of the expected ones, and whether all the expected ones are ready.
+func (r *RainbondClusteMgr) componentSummaries(rbdcomponents []rainbondv1alpha1.RbdComponent) ([]rainbondv1alpha1.RbdComponentSummary, string, bool) {
+	existing := make(map[string]*rainbondv1alpha1.RbdComponent, len(rbdcomponents))
+	for i := range rbdcomponents {
+		existing[rbdcomponents[i].Name] = &rbdcomponents[i]
+	}
+	expected := make(map[string]bool)
+	var names []string
+	for _, name := range handler.ExpectedComponents(r.cluster) {
+		expected[name] = true
+		names = append(names, name)
+	}
 	for _, cpt := range rbdcomponents {
-		idx, c := cpt.Status.GetCondition(rainbondv1alpha1.RbdComponentReady)
-		if idx == -1 {
-			return rbdutil.FailCondition(condition, "RbdComponentReadyNotFound",
-				fmt.Sprintf("condition 'RbdComponentReady' not found for %s", cpt.GetName()))
+		if !expected[cpt.Name] {
+			names = append(names, cpt.Name)
 		}
-		if c.Status == corev1.ConditionFalse {
-			return rbdutil.FailCondition(condition, "RbdComponentNotReady",
-				fmt.Sprintf("rbdcomponent(%s) not ready", cpt.GetName()))
+	}
+	sort.Strings(names)
+
+	summaries := make([]rainbondv1alpha1.RbdComponentSummary, 0, len(names))
+	var readyCount int
+	for _, name := range names {
+		summary := summarizeRbdComponent(name, existing[name])
+		if summary.Ready && expected[name] {
+			readyCount++
 		}
+		summaries = append(summaries, summary)
 	}
+	return summaries, fmt.Sprintf("%d/%d", readyCount, len(expected)), readyCount == len(expected)
+}
 
-	return condition
+// summarizeRbdComponent summarizes the status of the rbdcomponent, cpt is nil if it does not exist.
+func summarizeRbdComponent(name string, cpt *rainbondv1alpha1.RbdComponent) rainbondv1alpha1.RbdComponentSummary {
+	summary := rainbondv1alpha1.RbdComponentSummary{Name: name}
+	if cpt == nil {
+		summary.Reason = "NotFound"
+		summary.Message = fmt.Sprintf("rbdcomponent %s not found", name)
+		return summary
+	}
+	summary.Replicas = cpt.Status.Replicas
+	summary.ReadyReplicas = cpt.Status.ReadyReplicas
+	summary.Ready = handler.IsRbdComponentReady(cpt)
+	if summary.Ready {
+		return summary
+	}
+
+	// the first unsatisfied condition in the order the rbdcomponent is reconciled.
+	for _, typ3 := range []rainbondv1alpha1.RbdComponentConditionType{
+		rainbondv1alpha1.ClusterConfigCompeleted,
+		rainbondv1alpha1.RainbondPackageReady,
+		rainbondv1alpha1.DependenciesReady,
+		rainbondv1alpha1.RbdComponentReady,
+	} {
+		_, condition := cpt.Status.GetCondition(typ3)
+		if condition != nil && condition.Status != corev1.ConditionTrue {
+			summary.Reason = condition.Reason
+			summary.Message = condition.Message
+			break
+		}
+	}
+	if summary.Reason == "" {
+		summary.Reason = "NotReady"
+		summary.Message = fmt.Sprintf("%d of %d replicas are ready", cpt.Status.ReadyReplicas, cpt.Status.Replicas)
+	}
+	return summary
+}
+
+// phase returns the phase of the cluster, based on its conditions and whether all the expected rbdcomponents are ready.
+// It does not take upgrades into account, see Upgrade.
+func (r *RainbondClusteMgr) phase(conditions []rainbondv1alpha1.RainbondClusterCondition, ready bool) rainbondv1alpha1.RainbondClusterPhase {
+	installed := false
+	switch r.cluster.Status.Phase {
+	case rainbondv1alpha1.RainbondClusterPhaseRunning, rainbondv1alpha1.RainbondClusterPhaseDegraded, rainbondv1alpha1.RainbondClusterPhaseUpgrading:
+		installed = true
+	}
+
+	if !installed {
+		prechecked := r.cluster.Spec.ConfigCompleted
+		for _, condition := range conditions {
+			if condition.Type == rainbondv1alpha1.RainbondClusterConditionTypeRunning || !r.IsBlockingCondition(condition.Type) {
+				continue
+			}
+			if condition.Status == corev1.ConditionFalse {
+				return rainbondv1alpha1.RainbondClusterPhaseFailed
+			}
+			if condition.Status != corev1.ConditionTrue {
+				prechecked = false
+			}
+		}
+		if !prechecked {
+			return rainbondv1alpha1.RainbondClusterPhasePrechecking
+		}
+	}
+
+	if ready {
+		return rainbondv1alpha1.RainbondClusterPhaseRunning
+	}
+	if !installed {
+		return rainbondv1alpha1.RainbondClusterPhaseInstalling
+	}
+	// the phase of an upgrade in progress is set by Upgrade.
+	return rainbondv1alpha1.RainbondClusterPhaseDegraded
 }
 
 func (r *RainbondClusteMgr) listRbdComponents() ([]rainbondv1alpha1.RbdComponent, error) {
@@ -0,0 +1,213 @@
+package clustermgr
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newRbdComponent(name string, ready bool) *rainbondv1alpha1.RbdComponent {
+	cpt := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "rbd-system"},
+		Status:     rainbondv1alpha1.RbdComponentStatus{Replicas: 1},
+	}
+	if ready {
+		cpt.Status.ReadyReplicas = 1
+		cpt.Status.Conditions = []rainbondv1alpha1.RbdComponentCondition{
+			{Type: rainbondv1alpha1.RbdComponentReady, Status: corev1.ConditionTrue},
+		}
+	}
+	return cpt
+}
+
+func TestInstallProgress(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := fake.NewFakeClientWithScheme(scheme, []runtime.Object{
+		newRbdComponent("rbd-etcd", true),
+		newRbdComponent("rbd-db", false),
+		newRbdComponent("rbd-gateway", false),
+		newRbdComponent("rbd-mq", false),
+		newRbdComponent("rbd-api", false),
+		newRbdComponent("rbd-worker", false),
+	}...)
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+	cluster.Namespace = "rbd-system"
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+
+	rbdcomponents, err := mgr.listRbdComponents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, frontier := mgr.installProgress(rbdcomponents)
+	assert.Equal(t, []string{"rbd-db", "rbd-etcd", "rbd-api", "rbd-gateway", "rbd-mq", "rbd-worker"}, order)
+	// rbd-api and rbd-worker are waiting for rbd-db, and rbd-worker is also waiting for rbd-mq.
+	assert.Equal(t, []string{"rbd-db", "rbd-gateway", "rbd-mq"}, frontier)
+}
+
+func TestComponentSummaries(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		Spec: rainbondv1alpha1.RainbondClusterSpec{
+			RegionDatabase: &rainbondv1alpha1.Database{Host: "127.0.0.1"},
+			ImageHub:       &rainbondv1alpha1.ImageHub{Domain: "registry.example.com"},
+		},
+	}
+	api := newRbdComponent("rbd-api", false)
+	api.Status.Conditions = []rainbondv1alpha1.RbdComponentCondition{
+		{Type: rainbondv1alpha1.ClusterConfigCompeleted, Status: corev1.ConditionTrue},
+		{Type: rainbondv1alpha1.DependenciesReady, Status: corev1.ConditionFalse, Reason: "WaitingForDependencies", Message: "waiting for rbd-etcd"},
+		{Type: rainbondv1alpha1.RbdComponentReady, Status: corev1.ConditionFalse},
+	}
+	rbdcomponents := []rainbondv1alpha1.RbdComponent{
+		*api,
+		*newRbdComponent("rbd-gateway", true),
+		*newRbdComponent("rbd-monitor", false),
+	}
+	mgr := NewClusterMgr(context.Background(), nil, nil, ctrl.Log, cluster, nil)
+
+	summaries, readyComponents, ready := mgr.componentSummaries(rbdcomponents)
+	assert.False(t, ready)
+	// rbd-db and rbd-hub are replaced by external services.
+	assert.Equal(t, "1/8", readyComponents)
+	var names []string
+	for _, summary := range summaries {
+		names = append(names, summary.Name)
+	}
+	assert.Equal(t, []string{"rbd-api", "rbd-chaos", "rbd-etcd", "rbd-eventlog", "rbd-gateway", "rbd-monitor", "rbd-mq", "rbd-node-proxy", "rbd-worker"}, names)
+	assert.Equal(t, rainbondv1alpha1.RbdComponentSummary{
+		Name:     "rbd-api",
+		Replicas: 1,
+		Reason:   "WaitingForDependencies",
+		Message:  "waiting for rbd-etcd",
+	}, summaries[0])
+	assert.Equal(t, "NotFound", summaries[1].Reason)
+	assert.True(t, summaries[4].Ready)
+	assert.Equal(t, "NotReady", summaries[5].Reason)
+}
+
+func TestPhase(t *testing.T) {
+	passed := []rainbondv1alpha1.RainbondClusterCondition{
+		{Type: rainbondv1alpha1.RainbondClusterConditionTypeStorage, Status: corev1.ConditionTrue},
+		{Type: rainbondv1alpha1.RainbondClusterConditionTypeRunning, Status: corev1.ConditionFalse},
+	}
+	failed := []rainbondv1alpha1.RainbondClusterCondition{
+		{Type: rainbondv1alpha1.RainbondClusterConditionTypeStorage, Status: corev1.ConditionFalse},
+	}
+	tests := []struct {
+		name            string
+		configCompleted bool
+		phase           rainbondv1alpha1.RainbondClusterPhase
+		conditions      []rainbondv1alpha1.RainbondClusterCondition
+		prechecks       []rainbondv1alpha1.PrecheckConfig
+		ready           bool
+		want            rainbondv1alpha1.RainbondClusterPhase
+	}{
+		{name: "config not completed", conditions: passed, want: rainbondv1alpha1.RainbondClusterPhasePrechecking},
+		{name: "precheck failed", configCompleted: true, conditions: failed, want: rainbondv1alpha1.RainbondClusterPhaseFailed},
+		{name: "installing", configCompleted: true, conditions: passed, want: rainbondv1alpha1.RainbondClusterPhaseInstalling},
+		{
+			name:            "warning precheck failed",
+			configCompleted: true,
+			conditions:      failed,
+			prechecks:       []rainbondv1alpha1.PrecheckConfig{{Name: "Storage", Severity: rainbondv1alpha1.PrecheckSeverityWarning}},
+			want:            rainbondv1alpha1.RainbondClusterPhaseInstalling,
+		},
+		{name: "running", configCompleted: true, conditions: passed, ready: true, want: rainbondv1alpha1.RainbondClusterPhaseRunning},
+		{
+			name:            "degraded",
+			configCompleted: true,
+			phase:           rainbondv1alpha1.RainbondClusterPhaseRunning,
+			conditions:      failed,
+			want:            rainbondv1alpha1.RainbondClusterPhaseDegraded,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &rainbondv1alpha1.RainbondCluster{}
+			cluster.Spec.ConfigCompleted = tc.configCompleted
+			cluster.Spec.InstallVersion = "v5.3.0-release"
+			cluster.Spec.Prechecks = tc.prechecks
+			cluster.Status.Phase = tc.phase
+			mgr := NewClusterMgr(context.Background(), nil, nil, ctrl.Log, cluster, nil)
+			assert.Equal(t, tc.want, mgr.phase(tc.conditions, tc.ready))
+		})
+	}
+}
+
+type fakeDiagnoser map[string]*sentinelutil.NodeDiagnostics
+
+func (f fakeDiagnoser) Diagnose(ctx context.Context, namespace string) (map[string]*sentinelutil.NodeDiagnostics, map[string]error, error) {
+	return f, nil, nil
+}
+
+func TestFilterNodes(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	mgr := NewClusterMgr(context.Background(), nil, nil, ctrl.Log, cluster, nil)
+	mgr.diagnoser = fakeDiagnoser{
+		"node1": {Report: sentinelutil.Report{
+			ContainerRuntime: sentinelutil.ContainerRuntimeDocker,
+			ListeningPorts:   []int{22, 443},
+			Disks:            []sentinelutil.Disk{{Path: "/var/lib/docker", Free: 50 << 30}},
+		}},
+		"node2": {Report: sentinelutil.Report{
+			ContainerRuntime: sentinelutil.ContainerRuntimeDocker,
+			ListeningPorts:   []int{22},
+			Disks:            []sentinelutil.Disk{{Path: "/var/lib/docker", Free: 1 << 30}},
+		}},
+		"node3": {Report: sentinelutil.Report{
+			ContainerRuntime: sentinelutil.ContainerRuntimeContainerd,
+			ListeningPorts:   []int{22},
+		}},
+	}
+	nodes := []*rainbondv1alpha1.K8sNode{{Name: "node3"}, {Name: "node2"}, {Name: "node1"}}
+	names := func(nodes []*rainbondv1alpha1.K8sNode) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"node2", "node3"}, names(mgr.filterNodesForGateway(nodes)))
+	// the nodes without diagnostics are kept.
+	assert.Equal(t, []string{"node4", "node1"}, names(mgr.filterNodesForChaos(append([]*rainbondv1alpha1.K8sNode{{Name: "node4"}}, nodes...))))
+}
+
+func TestCreateImageHubPasswordSecretIfNotExists(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &rainbondv1alpha1.RainbondCluster{ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system"}}
+	cluster.Default()
+	cli := fake.NewFakeClientWithScheme(scheme, cluster)
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+
+	assert.NoError(t, mgr.CreateImageHubPasswordSecretIfNotExists())
+	password, err := rbdutil.GetImageHubPassword(context.Background(), cli, cluster)
+	if assert.NoError(t, err) {
+		assert.Len(t, password, 16)
+	}
+
+	// the generated password is kept.
+	assert.NoError(t, mgr.CreateImageHubPasswordSecretIfNotExists())
+	again, _ := rbdutil.GetImageHubPassword(context.Background(), cli, cluster)
+	assert.Equal(t, password, again)
+}
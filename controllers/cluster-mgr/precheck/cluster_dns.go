@@ -0,0 +1,163 @@
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// wildcardProbeHost is the host under the SuffixHTTPHost resolved for its wildcard record.
+const wildcardProbeHost = "rainbond-dns-precheck"
+
+type clusterDNS struct {
+	ctx           context.Context
+	log           logr.Logger
+	client        client.Client
+	scheme        *runtime.Scheme
+	cluster       *rainbondv1alpha1.RainbondCluster
+	prober        sentinelutil.Prober
+	clusterDomain string
+	// wildcard tells whether to resolve the host under the SuffixHTTPHost rather than the service.
+	wildcard bool
+}
+
+// NewClusterDNSPrechecker creates a new prechecker, which asks the sentinel on every node to resolve the service of
+// the sentinels by its fully qualified domain name, the same way as the components resolve rbd-db-rw or rbd-etcd.
+func NewClusterDNSPrechecker(ctx context.Context, log logr.Logger, client client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster,
+	prober sentinelutil.Prober, clusterDomain string) PreChecker {
+	return &clusterDNS{
+		ctx:           ctx,
+		log:           log.WithName("ClusterDNSPreChecker"),
+		client:        client,
+		scheme:        scheme,
+		cluster:       cluster,
+		prober:        prober,
+		clusterDomain: clusterDomain,
+	}
+}
+
+// NewWildcardDNSPrechecker creates a new prechecker, which asks the sentinel on every node to resolve a host under
+// the SuffixHTTPHost, which is expected to resolve to the gateway ips.
+func NewWildcardDNSPrechecker(ctx context.Context, log logr.Logger, client client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster,
+	prober sentinelutil.Prober) PreChecker {
+	return &clusterDNS{
+		ctx:      ctx,
+		log:      log.WithName("WildcardDNSPreChecker"),
+		client:   client,
+		scheme:   scheme,
+		cluster:  cluster,
+		prober:   prober,
+		wildcard: true,
+	}
+}
+
+func (d *clusterDNS) Check() rainbondv1alpha1.RainbondClusterCondition {
+	condition := rainbondv1alpha1.RainbondClusterCondition{
+		Type:              rainbondv1alpha1.RainbondClusterConditionTypeClusterDNS,
+		Status:            corev1.ConditionTrue,
+		LastHeartbeatTime: metav1.NewTime(time.Now()),
+	}
+	if d.wildcard {
+		condition.Type = rainbondv1alpha1.RainbondClusterConditionTypeWildcardDNS
+	}
+
+	svc, err := ensureSentinelService(d.ctx, d.client, d.scheme, d.cluster)
+	if err != nil {
+		return d.failCondition(condition, err.Error())
+	}
+	if msg, err := ensureSentinel(d.ctx, d.client, d.scheme, d.cluster); err != nil {
+		if err == ErrSentinelNotReady {
+			condition.Status = corev1.ConditionUnknown
+			condition.Reason = "SentinelNotReady"
+			condition.Message = msg
+			return condition
+		}
+		return d.failCondition(condition, err.Error())
+	}
+	pods, err := runningSentinels(d.ctx, d.client, d.cluster.Namespace)
+	if err != nil {
+		return d.failCondition(condition, err.Error())
+	}
+
+	target := sentinelutil.ProbeTarget{
+		Kind:    sentinelutil.ProbeKindResolve,
+		Name:    svc.Name,
+		Address: fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, d.clusterDomain),
+	}
+	expected := clusterIPs(svc)
+	if d.wildcard {
+		target.Name = "suffixHTTPHost"
+		target.Address = wildcardProbeHost + "." + strings.TrimPrefix(d.cluster.Spec.SuffixHTTPHost, "*.")
+		expected = d.cluster.GatewayIngressIPs()
+	}
+
+	results, errs := probeFromSentinels(d.ctx, d.prober, pods, []sentinelutil.ProbeTarget{target})
+	for node, err := range errs {
+		// the container network precheck reports the sentinels which can not be reached.
+		d.log.V(4).Info("probe", "node", node, "error", err.Error())
+	}
+	if len(results) == 0 {
+		if len(errs) > 0 {
+			return d.failCondition(condition, fmt.Sprintf("can not communicate with the %d sentinels", len(errs)))
+		}
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = "SentinelNotReady"
+		condition.Message = "no sentinel is running"
+		return condition
+	}
+
+	var failures []string
+	for _, node := range probedNodes(results) {
+		for _, result := range results[node] {
+			if msg := checkResolved(result, expected); msg != "" {
+				failures = append(failures, node+": "+msg)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return d.failCondition(condition, strings.Join(failures, "; "))
+	}
+	return condition
+}
+
+func (d *clusterDNS) failCondition(condition rainbondv1alpha1.RainbondClusterCondition, msg string) rainbondv1alpha1.RainbondClusterCondition {
+	if d.wildcard {
+		return failConditoin(condition, "WildcardDNSFailed", msg)
+	}
+	return failConditoin(condition, "ClusterDNSFailed", msg)
+}
+
+// checkResolved checks the domain name is resolved to one of the expected addresses, any address is expected if
+// there is none. It returns the failure, or empty if there is none.
+func checkResolved(result sentinelutil.ProbeResult, expected []string) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	if len(expected) == 0 {
+		return ""
+	}
+	for _, addr := range result.Addresses {
+		for _, e := range expected {
+			if addr == e {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("%s resolved to %s, expected %s", result.Address, strings.Join(result.Addresses, ","), strings.Join(expected, ","))
+}
+
+func clusterIPs(svc *corev1.Service) []string {
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil
+	}
+	return []string{svc.Spec.ClusterIP}
+}
@@ -0,0 +1,95 @@
+package precheck
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// fakeResolver resolves the domain names on every node with the addresses, or fails if there is none.
+type fakeResolver map[string][]string
+
+func (f fakeResolver) Probe(ctx context.Context, addr string, targets []sentinelutil.ProbeTarget) ([]sentinelutil.ProbeResult, error) {
+	var results []sentinelutil.ProbeResult
+	for _, target := range targets {
+		result := sentinelutil.ProbeResult{ProbeTarget: target, Addresses: f[target.Address]}
+		if len(result.Addresses) == 0 {
+			result.Error = "resolve " + target.Address + ": no such host"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func TestClusterDNS(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	cluster.Spec.SuffixHTTPHost = "foo.grapps.cn"
+	cluster.Spec.NodesForGateway = []*rainbondv1alpha1.K8sNode{{Name: "node1", InternalIP: "192.168.0.1"}}
+	resolver := fakeResolver{}
+	prechecker := NewClusterDNSPrechecker(ctx, ctrl.Log, cli, cli.Scheme(), cluster, resolver, "cluster.local")
+	wildcard := NewWildcardDNSPrechecker(ctx, ctrl.Log, cli, cli.Scheme(), cluster, resolver)
+
+	condition := prechecker.Check()
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	assert.Equal(t, "SentinelNotReady", condition.Reason)
+	ds := &appsv1.DaemonSet{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, ds); err != nil {
+		t.Fatal(err)
+	}
+	ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable = 1, 1
+	if err := cli.Update(ctx, ds); err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: SentinelName + "-node1", Namespace: cluster.Namespace, Labels: sentinelutil.Labels()},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = "10.0.0.1"
+	if err := cli.Create(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, svc); err != nil {
+		t.Fatal(err)
+	}
+	svc.Spec.ClusterIP = "10.96.0.10"
+	if err := cli.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "ClusterDNSFailed", condition.Reason)
+	assert.Equal(t, "node1: resolve rainbond-operator-sentinel.rbd-system.svc.cluster.local: no such host", condition.Message)
+
+	resolver["rainbond-operator-sentinel.rbd-system.svc.cluster.local"] = []string{"10.96.0.11"}
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "node1: rainbond-operator-sentinel.rbd-system.svc.cluster.local resolved to 10.96.0.11, expected 10.96.0.10", condition.Message)
+
+	resolver["rainbond-operator-sentinel.rbd-system.svc.cluster.local"] = []string{"10.96.0.10"}
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionTrue, condition.Status, condition.Message)
+
+	resolver["rainbond-dns-precheck.foo.grapps.cn"] = []string{"1.2.3.4"}
+	condition = wildcard.Check()
+	assert.Equal(t, rainbondv1alpha1.RainbondClusterConditionType(rainbondv1alpha1.RainbondClusterConditionTypeWildcardDNS), condition.Type)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "WildcardDNSFailed", condition.Reason)
+	assert.Equal(t, "node1: rainbond-dns-precheck.foo.grapps.cn resolved to 1.2.3.4, expected 192.168.0.1", condition.Message)
+
+	resolver["rainbond-dns-precheck.foo.grapps.cn"] = []string{"192.168.0.1"}
+	condition = wildcard.Check()
+	assert.Equal(t, corev1.ConditionTrue, condition.Status, condition.Message)
+}
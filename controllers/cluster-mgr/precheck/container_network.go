@@ -2,50 +2,49 @@ package precheck
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
-	"github.com/goodrain/rainbond-operator/util/commonutil"
-	"github.com/goodrain/rainbond-operator/util/constants"
-	"github.com/goodrain/rainbond-operator/util/k8sutil"
-	"github.com/goodrain/rainbond-operator/util/rbdutil"
-	appsv1 "k8s.io/api/apps/v1"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
 	corev1 "k8s.io/api/core/v1"
-	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-// SentinelName -
-const SentinelName = "rainbond-operator-sentinel"
-
-// ErrSentinelNotReady -
-var ErrSentinelNotReady = errors.New("rainbond-operator-sentinel not ready")
+// maxReportedPaths is the maximum number of the failed paths listed in the message of the condition.
+const maxReportedPaths = 10
 
 type containerNetwork struct {
-	ctx     context.Context
-	log     logr.Logger
-	client  client.Client
-	scheme  *runtime.Scheme
-	cluster *rainbondv1alpha1.RainbondCluster
+	ctx      context.Context
+	log      logr.Logger
+	client   client.Client
+	scheme   *runtime.Scheme
+	cluster  *rainbondv1alpha1.RainbondCluster
+	prober   sentinelutil.Prober
+	recorder record.EventRecorder
 }
 
-// NewContainerNetworkPrechecker creates a new prechecker.
-func NewContainerNetworkPrechecker(ctx context.Context, client client.Client, scheme *runtime.Scheme, log logr.Logger, cluster *rainbondv1alpha1.RainbondCluster) PreChecker {
+// NewContainerNetworkPrechecker creates a new prechecker, which asks the sentinel on every node to probe the sentinels
+// on the other nodes by pod ip, the service of the sentinels by cluster ip and by domain name.
+// The failed paths are recorded as events of the rainbondcluster if the recorder is not nil.
+func NewContainerNetworkPrechecker(ctx context.Context, client client.Client, scheme *runtime.Scheme, log logr.Logger, cluster *rainbondv1alpha1.RainbondCluster,
+	prober sentinelutil.Prober, recorder record.EventRecorder) PreChecker {
 	return &containerNetwork{
-		log:     log.WithName("ContainerNetworkPreChecker"),
-		ctx:     ctx,
-		cluster: cluster,
-		client:  client,
-		scheme:  scheme,
+		log:      log.WithName("ContainerNetworkPreChecker"),
+		ctx:      ctx,
+		cluster:  cluster,
+		client:   client,
+		scheme:   scheme,
+		prober:   prober,
+		recorder: recorder,
 	}
 }
 
@@ -56,8 +55,13 @@ func (c *containerNetwork) Check() rainbondv1alpha1.RainbondClusterCondition {
 		LastHeartbeatTime: metav1.NewTime(time.Now()),
 	}
 
+	svc, err := ensureSentinelService(c.ctx, c.client, c.scheme, c.cluster)
+	if err != nil {
+		return c.failCondition(condition, err.Error())
+	}
+
 	// Check if sentinel is ready
-	if msg, err := c.isSentinelReady(); err != nil {
+	if msg, err := ensureSentinel(c.ctx, c.client, c.scheme, c.cluster); err != nil {
 		if err == ErrSentinelNotReady {
 			condition.Status = corev1.ConditionFalse
 			condition.Reason = "SentinelNotReady"
@@ -67,10 +71,16 @@ func (c *containerNetwork) Check() rainbondv1alpha1.RainbondClusterCondition {
 		return c.failCondition(condition, err.Error())
 	}
 
-	// Check whether it can communicate with each pods
-	if err := c.communicate(); err != nil {
+	matrix, err := c.probe(svc)
+	if err != nil {
 		return c.failCondition(condition, err.Error())
 	}
+	c.log.V(4).Info("container network probed", "matrix", matrix.String())
+
+	if msg := matrix.summary(); msg != "" {
+		c.recordFailures(matrix)
+		return c.failCondition(condition, msg)
+	}
 
 	return condition
 }
@@ -79,112 +89,134 @@ func (c *containerNetwork) failCondition(condition rainbondv1alpha1.RainbondClus
 	return failConditoin(condition, "ContainerNetworkFailed", msg)
 }
 
-func (c *containerNetwork) isSentinelReady() (string, error) {
-	ds := appsv1.DaemonSet{}
-	err := c.client.Get(c.ctx, types.NamespacedName{Namespace: c.cluster.GetNamespace(), Name: SentinelName}, &ds)
+// probe asks every running sentinel to probe the others and the service, and returns the results.
+func (c *containerNetwork) probe(svc *corev1.Service) (*networkMatrix, error) {
+	pods, err := runningSentinels(c.ctx, c.client, c.cluster.Namespace)
 	if err != nil {
-		if k8sErrors.IsNotFound(err) {
-			// creates a new one
-			return "", c.createSentinel()
-		}
-		return "", err
+		return nil, err
 	}
 
-	if ds.Status.NumberAvailable != ds.Status.DesiredNumberScheduled {
-		msg := "desired %d pods to be available, but only got %d"
-		return fmt.Sprintf(msg, ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable), ErrSentinelNotReady
+	port := strconv.Itoa(sentinelutil.Port)
+	var targets []sentinelutil.ProbeTarget
+	for _, pod := range pods {
+		targets = append(targets, sentinelutil.ProbeTarget{
+			Kind:    sentinelutil.ProbeKindPod,
+			Name:    pod.Spec.NodeName,
+			Address: net.JoinHostPort(pod.Status.PodIP, port),
+		})
 	}
-
-	return "", nil
-}
-
-func (c *containerNetwork) communicate() error {
-	podList := corev1.PodList{}
-	labels := rbdutil.LabelsForRainbond(map[string]string{
-		"name": SentinelName,
-	})
-	err := c.client.List(c.ctx, &podList, client.InNamespace(c.cluster.Namespace), client.MatchingLabels(labels))
-	if err != nil {
-		return err
+	if svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		targets = append(targets, sentinelutil.ProbeTarget{
+			Kind:    sentinelutil.ProbeKindService,
+			Name:    svc.Name,
+			Address: net.JoinHostPort(svc.Spec.ClusterIP, port),
+		})
 	}
+	// resolved with the search domains of the pods, so that the cluster domain is not assumed.
+	domain := fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace)
+	targets = append(targets, sentinelutil.ProbeTarget{
+		Kind:    sentinelutil.ProbeKindDNS,
+		Name:    domain,
+		Address: net.JoinHostPort(domain, port),
+	})
 
-	var badPods []string
-	for _, pod := range podList.Items {
-		if err := dial(pod.Status.PodIP, 8080); err != nil {
-			badPods = append(badPods, fmt.Sprintf("%s(%s)", pod.GetName(), pod.Status.PodIP))
+	results, errs := probeFromSentinels(c.ctx, c.prober, pods, targets)
+	if len(errs) > 0 {
+		var badNodes []string
+		for node, err := range errs {
+			c.log.V(4).Info("probe", "node", node, "error", err.Error())
+			badNodes = append(badNodes, node)
 		}
+		sort.Strings(badNodes)
+		return nil, fmt.Errorf("can not communicate with the sentinels on %s", strings.Join(badNodes, ","))
 	}
 
-	if len(badPods) > 0 {
-		return fmt.Errorf("can not communicate with %s", strings.Join(badPods, ","))
+	return &networkMatrix{results: results}, nil
+}
+
+// recordFailures records the failed paths from every node as an event.
+func (c *containerNetwork) recordFailures(matrix *networkMatrix) {
+	if c.recorder == nil {
+		return
+	}
+	for _, node := range matrix.nodes() {
+		var paths []string
+		for _, result := range matrix.results[node] {
+			if result.Error != "" {
+				paths = append(paths, fmt.Sprintf("%s: %s", pathTo(result.ProbeTarget), result.Error))
+			}
+		}
+		if len(paths) > 0 {
+			c.recorder.Eventf(c.cluster, corev1.EventTypeWarning, "ContainerNetworkFailed", "%s can not reach %s", node, strings.Join(paths, "; "))
+		}
 	}
+}
 
-	return nil
+// networkMatrix is the reachability of the targets probed from the nodes, which are the sentinels on the nodes
+// by pod ip, the service of the sentinels by cluster ip and by domain name.
+type networkMatrix struct {
+	// results of the targets by the source node.
+	results map[string][]sentinelutil.ProbeResult
 }
 
-func dial(ip string, port int) error {
-	var d net.Dialer
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+func (m *networkMatrix) nodes() []string {
+	return probedNodes(m.results)
+}
 
-	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", ip, port))
-	if err != nil {
-		return err
+// summary returns the number of the failed paths, with the first maxReportedPaths of them,
+// or empty if all paths are reachable.
+func (m *networkMatrix) summary() string {
+	var total int
+	var failed []string
+	for _, node := range m.nodes() {
+		for _, result := range m.results[node] {
+			total++
+			if result.Error != "" {
+				failed = append(failed, node+" -> "+pathTo(result.ProbeTarget))
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return ""
 	}
-	defer conn.Close()
 
-	return nil
+	msg := fmt.Sprintf("%d of %d paths failed: ", len(failed), total)
+	if len(failed) > maxReportedPaths {
+		return msg + strings.Join(failed[:maxReportedPaths], ", ") + fmt.Sprintf(" and %d more", len(failed)-maxReportedPaths)
+	}
+	return msg + strings.Join(failed, ", ")
 }
 
-func (c *containerNetwork) createSentinel() error {
-	ds := c.daemonsetForSentinel()
-
-	// Set rainboncluster as the owner and controller
-	if err := controllerutil.SetControllerReference(c.cluster, ds, c.scheme); err != nil {
-		return err
+// String returns the matrix with a line per source node, such as
+//
+//	node1: node1=ok node2=failed service=ok dns=ok
+func (m *networkMatrix) String() string {
+	var lines []string
+	for _, node := range m.nodes() {
+		line := node + ":"
+		for _, result := range m.results[node] {
+			name := result.Name
+			if result.Kind != sentinelutil.ProbeKindPod {
+				name = result.Kind
+			}
+			status := "ok"
+			if result.Error != "" {
+				status = "failed"
+			}
+			line += " " + name + "=" + status
+		}
+		lines = append(lines, line)
 	}
-
-	return k8sutil.CreateIfNotExists(c.ctx, c.client, ds)
+	return strings.Join(lines, "\n")
 }
 
-func (c *containerNetwork) daemonsetForSentinel() *appsv1.DaemonSet {
-	labels := rbdutil.LabelsForRainbond(map[string]string{
-		"name": SentinelName,
-	})
-	return &appsv1.DaemonSet{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      SentinelName,
-			Namespace: c.cluster.GetNamespace(),
-			Labels: rbdutil.LabelsForRainbond(map[string]string{
-				"name": SentinelName,
-			}),
-		},
-		Spec: appsv1.DaemonSetSpec{
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:   SentinelName,
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					TerminationGracePeriodSeconds: commonutil.Int64(0),
-					ServiceAccountName:            constants.ServiceAccountName,
-					Tolerations: []corev1.Toleration{
-						{
-							Operator: corev1.TolerationOpExists, // tolerate everything.
-						},
-					},
-					Containers: []corev1.Container{
-						{
-							Name:            SentinelName,
-							Image:           c.cluster.Spec.SentinelImage,
-							ImagePullPolicy: corev1.PullIfNotPresent,
-						},
-					},
-				},
-			},
-		},
+func pathTo(target sentinelutil.ProbeTarget) string {
+	switch target.Kind {
+	case sentinelutil.ProbeKindPod:
+		return fmt.Sprintf("%s(pod %s)", target.Name, target.Address)
+	case sentinelutil.ProbeKindService:
+		return fmt.Sprintf("service %s", target.Address)
+	default:
+		return fmt.Sprintf("%s %s", target.Kind, target.Name)
 	}
 }
@@ -0,0 +1,117 @@
+package precheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// fakeProber probes the targets from the sentinels, which can not reach the addresses in unreachable by their addresses.
+type fakeProber struct {
+	unreachable map[string]map[string]bool
+	// down are the sentinels which can not be requested.
+	down map[string]bool
+}
+
+func (f *fakeProber) Probe(ctx context.Context, addr string, targets []sentinelutil.ProbeTarget) ([]sentinelutil.ProbeResult, error) {
+	if f.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	var results []sentinelutil.ProbeResult
+	for _, target := range targets {
+		result := sentinelutil.ProbeResult{ProbeTarget: target}
+		if f.unreachable[addr][target.Address] {
+			result.Error = "i/o timeout"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func TestContainerNetwork(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	prober := &fakeProber{}
+	recorder := record.NewFakeRecorder(10)
+	prechecker := NewContainerNetworkPrechecker(ctx, cli, cli.Scheme(), ctrl.Log, cluster, prober, recorder)
+
+	condition := prechecker.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "SentinelNotReady", condition.Reason)
+	ds := &appsv1.DaemonSet{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, ds); err != nil {
+		t.Fatal(err)
+	}
+	ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable = 2, 2
+	if err := cli.Update(ctx, ds); err != nil {
+		t.Fatal(err)
+	}
+	for node, ip := range map[string]string{"node1": "10.0.0.1", "node2": "10.0.0.2"} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: SentinelName + "-" + node, Namespace: cluster.Namespace, Labels: sentinelutil.Labels()},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.PodIP = ip
+		if err := cli.Create(ctx, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &corev1.Service{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, svc); err != nil {
+		t.Fatal(err)
+	}
+	svc.Spec.ClusterIP = "10.96.0.10"
+	if err := cli.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionTrue, condition.Status, condition.Message)
+
+	prober.unreachable = map[string]map[string]bool{
+		"10.0.0.1:8080": {"10.0.0.2:8080": true, "rainbond-operator-sentinel.rbd-system.svc:8080": true},
+		"10.0.0.2:8080": {"10.96.0.10:8080": true},
+	}
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "ContainerNetworkFailed", condition.Reason)
+	assert.Equal(t, "3 of 8 paths failed: node1 -> node2(pod 10.0.0.2:8080), node1 -> dns rainbond-operator-sentinel.rbd-system.svc, "+
+		"node2 -> service 10.96.0.10:8080", condition.Message)
+	if assert.Len(t, recorder.Events, 2) {
+		assert.Equal(t, "Warning ContainerNetworkFailed node1 can not reach node2(pod 10.0.0.2:8080): i/o timeout; "+
+			"dns rainbond-operator-sentinel.rbd-system.svc: i/o timeout", <-recorder.Events)
+		assert.Equal(t, "Warning ContainerNetworkFailed node2 can not reach service 10.96.0.10:8080: i/o timeout", <-recorder.Events)
+	}
+
+	prober.down = map[string]bool{"10.0.0.2:8080": true}
+	condition = prechecker.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "can not communicate with the sentinels on node2", condition.Message)
+}
+
+func TestNetworkMatrixSummary(t *testing.T) {
+	matrix := &networkMatrix{results: make(map[string][]sentinelutil.ProbeResult)}
+	for _, node := range []string{"a", "b", "c", "d"} {
+		for _, target := range []string{"a", "b", "c", "d"} {
+			result := sentinelutil.ProbeResult{ProbeTarget: sentinelutil.ProbeTarget{Kind: sentinelutil.ProbeKindPod, Name: target, Address: target}}
+			if node != target {
+				result.Error = "i/o timeout"
+			}
+			matrix.results[node] = append(matrix.results[node], result)
+		}
+	}
+	assert.Equal(t, "12 of 16 paths failed: a -> b(pod b), a -> c(pod c), a -> d(pod d), b -> a(pod a), b -> c(pod c), b -> d(pod d), "+
+		"c -> a(pod a), c -> b(pod b), c -> d(pod d), d -> a(pod a) and 2 more", matrix.summary())
+	assert.Equal(t, "a: a=ok b=failed c=failed d=failed", matrix.String()[:len("a: a=ok b=failed c=failed d=failed")])
+}
@@ -6,7 +6,7 @@ import (
 	"path"
 	"time"
 
-	"github.com/docker/docker/client"
+	dclient "github.com/docker/docker/client"
 	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/imageutil"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
@@ -15,20 +15,23 @@ import (
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type imagerepo struct {
 	ctx     context.Context
 	log     logr.Logger
+	client  client.Client
 	cluster *rainbondv1alpha1.RainbondCluster
 }
 
 // NewImageRepoPrechecker creates a new prechecker.
-func NewImageRepoPrechecker(ctx context.Context, log logr.Logger, cluster *rainbondv1alpha1.RainbondCluster) PreChecker {
+func NewImageRepoPrechecker(ctx context.Context, log logr.Logger, client client.Client, cluster *rainbondv1alpha1.RainbondCluster) PreChecker {
 	l := log.WithName("ImageRepoPreChecker")
 	return &imagerepo{
 		ctx:     ctx,
 		log:     l,
+		client:  client,
 		cluster: cluster,
 	}
 }
@@ -52,7 +55,7 @@ func (d *imagerepo) Check() rainbondv1alpha1.RainbondClusterCondition {
 	localImage := path.Join(d.cluster.Spec.RainbondImageRepository, "smallimage")
 	remoteImage := path.Join(imageRepo, "smallimage")
 
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv)
+	dockerClient, err := dclient.NewClientWithOpts(dclient.FromEnv)
 	if err != nil {
 		return d.failConditoin(condition, err)
 	}
@@ -72,10 +75,15 @@ func (d *imagerepo) Check() rainbondv1alpha1.RainbondClusterCondition {
 		return d.failConditoin(condition, fmt.Errorf("tag image %s to %s: %v", localImage, remoteImage, err))
 	}
 
+	password, err := rbdutil.GetImageHubPassword(d.ctx, d.client, d.cluster)
+	if err != nil {
+		return d.failConditoin(condition, fmt.Errorf("get image hub password: %v", err))
+	}
+
 	// push a small image to check the given image repository
 	d.log.V(6).Info("push image", "image", remoteImage, "repository", imageRepo, "user", d.cluster.Spec.ImageHub.Username)
 	if err := imageutil.ImagePush(d.ctx, dockerClient, remoteImage, imageRepo,
-		d.cluster.Spec.ImageHub.Username, d.cluster.Spec.ImageHub.Password); err != nil {
+		d.cluster.Spec.ImageHub.Username, password); err != nil {
 		condition = d.failConditoin(condition, fmt.Errorf("push image: %v", err))
 		if imageRepo == constants.DefImageRepository {
 			condition.Reason = "DefaultImageRepoFailed"
@@ -3,29 +3,94 @@ package precheck
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// K8sVersionRange is the range of the kubernetes versions supported by a Rainbond version.
+type K8sVersionRange struct {
+	// Rainbond is the minor version of Rainbond, such as v5.3.
+	Rainbond string
+	// Min is the lowest supported version of kubernetes, such as v1.13.0.
+	Min string
+	// Max is the highest supported minor version of kubernetes, such as v1.19, all of its patches are supported.
+	Max string
+	// MaxKubeletSkew is how many minor versions the kubelets may be older than the api server.
+	MaxKubeletSkew int
+}
+
+// k8sVersionMatrix lists the kubernetes versions supported by each Rainbond version, the newest first.
+// A new Rainbond release only needs a new row.
+var k8sVersionMatrix = []K8sVersionRange{
+	{Rainbond: "v5.4", Min: "v1.16.0", Max: "v1.21", MaxKubeletSkew: 2},
+	{Rainbond: "v5.3", Min: "v1.13.0", Max: "v1.19", MaxKubeletSkew: 2},
+	{Rainbond: "v5.2", Min: "v1.13.0", Max: "v1.18", MaxKubeletSkew: 2},
+}
+
+// SupportedK8sVersions returns the kubernetes versions supported by the Rainbond version, which is the row of the newest
+// Rainbond version not newer than it. The newest row is returned if the Rainbond version can not be parsed, such as a
+// development build, and the oldest row if the Rainbond version is older than all of the rows.
+func SupportedK8sVersions(rainbondVersion string) K8sVersionRange {
+	v, err := version.ParseGeneric(rainbondVersion)
+	if err != nil {
+		return k8sVersionMatrix[0]
+	}
+	for _, supported := range k8sVersionMatrix {
+		if compareMinor(v, version.MustParseGeneric(supported.Rainbond)) >= 0 {
+			return supported
+		}
+	}
+	return k8sVersionMatrix[len(k8sVersionMatrix)-1]
+}
+
 type k8sversion struct {
-	ctx    context.Context
-	log    logr.Logger
-	client client.Client
+	ctx           context.Context
+	log           logr.Logger
+	client        client.Client
+	serverVersion discovery.ServerVersionInterface
+
+	min            *version.Version
+	max            *version.Version
+	maxKubeletSkew int
 }
 
-// NewK8sVersionPrechecker creates a new kubernetes version prechecker.
-func NewK8sVersionPrechecker(ctx context.Context, log logr.Logger, client client.Client) PreChecker {
+// NewK8sVersionPrechecker creates a new kubernetes version prechecker, which expects the api server and the kubelets
+// to be in the supported range, and the kubelets not to be skewed from the api server.
+func NewK8sVersionPrechecker(ctx context.Context, log logr.Logger, client client.Client, serverVersion discovery.ServerVersionInterface, supported K8sVersionRange) (PreChecker, error) {
+	min, err := version.ParseGeneric(supported.Min)
+	if err != nil {
+		return nil, fmt.Errorf("min version: %v", err)
+	}
+	max, err := version.ParseGeneric(supported.Max)
+	if err != nil {
+		return nil, fmt.Errorf("max version: %v", err)
+	}
+	if compareMinor(min, max) > 0 {
+		return nil, fmt.Errorf("min version %s is newer than max version %s", supported.Min, supported.Max)
+	}
+	if supported.MaxKubeletSkew < 0 {
+		return nil, fmt.Errorf("negative max kubelet skew %d", supported.MaxKubeletSkew)
+	}
+
 	l := log.WithName("K8sVersionPreChecker")
 	return &k8sversion{
-		ctx:    ctx,
-		log:    l,
-		client: client,
-	}
+		ctx:            ctx,
+		log:            l,
+		client:         client,
+		serverVersion:  serverVersion,
+		min:            min,
+		max:            max,
+		maxKubeletSkew: supported.MaxKubeletSkew,
+	}, nil
 }
 
 func (k *k8sversion) Check() rainbondv1alpha1.RainbondClusterCondition {
@@ -35,44 +100,114 @@ func (k *k8sversion) Check() rainbondv1alpha1.RainbondClusterCondition {
 		LastHeartbeatTime: metav1.NewTime(time.Now()),
 	}
 
-	version, err := k.getKubernetesVersion()
+	server, err := k.getServerVersion()
 	if err != nil {
-		condition.Status = corev1.ConditionFalse
-		condition.Reason = "KubernetesVersionFailed"
-		condition.Message = err.Error()
-		return condition
+		return failConditoin(condition, "KubernetesVersionFailed", err.Error())
+	}
+	if server.LessThan(k.min) {
+		return failConditoin(condition, "KubernetesVersionTooOld",
+			fmt.Sprintf("expect the version of k8s to be greater than or equal to %s, but got %s", k.min, server))
+	}
+	if compareMinor(server, k.max) > 0 {
+		return failConditoin(condition, "KubernetesVersionTooNew",
+			fmt.Sprintf("expect the version of k8s to be at most v%d.%d.x, but got %s", k.max.Major(), k.max.Minor(), server))
 	}
 
-	if version < "v1.13.0" {
-		condition.Status = corev1.ConditionFalse
-		condition.Reason = "UnsupportedKubernetesVersion"
-		condition.Message = "expect the version of k8s to be greater than or equal to 1.13.0, but got " + version
-		return condition
+	kubelets, err := k.getKubeletVersions()
+	if err != nil {
+		return failConditoin(condition, "KubernetesVersionFailed", err.Error())
+	}
+	var tooOld, tooNew, skewed []string
+	for node, kubelet := range kubelets {
+		nodeVersion := fmt.Sprintf("%s(%s)", node, kubelet)
+		switch {
+		case compareMinor(kubelet, server) > 0:
+			tooNew = append(tooNew, nodeVersion)
+		case minorSkew(server, kubelet) > k.maxKubeletSkew:
+			skewed = append(skewed, nodeVersion)
+		case kubelet.LessThan(k.min):
+			tooOld = append(tooOld, nodeVersion)
+		}
+	}
+	if len(tooNew) > 0 {
+		return failConditoin(condition, "KubeletVersionTooNew",
+			fmt.Sprintf("expect the kubelets not to be newer than the api server %s, but got %s", server, joinSorted(tooNew)))
+	}
+	if len(skewed) > 0 {
+		return failConditoin(condition, "KubeletVersionSkewed",
+			fmt.Sprintf("expect the kubelets to be at most %d minor versions older than the api server %s, but got %s",
+				k.maxKubeletSkew, server, joinSorted(skewed)))
+	}
+	if len(tooOld) > 0 {
+		return failConditoin(condition, "KubeletVersionTooOld",
+			fmt.Sprintf("expect the version of the kubelets to be greater than or equal to %s, but got %s", k.min, joinSorted(tooOld)))
 	}
 
 	return condition
 }
 
-func (k *k8sversion) getKubernetesVersion() (string, error) {
+func (k *k8sversion) getServerVersion() (*version.Version, error) {
+	info, err := k.serverVersion.ServerVersion()
+	if err != nil {
+		k.log.Error(err, "get server version")
+		return nil, fmt.Errorf("get server version: %v", err)
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parse server version: %v", err)
+	}
+	return v, nil
+}
+
+// getKubeletVersions returns the versions of the kubelets by node name, the nodes without a kubelet version are ignored.
+func (k *k8sversion) getKubeletVersions() (map[string]*version.Version, error) {
 	nodeList := &corev1.NodeList{}
-	var listOpts []client.ListOption
-	if err := k.client.List(k.ctx, nodeList, listOpts...); err != nil {
+	if err := k.client.List(k.ctx, nodeList); err != nil {
 		k.log.Error(err, "list nodes")
-		return "", fmt.Errorf("list nodes: %v", err)
+		return nil, fmt.Errorf("list nodes: %v", err)
 	}
 
-	var version string
+	versions := make(map[string]*version.Version, len(nodeList.Items))
 	for _, node := range nodeList.Items {
 		if node.Status.NodeInfo.KubeletVersion == "" {
 			continue
 		}
-		version = node.Status.NodeInfo.KubeletVersion
-		break
+		v, err := version.ParseGeneric(node.Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			return nil, fmt.Errorf("parse kubelet version of node %s: %v", node.Name, err)
+		}
+		versions[node.Name] = v
+	}
+
+	return versions, nil
+}
+
+// compareMinor compares the major and minor versions of a and b, ignoring the patches.
+func compareMinor(a, b *version.Version) int {
+	switch {
+	case a.Major() != b.Major():
+		if a.Major() < b.Major() {
+			return -1
+		}
+		return 1
+	case a.Minor() < b.Minor():
+		return -1
+	case a.Minor() > b.Minor():
+		return 1
 	}
+	return 0
+}
 
-	if version == "" {
-		return "", fmt.Errorf("failed to get kubernetes version")
+// minorSkew returns how many minor versions the kubelet is older than the api server.
+func minorSkew(server, kubelet *version.Version) int {
+	if server.Major() != kubelet.Major() {
+		// the kubelets of a different major version are never supported.
+		return int(^uint(0) >> 1)
 	}
+	return int(server.Minor()) - int(kubelet.Minor())
+}
 
-	return version, nil
+func joinSorted(items []string) string {
+	sort.Strings(items)
+	return strings.Join(items, ", ")
 }
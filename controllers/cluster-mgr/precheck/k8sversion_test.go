@@ -0,0 +1,111 @@
+package precheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newNode(name, kubeletVersion string) runtime.Object {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.NodeInfo.KubeletVersion = kubeletVersion
+	return node
+}
+
+func TestSupportedK8sVersions(t *testing.T) {
+	tests := []struct {
+		rainbondVersion string
+		want            string
+	}{
+		{rainbondVersion: "v5.3.0-release", want: "v5.3"},
+		{rainbondVersion: "v5.3.3-release", want: "v5.3"},
+		{rainbondVersion: "v5.4.0-release", want: "v5.4"},
+		{rainbondVersion: "v5.10.0-release", want: "v5.4"},
+		{rainbondVersion: "v5.1.9-release", want: "v5.2"},
+		{rainbondVersion: "master", want: "v5.4"},
+		{rainbondVersion: "", want: "v5.4"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, SupportedK8sVersions(tc.rainbondVersion).Rainbond, tc.rainbondVersion)
+	}
+}
+
+func TestK8sVersionCheck(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	supported := K8sVersionRange{Min: "v1.13.0", Max: "v1.19", MaxKubeletSkew: 2}
+	tests := []struct {
+		name          string
+		serverVersion string
+		nodes         []runtime.Object
+		wantReason    string
+	}{
+		{name: "supported", serverVersion: "v1.19.3", nodes: []runtime.Object{newNode("node1", "v1.19.3"), newNode("node2", "v1.17.0")}},
+		{name: "vendor suffixes", serverVersion: "v1.18.8-aliyun.1", nodes: []runtime.Object{newNode("node1", "v1.18.8+k3s1")}},
+		{name: "nodes without kubelet versions", serverVersion: "v1.16.0", nodes: []runtime.Object{newNode("node1", "")}},
+		{name: "minor compared numerically", serverVersion: "v1.9.11", wantReason: "KubernetesVersionTooOld"},
+		{name: "above the max", serverVersion: "v1.20.0", wantReason: "KubernetesVersionTooNew"},
+		{name: "max patch", serverVersion: "v1.19.16", nodes: []runtime.Object{newNode("node1", "v1.19.16")}},
+		{name: "invalid server version", serverVersion: "unknown", wantReason: "KubernetesVersionFailed"},
+		{name: "invalid kubelet version", serverVersion: "v1.19.3", nodes: []runtime.Object{newNode("node1", "latest")}, wantReason: "KubernetesVersionFailed"},
+		{name: "kubelet newer", serverVersion: "v1.18.2", nodes: []runtime.Object{newNode("node1", "v1.19.0")}, wantReason: "KubeletVersionTooNew"},
+		{name: "kubelet newer patch", serverVersion: "v1.18.2", nodes: []runtime.Object{newNode("node1", "v1.18.6")}},
+		{
+			name:          "kubelet skewed",
+			serverVersion: "v1.19.3",
+			nodes:         []runtime.Object{newNode("node1", "v1.19.3"), newNode("node2", "v1.16.15")},
+			wantReason:    "KubeletVersionSkewed",
+		},
+		{name: "kubelet too old", serverVersion: "v1.14.0", nodes: []runtime.Object{newNode("node1", "v1.12.10")}, wantReason: "KubeletVersionTooOld"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			serverVersion := &fakediscovery.FakeDiscovery{
+				Fake:               &k8stesting.Fake{},
+				FakedServerVersion: &version.Info{GitVersion: tc.serverVersion},
+			}
+			cli := fake.NewFakeClientWithScheme(scheme, tc.nodes...)
+			prechecker, err := NewK8sVersionPrechecker(context.Background(), ctrl.Log, cli, serverVersion, supported)
+			if err != nil {
+				t.Fatal(err)
+			}
+			condition := prechecker.Check()
+			if tc.wantReason == "" {
+				assert.Equal(t, corev1.ConditionTrue, condition.Status, condition.Message)
+				return
+			}
+			assert.Equal(t, corev1.ConditionFalse, condition.Status)
+			assert.Equal(t, tc.wantReason, condition.Reason, condition.Message)
+		})
+	}
+}
+
+func TestNewK8sVersionPrechecker(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported K8sVersionRange
+	}{
+		{name: "invalid min", supported: K8sVersionRange{Min: "1", Max: "v1.19"}},
+		{name: "invalid max", supported: K8sVersionRange{Min: "v1.13.0", Max: "latest"}},
+		{name: "min newer than max", supported: K8sVersionRange{Min: "v1.20.0", Max: "v1.19"}},
+		{name: "negative skew", supported: K8sVersionRange{Min: "v1.13.0", Max: "v1.19", MaxKubeletSkew: -1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewK8sVersionPrechecker(context.Background(), ctrl.Log, nil, nil, tc.supported)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -15,21 +15,21 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const memoryRequest = 2 * 1024 * 1024 * 1024
-
 type memory struct {
-	ctx    context.Context
-	log    logr.Logger
-	client client.Client
+	ctx     context.Context
+	log     logr.Logger
+	client  client.Client
+	request int64
 }
 
-// NewMemory creates a new kubernetes version prechecker.
-func NewMemory(ctx context.Context, log logr.Logger, client client.Client) PreChecker {
+// NewMemory creates a new memory prechecker, which expects the allocatable memory of the nodes to be at least request.
+func NewMemory(ctx context.Context, log logr.Logger, client client.Client, request int64) PreChecker {
 	l := log.WithName("MemoryPrechecker")
 	return &memory{
-		ctx:    ctx,
-		log:    l,
-		client: client,
+		ctx:     ctx,
+		log:     l,
+		client:  client,
+		request: request,
 	}
 }
 
@@ -47,8 +47,8 @@ func (m *memory) Check() rainbondv1alpha1.RainbondClusterCondition {
 
 	nodes = m.filterOut(nodes)
 	totalMemory := totalMemory(nodes)
-	if totalMemory < memoryRequest {
-		return m.failCondition(condition, fmt.Sprintf("expected at least %d memory, but got %d", memoryRequest, totalMemory))
+	if totalMemory < m.request {
+		return m.failCondition(condition, fmt.Sprintf("expected at least %d memory, but got %d", m.request, totalMemory))
 	}
 
 	return condition
@@ -0,0 +1,153 @@
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodePrechecker checks the diagnostics of the nodes, reported by the sentinels.
+type nodePrechecker struct {
+	ctx       context.Context
+	log       logr.Logger
+	client    client.Client
+	scheme    *runtime.Scheme
+	cluster   *rainbondv1alpha1.RainbondCluster
+	diagnoser sentinelutil.Diagnoser
+	typ3      rainbondv1alpha1.RainbondClusterConditionType
+	check     func(diagnostics map[string]*sentinelutil.NodeDiagnostics) (reason, msg string)
+}
+
+// NewDiskPrechecker creates a new disk prechecker, which expects the free disk of the paths reported by the sentinels,
+// such as /opt/rainbond and /var/lib/docker, to be at least minFree bytes on every node.
+func NewDiskPrechecker(ctx context.Context, log logr.Logger, client client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster,
+	diagnoser sentinelutil.Diagnoser, minFree uint64) PreChecker {
+	return &nodePrechecker{
+		ctx:       ctx,
+		log:       log.WithName("DiskPreChecker"),
+		client:    client,
+		scheme:    scheme,
+		cluster:   cluster,
+		diagnoser: diagnoser,
+		typ3:      rainbondv1alpha1.RainbondClusterConditionTypeDisk,
+		check: func(diagnostics map[string]*sentinelutil.NodeDiagnostics) (string, string) {
+			var insufficient []string
+			for _, node := range sortedNodes(diagnostics) {
+				for _, disk := range diagnostics[node].Disks {
+					if disk.Free < minFree {
+						insufficient = append(insufficient, fmt.Sprintf("%s:%s(%s)", node, disk.Path, formatBytes(disk.Free)))
+					}
+				}
+			}
+			if len(insufficient) == 0 {
+				return "", ""
+			}
+			return "DiskInsufficient", fmt.Sprintf("expected at least %s free, but got %s", formatBytes(minFree), strings.Join(insufficient, ", "))
+		},
+	}
+}
+
+// NewTimeSyncPrechecker creates a new time sync prechecker, which expects the time of every node to be
+// within maxOffset of the operator.
+func NewTimeSyncPrechecker(ctx context.Context, log logr.Logger, client client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster,
+	diagnoser sentinelutil.Diagnoser, maxOffset time.Duration) PreChecker {
+	return &nodePrechecker{
+		ctx:       ctx,
+		log:       log.WithName("TimeSyncPreChecker"),
+		client:    client,
+		scheme:    scheme,
+		cluster:   cluster,
+		diagnoser: diagnoser,
+		typ3:      rainbondv1alpha1.RainbondClusterConditionTypeTimeSync,
+		check: func(diagnostics map[string]*sentinelutil.NodeDiagnostics) (string, string) {
+			var offsets []string
+			for _, node := range sortedNodes(diagnostics) {
+				offset := diagnostics[node].TimeOffset
+				switch {
+				case offset > maxOffset:
+					offsets = append(offsets, fmt.Sprintf("%s is %s ahead", node, offset.Round(time.Millisecond)))
+				case offset < -maxOffset:
+					offsets = append(offsets, fmt.Sprintf("%s is %s behind", node, (-offset).Round(time.Millisecond)))
+				}
+			}
+			if len(offsets) == 0 {
+				return "", ""
+			}
+			return "TimeNotSynchronized", fmt.Sprintf("expected the time of the nodes to be within %s of the operator, but %s", maxOffset, strings.Join(offsets, ", "))
+		},
+	}
+}
+
+func (n *nodePrechecker) Check() rainbondv1alpha1.RainbondClusterCondition {
+	condition := rainbondv1alpha1.RainbondClusterCondition{
+		Type:              n.typ3,
+		Status:            corev1.ConditionTrue,
+		LastHeartbeatTime: metav1.NewTime(time.Now()),
+	}
+
+	if msg, err := ensureSentinel(n.ctx, n.client, n.scheme, n.cluster); err != nil {
+		if err == ErrSentinelNotReady {
+			condition.Status = corev1.ConditionUnknown
+			condition.Reason = "SentinelNotReady"
+			condition.Message = msg
+			return condition
+		}
+		return failConditoin(condition, "DiagnosticsFailed", err.Error())
+	}
+
+	diagnostics, errs, err := n.diagnoser.Diagnose(n.ctx, n.cluster.Namespace)
+	if err != nil {
+		return failConditoin(condition, "DiagnosticsFailed", err.Error())
+	}
+	var outdated []string
+	for node, err := range errs {
+		if sentinelutil.IsOutdated(err) {
+			outdated = append(outdated, node)
+			continue
+		}
+		// the container network precheck reports the sentinels which can not be reached.
+		n.log.V(4).Info("get diagnostics", "node", node, "error", err.Error())
+	}
+	if len(outdated) > 0 {
+		sort.Strings(outdated)
+		return failConditoin(condition, "SentinelOutdated", fmt.Sprintf("the sentinel image %s serves no diagnostics on %s, "+
+			"update it to the rainbond-operator-sentinel of the same version as the operator", n.cluster.Spec.SentinelImage, strings.Join(outdated, ", ")))
+	}
+	if len(diagnostics) == 0 {
+		if len(errs) > 0 {
+			return failConditoin(condition, "DiagnosticsFailed", fmt.Sprintf("no diagnostics from the %d sentinels", len(errs)))
+		}
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = "SentinelNotReady"
+		condition.Message = "no sentinel is running"
+		return condition
+	}
+
+	if reason, msg := n.check(diagnostics); reason != "" {
+		return failConditoin(condition, reason, msg)
+	}
+	return condition
+}
+
+func sortedNodes(diagnostics map[string]*sentinelutil.NodeDiagnostics) []string {
+	nodes := make([]string, 0, len(diagnostics))
+	for node := range diagnostics {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func formatBytes(bytes uint64) string {
+	return fmt.Sprintf("%.1fGiB", float64(bytes)/(1<<30))
+}
@@ -0,0 +1,105 @@
+package precheck
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type fakeDiagnoser struct {
+	diagnostics map[string]*sentinelutil.NodeDiagnostics
+	errs        map[string]error
+}
+
+func (f *fakeDiagnoser) Diagnose(ctx context.Context, namespace string) (map[string]*sentinelutil.NodeDiagnostics, map[string]error, error) {
+	return f.diagnostics, f.errs, nil
+}
+
+func TestNodePrecheckers(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	diagnoser := &fakeDiagnoser{
+		diagnostics: map[string]*sentinelutil.NodeDiagnostics{
+			"node1": {
+				Report: sentinelutil.Report{Disks: []sentinelutil.Disk{
+					{Path: "/opt/rainbond", Free: 50 << 30},
+					{Path: "/var/lib/docker", Free: 3 << 29},
+				}},
+				TimeOffset: 12 * time.Second,
+			},
+			"node2": {
+				Report:     sentinelutil.Report{Disks: []sentinelutil.Disk{{Path: "/opt/rainbond", Free: 20 << 30}}},
+				TimeOffset: -time.Second,
+			},
+		},
+	}
+	disk := NewDiskPrechecker(ctx, ctrl.Log, cli, cli.Scheme(), cluster, diagnoser, 10<<30)
+	timeSync := NewTimeSyncPrechecker(ctx, ctrl.Log, cli, cli.Scheme(), cluster, diagnoser, 5*time.Second)
+
+	// the sentinels are created first.
+	condition := disk.Check()
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	assert.Equal(t, "SentinelNotReady", condition.Reason)
+	ds := &appsv1.DaemonSet{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, ds); err != nil {
+		t.Fatal(err)
+	}
+	ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable = 2, 2
+	if err := cli.Update(ctx, ds); err != nil {
+		t.Fatal(err)
+	}
+
+	condition = disk.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "DiskInsufficient", condition.Reason)
+	assert.Equal(t, "expected at least 10.0GiB free, but got node1:/var/lib/docker(1.5GiB)", condition.Message)
+
+	condition = timeSync.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "TimeNotSynchronized", condition.Reason)
+	assert.Contains(t, condition.Message, "node1 is 12s ahead")
+	assert.NotContains(t, condition.Message, "node2")
+
+	diagnoser.diagnostics["node1"].TimeOffset = 0
+	diagnoser.diagnostics["node1"].Disks[1].Free = 10 << 30
+	assert.Equal(t, corev1.ConditionTrue, disk.Check().Status)
+	assert.Equal(t, corev1.ConditionTrue, timeSync.Check().Status)
+
+	// the sentinel on node3 runs an image without the diagnostics.
+	diagnoser.errs = map[string]error{"node3": &sentinelutil.OutdatedError{Addr: "10.0.0.3:8080"}}
+	condition = disk.Check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "SentinelOutdated", condition.Reason)
+	assert.Contains(t, condition.Message, "rainbond/rainbond-operator-sentinel:v2.0.0 serves no diagnostics on node3")
+}
+
+func TestEnsureSentinelUpdatesOldSentinels(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	ds := daemonsetForSentinel(cluster)
+	ds.Spec.Template.Spec.Volumes = nil
+	ds.Spec.Template.Spec.Containers[0].VolumeMounts = nil
+	if err := cli.Create(ctx, ds); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := ensureSentinel(ctx, cli, cli.Scheme(), cluster)
+	assert.Equal(t, ErrSentinelNotReady, err)
+	assert.Equal(t, "updating the sentinels", msg)
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: SentinelName}, ds); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, ds.Spec.Template.Spec.Volumes, 1)
+
+	_, err = ensureSentinel(ctx, cli, cli.Scheme(), cluster)
+	assert.NoError(t, err)
+}
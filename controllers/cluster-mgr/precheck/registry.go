@@ -0,0 +1,339 @@
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Options contains what the prechecks need to check the rainbondcluster.
+type Options struct {
+	Ctx     context.Context
+	Log     logr.Logger
+	Client  client.Client
+	Scheme  *runtime.Scheme
+	Cluster *rainbondv1alpha1.RainbondCluster
+	// ServerVersion gets the version of the api server, the discovery client of k8sutil.GetClientSet is used if nil.
+	ServerVersion discovery.ServerVersionInterface
+	// Diagnoser gets the diagnostics of the nodes, the sentinels are requested if nil.
+	Diagnoser sentinelutil.Diagnoser
+	// Prober asks the sentinels to probe the container network, the sentinels are requested if nil.
+	Prober sentinelutil.Prober
+	// Recorder records the events of the rainbondcluster, no event is recorded if nil.
+	Recorder record.EventRecorder
+}
+
+func (o *Options) diagnoser() sentinelutil.Diagnoser {
+	if o.Diagnoser != nil {
+		return o.Diagnoser
+	}
+	return sentinelutil.NewDiagnoser(o.Client)
+}
+
+func (o *Options) prober() sentinelutil.Prober {
+	if o.Prober != nil {
+		return o.Prober
+	}
+	return sentinelutil.NewProber()
+}
+
+// Parameters are the parameters of a precheck, such as thresholds.
+type Parameters map[string]string
+
+// String returns the parameter, or def if it is not set.
+func (p Parameters) String(key, def string) string {
+	if val, ok := p[key]; ok && val != "" {
+		return val
+	}
+	return def
+}
+
+// Int returns the parameter parsed as an integer, or def if it is not set.
+func (p Parameters) Int(key string, def int) (int, error) {
+	val, ok := p[key]
+	if !ok || val == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return i, nil
+}
+
+// Duration returns the parameter parsed as a duration, such as 5s, or def if it is not set.
+func (p Parameters) Duration(key string, def time.Duration) (time.Duration, error) {
+	val, ok := p[key]
+	if !ok || val == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return d, nil
+}
+
+// Quantity returns the parameter parsed as a quantity, such as 2Gi, or def if it is not set.
+func (p Parameters) Quantity(key string, def resource.Quantity) (resource.Quantity, error) {
+	val, ok := p[key]
+	if !ok || val == "" {
+		return def, nil
+	}
+	quantity, err := resource.ParseQuantity(val)
+	if err != nil {
+		return quantity, fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return quantity, nil
+}
+
+// Precheck is a prechecker registered with its default configuration, which can be overridden by the
+// prechecks of the rainbondcluster spec.
+type Precheck struct {
+	// Name of the precheck, which is the type of the condition reported by its prechecker.
+	Name rainbondv1alpha1.RainbondClusterConditionType
+	// Enabled tells whether the precheck runs.
+	Enabled bool
+	// Severity of the failure of the precheck.
+	Severity rainbondv1alpha1.PrecheckSeverity
+	// Interval to re-run the precheck after it passed. Zero means it is never re-run once passed.
+	Interval time.Duration
+	// Reason of the failed condition if the prechecker can not be created, such as with invalid parameters.
+	Reason string
+	// Parameters of the precheck, which are only set by the spec of the rainbondcluster.
+	Parameters Parameters
+	// Applicable tells whether the precheck applies to the rainbondcluster, nil means it always applies.
+	Applicable func(cluster *rainbondv1alpha1.RainbondCluster) bool
+	// New creates the prechecker with the parameters.
+	New func(opts Options, params Parameters) (PreChecker, error)
+}
+
+// AppliesTo tells whether the precheck is enabled and applies to the rainbondcluster.
+func (p *Precheck) AppliesTo(cluster *rainbondv1alpha1.RainbondCluster) bool {
+	return p.Enabled && (p.Applicable == nil || p.Applicable(cluster))
+}
+
+var registry []Precheck
+
+// Register registers a precheck, which runs after the ones registered before it.
+// It panics if a precheck with the same name has been registered.
+func Register(p Precheck) {
+	for _, registered := range registry {
+		if registered.Name == p.Name {
+			panic(fmt.Sprintf("precheck %s has been registered", p.Name))
+		}
+	}
+	if p.Severity == "" {
+		p.Severity = rainbondv1alpha1.PrecheckSeverityBlocking
+	}
+	registry = append(registry, p)
+}
+
+// Prechecks returns the registered prechecks, with the overrides of the prechecks of the rainbondcluster spec applied.
+func Prechecks(cluster *rainbondv1alpha1.RainbondCluster) []Precheck {
+	configs := make(map[string]*rainbondv1alpha1.PrecheckConfig, len(cluster.Spec.Prechecks))
+	for i := range cluster.Spec.Prechecks {
+		configs[cluster.Spec.Prechecks[i].Name] = &cluster.Spec.Prechecks[i]
+	}
+
+	prechecks := make([]Precheck, 0, len(registry))
+	for _, p := range registry {
+		if config := configs[string(p.Name)]; config != nil {
+			if config.Enabled != nil {
+				p.Enabled = *config.Enabled
+			}
+			if config.Severity != "" {
+				p.Severity = config.Severity
+			}
+			if config.Interval != nil {
+				p.Interval = config.Interval.Duration
+			}
+			p.Parameters = config.Parameters
+		}
+		prechecks = append(prechecks, p)
+	}
+	return prechecks
+}
+
+// IsBlocking tells whether the failure of the condition blocks the installation and the upgrades of the rainbondcluster.
+// The conditions not reported by the registered prechecks are always blocking.
+func IsBlocking(cluster *rainbondv1alpha1.RainbondCluster, typ3 rainbondv1alpha1.RainbondClusterConditionType) bool {
+	for _, p := range Prechecks(cluster) {
+		if p.Name == typ3 {
+			return p.Severity != rainbondv1alpha1.PrecheckSeverityWarning
+		}
+	}
+	return true
+}
+
+func init() {
+	Register(Precheck{
+		Name:    rainbondv1alpha1.RainbondClusterConditionTypeDatabaseRegion,
+		Enabled: true,
+		Reason:  "DatabaseFailed",
+		Applicable: func(cluster *rainbondv1alpha1.RainbondCluster) bool {
+			return cluster.Spec.RegionDatabase != nil
+		},
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			db, err := rbdutil.ResolveDatabase(opts.Ctx, opts.Client, opts.Cluster.Namespace, opts.Cluster.Spec.RegionDatabase)
+			if err != nil {
+				return nil, fmt.Errorf("resolve database password: %v", err)
+			}
+			return NewDatabasePrechecker(rainbondv1alpha1.RainbondClusterConditionTypeDatabaseRegion, db), nil
+		},
+	})
+	Register(Precheck{
+		Name:    rainbondv1alpha1.RainbondClusterConditionTypeImageRepository,
+		Enabled: true,
+		Reason:  "ImageRepositoryFailed",
+		Applicable: func(cluster *rainbondv1alpha1.RainbondCluster) bool {
+			return cluster.Spec.ImageHub != nil
+		},
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewImageRepoPrechecker(opts.Ctx, opts.Log, opts.Client, opts.Cluster), nil
+		},
+	})
+	Register(Precheck{
+		Name:    rainbondv1alpha1.RainbondClusterConditionTypeKubernetesVersion,
+		Enabled: true,
+		Reason:  "KubernetesVersionFailed",
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			supported := SupportedK8sVersions(opts.Cluster.Spec.InstallVersion)
+			supported.Min = params.String("minVersion", supported.Min)
+			supported.Max = params.String("maxVersion", supported.Max)
+			maxKubeletSkew, err := params.Int("maxKubeletSkew", supported.MaxKubeletSkew)
+			if err != nil {
+				return nil, err
+			}
+			supported.MaxKubeletSkew = maxKubeletSkew
+			serverVersion := opts.ServerVersion
+			if serverVersion == nil {
+				serverVersion = k8sutil.GetClientSet().Discovery()
+			}
+			return NewK8sVersionPrechecker(opts.Ctx, opts.Log, opts.Client, serverVersion, supported)
+		},
+	})
+	// the pods in kube-system are not checked by default.
+	Register(Precheck{
+		Name:   rainbondv1alpha1.RainbondClusterConditionTypeKubernetesStatus,
+		Reason: "KubernetesStatusFailed",
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewK8sStatusPrechecker(opts.Ctx, opts.Cluster, opts.Client, opts.Log), nil
+		},
+	})
+	// the test volumes are only mounted again if requested, once they passed.
+	Register(Precheck{
+		Name:    rainbondv1alpha1.RainbondClusterConditionTypeStorage,
+		Enabled: true,
+		Reason:  "StorageFailed",
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewStorage(opts.Ctx, opts.Log, opts.Client, opts.Scheme, opts.Cluster), nil
+		},
+	})
+	Register(Precheck{
+		Name:     rainbondv1alpha1.RainbondClusterConditionTypeDNS,
+		Enabled:  true,
+		Interval: time.Minute,
+		Reason:   "DNSFailed",
+		Applicable: func(cluster *rainbondv1alpha1.RainbondCluster) bool {
+			return cluster.Spec.InstallMode != rainbondv1alpha1.InstallationModeOffline
+		},
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewDNSPrechecker(opts.Cluster, opts.Log), nil
+		},
+	})
+	// the dns of the cluster is required by the components in all install modes.
+	Register(Precheck{
+		Name:       rainbondv1alpha1.RainbondClusterConditionTypeClusterDNS,
+		Enabled:    true,
+		Interval:   time.Minute,
+		Reason:     "ClusterDNSFailed",
+		Applicable: sentinelApplicable,
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewClusterDNSPrechecker(opts.Ctx, opts.Log, opts.Client, opts.Scheme, opts.Cluster, opts.prober(),
+				params.String("clusterDomain", "cluster.local")), nil
+		},
+	})
+	// the suffix http host may only be resolved outside of the cluster, which is reported by default.
+	Register(Precheck{
+		Name:       rainbondv1alpha1.RainbondClusterConditionTypeWildcardDNS,
+		Enabled:    true,
+		Severity:   rainbondv1alpha1.PrecheckSeverityWarning,
+		Interval:   time.Minute,
+		Reason:     "WildcardDNSFailed",
+		Applicable: sentinelApplicable,
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewWildcardDNSPrechecker(opts.Ctx, opts.Log, opts.Client, opts.Scheme, opts.Cluster, opts.prober()), nil
+		},
+	})
+	Register(Precheck{
+		Name:     rainbondv1alpha1.RainbondClusterConditionTypeMemory,
+		Enabled:  true,
+		Interval: time.Minute,
+		Reason:   "MemoryFailed",
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			request, err := params.Quantity("memoryRequest", resource.MustParse("2Gi"))
+			if err != nil {
+				return nil, err
+			}
+			return NewMemory(opts.Ctx, opts.Log, opts.Client, request.Value()), nil
+		},
+	})
+	Register(Precheck{
+		Name:       rainbondv1alpha1.RainbondClusterConditionTypeContainerNetwork,
+		Enabled:    true,
+		Interval:   time.Minute,
+		Reason:     "ContainerNetworkFailed",
+		Applicable: sentinelApplicable,
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			return NewContainerNetworkPrechecker(opts.Ctx, opts.Client, opts.Scheme, opts.Log, opts.Cluster, opts.prober(), opts.Recorder), nil
+		},
+	})
+	Register(Precheck{
+		Name:       rainbondv1alpha1.RainbondClusterConditionTypeDisk,
+		Enabled:    true,
+		Interval:   time.Minute,
+		Reason:     "DiskFailed",
+		Applicable: sentinelApplicable,
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			minFree, err := params.Quantity("minFree", resource.MustParse("10Gi"))
+			if err != nil {
+				return nil, err
+			}
+			return NewDiskPrechecker(opts.Ctx, opts.Log, opts.Client, opts.Scheme, opts.Cluster, opts.diagnoser(), uint64(minFree.Value())), nil
+		},
+	})
+	// the nodes out of sync are only reported by default.
+	Register(Precheck{
+		Name:       rainbondv1alpha1.RainbondClusterConditionTypeTimeSync,
+		Enabled:    true,
+		Severity:   rainbondv1alpha1.PrecheckSeverityWarning,
+		Interval:   time.Minute,
+		Reason:     "TimeSyncFailed",
+		Applicable: sentinelApplicable,
+		New: func(opts Options, params Parameters) (PreChecker, error) {
+			maxOffset, err := params.Duration("maxOffset", 5*time.Second)
+			if err != nil {
+				return nil, err
+			}
+			return NewTimeSyncPrechecker(opts.Ctx, opts.Log, opts.Client, opts.Scheme, opts.Cluster, opts.diagnoser(), maxOffset), nil
+		},
+	})
+}
+
+// sentinelApplicable tells whether the sentinels can run, which the prechecks of the nodes depend on.
+func sentinelApplicable(cluster *rainbondv1alpha1.RainbondCluster) bool {
+	return cluster.Spec.SentinelImage != ""
+}
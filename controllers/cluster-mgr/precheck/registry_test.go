@@ -0,0 +1,95 @@
+package precheck
+
+import (
+	"testing"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func findPrecheck(prechecks []Precheck, name rainbondv1alpha1.RainbondClusterConditionType) *Precheck {
+	for i := range prechecks {
+		if prechecks[i].Name == name {
+			return &prechecks[i]
+		}
+	}
+	return nil
+}
+
+func TestPrechecks(t *testing.T) {
+	disabled, enabled := false, true
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+	cluster.Spec.Prechecks = []rainbondv1alpha1.PrecheckConfig{
+		{Name: "Memory", Severity: rainbondv1alpha1.PrecheckSeverityWarning, Parameters: map[string]string{"memoryRequest": "1Gi"}},
+		{Name: "Storage", Enabled: &disabled},
+		{Name: "KubernetesStatus", Enabled: &enabled, Interval: &metav1.Duration{Duration: 5 * time.Minute}},
+	}
+	prechecks := Prechecks(cluster)
+	assert.Len(t, prechecks, len(registry))
+
+	memory := findPrecheck(prechecks, rainbondv1alpha1.RainbondClusterConditionTypeMemory)
+	if assert.NotNil(t, memory) {
+		assert.True(t, memory.Enabled)
+		assert.Equal(t, rainbondv1alpha1.PrecheckSeverityWarning, memory.Severity)
+		assert.Equal(t, time.Minute, memory.Interval)
+		assert.Equal(t, "1Gi", memory.Parameters["memoryRequest"])
+	}
+	storage := findPrecheck(prechecks, rainbondv1alpha1.RainbondClusterConditionTypeStorage)
+	if assert.NotNil(t, storage) {
+		assert.False(t, storage.AppliesTo(cluster))
+	}
+	k8sStatus := findPrecheck(prechecks, rainbondv1alpha1.RainbondClusterConditionTypeKubernetesStatus)
+	if assert.NotNil(t, k8sStatus) {
+		assert.True(t, k8sStatus.AppliesTo(cluster))
+		assert.Equal(t, 5*time.Minute, k8sStatus.Interval)
+	}
+	// the overrides are not kept in the registry.
+	assert.Equal(t, rainbondv1alpha1.PrecheckSeverityBlocking, findPrecheck(registry, rainbondv1alpha1.RainbondClusterConditionTypeMemory).Severity)
+	assert.False(t, findPrecheck(registry, rainbondv1alpha1.RainbondClusterConditionTypeKubernetesStatus).Enabled)
+
+	// the database precheck only applies if there is a region database.
+	database := findPrecheck(prechecks, rainbondv1alpha1.RainbondClusterConditionTypeDatabaseRegion)
+	if assert.NotNil(t, database) {
+		assert.False(t, database.AppliesTo(cluster))
+	}
+}
+
+func TestIsBlocking(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+	cluster.Spec.Prechecks = []rainbondv1alpha1.PrecheckConfig{
+		{Name: "Memory", Severity: rainbondv1alpha1.PrecheckSeverityWarning},
+	}
+	assert.False(t, IsBlocking(cluster, rainbondv1alpha1.RainbondClusterConditionTypeMemory))
+	assert.True(t, IsBlocking(cluster, rainbondv1alpha1.RainbondClusterConditionTypeStorage))
+	assert.True(t, IsBlocking(cluster, rainbondv1alpha1.RainbondClusterConditionTypeRunning))
+}
+
+func TestParametersQuantity(t *testing.T) {
+	def := resource.MustParse("2Gi")
+	tests := []struct {
+		name    string
+		params  Parameters
+		want    int64
+		wantErr bool
+	}{
+		{name: "default", want: def.Value()},
+		{name: "empty", params: Parameters{"memoryRequest": ""}, want: def.Value()},
+		{name: "override", params: Parameters{"memoryRequest": "512Mi"}, want: 512 * 1024 * 1024},
+		{name: "invalid", params: Parameters{"memoryRequest": "two gigabytes"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			quantity, err := tc.params.Quantity("memoryRequest", def)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, quantity.Value())
+			}
+		})
+	}
+}
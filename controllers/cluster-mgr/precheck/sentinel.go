@@ -0,0 +1,245 @@
+package precheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// SentinelName -
+const SentinelName = sentinelutil.Name
+
+// ErrSentinelNotReady -
+var ErrSentinelNotReady = errors.New("rainbond-operator-sentinel not ready")
+
+// ensureSentinel creates or updates the sentinel DaemonSet, and returns ErrSentinelNotReady with the details
+// until all of its pods are available.
+func ensureSentinel(ctx context.Context, c client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster) (string, error) {
+	desired := daemonsetForSentinel(cluster)
+	ds := &appsv1.DaemonSet{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: cluster.GetNamespace(), Name: SentinelName}, ds)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return "", err
+		}
+		// Set rainboncluster as the owner and controller
+		if err := controllerutil.SetControllerReference(cluster, desired, scheme); err != nil {
+			return "", err
+		}
+		if err := c.Create(ctx, desired); err != nil && !k8sErrors.IsAlreadyExists(err) {
+			return "", err
+		}
+		return "creating the sentinels", ErrSentinelNotReady
+	}
+
+	// the sentinels created by older versions do not mount the host.
+	if !equality.Semantic.DeepDerivative(desired.Spec.Template, ds.Spec.Template) {
+		ds.Spec.Template = desired.Spec.Template
+		if err := c.Update(ctx, ds); err != nil {
+			return "", fmt.Errorf("update sentinels: %v", err)
+		}
+		return "updating the sentinels", ErrSentinelNotReady
+	}
+
+	if ds.Status.NumberAvailable != ds.Status.DesiredNumberScheduled {
+		msg := "desired %d pods to be available, but only got %d"
+		return fmt.Sprintf(msg, ds.Status.DesiredNumberScheduled, ds.Status.NumberAvailable), ErrSentinelNotReady
+	}
+
+	return "", nil
+}
+
+// ensureSentinelService creates the service of the sentinels if it does not exist, which is probed by the sentinels
+// for the service network and the cluster dns.
+func ensureSentinelService(ctx context.Context, c client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster) (*corev1.Service, error) {
+	svc := &corev1.Service{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: cluster.GetNamespace(), Name: SentinelName}, svc)
+	if err == nil {
+		return svc, nil
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	svc = serviceForSentinel(cluster)
+	if err := controllerutil.SetControllerReference(cluster, svc, scheme); err != nil {
+		return nil, err
+	}
+	if err := c.Create(ctx, svc); err != nil {
+		return nil, fmt.Errorf("create sentinel service: %v", err)
+	}
+	return svc, nil
+}
+
+func serviceForSentinel(cluster *rainbondv1alpha1.RainbondCluster) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SentinelName,
+			Namespace: cluster.GetNamespace(),
+			Labels:    sentinelutil.Labels(),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: sentinelutil.Labels(),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       sentinelutil.Port,
+					TargetPort: intstr.FromInt(sentinelutil.Port),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
+// runningSentinels returns the running sentinel pods with their ips, sorted by their nodes.
+func runningSentinels(ctx context.Context, c client.Client, namespace string) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabels(sentinelutil.Labels())); err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.Spec.NodeName == "" {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Spec.NodeName < pods[j].Spec.NodeName
+	})
+	return pods, nil
+}
+
+// probeFromSentinels asks the sentinels to probe the targets in parallel, and returns the results by their nodes,
+// with the errors of the sentinels which can not be requested.
+func probeFromSentinels(ctx context.Context, prober sentinelutil.Prober, pods []corev1.Pod,
+	targets []sentinelutil.ProbeTarget) (map[string][]sentinelutil.ProbeResult, map[string]error) {
+	type result struct {
+		node    string
+		results []sentinelutil.ProbeResult
+		err     error
+	}
+	ch := make(chan result, len(pods))
+	for _, pod := range pods {
+		go func(node, addr string) {
+			results, err := prober.Probe(ctx, addr, targets)
+			ch <- result{node: node, results: results, err: err}
+		}(pod.Spec.NodeName, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(sentinelutil.Port)))
+	}
+
+	results := make(map[string][]sentinelutil.ProbeResult)
+	errs := make(map[string]error)
+	for range pods {
+		r := <-ch
+		if r.err != nil {
+			errs[r.node] = r.err
+			continue
+		}
+		results[r.node] = r.results
+	}
+	return results, errs
+}
+
+// probedNodes returns the nodes of the probe results in order.
+func probedNodes(results map[string][]sentinelutil.ProbeResult) []string {
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func daemonsetForSentinel(cluster *rainbondv1alpha1.RainbondCluster) *appsv1.DaemonSet {
+	labels := sentinelutil.Labels()
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SentinelName,
+			Namespace: cluster.GetNamespace(),
+			Labels:    sentinelutil.Labels(),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   SentinelName,
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: commonutil.Int64(0),
+					ServiceAccountName:            constants.ServiceAccountName,
+					Tolerations: []corev1.Toleration{
+						{
+							Operator: corev1.TolerationOpExists, // tolerate everything.
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            SentinelName,
+							Image:           cluster.Spec.SentinelImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Env: []corev1.EnvVar{
+								{
+									Name: "NODE_NAME",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "http",
+									ContainerPort: sentinelutil.Port,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:             "host",
+									MountPath:        sentinelutil.HostRoot,
+									ReadOnly:         true,
+									MountPropagation: mountPropagation(corev1.MountPropagationHostToContainer),
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "host",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: "/",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func mountPropagation(mode corev1.MountPropagationMode) *corev1.MountPropagationMode {
+	return &mode
+}
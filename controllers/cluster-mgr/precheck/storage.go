@@ -6,29 +6,38 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type storage struct {
-	ctx    context.Context
-	client client.Client
-	ns     string
-	rwx    *rainbondv1alpha1.RainbondVolumeSpec
+	ctx     context.Context
+	log     logr.Logger
+	client  client.Client
+	scheme  *runtime.Scheme
+	cluster *rainbondv1alpha1.RainbondCluster
+	ns      string
+	rwx     *rainbondv1alpha1.RainbondVolumeSpec
 }
 
-//NewStorage -
-func NewStorage(ctx context.Context, client client.Client, ns string, rwx *rainbondv1alpha1.RainbondVolumeSpec) PreChecker {
+// NewStorage creates a new storage prechecker, which checks the foobar pvc, then mounts a test volume from the storage
+// classes of the rainbondcluster on two nodes.
+func NewStorage(ctx context.Context, log logr.Logger, client client.Client, scheme *runtime.Scheme, cluster *rainbondv1alpha1.RainbondCluster) PreChecker {
 	return &storage{
-		ctx:    ctx,
-		client: client,
-		ns:     ns,
-		rwx:    rwx,
+		ctx:     ctx,
+		log:     log.WithName("StoragePreChecker"),
+		client:  client,
+		scheme:  scheme,
+		cluster: cluster,
+		ns:      cluster.Namespace,
+		rwx:     cluster.Spec.RainbondVolumeSpecRWX,
 	}
 }
 
@@ -56,7 +65,7 @@ func (s *storage) Check() rainbondv1alpha1.RainbondClusterCondition {
 				return s.failConditoin(condition, eventListToString(eventList))
 			}
 		}
-		return condition
+		return s.checkVolumes(condition)
 	}
 
 	if s.rwx == nil {
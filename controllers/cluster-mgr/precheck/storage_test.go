@@ -0,0 +1,195 @@
+package precheck
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newStorageTestCluster() *rainbondv1alpha1.RainbondCluster {
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system", UID: "foobar"},
+	}
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	cluster.Spec.RainbondVolumeSpecRWX = &rainbondv1alpha1.RainbondVolumeSpec{StorageClassName: "nfs"}
+	return cluster
+}
+
+func newStorageTestClient(t *testing.T) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	foobar := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: constants.FoobarPVC, Namespace: "rbd-system"}}
+	foobar.Status.Phase = corev1.ClaimBound
+	return fake.NewFakeClientWithScheme(scheme, foobar, newNode("node1", "v1.19.3"), newNode("node2", "v1.19.3"))
+}
+
+// finishTestJob finishes the job with a pod on the node, which terminates with the message.
+func finishTestJob(t *testing.T, cli client.Client, name, node, message string, succeeded bool) {
+	ctx := context.Background()
+	job := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: name}, job); err != nil {
+		t.Fatal(err)
+	}
+	exitCode := int32(0)
+	if succeeded {
+		job.Status.Succeeded = 1
+	} else {
+		job.Status.Failed = 1
+		exitCode = 1
+	}
+	if err := cli.Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name + "-abcde", Namespace: "rbd-system", Labels: map[string]string{"job-name": name}},
+		Spec:       corev1.PodSpec{NodeName: node},
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "precheck", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}}},
+	}
+	if err := cli.Create(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countStorageTestObjects(t *testing.T, cli client.Client) int {
+	jobs := &batchv1.JobList{}
+	if err := cli.List(context.Background(), jobs, client.MatchingLabels(storagePrecheckLabels())); err != nil {
+		t.Fatal(err)
+	}
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := cli.List(context.Background(), pvcs, client.MatchingLabels(storagePrecheckLabels())); err != nil {
+		t.Fatal(err)
+	}
+	return len(jobs.Items) + len(pvcs.Items)
+}
+
+func TestStorageCheckVolumes(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	scheme := cli.Scheme()
+	check := func() rainbondv1alpha1.RainbondClusterCondition {
+		return NewStorage(ctx, ctrl.Log, cli, scheme, cluster).Check()
+	}
+
+	// the test pvc is created first.
+	condition := check()
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-storage-precheck-rwx"}, pvc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}, pvc.Spec.AccessModes)
+	assert.NotEmpty(t, pvc.Annotations[storagePrecheckTokenAnnotation])
+
+	// then the writer.
+	condition = check()
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	writer := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-storage-precheck-rwx-write"}, writer); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pvc.Annotations[storagePrecheckTokenAnnotation], writer.Spec.Template.Spec.Containers[0].Env[0].Value)
+	finishTestJob(t, cli, writer.Name, "node1", "67108864 bytes (67 MB, 64 MiB) copied, 0.5 s, 134 MB/s", true)
+
+	// the reader runs on the other node.
+	condition = check()
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	reader := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-storage-precheck-rwx-read"}, reader); err != nil {
+		t.Fatal(err)
+	}
+	affinity := reader.Spec.Template.Spec.Affinity
+	if assert.NotNil(t, affinity) && assert.NotNil(t, affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution) {
+		term := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0]
+		if assert.Len(t, term.MatchFields, 1) {
+			assert.Equal(t, "metadata.name", term.MatchFields[0].Key)
+			assert.Equal(t, corev1.NodeSelectorOpNotIn, term.MatchFields[0].Operator)
+			assert.Equal(t, []string{"node1"}, term.MatchFields[0].Values)
+		}
+	}
+	finishTestJob(t, cli, reader.Name, "node2", "67108864 bytes (64.0MB) copied, 0.25 seconds, 256.0MB/s", true)
+
+	condition = check()
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "rbd-storage-precheck-rwx(nfs): wrote 64MiB at 128.0MiB/s on node1, read at 256.0MiB/s on node2", condition.Message)
+	assert.Equal(t, 0, countStorageTestObjects(t, cli))
+}
+
+func TestStorageCheckVolumesFailed(t *testing.T) {
+	ctx := context.Background()
+	cli := newStorageTestClient(t)
+	cluster := newStorageTestCluster()
+	cluster.Spec.RainbondVolumeSpecRWO = &rainbondv1alpha1.RainbondVolumeSpec{StorageClassName: "local-path"}
+	scheme := cli.Scheme()
+	check := func() rainbondv1alpha1.RainbondClusterCondition {
+		return NewStorage(ctx, ctrl.Log, cli, scheme, cluster).Check()
+	}
+
+	check()
+	check()
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-storage-precheck-rwx"}, pvc); err != nil {
+		t.Fatal(err)
+	}
+	pvc.Status.Phase = corev1.ClaimBound
+	if err := cli.Update(ctx, pvc); err != nil {
+		t.Fatal(err)
+	}
+	finishTestJob(t, cli, "rbd-storage-precheck-rwx-write", "node1", "sh: can't create /data/token: Permission denied", false)
+
+	condition := check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "StorageWriteFailed", condition.Reason)
+	assert.Contains(t, condition.Message, "Permission denied on node1")
+	assert.Equal(t, 0, countStorageTestObjects(t, cli))
+
+	// the failure is kept while the volumes are tested again.
+	cluster.Status.Conditions = []rainbondv1alpha1.RainbondClusterCondition{condition}
+	condition = check()
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "StorageWriteFailed", condition.Reason)
+	assert.Equal(t, 1, countStorageTestObjects(t, cli))
+}
+
+func TestParseDDThroughput(t *testing.T) {
+	tests := []struct {
+		stats   string
+		want    string
+		wantErr bool
+	}{
+		{stats: "67108864 bytes (67 MB, 64 MiB) copied, 0.5 s, 134 MB/s", want: "128.0MiB/s"},
+		{stats: "67108864 bytes (64.0MB) copied, 0.25 seconds, 256.0MB/s\n", want: "256.0MiB/s"},
+		{stats: "67108864 bytes (67 MB, 64 MiB) copied, 0 s, Infinity B/s", want: "unknown speed"},
+		{stats: "dd: error writing '/data/testfile': No space left on device", wantErr: true},
+		{stats: "", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseDDThroughput(tc.stats)
+		if tc.wantErr {
+			assert.Error(t, err, tc.stats)
+			continue
+		}
+		if assert.NoError(t, err, tc.stats) {
+			assert.Equal(t, tc.want, got)
+		}
+	}
+}
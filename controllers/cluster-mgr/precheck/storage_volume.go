@@ -0,0 +1,428 @@
+package precheck
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/uuidutil"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	storagePrecheckName = "rbd-storage-precheck"
+	// storagePrecheckTokenAnnotation is the annotation of the test pvc, holding the token written by one node
+	// and expected by the other.
+	storagePrecheckTokenAnnotation = "rainbond.io/storage-precheck-token"
+	// storagePrecheckDataSize is the size of the test file in MiB.
+	storagePrecheckDataSize = 64
+	// storagePrecheckDeadline is how long the test jobs may take in seconds, including provisioning the volume.
+	storagePrecheckDeadline  = 180
+	storagePrecheckMountPath = "/data"
+)
+
+// storageVolume is a volume to test, from one of the storage classes of the rainbondcluster.
+type storageVolume struct {
+	name             string
+	accessMode       corev1.PersistentVolumeAccessMode
+	storageClassName string
+}
+
+// storageVolumeError is the failure of a test volume.
+type storageVolumeError struct {
+	reason  string
+	message string
+}
+
+func (e *storageVolumeError) Error() string {
+	return e.message
+}
+
+// checkVolumes mounts a test volume from each storage class of the rainbondcluster on two nodes, writes to it on one node
+// and reads from it on the other. The test volumes take a few reconciles, the condition is unknown until they are done.
+// The jobs and the pvcs are deleted once all of the volumes passed, or one of them failed.
+func (s *storage) checkVolumes(condition rainbondv1alpha1.RainbondClusterCondition) rainbondv1alpha1.RainbondClusterCondition {
+	if s.cluster.Spec.SentinelImage == "" {
+		// there is no image to run the test jobs.
+		return condition
+	}
+
+	var results []string
+	for _, volume := range s.volumesToTest() {
+		result, err := s.testVolume(volume)
+		if err != nil {
+			if err := s.cleanupVolumes(); err != nil {
+				s.log.Error(err, "cleanup test volumes")
+			}
+			if volumeErr, ok := err.(*storageVolumeError); ok {
+				return failConditoin(condition, volumeErr.reason, fmt.Sprintf("%s: %s", volume.name, volumeErr.message))
+			}
+			return s.failConditoin(condition, err.Error())
+		}
+		if result == "" {
+			return s.inProgressCondition(condition, fmt.Sprintf("testing volume %s", volume.name))
+		}
+		results = append(results, result)
+	}
+
+	if err := s.cleanupVolumes(); err != nil {
+		s.log.Error(err, "cleanup test volumes")
+		return s.inProgressCondition(condition, fmt.Sprintf("cleanup test volumes: %v", err))
+	}
+	condition.Message = strings.Join(results, "; ")
+	return condition
+}
+
+// inProgressCondition returns the condition of the test volumes in progress.
+// The previous failure is kept while they are tested again, so that the rainbondcluster does not flap between failed and prechecking.
+func (s *storage) inProgressCondition(condition rainbondv1alpha1.RainbondClusterCondition, msg string) rainbondv1alpha1.RainbondClusterCondition {
+	if _, previous := s.cluster.Status.GetCondition(rainbondv1alpha1.RainbondClusterConditionTypeStorage); previous != nil && previous.Status == corev1.ConditionFalse {
+		return *previous
+	}
+	condition.Status = corev1.ConditionUnknown
+	condition.Reason = "InProgress"
+	condition.Message = msg
+	return condition
+}
+
+func (s *storage) volumesToTest() []storageVolume {
+	var volumes []storageVolume
+	if s.rwx != nil && s.rwx.StorageClassName != "" {
+		volumes = append(volumes, storageVolume{
+			name:             storagePrecheckName + "-rwx",
+			accessMode:       corev1.ReadWriteMany,
+			storageClassName: s.rwx.StorageClassName,
+		})
+	}
+	if rwo := s.cluster.Spec.RainbondVolumeSpecRWO; rwo != nil && rwo.StorageClassName != "" {
+		volumes = append(volumes, storageVolume{
+			name:             storagePrecheckName + "-rwo",
+			accessMode:       corev1.ReadWriteOnce,
+			storageClassName: rwo.StorageClassName,
+		})
+	}
+	return volumes
+}
+
+// testVolume moves the test of the volume forward, and returns its result once it passed, or an empty string if it is in progress.
+func (s *storage) testVolume(volume storageVolume) (string, error) {
+	pvc, err := s.ensureTestPVC(volume)
+	if err != nil || pvc == nil {
+		return "", err
+	}
+
+	writer, err := s.ensureTestJob(s.writerJob(volume, pvc))
+	if err != nil {
+		return "", err
+	}
+	written, writerNode, done, err := s.testJobResult(writer)
+	if err != nil {
+		if !s.isPVCBound(pvc) {
+			return "", &storageVolumeError{reason: "StorageProvisionFailed", message: fmt.Sprintf("pvc is not bound: %v", err)}
+		}
+		return "", &storageVolumeError{reason: "StorageWriteFailed", message: err.Error()}
+	}
+	if !done {
+		return "", nil
+	}
+
+	reader, err := s.readerJob(volume, pvc, writerNode)
+	if err != nil {
+		return "", err
+	}
+	if reader, err = s.ensureTestJob(reader); err != nil {
+		return "", err
+	}
+	read, readerNode, done, err := s.testJobResult(reader)
+	if err != nil {
+		return "", &storageVolumeError{reason: "StorageReadFailed", message: err.Error()}
+	}
+	if !done {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%s(%s): wrote %dMiB at %s on %s, read at %s on %s",
+		volume.name, volume.storageClassName, storagePrecheckDataSize, written, writerNode, read, readerNode), nil
+}
+
+// ensureTestPVC returns the test pvc of the volume, or creates it and returns nil.
+// Nil is also returned while the previous test pvc is being deleted, or after it is deleted because the storage class of the volume changed.
+func (s *storage) ensureTestPVC(volume storageVolume) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := s.client.Get(s.ctx, types.NamespacedName{Namespace: s.ns, Name: volume.name}, pvc)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get pvc %s: %v", volume.name, err)
+	}
+	if err == nil {
+		if pvc.DeletionTimestamp != nil {
+			return nil, nil
+		}
+		if commonutil.StringValue(pvc.Spec.StorageClassName) == volume.storageClassName {
+			return pvc, nil
+		}
+		s.log.Info("storage class changed, test the volume again", "pvc", pvc.Name)
+		return nil, s.cleanupVolumes()
+	}
+
+	pvc = k8sutil.PersistentVolumeClaimForGrdata(s.ns, volume.name, []corev1.PersistentVolumeAccessMode{volume.accessMode},
+		storagePrecheckLabels(), volume.storageClassName, 1)
+	pvc.Annotations = map[string]string{storagePrecheckTokenAnnotation: uuidutil.NewUUID()}
+	if err := controllerutil.SetControllerReference(s.cluster, pvc, s.scheme); err != nil {
+		return nil, fmt.Errorf("set controller reference for pvc %s: %v", pvc.Name, err)
+	}
+	if err := s.client.Create(s.ctx, pvc); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("create pvc %s: %v", pvc.Name, err)
+	}
+	return nil, nil
+}
+
+// ensureTestJob returns the test job, or creates it. The test job is in progress while the previous one is being deleted.
+func (s *storage) ensureTestJob(job *batchv1.Job) (*batchv1.Job, error) {
+	existing := &batchv1.Job{}
+	err := s.client.Get(s.ctx, types.NamespacedName{Namespace: job.Namespace, Name: job.Name}, existing)
+	if err == nil {
+		if existing.DeletionTimestamp != nil {
+			return job, nil
+		}
+		return existing, nil
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get job %s: %v", job.Name, err)
+	}
+	if err := controllerutil.SetControllerReference(s.cluster, job, s.scheme); err != nil {
+		return nil, fmt.Errorf("set controller reference for job %s: %v", job.Name, err)
+	}
+	if err := s.client.Create(s.ctx, job); err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("create job %s: %v", job.Name, err)
+	}
+	return job, nil
+}
+
+// testJobResult returns the throughput measured by the test job and the node it ran on, once the job is done.
+func (s *storage) testJobResult(job *batchv1.Job) (string, string, bool, error) {
+	failed := job.Status.Failed > 0
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			failed = true
+		}
+	}
+	if !failed && job.Status.Succeeded == 0 {
+		return "", "", false, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := s.client.List(s.ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return "", "", false, fmt.Errorf("list pods of job %s: %v", job.Name, err)
+	}
+	var node, message string
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+			node, message = pod.Spec.NodeName, strings.TrimSpace(status.State.Terminated.Message)
+		}
+	}
+
+	if failed {
+		if message == "" {
+			message = jobFailure(job)
+		}
+		if node != "" {
+			message = fmt.Sprintf("%s on %s", message, node)
+		}
+		return "", "", false, fmt.Errorf("job %s failed: %s", job.Name, message)
+	}
+	throughput, err := parseDDThroughput(message)
+	if err != nil {
+		return "", "", false, fmt.Errorf("job %s: %v", job.Name, err)
+	}
+	return throughput, node, true, nil
+}
+
+func jobFailure(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Message != "" {
+			return condition.Message
+		}
+	}
+	return "unknown error"
+}
+
+// cleanupVolumes deletes the test jobs and the test pvcs.
+func (s *storage) cleanupVolumes() error {
+	jobs := &batchv1.JobList{}
+	if err := s.client.List(s.ctx, jobs, client.InNamespace(s.ns), client.MatchingLabels(storagePrecheckLabels())); err != nil {
+		return fmt.Errorf("list test jobs: %v", err)
+	}
+	for i := range jobs.Items {
+		if err := s.client.Delete(s.ctx, &jobs.Items[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !k8sErrors.IsNotFound(err) {
+			return fmt.Errorf("delete job %s: %v", jobs.Items[i].Name, err)
+		}
+	}
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := s.client.List(s.ctx, pvcs, client.InNamespace(s.ns), client.MatchingLabels(storagePrecheckLabels())); err != nil {
+		return fmt.Errorf("list test pvcs: %v", err)
+	}
+	for i := range pvcs.Items {
+		if err := s.client.Delete(s.ctx, &pvcs.Items[i]); err != nil && !k8sErrors.IsNotFound(err) {
+			return fmt.Errorf("delete pvc %s: %v", pvcs.Items[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// writerJob returns the job writing the token and the test file to the volume.
+func (s *storage) writerJob(volume storageVolume, pvc *corev1.PersistentVolumeClaim) *batchv1.Job {
+	script := fmt.Sprintf(`set -e
+echo "$TOKEN" > %[1]s/token
+dd if=/dev/zero of=%[1]s/testfile bs=1M count=%[2]d conv=fsync 2> /tmp/dd || { cat /tmp/dd >&2; exit 1; }
+tail -n 1 /tmp/dd > /dev/termination-log`, storagePrecheckMountPath, storagePrecheckDataSize)
+	return s.testJob(volume.name+"-write", pvc, script, nil)
+}
+
+// readerJob returns the job checking the token and reading the test file from the volume, on another node than the writer.
+// A ReadWriteMany volume must be read on another node if there is one, a ReadWriteOnce volume may be bound to the node of the writer.
+func (s *storage) readerJob(volume storageVolume, pvc *corev1.PersistentVolumeClaim, writerNode string) (*batchv1.Job, error) {
+	script := fmt.Sprintf(`set -e
+test "$(cat %[1]s/token)" = "$TOKEN" || { echo "the token written on the other node is not found" >&2; exit 1; }
+dd if=%[1]s/testfile of=/dev/null bs=1M 2> /tmp/dd || { cat /tmp/dd >&2; exit 1; }
+tail -n 1 /tmp/dd > /dev/termination-log`, storagePrecheckMountPath)
+
+	// the node is matched by its name, which is not necessarily the same as its hostname label.
+	otherNode := corev1.NodeSelectorTerm{
+		MatchFields: []corev1.NodeSelectorRequirement{
+			{Key: "metadata.name", Operator: corev1.NodeSelectorOpNotIn, Values: []string{writerNode}},
+		},
+	}
+	affinity := &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+			{Weight: 100, Preference: otherNode},
+		},
+	}
+	if volume.accessMode == corev1.ReadWriteMany {
+		nodes, err := k8sutil.ListNodes(s.ctx, s.client)
+		if err != nil {
+			return nil, fmt.Errorf("list nodes: %v", err)
+		}
+		schedulable := 0
+		for _, node := range nodes {
+			if !node.Spec.Unschedulable {
+				schedulable++
+			}
+		}
+		if schedulable > 1 {
+			affinity = &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{otherNode},
+				},
+			}
+		}
+	}
+	return s.testJob(volume.name+"-read", pvc, script, affinity), nil
+}
+
+func (s *storage) testJob(name string, pvc *corev1.PersistentVolumeClaim, script string, affinity *corev1.NodeAffinity) *batchv1.Job {
+	labels := storagePrecheckLabels()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.ns,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          commonutil.Int32(0),
+			ActiveDeadlineSeconds: commonutil.Int64(storagePrecheckDeadline),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                 corev1.RestartPolicyNever,
+					TerminationGracePeriodSeconds: commonutil.Int64(0),
+					Tolerations: []corev1.Toleration{
+						{
+							Operator: corev1.TolerationOpExists,
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:                     "precheck",
+							Image:                    s.cluster.Spec.SentinelImage,
+							ImagePullPolicy:          corev1.PullIfNotPresent,
+							Command:                  []string{"/bin/sh", "-c", script},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TOKEN",
+									Value: pvc.Annotations[storagePrecheckTokenAnnotation],
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "data",
+									MountPath: storagePrecheckMountPath,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvc.Name,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if affinity != nil {
+		job.Spec.Template.Spec.Affinity = &corev1.Affinity{NodeAffinity: affinity}
+	}
+	return job
+}
+
+func storagePrecheckLabels() map[string]string {
+	return rbdutil.LabelsForRainbond(map[string]string{"name": storagePrecheckName})
+}
+
+// ddStatsRE matches the last line of the statistics of dd, such as
+// "67108864 bytes (67 MB, 64 MiB) copied, 0.5 s, 134 MB/s" of coreutils, or
+// "67108864 bytes (64.0MB) copied, 0.5 seconds, 128.0MB/s" of busybox.
+var ddStatsRE = regexp.MustCompile(`^(\d+) bytes .*copied, ([0-9.]+) s(?:econds)?,`)
+
+// parseDDThroughput returns the throughput in the statistics of dd, such as 128.0MiB/s.
+func parseDDThroughput(stats string) (string, error) {
+	match := ddStatsRE.FindStringSubmatch(strings.TrimSpace(stats))
+	if match == nil {
+		return "", fmt.Errorf("unexpected dd statistics %q", stats)
+	}
+	bytes, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return "", fmt.Errorf("unexpected dd statistics %q: %v", stats, err)
+	}
+	seconds, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return "", fmt.Errorf("unexpected dd statistics %q: %v", stats, err)
+	}
+	if seconds <= 0 {
+		// too fast to be measured.
+		return "unknown speed", nil
+	}
+	return fmt.Sprintf("%.1fMiB/s", bytes/seconds/1024/1024), nil
+}
@@ -0,0 +1,104 @@
+package clustermgr
+
+import (
+	"strings"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/controllers/cluster-mgr/precheck"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runPrechecks runs the registered prechecks which are due, and updates their conditions.
+// A precheck is due if it has not passed, its interval has elapsed since the last run, or it is requested to re-run
+// through the annotation. The conditions of the prechecks which are disabled or do not apply are removed.
+func (r *RainbondClusteMgr) runPrechecks() {
+	opts := precheck.Options{
+		Ctx:           r.ctx,
+		Log:           r.log,
+		Client:        r.client,
+		Scheme:        r.scheme,
+		Cluster:       r.cluster,
+		ServerVersion: r.serverVersion,
+		Diagnoser:     r.diagnoser,
+		Recorder:      r.recorder,
+	}
+	rerun, rerunAll := r.prechecksToRerun()
+	r.nextPrecheck = 0
+	for _, p := range precheck.Prechecks(r.cluster) {
+		if !p.AppliesTo(r.cluster) {
+			r.cluster.Status.DeleteCondition(p.Name)
+			continue
+		}
+
+		if !rerunAll && !rerun[string(p.Name)] {
+			wait, due := r.precheckDue(&p)
+			if !due {
+				if wait > 0 && (r.nextPrecheck == 0 || wait < r.nextPrecheck) {
+					r.nextPrecheck = wait
+				}
+				continue
+			}
+		}
+
+		condition := runPrecheck(&p, opts)
+		r.cluster.Status.UpdateCondition(&condition)
+		if condition.Status == corev1.ConditionTrue && p.Interval > 0 && (r.nextPrecheck == 0 || p.Interval < r.nextPrecheck) {
+			r.nextPrecheck = p.Interval
+		}
+	}
+}
+
+// NextPrecheck returns how long until a passed precheck is due to re-run, or zero if none will be.
+func (r *RainbondClusteMgr) NextPrecheck() time.Duration {
+	return r.nextPrecheck
+}
+
+// IsBlockingCondition tells whether the failure of the condition blocks the installation and the upgrades.
+func (r *RainbondClusteMgr) IsBlockingCondition(typ3 rainbondv1alpha1.RainbondClusterConditionType) bool {
+	return precheck.IsBlocking(r.cluster, typ3)
+}
+
+// precheckDue tells whether the precheck is due to run, or how long until it is.
+func (r *RainbondClusteMgr) precheckDue(p *precheck.Precheck) (time.Duration, bool) {
+	_, condition := r.cluster.Status.GetCondition(p.Name)
+	if condition == nil || condition.Status != corev1.ConditionTrue {
+		return 0, true
+	}
+	if p.Interval <= 0 {
+		return 0, false
+	}
+	wait := time.Until(condition.LastHeartbeatTime.Add(p.Interval))
+	return wait, wait <= 0
+}
+
+// prechecksToRerun returns the prechecks requested to re-run through the annotation, or true if all of them are.
+func (r *RainbondClusteMgr) prechecksToRerun() (map[string]bool, bool) {
+	value, ok := r.cluster.Annotations[constants.RerunPrechecksAnnotation]
+	if !ok {
+		return nil, false
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, true
+	}
+	names := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		names[strings.TrimSpace(name)] = true
+	}
+	return names, false
+}
+
+func runPrecheck(p *precheck.Precheck, opts precheck.Options) rainbondv1alpha1.RainbondClusterCondition {
+	prechecker, err := p.New(opts, p.Parameters)
+	if err != nil {
+		return rbdutil.FailCondition(rainbondv1alpha1.RainbondClusterCondition{
+			Type:              p.Name,
+			LastHeartbeatTime: metav1.Now(),
+		}, p.Reason, err.Error())
+	}
+	return prechecker.Check()
+}
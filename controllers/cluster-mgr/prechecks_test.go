@@ -0,0 +1,78 @@
+package clustermgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func getConditionStatus(cluster *rainbondv1alpha1.RainbondCluster, typ3 rainbondv1alpha1.RainbondClusterConditionType) corev1.ConditionStatus {
+	_, condition := cluster.Status.GetCondition(typ3)
+	if condition == nil {
+		return ""
+	}
+	return condition.Status
+}
+
+func TestRunPrechecks(t *testing.T) {
+	scheme := newUpgradeTestScheme(t)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	node.Status.NodeInfo.KubeletVersion = "v1.19.3"
+	node.Status.Allocatable = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}
+	cli := fake.NewFakeClientWithScheme(scheme, node)
+
+	disabled := false
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.InstallMode = rainbondv1alpha1.InstallationModeOffline
+	cluster.Spec.Prechecks = []rainbondv1alpha1.PrecheckConfig{
+		{Name: "Storage", Enabled: &disabled},
+		{Name: "Memory", Severity: rainbondv1alpha1.PrecheckSeverityWarning},
+		{Name: "KubernetesVersion", Interval: &metav1.Duration{Duration: 10 * time.Minute}},
+	}
+	cluster.Status.Conditions = []rainbondv1alpha1.RainbondClusterCondition{
+		{Type: rainbondv1alpha1.RainbondClusterConditionTypeStorage, Status: corev1.ConditionFalse},
+	}
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	mgr.serverVersion = &fakediscovery.FakeDiscovery{
+		Fake:               &k8stesting.Fake{},
+		FakedServerVersion: &version.Info{GitVersion: "v1.19.3"},
+	}
+
+	mgr.runPrechecks()
+	assert.Equal(t, corev1.ConditionStatus(""), getConditionStatus(cluster, rainbondv1alpha1.RainbondClusterConditionTypeStorage))
+	assert.Equal(t, corev1.ConditionTrue, getConditionStatus(cluster, rainbondv1alpha1.RainbondClusterConditionTypeKubernetesVersion))
+	assert.Equal(t, corev1.ConditionFalse, getConditionStatus(cluster, rainbondv1alpha1.RainbondClusterConditionTypeMemory))
+	assert.Equal(t, 10*time.Minute, mgr.NextPrecheck())
+
+	// the failed memory precheck is only a warning.
+	assert.False(t, mgr.IsBlockingCondition(rainbondv1alpha1.RainbondClusterConditionTypeMemory))
+	cluster.Spec.ConfigCompleted = true
+	assert.Equal(t, rainbondv1alpha1.RainbondClusterPhaseInstalling, mgr.phase(cluster.Status.Conditions, false))
+
+	// the passed precheck is not due yet.
+	node.Status.NodeInfo.KubeletVersion = "v1.12.1"
+	if err := cli.Update(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	mgr.runPrechecks()
+	assert.Equal(t, corev1.ConditionTrue, getConditionStatus(cluster, rainbondv1alpha1.RainbondClusterConditionTypeKubernetesVersion))
+	assert.True(t, mgr.NextPrecheck() > 0 && mgr.NextPrecheck() <= 10*time.Minute)
+
+	// unless it is requested to re-run.
+	cluster.Annotations = map[string]string{constants.RerunPrechecksAnnotation: "KubernetesVersion"}
+	mgr.runPrechecks()
+	assert.Equal(t, corev1.ConditionFalse, getConditionStatus(cluster, rainbondv1alpha1.RainbondClusterConditionTypeKubernetesVersion))
+	assert.Equal(t, rainbondv1alpha1.RainbondClusterPhaseFailed, mgr.phase(cluster.Status.Conditions, false))
+}
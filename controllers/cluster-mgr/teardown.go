@@ -0,0 +1,418 @@
+package clustermgr
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/controllers/handler"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// teardownStep deletes the objects of a step, and returns the ones not gone yet.
+type teardownStep struct {
+	step rainbondv1alpha1.TeardownStep
+	run  func() ([]string, error)
+}
+
+// Teardown cleans up the resources left by the deleted cluster step by step, and records the progress in its status.
+// A step does not start until the objects of the previous one are gone, so that no pod is using the volumes being deleted.
+// The PersistentVolumeClaims, PersistentVolumes and the hostPath data are retained if RetainData is set.
+// The hostPath data failed to be deleted is left on the nodes, and reported in the message of the following steps.
+// It returns true once everything is gone.
+func (r *RainbondClusteMgr) Teardown() (bool, error) {
+	r.leftData = nil
+	steps := []teardownStep{
+		{step: rainbondv1alpha1.TeardownStepRbdComponents, run: r.deleteRbdComponents},
+		{step: rainbondv1alpha1.TeardownStepPersistentVolumeClaims, run: r.deletePersistentVolumeClaims},
+		{step: rainbondv1alpha1.TeardownStepHostPathData, run: r.deleteHostPathData},
+		{step: rainbondv1alpha1.TeardownStepPersistentVolumes, run: r.deletePersistentVolumes},
+		{step: rainbondv1alpha1.TeardownStepRainbondVolumes, run: r.deleteRainbondVolumes},
+		{step: rainbondv1alpha1.TeardownStepClusterScopedResources, run: r.deleteClusterScopedResources},
+	}
+	for _, s := range steps {
+		remaining, err := s.run()
+		if err != nil {
+			r.cluster.Status.Teardown = &rainbondv1alpha1.TeardownStatus{Step: s.step, Message: err.Error()}
+			return false, err
+		}
+		if len(remaining) > 0 {
+			message := fmt.Sprintf("waiting for %d objects to be deleted", len(remaining))
+			if len(r.leftData) > 0 {
+				message = fmt.Sprintf("%s, hostPath data left on the nodes: %s", message, strings.Join(r.leftData, "; "))
+			}
+			r.cluster.Status.Teardown = &rainbondv1alpha1.TeardownStatus{
+				Step:      s.step,
+				Remaining: remaining,
+				Message:   message,
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// deleteRbdComponents deletes the rbdcomponents, and waits for their pods to be gone.
+// The pods of the sentinels and the volume plugins are left to the cluster and the rainbondvolumes,
+// the volume plugins are still needed to delete the volumes in the following steps.
+func (r *RainbondClusteMgr) deleteRbdComponents() ([]string, error) {
+	rbdcomponents, err := r.listRbdComponents()
+	if err != nil {
+		return nil, fmt.Errorf("list rbdcomponents: %v", err)
+	}
+	var remaining []string
+	for i := range rbdcomponents {
+		if err := r.deleteObject(&rbdcomponents[i]); err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "RbdComponent/"+rbdcomponents[i].Name)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.client.List(r.ctx, pods, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(rbdutil.LabelsForRainbond(nil))); err != nil {
+		return nil, fmt.Errorf("list pods: %v", err)
+	}
+	workloadOwners := make(map[string]*metav1.OwnerReference)
+	for i := range pods.Items {
+		// the pods of the snapshot and cleanup jobs are garbage collected along with the cluster.
+		if owner := metav1.GetControllerOf(&pods.Items[i]); owner != nil && owner.Kind == "Job" {
+			continue
+		}
+		if k8sutil.IsPodCompleted(&pods.Items[i]) {
+			continue
+		}
+		owner, err := r.workloadOwnerOf(&pods.Items[i], workloadOwners)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil && owner.Kind != "RbdComponent" {
+			continue
+		}
+		remaining = append(remaining, "Pod/"+pods.Items[i].Name)
+	}
+	return remaining, nil
+}
+
+// workloadOwnerOf returns the controller of the workload the pod belongs to, or nil if it is unknown,
+// because the pod is not created by a workload, or the workload is gone. owners caches the controllers by workload.
+func (r *RainbondClusteMgr) workloadOwnerOf(pod *corev1.Pod, owners map[string]*metav1.OwnerReference) (*metav1.OwnerReference, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+	if ref.Kind == "ReplicaSet" {
+		rs := &appsv1.ReplicaSet{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, rs); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("get replicaset %s: %v", ref.Name, err)
+		}
+		if ref = metav1.GetControllerOf(rs); ref == nil {
+			return nil, nil
+		}
+	}
+
+	key := ref.Kind + "/" + ref.Name
+	if owner, ok := owners[key]; ok {
+		return owner, nil
+	}
+	var workload client.Object
+	switch ref.Kind {
+	case "Deployment":
+		workload = &appsv1.Deployment{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	case "DaemonSet":
+		workload = &appsv1.DaemonSet{}
+	default:
+		return nil, nil
+	}
+	var owner *metav1.OwnerReference
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, workload); err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("get %s: %v", key, err)
+		}
+	} else {
+		owner = metav1.GetControllerOf(workload)
+	}
+	owners[key] = owner
+	return owner, nil
+}
+
+// deletePersistentVolumeClaims deletes the PersistentVolumeClaims created for rainbond.
+func (r *RainbondClusteMgr) deletePersistentVolumeClaims() ([]string, error) {
+	if r.cluster.Spec.RetainData {
+		return nil, nil
+	}
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.client.List(r.ctx, pvcs, client.InNamespace(r.cluster.Namespace), client.MatchingLabels(rbdutil.LabelsForRainbond(nil))); err != nil {
+		return nil, fmt.Errorf("list persistent volume claims: %v", err)
+	}
+	var remaining []string
+	for i := range pvcs.Items {
+		if err := r.deleteObject(&pvcs.Items[i]); err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "PersistentVolumeClaim/"+pvcs.Items[i].Name)
+	}
+	return remaining, nil
+}
+
+// deleteHostPathData runs a job on the node of each hostPath PersistentVolume of rainbond released from the namespace, to delete its data.
+// The jobs are run with the sentinel image, the data is left on nodes if the sentinel image is not set,
+// or the job fails, which is to be deleted by hand.
+func (r *RainbondClusteMgr) deleteHostPathData() ([]string, error) {
+	if r.cluster.Spec.RetainData {
+		return nil, nil
+	}
+	pvs, err := r.listReleasedPersistentVolumes()
+	if err != nil {
+		return nil, err
+	}
+	var remaining []string
+	for i := range pvs {
+		pv := &pvs[i]
+		if pv.Spec.HostPath == nil {
+			continue
+		}
+		job := hostPathCleanupJob(pv, r.cluster)
+		if job == nil {
+			r.log.Info("hostPath data can not be deleted, leave it on the node", "pv", pv.Name, "path", pv.Spec.HostPath.Path)
+			continue
+		}
+
+		existing := &batchv1.Job{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: job.Namespace, Name: job.Name}, existing); err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				return nil, fmt.Errorf("get job %s: %v", job.Name, err)
+			}
+			if err := controllerutil.SetControllerReference(r.cluster, job, r.scheme); err != nil {
+				return nil, fmt.Errorf("set controller reference for job %s: %v", job.Name, err)
+			}
+			if err := r.client.Create(r.ctx, job); err != nil {
+				if k8sErrors.IsForbidden(err) {
+					// the namespace is being terminated.
+					r.log.Info("hostPath data can not be deleted, leave it on the node", "pv", pv.Name, "path", pv.Spec.HostPath.Path, "reason", err.Error())
+					continue
+				}
+				return nil, fmt.Errorf("create job %s: %v", job.Name, err)
+			}
+			remaining = append(remaining, "Job/"+job.Name)
+			continue
+		}
+		if failed := jobFailedCondition(existing); failed != nil {
+			left := fmt.Sprintf("%s on node %s, job %s failed: %s", pv.Spec.HostPath.Path, persistentVolumeNode(pv), job.Name, failed.Message)
+			r.log.Info("hostPath data can not be deleted, leave it on the node", "pv", pv.Name, "path", pv.Spec.HostPath.Path,
+				"node", persistentVolumeNode(pv), "job", job.Name, "reason", failed.Message)
+			r.leftData = append(r.leftData, left)
+			continue
+		}
+		if existing.Status.Succeeded == 0 {
+			remaining = append(remaining, "Job/"+job.Name)
+		}
+	}
+	return remaining, nil
+}
+
+// jobFailedCondition returns the failed condition of the job, or nil if it has not failed.
+func jobFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// persistentVolumeNode returns the node the PersistentVolume is bound to by its node affinity.
+func persistentVolumeNode(pv *corev1.PersistentVolume) string {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return "unknown"
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == corev1.LabelHostname && expr.Operator == corev1.NodeSelectorOpIn && len(expr.Values) > 0 {
+				return strings.Join(expr.Values, ",")
+			}
+		}
+	}
+	return "unknown"
+}
+
+// deletePersistentVolumes deletes the PersistentVolumes of rainbond released from the namespace.
+func (r *RainbondClusteMgr) deletePersistentVolumes() ([]string, error) {
+	if r.cluster.Spec.RetainData {
+		return nil, nil
+	}
+	pvs, err := r.listReleasedPersistentVolumes()
+	if err != nil {
+		return nil, err
+	}
+	var remaining []string
+	for i := range pvs {
+		if err := r.deleteObject(&pvs[i]); err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "PersistentVolume/"+pvs[i].Name)
+	}
+	return remaining, nil
+}
+
+// deleteRainbondVolumes deletes the rainbondvolumes, whose finalizers clean up their storage classes and csi plugins.
+func (r *RainbondClusteMgr) deleteRainbondVolumes() ([]string, error) {
+	volumes := &rainbondv1alpha1.RainbondVolumeList{}
+	if err := r.client.List(r.ctx, volumes, client.InNamespace(r.cluster.Namespace)); err != nil {
+		return nil, fmt.Errorf("list rainbondvolumes: %v", err)
+	}
+	var remaining []string
+	for i := range volumes.Items {
+		if err := r.deleteObject(&volumes.Items[i]); err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, "RainbondVolume/"+volumes.Items[i].Name)
+	}
+	return remaining, nil
+}
+
+// deleteClusterScopedResources deletes the cluster-scoped resources created by the rbdcomponents.
+func (r *RainbondClusteMgr) deleteClusterScopedResources() ([]string, error) {
+	apiservice, err := handler.MetricsAPIService(r.ctx, r.client, r.cluster.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if apiservice == nil {
+		return nil, nil
+	}
+	if err := r.deleteObject(apiservice); err != nil {
+		return nil, err
+	}
+	return []string{"APIService/" + apiservice.Name}, nil
+}
+
+// listReleasedPersistentVolumes lists the PersistentVolumes of rainbond claimed from the namespace, but not bound anymore.
+// The PersistentVolumes of rainbond are the ones created for the rbdcomponents, and the ones provisioned by the
+// storage classes created for the rainbondvolumes. The others in the namespace are left to their owners.
+func (r *RainbondClusteMgr) listReleasedPersistentVolumes() ([]corev1.PersistentVolume, error) {
+	volumes := &rainbondv1alpha1.RainbondVolumeList{}
+	if err := r.client.List(r.ctx, volumes, client.InNamespace(r.cluster.Namespace)); err != nil {
+		return nil, fmt.Errorf("list rainbondvolumes: %v", err)
+	}
+	storageClasses := make(map[string]bool)
+	for _, volume := range volumes.Items {
+		if volume.Spec.StorageClassParameters != nil && volume.Spec.StorageClassName != "" {
+			storageClasses[volume.Spec.StorageClassName] = true
+		}
+	}
+
+	pvList := &corev1.PersistentVolumeList{}
+	if err := r.client.List(r.ctx, pvList); err != nil {
+		return nil, fmt.Errorf("list persistent volumes: %v", err)
+	}
+	created := labels.SelectorFromSet(rbdutil.LabelsForClusterScoped(r.cluster.Namespace, nil))
+	var pvs []corev1.PersistentVolume
+	for _, pv := range pvList.Items {
+		if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.Namespace != r.cluster.Namespace {
+			continue
+		}
+		if !created.Matches(labels.Set(pv.Labels)) && !storageClasses[pv.Spec.StorageClassName] {
+			continue
+		}
+		if pv.Status.Phase == corev1.VolumeBound {
+			continue
+		}
+		pvs = append(pvs, pv)
+	}
+	return pvs, nil
+}
+
+// deleteObject deletes the object in the background, unless it is being deleted.
+func (r *RainbondClusteMgr) deleteObject(obj client.Object) error {
+	if obj.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	if err := r.client.Delete(r.ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("delete %s: %v", obj.GetName(), err)
+	}
+	return nil
+}
+
+// hostPathCleanupJob returns the job deleting the hostPath data of the PersistentVolume on its node,
+// or nil if the job can not be run, because the node or the image is unknown, or the path is not safe to delete.
+func hostPathCleanupJob(pv *corev1.PersistentVolume, cluster *rainbondv1alpha1.RainbondCluster) *batchv1.Job {
+	if cluster.Spec.SentinelImage == "" || pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return nil
+	}
+	dataPath := path.Clean(pv.Spec.HostPath.Path)
+	parent := path.Dir(dataPath)
+	if !path.IsAbs(dataPath) || parent == "/" {
+		return nil
+	}
+
+	labels := rbdutil.LabelsForRainbond(map[string]string{"name": "rbd-cleanup"})
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rbd-cleanup-" + pv.Name,
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: commonutil.Int32(2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Affinity: &corev1.Affinity{
+						NodeAffinity: &corev1.NodeAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: pv.Spec.NodeAffinity.Required,
+						},
+					},
+					Tolerations: []corev1.Toleration{
+						{
+							Operator: corev1.TolerationOpExists,
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "cleanup",
+							Image:   cluster.Spec.SentinelImage,
+							Command: []string{"rm", "-rf", path.Join("/host", path.Base(dataPath))},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "host",
+									MountPath: "/host",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "host",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: parent,
+									Type: k8sutil.HostPath(corev1.HostPathDirectory),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
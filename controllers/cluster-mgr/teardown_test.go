@@ -0,0 +1,276 @@
+package clustermgr
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/sentinelutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubeaggregatorv1beta1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTeardownTestObjects() []runtime.Object {
+	labels := rbdutil.LabelsForRainbond(map[string]string{"name": "rbd-db"})
+	controller := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: commonutil.Bool(true)}}
+	}
+	nfsLabels := rbdutil.LabelsForRainbond(map[string]string{"name": "nfs-provisioner"})
+	return []runtime.Object{
+		newRbdComponent("rbd-db", true),
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "rbd-db-0", Namespace: "rbd-system", Labels: labels,
+				OwnerReferences: controller("StatefulSet", "rbd-db")},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "rbd-db", Namespace: "rbd-system", Labels: labels},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "rbd-db", Labels: rbdutil.LabelsForClusterScoped("rbd-system", labels)},
+			Spec: corev1.PersistentVolumeSpec{
+				ClaimRef: &corev1.ObjectReference{Namespace: "rbd-system", Name: "rbd-db"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: "/opt/rainbond/data/db20210101000000"},
+				},
+				NodeAffinity: &corev1.VolumeNodeAffinity{
+					Required: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{
+							{
+								MatchExpressions: []corev1.NodeSelectorRequirement{
+									{Key: "kubernetes.io/hostname", Operator: corev1.NodeSelectorOpIn, Values: []string{"node1"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeReleased},
+		},
+		&rainbondv1alpha1.RainbondVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "rainbondvolumerwx", Namespace: "rbd-system"},
+			Spec: rainbondv1alpha1.RainbondVolumeSpec{
+				StorageClassName:       "rainbondvolumerwx",
+				StorageClassParameters: &rainbondv1alpha1.StorageClassParameters{Provisioner: "rbd-system.rainbond.io/nfs"},
+			},
+		},
+		&kubeaggregatorv1beta1.APIService{
+			ObjectMeta: metav1.ObjectMeta{Name: "v1beta1.metrics.k8s.io"},
+			Spec: kubeaggregatorv1beta1.APIServiceSpec{
+				Service: &kubeaggregatorv1beta1.ServiceReference{Name: "metrics-server", Namespace: "rbd-system"},
+			},
+		},
+		// the sentinels and the volume plugins outlive the rbdcomponents.
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: sentinelutil.Name, Namespace: "rbd-system", Labels: sentinelutil.Labels(),
+				OwnerReferences: controller("RainbondCluster", "rainbondcluster")},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: sentinelutil.Name + "-abcde", Namespace: "rbd-system", Labels: sentinelutil.Labels(),
+				OwnerReferences: controller("DaemonSet", sentinelutil.Name)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "nfs-provisioner", Namespace: "rbd-system", Labels: nfsLabels,
+				OwnerReferences: controller("RainbondVolume", "rainbondvolumerwx")},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nfs-provisioner-0", Namespace: "rbd-system", Labels: nfsLabels,
+				OwnerReferences: controller("StatefulSet", "nfs-provisioner")},
+		},
+		// provisioned by the storage class of the rainbondvolume.
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-grdata"},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: "rainbondvolumerwx",
+				ClaimRef:         &corev1.ObjectReference{Namespace: "rbd-system", Name: "rbd-grdata"},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeReleased},
+		},
+		// not of rainbond.
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-foo"},
+			Spec: corev1.PersistentVolumeSpec{
+				StorageClassName: "foo",
+				ClaimRef:         &corev1.ObjectReference{Namespace: "rbd-system", Name: "foo"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: "/opt/foo/data"},
+				},
+			},
+			Status: corev1.PersistentVolumeStatus{Phase: corev1.VolumeReleased},
+		},
+	}
+}
+
+func newTeardownTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := newUpgradeTestScheme(t)
+	if err := kubeaggregatorv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func runTeardown(t *testing.T, mgr *RainbondClusteMgr) bool {
+	done, err := mgr.Teardown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return done
+}
+
+func TestTeardown(t *testing.T) {
+	scheme := newTeardownTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, newTeardownTestObjects()...)
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	ctx := context.Background()
+
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepRbdComponents, cluster.Status.Teardown.Step)
+	assert.Equal(t, []string{"RbdComponent/rbd-db", "Pod/rbd-db-0"}, cluster.Status.Teardown.Remaining)
+	// the pods are garbage collected after the rbdcomponents are gone.
+	if err := cli.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "rbd-db-0", Namespace: "rbd-system"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepPersistentVolumeClaims, cluster.Status.Teardown.Step)
+
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepHostPathData, cluster.Status.Teardown.Step)
+	job := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-cleanup-rbd-db"}, job); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"rm", "-rf", "/host/db20210101000000"}, job.Spec.Template.Spec.Containers[0].Command)
+	assert.Equal(t, "/opt/rainbond/data", job.Spec.Template.Spec.Volumes[0].HostPath.Path)
+	// waiting for the cleanup job.
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepHostPathData, cluster.Status.Teardown.Step)
+	job.Status.Succeeded = 1
+	if err := cli.Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepPersistentVolumes, cluster.Status.Teardown.Step)
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepRainbondVolumes, cluster.Status.Teardown.Step)
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepClusterScopedResources, cluster.Status.Teardown.Step)
+	assert.Equal(t, []string{"APIService/v1beta1.metrics.k8s.io"}, cluster.Status.Teardown.Remaining)
+	assert.True(t, runTeardown(t, mgr))
+
+	pvs := &corev1.PersistentVolumeList{}
+	if err := cli.List(ctx, pvs); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, pvs.Items, 1) {
+		assert.Equal(t, "pvc-foo", pvs.Items[0].Name)
+	}
+	jobs := &batchv1.JobList{}
+	if err := cli.List(ctx, jobs, client.InNamespace("rbd-system")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, jobs.Items, 1)
+}
+
+func TestTeardownCleanupJobFailed(t *testing.T) {
+	scheme := newTeardownTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, newTeardownTestObjects()...)
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	ctx := context.Background()
+
+	if err := cli.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "rbd-db-0", Namespace: "rbd-system"}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3 && (cluster.Status.Teardown == nil || cluster.Status.Teardown.Step != rainbondv1alpha1.TeardownStepHostPathData); i++ {
+		runTeardown(t, mgr)
+	}
+	job := &batchv1.Job{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: "rbd-cleanup-rbd-db"}, job); err != nil {
+		t.Fatal(err)
+	}
+	job.Status.Failed = 3
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+	}
+	if err := cli.Update(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data is left on the node, and the teardown goes on.
+	assert.False(t, runTeardown(t, mgr))
+	assert.Equal(t, rainbondv1alpha1.TeardownStepPersistentVolumes, cluster.Status.Teardown.Step)
+	assert.Contains(t, cluster.Status.Teardown.Message, "/opt/rainbond/data/db20210101000000 on node node1")
+	assert.Contains(t, cluster.Status.Teardown.Message, "Job has reached the specified backoff limit")
+	done := false
+	for i := 0; i < 3 && !done; i++ {
+		done = runTeardown(t, mgr)
+	}
+	assert.True(t, done)
+}
+
+func TestTeardownRetainData(t *testing.T) {
+	scheme := newTeardownTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, newTeardownTestObjects()...)
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.RetainData = true
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	ctx := context.Background()
+
+	if err := cli.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "rbd-db-0", Namespace: "rbd-system"}}); err != nil {
+		t.Fatal(err)
+	}
+	// the steps deleting data are skipped.
+	done := false
+	for i := 0; i < 5 && !done; i++ {
+		done = runTeardown(t, mgr)
+	}
+	assert.True(t, done)
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := cli.List(ctx, pvcs, client.InNamespace("rbd-system")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, pvcs.Items, 1)
+	pvs := &corev1.PersistentVolumeList{}
+	if err := cli.List(ctx, pvs); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, pvs.Items, 3)
+	jobs := &batchv1.JobList{}
+	if err := cli.List(ctx, jobs, client.InNamespace("rbd-system")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, jobs.Items)
+}
+
+func TestHostPathCleanupJob(t *testing.T) {
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.SentinelImage = "rainbond/rainbond-operator-sentinel:v2.0.0"
+	pv := newTeardownTestObjects()[3].(*corev1.PersistentVolume)
+	assert.NotNil(t, hostPathCleanupJob(pv, cluster))
+
+	// never delete the top-level directories.
+	pv.Spec.HostPath.Path = "/opt"
+	assert.Nil(t, hostPathCleanupJob(pv, cluster))
+
+	// the node of the data is unknown.
+	pv.Spec.HostPath.Path = "/opt/rainbond/data/db"
+	pv.Spec.NodeAffinity = nil
+	assert.Nil(t, hostPathCleanupJob(pv, cluster))
+}
@@ -0,0 +1,506 @@
+package clustermgr
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/controllers/handler"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// defaultUpgradeTimeout is how long to wait for each rbdcomponent to become ready during an upgrade by default.
+	defaultUpgradeTimeout = 10 * time.Minute
+	// maxUpgradeHistory is the number of upgrades kept in the status.
+	maxUpgradeHistory = 10
+)
+
+// Upgrade upgrades the rbdcomponents when the install version of the cluster changes, and records the progress in s.
+// An upgrade goes through the pre-upgrade checks, snapshots of rbd-db and rbd-etcd, and then changes the images of
+// the rbdcomponents one by one in dependency order, waiting for each of them to become ready. If one of them fails
+// to become ready in time, all the upgraded rbdcomponents are rolled back to their previous images.
+// It returns true if the upgrade is still in progress.
+func (r *RainbondClusteMgr) Upgrade(s *rainbondv1alpha1.RainbondClusterStatus) (bool, error) {
+	upgrade := currentUpgrade(s)
+	if upgrade == nil {
+		if !r.needUpgrade(s) {
+			return false, nil
+		}
+		now := metav1.Now()
+		s.UpgradeHistory = append(s.UpgradeHistory, rainbondv1alpha1.RainbondClusterUpgrade{
+			FromVersion:        s.InstalledVersion,
+			ToVersion:          r.cluster.Spec.InstallVersion,
+			Phase:              rainbondv1alpha1.UpgradePhasePrechecking,
+			StartTime:          now,
+			LastTransitionTime: now,
+		})
+		if len(s.UpgradeHistory) > maxUpgradeHistory {
+			s.UpgradeHistory = s.UpgradeHistory[len(s.UpgradeHistory)-maxUpgradeHistory:]
+		}
+		upgrade = &s.UpgradeHistory[len(s.UpgradeHistory)-1]
+		r.log.Info("start upgrading", "from", upgrade.FromVersion, "to", upgrade.ToVersion)
+	}
+
+	if upgrade.ToVersion != r.cluster.Spec.InstallVersion {
+		message := fmt.Sprintf("install version changed to %s during the upgrade", r.cluster.Spec.InstallVersion)
+		switch upgrade.Phase {
+		case rainbondv1alpha1.UpgradePhasePrechecking, rainbondv1alpha1.UpgradePhaseSnapshotting:
+			completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "Canceled", message)
+			return false, nil
+		case rainbondv1alpha1.UpgradePhaseRolling:
+			transitUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseRollingBack, "Canceled", message)
+		}
+	}
+
+	var err error
+	switch upgrade.Phase {
+	case rainbondv1alpha1.UpgradePhasePrechecking:
+		err = r.precheckUpgrade(upgrade, s)
+	case rainbondv1alpha1.UpgradePhaseSnapshotting:
+		err = r.snapshot(upgrade)
+	case rainbondv1alpha1.UpgradePhaseRolling:
+		err = r.rollComponents(upgrade)
+	case rainbondv1alpha1.UpgradePhaseRollingBack:
+		err = r.rollBack(upgrade)
+	}
+
+	if upgrade.CompletionTime == nil {
+		s.Phase = rainbondv1alpha1.RainbondClusterPhaseUpgrading
+		return true, err
+	}
+	r.log.Info("upgrade completed", "from", upgrade.FromVersion, "to", upgrade.ToVersion, "phase", upgrade.Phase)
+	if upgrade.Phase == rainbondv1alpha1.UpgradePhaseSucceeded {
+		s.InstalledVersion = upgrade.ToVersion
+	}
+	return false, err
+}
+
+// needUpgrade checks if the install version of the cluster differs from the installed one.
+// A version which has been upgraded to, but failed or was rolled back, will not be upgraded to again,
+// until the install version is changed to another one, or the cluster is annotated with rainbond.io/retry-upgrade.
+func (r *RainbondClusteMgr) needUpgrade(s *rainbondv1alpha1.RainbondClusterStatus) bool {
+	target := r.cluster.Spec.InstallVersion
+	if s.InstalledVersion == "" || target == "" || s.InstalledVersion == target {
+		return false
+	}
+	if n := len(s.UpgradeHistory); n > 0 {
+		last := s.UpgradeHistory[n-1]
+		if last.FromVersion == s.InstalledVersion && last.ToVersion == target {
+			_, retry := r.cluster.Annotations[constants.RetryUpgradeAnnotation]
+			if retry {
+				r.log.Info("retry upgrading", "from", last.FromVersion, "to", last.ToVersion, "last phase", last.Phase)
+			}
+			return retry
+		}
+	}
+	return true
+}
+
+// precheckUpgrade fails the upgrade if it is a downgrade or a precheck of the cluster failed, waits for the images
+// of the install version upgraded to in the offline mode, and waits for all the expected rbdcomponents to be ready
+// before taking snapshots.
+func (r *RainbondClusteMgr) precheckUpgrade(upgrade *rainbondv1alpha1.RainbondClusterUpgrade, s *rainbondv1alpha1.RainbondClusterStatus) error {
+	from, fromErr := version.ParseGeneric(upgrade.FromVersion)
+	to, toErr := version.ParseGeneric(upgrade.ToVersion)
+	if fromErr == nil && toErr == nil && to.LessThan(from) {
+		completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "Downgrade",
+			fmt.Sprintf("downgrading from %s to %s is not supported", upgrade.FromVersion, upgrade.ToVersion))
+		return nil
+	}
+
+	for _, condition := range s.Conditions {
+		if condition.Type == rainbondv1alpha1.RainbondClusterConditionTypeRunning || !r.IsBlockingCondition(condition.Type) {
+			continue
+		}
+		if condition.Status == corev1.ConditionFalse {
+			completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "PrecheckFailed",
+				fmt.Sprintf("precheck %s failed: %s", condition.Type, condition.Message))
+			return nil
+		}
+	}
+
+	if r.cluster.Spec.InstallMode == rainbondv1alpha1.InstallationModeOffline {
+		pushed, err := r.waitForPackage(upgrade)
+		if err != nil || !pushed {
+			return err
+		}
+	}
+
+	expected := make(map[string]bool)
+	for _, name := range handler.ExpectedComponents(r.cluster) {
+		expected[name] = true
+	}
+	var notReady []string
+	for _, summary := range s.Components {
+		if expected[summary.Name] && !summary.Ready {
+			notReady = append(notReady, summary.Name)
+		}
+	}
+	if len(notReady) > 0 {
+		message := fmt.Sprintf("rbdcomponents not ready: %s", strings.Join(notReady, ", "))
+		if time.Since(upgrade.LastTransitionTime.Time) > r.upgradeTimeout() {
+			completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "RbdComponentNotReady", message)
+			return nil
+		}
+		upgrade.Reason = "WaitingForRbdComponents"
+		upgrade.Message = message
+		return nil
+	}
+
+	transitUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseSnapshotting, "PrecheckPassed", "snapshotting rbd-db and rbd-etcd")
+	return nil
+}
+
+// waitForPackage waits for the rainbondpackage to push the images of the install version upgraded to into the local
+// image hub, where the rbdcomponents pull their images from in the offline mode. The rainbondpackage handles the
+// package again once the install version changes. It returns true if the images have been pushed.
+func (r *RainbondClusteMgr) waitForPackage(upgrade *rainbondv1alpha1.RainbondClusterUpgrade) (bool, error) {
+	pkg, err := rbdutil.GetRainbondPackage(r.ctx, r.client, r.cluster)
+	if err != nil {
+		return false, fmt.Errorf("get rainbondpackage: %v", err)
+	}
+	if pkg.Status.Version == upgrade.ToVersion {
+		if _, ready := pkg.Status.GetCondition(rainbondv1alpha1.Ready); ready != nil && ready.Status == rainbondv1alpha1.Completed {
+			return true, nil
+		}
+	}
+
+	message := fmt.Sprintf("waiting for rainbondpackage %s to push the images of %s", pkg.Name, upgrade.ToVersion)
+	if pkg.Status.Version == upgrade.ToVersion {
+		for _, condition := range pkg.Status.Conditions {
+			// the failed step is retried by the rainbondpackage.
+			if condition.Status == rainbondv1alpha1.Failed {
+				message = fmt.Sprintf("%s, %s failed: %s", message, condition.Type, condition.Message)
+				break
+			}
+		}
+	}
+	if time.Since(upgrade.LastTransitionTime.Time) > r.upgradeTimeout() {
+		completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "PackageNotReady", message)
+		return false, nil
+	}
+	upgrade.Reason = "WaitingForPackage"
+	upgrade.Message = message
+	return false, nil
+}
+
+// snapshot creates the jobs taking snapshots of rbd-db and rbd-etcd, and waits for them to complete.
+func (r *RainbondClusteMgr) snapshot(upgrade *rainbondv1alpha1.RainbondClusterUpgrade) error {
+	suffix := fmt.Sprintf("snapshot-%d", upgrade.StartTime.Unix())
+	dir := path.Join(handler.SnapshotRoot, fmt.Sprintf("%s-%d", upgrade.ToVersion, upgrade.StartTime.Unix()))
+
+	var snapshots []string
+	for _, name := range handler.SnapshotComponents(r.cluster) {
+		cpt := &rainbondv1alpha1.RbdComponent{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}, cpt); err != nil {
+			return fmt.Errorf("get rbdcomponent %s: %v", name, err)
+		}
+		job, snapshot, err := handler.SnapshotJob(cpt, r.cluster, name+"-"+suffix, dir)
+		if err != nil {
+			return err
+		}
+
+		existing := &batchv1.Job{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: job.Namespace, Name: job.Name}, existing); err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				return fmt.Errorf("get job %s: %v", job.Name, err)
+			}
+			if err := controllerutil.SetControllerReference(r.cluster, job, r.scheme); err != nil {
+				return fmt.Errorf("set controller reference for job %s: %v", job.Name, err)
+			}
+			if err := r.client.Create(r.ctx, job); err != nil {
+				return fmt.Errorf("create job %s: %v", job.Name, err)
+			}
+			continue
+		}
+
+		for _, condition := range existing.Status.Conditions {
+			if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+				completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "SnapshotFailed",
+					fmt.Sprintf("job %s failed: %s", job.Name, condition.Message))
+				return nil
+			}
+		}
+		if existing.Status.Succeeded > 0 {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	if len(snapshots) < len(handler.SnapshotComponents(r.cluster)) {
+		if time.Since(upgrade.LastTransitionTime.Time) > r.upgradeTimeout() {
+			completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "SnapshotTimeout",
+				fmt.Sprintf("snapshots are not completed in %s", r.upgradeTimeout()))
+		}
+		return nil
+	}
+	upgrade.Snapshots = snapshots
+	transitUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseRolling, "SnapshotCompleted", "upgrading rbdcomponents")
+	return nil
+}
+
+// rollComponents changes the image of the next rbdcomponent in dependency order, once the previous one is ready.
+// The rbdcomponents whose image tags are not the install version upgraded from are left unchanged,
+// and reported in SkippedComponents.
+func (r *RainbondClusteMgr) rollComponents(upgrade *rainbondv1alpha1.RainbondClusterUpgrade) error {
+	rbdcomponents, err := r.listRbdComponents()
+	if err != nil {
+		return fmt.Errorf("list rbdcomponents: %v", err)
+	}
+	existing := make(map[string]*rainbondv1alpha1.RbdComponent, len(rbdcomponents))
+	names := make([]string, 0, len(rbdcomponents))
+	for i := range rbdcomponents {
+		existing[rbdcomponents[i].Name] = &rbdcomponents[i]
+		names = append(names, rbdcomponents[i].Name)
+	}
+
+	// wait for the rbdcomponent being upgraded.
+	if n := len(upgrade.Components); n > 0 && !upgrade.Components[n-1].Ready {
+		current := &upgrade.Components[n-1]
+		cpt, ok := existing[current.Name]
+		if !ok {
+			transitUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseRollingBack, "RbdComponentNotFound",
+				fmt.Sprintf("rbdcomponent %s not found", current.Name))
+			return nil
+		}
+		rolledOut, err := r.rolledOut(cpt, current.Image)
+		if err != nil {
+			return err
+		}
+		if !rolledOut {
+			if time.Since(current.StartTime.Time) > r.upgradeTimeout() {
+				transitUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseRollingBack, "RbdComponentNotReady",
+					fmt.Sprintf("rbdcomponent %s is not ready in %s", current.Name, r.upgradeTimeout()))
+			}
+			return nil
+		}
+		current.Ready = true
+	}
+
+	order, err := handler.InstallOrder(names, r.cluster)
+	if err != nil {
+		return err
+	}
+	upgraded := make(map[string]bool, len(upgrade.Components))
+	for _, component := range upgrade.Components {
+		upgraded[component.Name] = true
+	}
+	for _, name := range order {
+		if upgraded[name] {
+			continue
+		}
+		previous := existing[name].Spec.Image
+		image, ok := imageWithTag(previous, upgrade.FromVersion, upgrade.ToVersion)
+		if !ok {
+			r.skipComponent(upgrade, name, previous)
+			continue
+		}
+		if err := r.setRbdComponentImage(name, image); err != nil {
+			return err
+		}
+		upgrade.Components = append(upgrade.Components, rainbondv1alpha1.UpgradedComponent{
+			Name:          name,
+			PreviousImage: previous,
+			Image:         image,
+			StartTime:     metav1.Now(),
+		})
+		upgrade.Message = fmt.Sprintf("upgrading rbdcomponent %s", name)
+		return nil
+	}
+
+	message := fmt.Sprintf("%d rbdcomponents upgraded to %s", len(upgrade.Components), upgrade.ToVersion)
+	if len(upgrade.SkippedComponents) > 0 {
+		message = fmt.Sprintf("%s, skipped the ones whose image tags are not %s: %s", message, upgrade.FromVersion,
+			strings.Join(upgrade.SkippedComponents, ", "))
+	}
+	completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseSucceeded, "Upgraded", message)
+	return nil
+}
+
+// skipComponent records the rbdcomponent whose image is left unchanged by the upgrade.
+func (r *RainbondClusteMgr) skipComponent(upgrade *rainbondv1alpha1.RainbondClusterUpgrade, name, image string) {
+	for _, skipped := range upgrade.SkippedComponents {
+		if skipped == name {
+			return
+		}
+	}
+	r.log.Info("skip upgrading rbdcomponent, its image tag is not the version upgraded from", "name", name, "image", image, "from", upgrade.FromVersion)
+	upgrade.SkippedComponents = append(upgrade.SkippedComponents, name)
+}
+
+// rollBack restores the previous images of the upgraded rbdcomponents, in reverse order, and waits for them to be ready.
+func (r *RainbondClusteMgr) rollBack(upgrade *rainbondv1alpha1.RainbondClusterUpgrade) error {
+	var notReady []string
+	for i := len(upgrade.Components) - 1; i >= 0; i-- {
+		component := upgrade.Components[i]
+		cpt := &rainbondv1alpha1.RbdComponent{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: component.Name}, cpt); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("get rbdcomponent %s: %v", component.Name, err)
+		}
+		if cpt.Spec.Image != component.PreviousImage {
+			if err := r.setRbdComponentImage(component.Name, component.PreviousImage); err != nil {
+				return err
+			}
+			notReady = append(notReady, component.Name)
+			continue
+		}
+		rolledOut, err := r.rolledOut(cpt, component.PreviousImage)
+		if err != nil {
+			return err
+		}
+		if !rolledOut {
+			notReady = append(notReady, component.Name)
+		}
+	}
+
+	if len(notReady) == 0 {
+		completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseRolledBack, upgrade.Reason, upgrade.Message)
+		return nil
+	}
+	if time.Since(upgrade.LastTransitionTime.Time) > r.upgradeTimeout() {
+		completeUpgrade(upgrade, rainbondv1alpha1.UpgradePhaseFailed, "RollbackTimeout",
+			fmt.Sprintf("rbdcomponents not ready in %s after rolling back: %s", r.upgradeTimeout(), strings.Join(notReady, ", ")))
+	}
+	return nil
+}
+
+// rolledOut checks if the workload of the rbdcomponent has been rolled out with the given image, and is ready.
+// The ready condition of the rbdcomponent alone is not enough, since the old pods are still ready during the rollout.
+func (r *RainbondClusteMgr) rolledOut(cpt *rainbondv1alpha1.RbdComponent, image string) (bool, error) {
+	if cpt.Spec.Image != image || !handler.IsRbdComponentReady(cpt) {
+		return false, nil
+	}
+
+	key := types.NamespacedName{Namespace: cpt.Namespace, Name: cpt.Name}
+	deploy := &appsv1.Deployment{}
+	if err := r.client.Get(r.ctx, key, deploy); err == nil {
+		return deploymentRolledOut(deploy, image), nil
+	} else if !k8sErrors.IsNotFound(err) {
+		return false, fmt.Errorf("get deployment %s: %v", key.Name, err)
+	}
+	sts := &appsv1.StatefulSet{}
+	if err := r.client.Get(r.ctx, key, sts); err == nil {
+		return statefulSetRolledOut(sts, image), nil
+	} else if !k8sErrors.IsNotFound(err) {
+		return false, fmt.Errorf("get statefulset %s: %v", key.Name, err)
+	}
+	ds := &appsv1.DaemonSet{}
+	if err := r.client.Get(r.ctx, key, ds); err == nil {
+		return daemonSetRolledOut(ds, image), nil
+	} else if !k8sErrors.IsNotFound(err) {
+		return false, fmt.Errorf("get daemonset %s: %v", key.Name, err)
+	}
+	// no workload named after the rbdcomponent, rely on its readiness.
+	return true, nil
+}
+
+func (r *RainbondClusteMgr) setRbdComponentImage(name, image string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cpt := &rainbondv1alpha1.RbdComponent{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cluster.Namespace, Name: name}, cpt); err != nil {
+			return fmt.Errorf("get rbdcomponent %s: %v", name, err)
+		}
+		if cpt.Spec.Image == image {
+			return nil
+		}
+		r.log.Info("set image of rbdcomponent", "name", name, "image", image)
+		cpt.Spec.Image = image
+		return r.client.Update(r.ctx, cpt)
+	})
+}
+
+func (r *RainbondClusteMgr) upgradeTimeout() time.Duration {
+	if r.cluster.Spec.UpgradeTimeout != nil && r.cluster.Spec.UpgradeTimeout.Duration > 0 {
+		return r.cluster.Spec.UpgradeTimeout.Duration
+	}
+	return defaultUpgradeTimeout
+}
+
+// currentUpgrade returns the upgrade in progress, or nil if there is none.
+func currentUpgrade(s *rainbondv1alpha1.RainbondClusterStatus) *rainbondv1alpha1.RainbondClusterUpgrade {
+	n := len(s.UpgradeHistory)
+	if n == 0 || s.UpgradeHistory[n-1].CompletionTime != nil {
+		return nil
+	}
+	return &s.UpgradeHistory[n-1]
+}
+
+func transitUpgrade(upgrade *rainbondv1alpha1.RainbondClusterUpgrade, phase rainbondv1alpha1.UpgradePhase, reason, message string) {
+	upgrade.Phase = phase
+	upgrade.LastTransitionTime = metav1.Now()
+	upgrade.Reason = reason
+	upgrade.Message = message
+}
+
+func completeUpgrade(upgrade *rainbondv1alpha1.RainbondClusterUpgrade, phase rainbondv1alpha1.UpgradePhase, reason, message string) {
+	transitUpgrade(upgrade, phase, reason, message)
+	now := metav1.Now()
+	upgrade.CompletionTime = &now
+}
+
+// imageWithTag replaces the tag of the image with to, if the tag is from.
+func imageWithTag(image, from, to string) (string, bool) {
+	idx := strings.LastIndex(image, ":")
+	if idx == -1 || idx < strings.LastIndex(image, "/") {
+		return "", false
+	}
+	if image[idx+1:] != from {
+		return "", false
+	}
+	return image[:idx+1] + to, true
+}
+
+func podTemplateHasImage(template *corev1.PodTemplateSpec, image string) bool {
+	for _, container := range template.Spec.Containers {
+		if container.Image == image {
+			return true
+		}
+	}
+	return false
+}
+
+func deploymentRolledOut(deploy *appsv1.Deployment, image string) bool {
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	return podTemplateHasImage(&deploy.Spec.Template, image) &&
+		deploy.Status.ObservedGeneration >= deploy.Generation &&
+		deploy.Status.UpdatedReplicas == replicas &&
+		deploy.Status.Replicas == replicas &&
+		deploy.Status.AvailableReplicas >= replicas
+}
+
+func statefulSetRolledOut(sts *appsv1.StatefulSet, image string) bool {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	return podTemplateHasImage(&sts.Spec.Template, image) &&
+		sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdatedReplicas == replicas &&
+		sts.Status.ReadyReplicas >= replicas &&
+		sts.Status.CurrentRevision == sts.Status.UpdateRevision
+}
+
+func daemonSetRolledOut(ds *appsv1.DaemonSet, image string) bool {
+	return podTemplateHasImage(&ds.Spec.Template, image) &&
+		ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled
+}
@@ -0,0 +1,322 @@
+package clustermgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newUpgradeTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func newUpgradeTestCluster() *rainbondv1alpha1.RainbondCluster {
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system", UID: "foobar"},
+		Spec:       rainbondv1alpha1.RainbondClusterSpec{InstallVersion: "v5.4.0-release"},
+	}
+	cluster.Status.InstalledVersion = "v5.3.0-release"
+	return cluster
+}
+
+func newRbdComponentWithImage(name, image string) *rainbondv1alpha1.RbdComponent {
+	cpt := newRbdComponent(name, true)
+	cpt.Spec.Image = image
+	return cpt
+}
+
+func getRbdComponentImage(t *testing.T, cli client.Client, name string) string {
+	cpt := &rainbondv1alpha1.RbdComponent{}
+	if err := cli.Get(context.Background(), types.NamespacedName{Namespace: "rbd-system", Name: name}, cpt); err != nil {
+		t.Fatal(err)
+	}
+	return cpt.Spec.Image
+}
+
+func TestUpgrade(t *testing.T) {
+	scheme := newUpgradeTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, []runtime.Object{
+		newRbdComponentWithImage("rbd-db", "rainbond/rbd-db:8.0.19"),
+		newRbdComponentWithImage("rbd-etcd", "rainbond/etcd:v3.3.18"),
+		newRbdComponentWithImage("rbd-worker", "rainbond/rbd-worker:v5.3.0-release"),
+		newRbdComponentWithImage("rbd-api", "rainbond/rbd-api:v5.3.0-release"),
+	}...)
+	cluster := newUpgradeTestCluster()
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	s := cluster.Status.DeepCopy()
+
+	upgrading, err := mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, upgrading)
+	assert.Equal(t, rainbondv1alpha1.RainbondClusterPhaseUpgrading, s.Phase)
+	if !assert.Len(t, s.UpgradeHistory, 1) {
+		return
+	}
+	upgrade := &s.UpgradeHistory[0]
+	assert.Equal(t, "v5.3.0-release", upgrade.FromVersion)
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseSnapshotting, upgrade.Phase)
+
+	// snapshots of rbd-db and rbd-etcd.
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	jobs := &batchv1.JobList{}
+	if err := cli.List(context.Background(), jobs, client.InNamespace("rbd-system")); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, jobs.Items, 2) {
+		return
+	}
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseSnapshotting, upgrade.Phase)
+	for i := range jobs.Items {
+		jobs.Items[i].Status.Succeeded = 1
+		if err := cli.Update(context.Background(), &jobs.Items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseRolling, upgrade.Phase)
+	assert.Len(t, upgrade.Snapshots, 2)
+
+	// rbd-api is upgraded before rbd-worker, and the images not tagged with the install version are left unchanged.
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rainbond/rbd-api:v5.4.0-release", getRbdComponentImage(t, cli, "rbd-api"))
+	assert.Equal(t, "rainbond/rbd-worker:v5.3.0-release", getRbdComponentImage(t, cli, "rbd-worker"))
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rainbond/rbd-worker:v5.4.0-release", getRbdComponentImage(t, cli, "rbd-worker"))
+	upgrading, err = mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upgrading)
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseSucceeded, upgrade.Phase)
+	assert.NotNil(t, upgrade.CompletionTime)
+	assert.Equal(t, "v5.4.0-release", s.InstalledVersion)
+	assert.Equal(t, "rainbond/rbd-db:8.0.19", getRbdComponentImage(t, cli, "rbd-db"))
+	assert.ElementsMatch(t, []string{"rbd-db", "rbd-etcd"}, upgrade.SkippedComponents)
+	assert.Contains(t, upgrade.Message, "rbd-db")
+	if assert.Len(t, upgrade.Components, 2) {
+		assert.Equal(t, "rainbond/rbd-api:v5.3.0-release", upgrade.Components[0].PreviousImage)
+		assert.True(t, upgrade.Components[1].Ready)
+	}
+}
+
+func TestUpgradeRollBack(t *testing.T) {
+	previous := "rainbond/rbd-api:v5.3.0-release"
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system", Generation: 1},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: commonutil.Int32(1),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "rbd-api", Image: previous}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+	scheme := newUpgradeTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, newRbdComponentWithImage("rbd-api", previous), deploy)
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.UpgradeTimeout = &metav1.Duration{Duration: time.Nanosecond}
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	s := cluster.Status.DeepCopy()
+	s.UpgradeHistory = []rainbondv1alpha1.RainbondClusterUpgrade{
+		{FromVersion: "v5.3.0-release", ToVersion: "v5.4.0-release", Phase: rainbondv1alpha1.UpgradePhaseRolling},
+	}
+	upgrade := &s.UpgradeHistory[0]
+
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rainbond/rbd-api:v5.4.0-release", getRbdComponentImage(t, cli, "rbd-api"))
+
+	// the deployment is not rolled out with the new image in time.
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseRollingBack, upgrade.Phase)
+	assert.Equal(t, "RbdComponentNotReady", upgrade.Reason)
+
+	cluster.Spec.UpgradeTimeout = nil
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, previous, getRbdComponentImage(t, cli, "rbd-api"))
+	upgrading, err := mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upgrading)
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseRolledBack, upgrade.Phase)
+	assert.Equal(t, "v5.3.0-release", s.InstalledVersion)
+
+	// the version rolled back from is not upgraded to again.
+	upgrading, err = mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upgrading)
+	assert.Len(t, s.UpgradeHistory, 1)
+
+	// unless a retry is requested.
+	cluster.Annotations = map[string]string{constants.RetryUpgradeAnnotation: ""}
+	upgrading, err = mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, upgrading)
+	if assert.Len(t, s.UpgradeHistory, 2) {
+		assert.Equal(t, rainbondv1alpha1.UpgradePhaseRolledBack, s.UpgradeHistory[0].Phase)
+		assert.Equal(t, "v5.4.0-release", s.UpgradeHistory[1].ToVersion)
+	}
+}
+
+func TestUpgradeWaitForPackage(t *testing.T) {
+	pkg := &rainbondv1alpha1.RainbondPackage{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondpackage", Namespace: "rbd-system"},
+		Status: rainbondv1alpha1.RainbondPackageStatus{
+			Version: "v5.3.0-release",
+			Conditions: []rainbondv1alpha1.PackageCondition{
+				{Type: rainbondv1alpha1.Ready, Status: rainbondv1alpha1.Completed},
+			},
+		},
+	}
+	scheme := newUpgradeTestScheme(t)
+	cli := fake.NewFakeClientWithScheme(scheme, pkg)
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.InstallMode = rainbondv1alpha1.InstallationModeOffline
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, cluster, scheme)
+	s := cluster.Status.DeepCopy()
+
+	// the images pushed are the ones of the installed version.
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, s.UpgradeHistory, 1) {
+		return
+	}
+	upgrade := &s.UpgradeHistory[0]
+	assert.Equal(t, rainbondv1alpha1.UpgradePhasePrechecking, upgrade.Phase)
+	assert.Equal(t, "WaitingForPackage", upgrade.Reason)
+
+	// the failed step is reported while it is retried.
+	pkg.Status.Version = "v5.4.0-release"
+	pkg.Status.Conditions = []rainbondv1alpha1.PackageCondition{
+		{Type: rainbondv1alpha1.PushImage, Status: rainbondv1alpha1.Failed, Message: "push image failed"},
+		{Type: rainbondv1alpha1.Ready, Status: rainbondv1alpha1.Waiting},
+	}
+	if err := cli.Status().Update(context.Background(), pkg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Upgrade(s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "WaitingForPackage", upgrade.Reason)
+	assert.Contains(t, upgrade.Message, "push image failed")
+
+	cluster.Spec.UpgradeTimeout = &metav1.Duration{Duration: time.Nanosecond}
+	upgrading, err := mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upgrading)
+	assert.Equal(t, rainbondv1alpha1.UpgradePhaseFailed, upgrade.Phase)
+	assert.Equal(t, "PackageNotReady", upgrade.Reason)
+}
+
+func TestUpgradeDowngrade(t *testing.T) {
+	cluster := newUpgradeTestCluster()
+	cluster.Spec.InstallVersion = "v5.2.0-release"
+	mgr := NewClusterMgr(context.Background(), nil, nil, ctrl.Log, cluster, nil)
+	s := cluster.Status.DeepCopy()
+
+	upgrading, err := mgr.Upgrade(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upgrading)
+	if assert.Len(t, s.UpgradeHistory, 1) {
+		assert.Equal(t, rainbondv1alpha1.UpgradePhaseFailed, s.UpgradeHistory[0].Phase)
+		assert.Equal(t, "Downgrade", s.UpgradeHistory[0].Reason)
+	}
+}
+
+func TestRolledOut(t *testing.T) {
+	image := "rainbond/rbd-api:v5.4.0-release"
+	replicas := int32(2)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "rbd-api", Image: image}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{UpdatedReplicas: 2, Replicas: 2, AvailableReplicas: 2},
+	}
+	// the pod of the old revision is still terminating, and ready.
+	cpt := newRbdComponentWithImage("rbd-api", image)
+	cpt.Status.Replicas = 2
+	cpt.Status.ReadyReplicas = 3
+	cli := fake.NewFakeClientWithScheme(newUpgradeTestScheme(t), deploy)
+	mgr := NewClusterMgr(context.Background(), cli, nil, ctrl.Log, newUpgradeTestCluster(), nil)
+
+	rolledOut, err := mgr.rolledOut(cpt, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, rolledOut)
+
+	cpt.Status.ReadyReplicas = 1
+	rolledOut, err = mgr.rolledOut(cpt, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, rolledOut)
+}
+
+func TestImageWithTag(t *testing.T) {
+	tests := []struct {
+		image, want string
+		ok          bool
+	}{
+		{image: "rainbond/rbd-api:v5.3.0-release", want: "rainbond/rbd-api:v5.4.0-release", ok: true},
+		{image: "goodrain.me:5000/rbd-api:v5.3.0-release", want: "goodrain.me:5000/rbd-api:v5.4.0-release", ok: true},
+		{image: "rainbond/etcd:v3.3.18"},
+		{image: "goodrain.me:5000/rbd-api"},
+	}
+	for _, tc := range tests {
+		got, ok := imageWithTag(tc.image, "v5.3.0-release", "v5.4.0-release")
+		assert.Equal(t, tc.ok, ok, tc.image)
+		assert.Equal(t, tc.want, got, tc.image)
+	}
+}
@@ -2,6 +2,7 @@ package componentmgr
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -12,18 +13,30 @@ import (
 	"github.com/goodrain/rainbond-operator/controllers/handler"
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
-	mv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	storagev1 "k8s.io/api/storage/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// FieldManager is the name of the field manager used by rainbond-operator to apply the sub resources of rbdcomponent.
+const FieldManager = "rainbond-operator"
+
+// handoverFieldManager keeps the replicas of a deployment while they are handed over to the horizontal pod autoscaler.
+const handoverFieldManager = "rainbond-operator-handover"
+
 //RbdcomponentMgr -
 type RbdcomponentMgr struct {
 	ctx      context.Context
@@ -98,8 +111,12 @@ func (r *RbdcomponentMgr) SetPackageReadyCondition(pkg *rainbondv1alpha1.Rainbon
 
 //CheckPrerequisites -
 func (r *RbdcomponentMgr) CheckPrerequisites(cluster *rainbondv1alpha1.RainbondCluster, pkg *rainbondv1alpha1.RainbondPackage) bool {
-	if r.cpt.Spec.PriorityComponent {
-		// If ImageHub is empty, the priority component no need to wait until rainbondpackage is completed.
+	if handler.InstalledBeforePackage(r.cpt, cluster) {
+		// the rainbondpackage depends on the component, no need to wait until rainbondpackage is completed.
+		return true
+	}
+	if cluster.Status.InstalledVersion != "" {
+		// the rainbondpackage is handled again for an upgrade, which waits for the images itself.
 		return true
 	}
 	// Otherwise, we have to make sure rainbondpackage is completed before we create the resource.
@@ -112,19 +129,35 @@ func (r *RbdcomponentMgr) CheckPrerequisites(cluster *rainbondv1alpha1.RainbondC
 	return true
 }
 
+// WaitingDependencies returns the dependencies of the rbdcomponent which are not ready yet.
+func (r *RbdcomponentMgr) WaitingDependencies(cluster *rainbondv1alpha1.RainbondCluster) ([]string, error) {
+	var waiting []string
+	for _, name := range handler.Dependencies(r.cpt.Name, cluster) {
+		dep := &rainbondv1alpha1.RbdComponent{}
+		if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cpt.Namespace, Name: name}, dep); err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				return nil, fmt.Errorf("get rbdcomponent %s: %v", name, err)
+			}
+			waiting = append(waiting, name)
+			continue
+		}
+		if !handler.IsRbdComponentReady(dep) {
+			waiting = append(waiting, name)
+		}
+	}
+	return waiting, nil
+}
+
+//SetDependenciesReadyCondition -
+func (r *RbdcomponentMgr) SetDependenciesReadyCondition() {
+	condition := rainbondv1alpha1.NewRbdComponentCondition(rainbondv1alpha1.DependenciesReady, corev1.ConditionTrue, "DependenciesReady", "")
+	_ = r.cpt.Status.UpdateCondition(condition)
+}
+
 //GenerateStatus -
 func (r *RbdcomponentMgr) GenerateStatus(pods []corev1.Pod) {
 	status := r.cpt.Status.DeepCopy()
-	var replicas int32 = 1
-	if r.cpt.Spec.Replicas != nil {
-		replicas = *r.cpt.Spec.Replicas
-	}
-	if r.replicaser != nil {
-		if rc := r.replicaser.Replicas(); rc != nil {
-			r.log.V(6).Info(fmt.Sprintf("replica from replicaser: %d", *rc))
-			replicas = *rc
-		}
-	}
+	replicas := r.replicas()
 	status.Replicas = replicas
 
 	readyReplicas := func() int32 {
@@ -156,14 +189,107 @@ func (r *RbdcomponentMgr) GenerateStatus(pods []corev1.Pod) {
 	r.cpt.Status = *status
 }
 
-//IsRbdComponentReady -
-func (r *RbdcomponentMgr) IsRbdComponentReady() bool {
-	_, condition := r.cpt.Status.GetCondition(rainbondv1alpha1.RbdComponentReady)
-	if condition == nil {
-		return false
+// replicas returns the effective replicas of the component.
+func (r *RbdcomponentMgr) replicas() int32 {
+	var replicas int32 = 1
+	if r.cpt.Spec.Replicas != nil {
+		replicas = *r.cpt.Spec.Replicas
+	}
+	if r.replicaser != nil {
+		if rc := r.replicaser.Replicas(); rc != nil {
+			r.log.V(6).Info(fmt.Sprintf("replica from replicaser: %d", *rc))
+			replicas = *rc
+		}
 	}
+	if hpa := r.horizontalPodAutoscaler(); hpa != nil && hpa.Status.CurrentReplicas > 0 {
+		r.log.V(6).Info(fmt.Sprintf("replica from horizontal pod autoscaler: %d", hpa.Status.CurrentReplicas))
+		replicas = hpa.Status.CurrentReplicas
+	}
+	return replicas
+}
+
+// PodDisruptionBudget returns the pod disruption budget of the component,
+// or nil if the component does not need one.
+func (r *RbdcomponentMgr) PodDisruptionBudget() *policyv1beta1.PodDisruptionBudget {
+	policy := r.cpt.Spec.PodDisruptionBudget
+	if policy != nil && policy.Disabled {
+		return nil
+	}
+	replicas := r.replicas()
+	if replicas <= 1 {
+		return nil
+	}
+
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.cpt.Name,
+			Namespace: r.cpt.Namespace,
+			Labels:    handler.LabelsForRainbondComponent(r.cpt),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: handler.LabelsForRainbondComponent(r.cpt),
+			},
+		},
+	}
+	if policy != nil && (policy.MinAvailable != nil || policy.MaxUnavailable != nil) {
+		pdb.Spec.MinAvailable = policy.MinAvailable
+		pdb.Spec.MaxUnavailable = policy.MaxUnavailable
+	} else {
+		// an integer works for the pods of daemonsets, which do not support the scale subresource.
+		minAvailable := intstr.FromInt(int(replicas - 1))
+		pdb.Spec.MinAvailable = &minAvailable
+	}
+	return pdb
+}
 
-	return condition.Status == corev1.ConditionTrue && r.cpt.Status.ReadyReplicas == r.cpt.Status.Replicas
+// DeletePodDisruptionBudget deletes the pod disruption budget owned by the component if it exists.
+func (r *RbdcomponentMgr) DeletePodDisruptionBudget() error {
+	return r.deleteOwnedResourceIfExists(&policyv1beta1.PodDisruptionBudget{})
+}
+
+// DeleteHorizontalPodAutoscaler deletes the horizontal pod autoscaler owned by the component if it exists.
+func (r *RbdcomponentMgr) DeleteHorizontalPodAutoscaler() error {
+	return r.deleteOwnedResourceIfExists(&autoscalingv2beta2.HorizontalPodAutoscaler{})
+}
+
+// deleteOwnedResourceIfExists deletes the resource which has the same name as the component,
+// if it exists and is controlled by the component.
+func (r *RbdcomponentMgr) deleteOwnedResourceIfExists(obj client.Object) error {
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cpt.Namespace, Name: r.cpt.Name}, obj); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(obj, r.cpt) {
+		return nil
+	}
+	r.log.Info(fmt.Sprintf("Deleting %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+	return r.deleteResourcesIfExists(obj)
+}
+
+// horizontalPodAutoscaler returns the horizontal pod autoscaler owned by the component, or nil if there is not one.
+func (r *RbdcomponentMgr) horizontalPodAutoscaler() *autoscalingv2beta2.HorizontalPodAutoscaler {
+	if r.cpt.Spec.Autoscaling == nil {
+		return nil
+	}
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+	if err := r.client.Get(r.ctx, types.NamespacedName{Namespace: r.cpt.Namespace, Name: r.cpt.Name}, hpa); err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			r.log.V(4).Info("get horizontal pod autoscaler", "error", err.Error())
+		}
+		return nil
+	}
+	if !metav1.IsControlledBy(hpa, r.cpt) {
+		return nil
+	}
+	return hpa
+}
+
+//IsRbdComponentReady -
+func (r *RbdcomponentMgr) IsRbdComponentReady() bool {
+	return handler.IsRbdComponentReady(r.cpt)
 }
 
 //ResourceCreateIfNotExists -
@@ -179,7 +305,7 @@ func (r *RbdcomponentMgr) ResourceCreateIfNotExists(obj client.Object) error {
 	return nil
 }
 
-//UpdateOrCreateResource -
+//UpdateOrCreateResource applies obj with server-side apply, the existing object is only written when its managed fields drift.
 func (r *RbdcomponentMgr) UpdateOrCreateResource(obj client.Object) (reconcile.Result, error) {
 	var oldOjb = reflect.New(reflect.ValueOf(obj).Elem().Type()).Interface().(client.Object)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
@@ -187,13 +313,12 @@ func (r *RbdcomponentMgr) UpdateOrCreateResource(obj client.Object) (reconcile.R
 	err := r.client.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, oldOjb)
 	if err != nil {
 		if !k8sErrors.IsNotFound(err) {
-			r.log.Error(err, fmt.Sprintf("Failed to get %s", obj.GetObjectKind()))
+			r.log.Error(err, fmt.Sprintf("Failed to get %T", obj))
 			return reconcile.Result{}, err
 		}
-		r.log.Info(fmt.Sprintf("Creating a new %s", obj.GetObjectKind().GroupVersionKind().Kind), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
-		err = r.client.Create(ctx, obj)
-		if err != nil {
-			r.log.Error(err, "Failed to create new", obj.GetObjectKind(), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		r.log.Info(fmt.Sprintf("Creating a new %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		if err := r.apply(ctx, obj); err != nil {
+			r.log.Error(err, fmt.Sprintf("Failed to create new %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
 			return reconcile.Result{}, err
 		}
 		return reconcile.Result{Requeue: true}, nil
@@ -203,37 +328,111 @@ func (r *RbdcomponentMgr) UpdateOrCreateResource(obj client.Object) (reconcile.R
 		return reconcile.Result{}, nil
 	}
 
-	obj = r.updateRuntimeObject(oldOjb, obj)
+	if err := r.handoverReplicas(ctx, oldOjb); err != nil {
+		r.log.Error(err, fmt.Sprintf("Failed to hand over the replicas of %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		return reconcile.Result{}, err
+	}
+	obj = r.updateRuntimeObject(obj)
 
-	r.log.V(5).Info("Object exists.", "Kind", obj.GetObjectKind().GroupVersionKind().Kind,
-		"Namespace", obj.GetNamespace(), "Name", obj.GetName())
-	if err := r.client.Update(ctx, obj); err != nil {
-		r.log.Error(err, "Failed to update", "Kind", obj.GetObjectKind())
+	// find out what would be changed by a dry run, so that nothing is written if nothing drifted.
+	dryRun := obj.DeepCopyObject().(client.Object)
+	if err := r.apply(ctx, dryRun, client.DryRunAll); err != nil {
+		r.log.Error(err, fmt.Sprintf("Failed to dry run %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		return reconcile.Result{}, err
+	}
+	fields, err := changedFields(oldOjb, dryRun)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(fields) == 0 {
+		r.log.V(6).Info("Object is up to date.", "Kind", dryRun.GetObjectKind().GroupVersionKind().Kind,
+			"Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		r.clearDrift(dryRun.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+		return reconcile.Result{}, nil
+	}
+	// only the fields changed by others are drifted, the rest are the changes of the desired state.
+	drifted, err := driftedFields(oldOjb, dryRun)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(drifted) > 0 {
+		r.recordDrift(dryRun.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), drifted)
+	} else {
+		r.log.V(4).Info("Updating", "Kind", dryRun.GetObjectKind().GroupVersionKind().Kind,
+			"Namespace", obj.GetNamespace(), "Name", obj.GetName(), "Fields", fields)
+		r.clearDrift(dryRun.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+	}
+
+	if err := r.apply(ctx, obj); err != nil {
+		r.log.Error(err, fmt.Sprintf("Failed to update %T", obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
 		return reconcile.Result{}, err
 	}
 
 	return reconcile.Result{}, nil
 }
 
-func (r *RbdcomponentMgr) updateRuntimeObject(old, new client.Object) client.Object {
-	// TODO: maybe use patch is better
-	// spec.clusterIP: Invalid value: \"\": field is immutable
-	if n, ok := new.(*corev1.Service); ok {
-		r.log.V(6).Info("copy necessary fields from old service before updating")
-		o := old.(*corev1.Service)
-		n.ResourceVersion = o.ResourceVersion
-		n.Spec.ClusterIP = o.Spec.ClusterIP
-		return n
-	}
-	if n, ok := new.(*mv1.ServiceMonitor); ok {
-		r.log.V(6).Info("copy necessary fields from old service before updating")
-		o := old.(*corev1.Service)
-		n.ResourceVersion = o.ResourceVersion
-		return n
+// apply applies obj with server-side apply, and takes over the conflicting fields from other field managers.
+func (r *RbdcomponentMgr) apply(ctx context.Context, obj client.Object, opts ...client.PatchOption) error {
+	gvk, err := apiutil.GVKForObject(obj, r.client.Scheme())
+	if err != nil {
+		return fmt.Errorf("get group version kind for %T: %v", obj, err)
+	}
+	// an applied configuration must have the type meta, and must not have the managed fields.
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	opts = append([]client.PatchOption{client.ForceOwnership, client.FieldOwner(FieldManager)}, opts...)
+	return r.client.Patch(ctx, obj, client.Apply, opts...)
+}
+
+// updateRuntimeObject leaves the fields managed by others out of the applied object.
+func (r *RbdcomponentMgr) updateRuntimeObject(new client.Object) client.Object {
+	if n, ok := new.(*appsv1.Deployment); ok && r.cpt.Spec.Autoscaling != nil {
+		// the replicas are taken over by the horizontal pod autoscaler, applying them with the force ownership
+		// would scale the deployment back on every reconcile.
+		r.log.V(6).Info("leave the replicas of deployment to the horizontal pod autoscaler")
+		n.Spec.Replicas = nil
 	}
 	return new
 }
 
+// handoverReplicas hands the replicas of the deployment over to another field manager, before they are left out of
+// the applied object for the horizontal pod autoscaler. Otherwise the replicas still owned only by FieldManager
+// would be reset to the default by the next apply.
+func (r *RbdcomponentMgr) handoverReplicas(ctx context.Context, old client.Object) error {
+	deploy, ok := old.(*appsv1.Deployment)
+	if !ok || r.cpt.Spec.Autoscaling == nil || deploy.Spec.Replicas == nil || !ownsField(deploy, FieldManager, "f:spec", "f:replicas") {
+		return nil
+	}
+	handover := &unstructured.Unstructured{}
+	handover.SetAPIVersion("apps/v1")
+	handover.SetKind("Deployment")
+	handover.SetNamespace(deploy.Namespace)
+	handover.SetName(deploy.Name)
+	if err := unstructured.SetNestedField(handover.Object, int64(*deploy.Spec.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	r.log.V(4).Info("hand over the replicas of deployment", "Name", deploy.Name, "Replicas", *deploy.Spec.Replicas)
+	return r.client.Patch(ctx, handover, client.Apply, client.FieldOwner(handoverFieldManager))
+}
+
+// ownsField reports whether the field at path, such as f:spec, f:replicas, is applied by the given field manager.
+func ownsField(obj metav1.Object, manager string, path ...string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, found, _ := unstructured.NestedFieldNoCopy(fields, path...); found {
+			return true
+		}
+	}
+	return false
+}
+
 func objectCanUpdate(obj client.Object) bool {
 	if obj.GetAnnotations()["ignore_controller_update"] == "true" {
 		return false
@@ -0,0 +1,249 @@
+package componentmgr
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type fakeReplicaser struct {
+	replicas *int32
+}
+
+func (f *fakeReplicaser) Replicas() *int32 {
+	return f.replicas
+}
+
+func TestPodDisruptionBudget(t *testing.T) {
+	one := intstr.FromInt(1)
+	percent := intstr.FromString("50%")
+	tests := []struct {
+		name               string
+		replicas           *int32
+		replicaser         *fakeReplicaser
+		policy             *rainbondv1alpha1.PodDisruptionBudgetSpec
+		wantNil            bool
+		wantMinAvailable   *intstr.IntOrString
+		wantMaxUnavailable *intstr.IntOrString
+	}{
+		{name: "default replicas", wantNil: true},
+		{name: "one replica", replicas: commonutil.Int32(1), wantNil: true},
+		{name: "three replicas", replicas: commonutil.Int32(3), wantMinAvailable: intstrPtr(intstr.FromInt(2))},
+		{
+			name:             "replicas from replicaser",
+			replicas:         commonutil.Int32(1),
+			replicaser:       &fakeReplicaser{replicas: commonutil.Int32(2)},
+			wantMinAvailable: &one,
+		},
+		{
+			name:       "one replica from replicaser",
+			replicas:   commonutil.Int32(3),
+			replicaser: &fakeReplicaser{replicas: commonutil.Int32(1)},
+			wantNil:    true,
+		},
+		{
+			name:               "max unavailable",
+			replicas:           commonutil.Int32(3),
+			policy:             &rainbondv1alpha1.PodDisruptionBudgetSpec{MaxUnavailable: &percent},
+			wantMaxUnavailable: &percent,
+		},
+		{
+			name:     "disabled",
+			replicas: commonutil.Int32(3),
+			policy:   &rainbondv1alpha1.PodDisruptionBudgetSpec{Disabled: true},
+			wantNil:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpt := &rainbondv1alpha1.RbdComponent{
+				ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+				Spec: rainbondv1alpha1.RbdComponentSpec{
+					Replicas:            tc.replicas,
+					PodDisruptionBudget: tc.policy,
+				},
+			}
+			mgr := NewRbdcomponentMgr(context.Background(), nil, nil, ctrl.Log, cpt)
+			if tc.replicaser != nil {
+				mgr.SetReplicaser(tc.replicaser)
+			}
+
+			pdb := mgr.PodDisruptionBudget()
+			if tc.wantNil {
+				assert.Nil(t, pdb)
+				return
+			}
+			if assert.NotNil(t, pdb) {
+				assert.Equal(t, "rbd-api", pdb.Name)
+				assert.Equal(t, "rbd-api", pdb.Spec.Selector.MatchLabels["name"])
+				assert.Equal(t, tc.wantMinAvailable, pdb.Spec.MinAvailable)
+				assert.Equal(t, tc.wantMaxUnavailable, pdb.Spec.MaxUnavailable)
+			}
+		})
+	}
+}
+
+func intstrPtr(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
+
+func TestHorizontalPodAutoscalerReplicas(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cpt := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system", UID: "foobar"},
+		Spec: rainbondv1alpha1.RbdComponentSpec{
+			Replicas:    commonutil.Int32(1),
+			Autoscaling: &rainbondv1alpha1.AutoscalingSpec{MaxReplicas: 5},
+		},
+	}
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{Kind: "Deployment", Name: "rbd-api"},
+			MaxReplicas:    5,
+		},
+		Status: autoscalingv2beta2.HorizontalPodAutoscalerStatus{CurrentReplicas: 3},
+	}
+	if err := controllerutil.SetControllerReference(cpt, hpa, scheme); err != nil {
+		t.Fatal(err)
+	}
+	cli := fake.NewFakeClientWithScheme(scheme, hpa)
+	mgr := NewRbdcomponentMgr(context.Background(), cli, nil, ctrl.Log, cpt)
+
+	mgr.GenerateStatus(nil)
+	assert.Equal(t, int32(3), cpt.Status.Replicas)
+
+	desired := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: cpt.Spec.Replicas}}
+	desired.Name = "rbd-api"
+	updated := mgr.updateRuntimeObject(desired).(*appsv1.Deployment)
+	// the replicas are left to the autoscaler.
+	assert.Nil(t, updated.Spec.Replicas)
+
+	// the autoscaler is not owned by the component.
+	cpt.Spec.Autoscaling = nil
+	mgr.GenerateStatus(nil)
+	assert.Equal(t, int32(1), cpt.Status.Replicas)
+}
+
+// patchRecorder records the patches instead of sending them, the fake client does not support server-side apply.
+// The dry-run patches are not recorded, the managed fields of their results are set to dryRunManagedFields.
+type patchRecorder struct {
+	client.Client
+	dryRunManagedFields []metav1.ManagedFieldsEntry
+	patches             []client.Object
+}
+
+func (p *patchRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patchOptions := &client.PatchOptions{}
+	patchOptions.ApplyOptions(opts)
+	if len(patchOptions.DryRun) > 0 {
+		obj.SetManagedFields(p.dryRunManagedFields)
+		return nil
+	}
+	p.patches = append(p.patches, obj)
+	return nil
+}
+
+func TestHandoverReplicas(t *testing.T) {
+	cpt := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+		Spec:       rainbondv1alpha1.RbdComponentSpec{Autoscaling: &rainbondv1alpha1.AutoscalingSpec{MaxReplicas: 5}},
+	}
+	old := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rbd-api",
+			Namespace: "rbd-system",
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:   FieldManager,
+				Operation: metav1.ManagedFieldsOperationApply,
+				FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{},"f:template":{}}}`)},
+			}},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: commonutil.Int32(3)},
+	}
+	cli := &patchRecorder{}
+	mgr := NewRbdcomponentMgr(context.Background(), cli, nil, ctrl.Log, cpt)
+
+	assert.NoError(t, mgr.handoverReplicas(context.Background(), old))
+	if assert.Len(t, cli.patches, 1) {
+		replicas, _, _ := unstructured.NestedInt64(cli.patches[0].(*unstructured.Unstructured).Object, "spec", "replicas")
+		assert.Equal(t, int64(3), replicas)
+	}
+
+	// the replicas have been handed over, or are owned by the autoscaler.
+	old.ManagedFields[0].FieldsV1.Raw = []byte(`{"f:spec":{"f:template":{}}}`)
+	assert.NoError(t, mgr.handoverReplicas(context.Background(), old))
+	assert.Len(t, cli.patches, 1)
+}
+
+func TestWaitingDependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	etcd := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-etcd", Namespace: "rbd-system"},
+		Status: rainbondv1alpha1.RbdComponentStatus{
+			Replicas:      1,
+			ReadyReplicas: 1,
+			Conditions: []rainbondv1alpha1.RbdComponentCondition{
+				{Type: rainbondv1alpha1.RbdComponentReady, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+	db := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-db", Namespace: "rbd-system"},
+		Status:     rainbondv1alpha1.RbdComponentStatus{Replicas: 1},
+	}
+	cpt := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+	}
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+
+	cli := fake.NewFakeClientWithScheme(scheme, etcd)
+	mgr := NewRbdcomponentMgr(context.Background(), cli, nil, ctrl.Log, cpt)
+	waiting, err := mgr.WaitingDependencies(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"rbd-db"}, waiting)
+
+	cli = fake.NewFakeClientWithScheme(scheme, etcd, db)
+	mgr = NewRbdcomponentMgr(context.Background(), cli, nil, ctrl.Log, cpt)
+	waiting, err = mgr.WaitingDependencies(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"rbd-db"}, waiting)
+
+	// use an external database.
+	cluster.Spec.RegionDatabase = &rainbondv1alpha1.Database{Host: "127.0.0.1"}
+	waiting, err = mgr.WaitingDependencies(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, waiting)
+}
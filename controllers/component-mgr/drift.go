@@ -0,0 +1,263 @@
+package componentmgr
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+// maxDriftedFields is the maximum number of drifted fields recorded for a resource.
+const maxDriftedFields = 10
+
+// ignoredMetadataFields are maintained by the api server, they change on every write.
+var ignoredMetadataFields = []string{"managedFields", "resourceVersion", "generation", "creationTimestamp", "uid", "selfLink"}
+
+// changedFields returns the paths of the fields which are different between the current object and the desired one.
+// The desired object is expected to be the result of a dry-run apply, so that the defaults are filled in.
+// The changes include the intended ones, such as a new image, not only the drifted fields.
+func changedFields(current, desired client.Object) ([]string, error) {
+	cur, des, err := toUnstructured(current, desired)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range []map[string]interface{}{cur, des} {
+		delete(obj, "apiVersion")
+		delete(obj, "kind")
+		delete(obj, "status")
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			for _, field := range ignoredMetadataFields {
+				delete(metadata, field)
+			}
+		}
+	}
+
+	var fields []string
+	diffValue("", cur, des, &fields)
+	return fields, nil
+}
+
+// driftedFields returns the paths of the fields applied by FieldManager, which have been changed by other field managers
+// since the last apply. The desired object is expected to be the result of a dry-run apply, whose managed fields tell
+// the fields applied by FieldManager. The fields only changed by the desired state, such as a new image, are not drifted.
+func driftedFields(current, desired client.Object) ([]string, error) {
+	applied, err := managedFieldSet(desired, func(entry metav1.ManagedFieldsEntry) bool {
+		return entry.Manager == FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply
+	})
+	if err != nil {
+		return nil, err
+	}
+	others, err := managedFieldSet(current, func(entry metav1.ManagedFieldsEntry) bool {
+		return entry.Manager != FieldManager && entry.Manager != handoverFieldManager
+	})
+	if err != nil {
+		return nil, err
+	}
+	cur, des, err := toUnstructured(current, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	applied.Intersection(others).Iterate(func(path fieldpath.Path) {
+		curValue, curFound := valueAt(cur, path)
+		desValue, desFound := valueAt(des, path)
+		if curFound == desFound && reflect.DeepEqual(curValue, desValue) {
+			return
+		}
+		paths = append(paths, strings.TrimPrefix(path.String(), "."))
+	})
+	sort.Strings(paths)
+
+	// only keep the innermost fields, the values of their parents are different as well.
+	var fields []string
+	for _, path := range paths {
+		if !hasChildPath(path, paths) {
+			fields = append(fields, path)
+		}
+	}
+	return fields, nil
+}
+
+func hasChildPath(parent string, paths []string) bool {
+	for _, path := range paths {
+		if strings.HasPrefix(path, parent+".") || strings.HasPrefix(path, parent+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// managedFieldSet returns the union of the fields managed by the managed fields entries of obj selected by the filter.
+func managedFieldSet(obj client.Object, filter func(entry metav1.ManagedFieldsEntry) bool) (*fieldpath.Set, error) {
+	set := &fieldpath.Set{}
+	for _, entry := range obj.GetManagedFields() {
+		if !filter(entry) || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := &fieldpath.Set{}
+		if err := fields.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, fmt.Errorf("decode managed fields of %s: %v", entry.Manager, err)
+		}
+		set = set.Union(fields)
+	}
+	return set, nil
+}
+
+// valueAt returns the value at the path in the unstructured object.
+func valueAt(obj interface{}, path fieldpath.Path) (interface{}, bool) {
+	for _, element := range path {
+		switch {
+		case element.FieldName != nil:
+			m, ok := obj.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if obj, ok = m[*element.FieldName]; !ok {
+				return nil, false
+			}
+		case element.Index != nil:
+			list, ok := obj.([]interface{})
+			if !ok || *element.Index >= len(list) {
+				return nil, false
+			}
+			obj = list[*element.Index]
+		default:
+			list, ok := obj.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			var found bool
+			for _, item := range list {
+				if listElementMatches(item, element) {
+					obj, found = item, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		}
+	}
+	return obj, true
+}
+
+// listElementMatches reports whether the item of an associative list or a set is selected by the path element.
+func listElementMatches(item interface{}, element fieldpath.PathElement) bool {
+	if element.Value != nil {
+		return value.Equals(value.NewValueInterface(item), *element.Value)
+	}
+	m, ok := item.(map[string]interface{})
+	if !ok || element.Key == nil {
+		return false
+	}
+	for _, key := range *element.Key {
+		field, ok := m[key.Name]
+		if !ok || !value.Equals(value.NewValueInterface(field), key.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func toUnstructured(current, desired client.Object) (map[string]interface{}, map[string]interface{}, error) {
+	cur, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return nil, nil, fmt.Errorf("convert current object to unstructured: %v", err)
+	}
+	des, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, nil, fmt.Errorf("convert desired object to unstructured: %v", err)
+	}
+	return cur, des, nil
+}
+
+func diffValue(path string, current, desired interface{}, fields *[]string) {
+	switch des := desired.(type) {
+	case map[string]interface{}:
+		cur, ok := current.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{})
+		for key := range cur {
+			keys[key] = struct{}{}
+		}
+		for key := range des {
+			keys[key] = struct{}{}
+		}
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+		for _, key := range sortedKeys {
+			diffValue(joinFieldPath(path, key), cur[key], des[key], fields)
+		}
+		return
+	case []interface{}:
+		cur, ok := current.([]interface{})
+		if !ok || len(cur) != len(des) {
+			break
+		}
+		for i := range des {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), cur[i], des[i], fields)
+		}
+		return
+	}
+	if !reflect.DeepEqual(current, desired) {
+		*fields = append(*fields, path)
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// recordDrift records the drifted resource in the status and events of the rbdcomponent.
+func (r *RbdcomponentMgr) recordDrift(kind, name string, fields []string) {
+	if len(fields) > maxDriftedFields {
+		fields = append(fields[:maxDriftedFields:maxDriftedFields], fmt.Sprintf("and %d more", len(fields)-maxDriftedFields))
+	}
+	r.log.Info("Resource drifted", "Kind", kind, "Name", name, "Fields", fields)
+	if r.recorder != nil {
+		r.recorder.Eventf(r.cpt, corev1.EventTypeWarning, "ResourceDrifted", "%s %s drifted: %s", kind, name, strings.Join(fields, ", "))
+	}
+
+	drifted := rainbondv1alpha1.DriftedResource{
+		Kind:          kind,
+		Name:          name,
+		Fields:        fields,
+		LastDriftTime: metav1.Now(),
+	}
+	for i := range r.cpt.Status.DriftedResources {
+		if r.cpt.Status.DriftedResources[i].Kind == kind && r.cpt.Status.DriftedResources[i].Name == name {
+			r.cpt.Status.DriftedResources[i] = drifted
+			return
+		}
+	}
+	r.cpt.Status.DriftedResources = append(r.cpt.Status.DriftedResources, drifted)
+}
+
+// clearDrift removes the resource from the drifted resources in the status of the rbdcomponent,
+// once it is found without drifted fields.
+func (r *RbdcomponentMgr) clearDrift(kind, name string) {
+	for i := range r.cpt.Status.DriftedResources {
+		if r.cpt.Status.DriftedResources[i].Kind == kind && r.cpt.Status.DriftedResources[i].Name == name {
+			r.cpt.Status.DriftedResources = append(r.cpt.Status.DriftedResources[:i], r.cpt.Status.DriftedResources[i+1:]...)
+			return
+		}
+	}
+}
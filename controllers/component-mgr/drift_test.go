@@ -0,0 +1,251 @@
+package componentmgr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newDriftTestDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rbd-api",
+			Namespace: "rbd-system",
+			Labels:    map[string]string{"name": "rbd-api"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: commonutil.Int32(1),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "rbd-api", Image: "rainbond/rbd-api:v5.3.0"}},
+				},
+			},
+		},
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(current *appsv1.Deployment)
+		want   []string
+	}{
+		{
+			name: "no drift",
+			mutate: func(current *appsv1.Deployment) {
+				// maintained by the api server.
+				current.ResourceVersion = "12"
+				current.Generation = 3
+				current.UID = "foobar"
+				current.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+				current.Status.ReadyReplicas = 1
+			},
+		},
+		{
+			name: "image changed",
+			mutate: func(current *appsv1.Deployment) {
+				current.Spec.Template.Spec.Containers[0].Image = "rainbond/rbd-api:v5.2.0"
+			},
+			want: []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name: "container added",
+			mutate: func(current *appsv1.Deployment) {
+				current.Spec.Template.Spec.Containers = append(current.Spec.Template.Spec.Containers, corev1.Container{Name: "sidecar"})
+			},
+			want: []string{"spec.template.spec.containers"},
+		},
+		{
+			name: "labels changed",
+			mutate: func(current *appsv1.Deployment) {
+				current.Labels["name"] = "foo"
+				current.Spec.Replicas = commonutil.Int32(2)
+			},
+			want: []string{"metadata.labels.name", "spec.replicas"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			current := newDriftTestDeployment()
+			tc.mutate(current)
+			got, err := changedFields(current, newDriftTestDeployment())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// appliedFields are the fields of the deployment from newDriftTestDeployment applied by FieldManager.
+const appliedFields = `{"f:metadata":{"f:labels":{"f:name":{}}},"f:spec":{"f:replicas":{},"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"rbd-api\"}":{".":{},"f:image":{},"f:name":{}}}}}}}`
+
+func managedFieldsEntry(manager string, operation metav1.ManagedFieldsOperationType, fields string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{Manager: manager, Operation: operation, FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)}}
+}
+
+func TestDriftedFields(t *testing.T) {
+	tests := []struct {
+		name          string
+		mutate        func(current *appsv1.Deployment)
+		managedFields []metav1.ManagedFieldsEntry
+		want          []string
+	}{
+		{
+			name: "image upgraded",
+			mutate: func(current *appsv1.Deployment) {
+				current.Spec.Template.Spec.Containers[0].Image = "rainbond/rbd-api:v5.2.0"
+			},
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields)},
+		},
+		{
+			name: "image changed by others",
+			mutate: func(current *appsv1.Deployment) {
+				current.Spec.Template.Spec.Containers[0].Image = "rainbond/rbd-api:dev"
+			},
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, `{"f:metadata":{"f:labels":{"f:name":{}}},"f:spec":{"f:replicas":{}}}`),
+				managedFieldsEntry("kubectl-edit", metav1.ManagedFieldsOperationUpdate,
+					`{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"rbd-api\"}":{"f:image":{}}}}}}}`),
+			},
+			want: []string{`spec.template.spec.containers[name="rbd-api"].image`},
+		},
+		{
+			name: "same replicas applied by others",
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields),
+				managedFieldsEntry("kubectl", metav1.ManagedFieldsOperationApply, `{"f:spec":{"f:replicas":{}}}`),
+			},
+		},
+		{
+			name: "replicas scaled by others",
+			mutate: func(current *appsv1.Deployment) {
+				current.Spec.Replicas = commonutil.Int32(3)
+			},
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields),
+				managedFieldsEntry("kubectl", metav1.ManagedFieldsOperationUpdate, `{"f:spec":{"f:replicas":{}}}`),
+			},
+			want: []string{"spec.replicas"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			current := newDriftTestDeployment()
+			if tc.mutate != nil {
+				tc.mutate(current)
+			}
+			current.ManagedFields = tc.managedFields
+			desired := newDriftTestDeployment()
+			desired.ManagedFields = []metav1.ManagedFieldsEntry{managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields)}
+			got, err := driftedFields(current, desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestUpdateOrCreateResourceDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		managedFields []metav1.ManagedFieldsEntry
+		wantDrifted   []string
+	}{
+		{
+			name:          "upgraded",
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields)},
+		},
+		{
+			name: "changed by others",
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, `{"f:metadata":{"f:labels":{"f:name":{}}},"f:spec":{"f:replicas":{}}}`),
+				managedFieldsEntry("kubectl-edit", metav1.ManagedFieldsOperationUpdate,
+					`{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"rbd-api\"}":{"f:image":{}}}}}}}`),
+			},
+			wantDrifted: []string{`spec.template.spec.containers[name="rbd-api"].image`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			current := newDriftTestDeployment()
+			current.Spec.Template.Spec.Containers[0].Image = "rainbond/rbd-api:v5.2.0"
+			current.ManagedFields = tc.managedFields
+			cli := &patchRecorder{
+				Client:              fake.NewFakeClientWithScheme(scheme, current),
+				dryRunManagedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry(FieldManager, metav1.ManagedFieldsOperationApply, appliedFields)},
+			}
+			cpt := &rainbondv1alpha1.RbdComponent{ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"}}
+			// drifted in the last reconciliation.
+			cpt.Status.DriftedResources = []rainbondv1alpha1.DriftedResource{
+				{Kind: "Deployment", Name: "rbd-api", Fields: []string{"spec.replicas"}},
+			}
+			recorder := record.NewFakeRecorder(10)
+			mgr := NewRbdcomponentMgr(context.Background(), cli, recorder, ctrl.Log, cpt)
+
+			if _, err := mgr.UpdateOrCreateResource(newDriftTestDeployment()); err != nil {
+				t.Fatal(err)
+			}
+			// the desired state is applied either way.
+			assert.Len(t, cli.patches, 1)
+			if tc.wantDrifted == nil {
+				assert.Empty(t, cpt.Status.DriftedResources)
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			if assert.Len(t, cpt.Status.DriftedResources, 1) {
+				assert.Equal(t, tc.wantDrifted, cpt.Status.DriftedResources[0].Fields)
+			}
+			assert.Len(t, recorder.Events, 1)
+		})
+	}
+}
+
+func TestRecordDrift(t *testing.T) {
+	cpt := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-system"},
+	}
+	recorder := record.NewFakeRecorder(10)
+	mgr := NewRbdcomponentMgr(context.Background(), nil, recorder, ctrl.Log, cpt)
+
+	mgr.recordDrift("Deployment", "rbd-api", []string{"spec.replicas"})
+	mgr.recordDrift("Service", "rbd-api-api", []string{"spec.ports"})
+	var fields []string
+	for i := 0; i < maxDriftedFields+2; i++ {
+		fields = append(fields, fmt.Sprintf("metadata.labels.l%d", i))
+	}
+	mgr.recordDrift("Deployment", "rbd-api", fields)
+
+	if assert.Len(t, cpt.Status.DriftedResources, 2) {
+		deploy := cpt.Status.DriftedResources[0]
+		assert.Equal(t, "Deployment", deploy.Kind)
+		assert.Len(t, deploy.Fields, maxDriftedFields+1)
+		assert.Equal(t, "and 2 more", deploy.Fields[maxDriftedFields])
+		assert.Equal(t, "Service", cpt.Status.DriftedResources[1].Kind)
+	}
+	assert.Len(t, recorder.Events, 3)
+
+	mgr.clearDrift("Deployment", "rbd-api")
+	mgr.clearDrift("Deployment", "rbd-worker")
+	if assert.Len(t, cpt.Status.DriftedResources, 1) {
+		assert.Equal(t, "Service", cpt.Status.DriftedResources[0].Kind)
+	}
+}
@@ -85,6 +85,7 @@ func (a *api) Before() error {
 func (a *api) Resources() []client.Object {
 	resources := a.secretAndConfigMapForAPI()
 	resources = append(resources, a.deployment())
+	resources = append(resources, horizontalPodAutoscaler(a.component, APIName, a.labels))
 	resources = append(resources, a.createService()...)
 	resources = append(resources, a.ingressForAPI())
 	resources = append(resources, a.ingressForWebsocket())
@@ -225,6 +226,7 @@ func (a *api) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, a.component)
 
 	return ds
 }
@@ -241,10 +241,7 @@ func (c *chaos) deployment() client.Object {
 			Name:  "BUILD_IMAGE_REPOSTORY_USER",
 			Value: imageHub.Username,
 		})
-		env = append(env, corev1.EnvVar{
-			Name:  "BUILD_IMAGE_REPOSTORY_PASS",
-			Value: imageHub.Password,
-		})
+		env = append(env, k8sutil.EnvVarFromSecretKeyRef("BUILD_IMAGE_REPOSTORY_PASS", imageHub.Password, imageHub.PasswordSecretRef))
 	}
 
 	env = mergeEnvs(env, c.component.Spec.Env)
@@ -297,6 +294,7 @@ func (c *chaos) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, c.component)
 
 	return ds
 }
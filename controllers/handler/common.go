@@ -14,6 +14,7 @@ import (
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -50,7 +51,11 @@ func LabelsForRainbondComponent(cpt *rainbondv1alpha1.RbdComponent) map[string]s
 func getDefaultDBInfo(ctx context.Context, cli client.Client, in *rainbondv1alpha1.Database, namespace, name string) (*rainbondv1alpha1.Database, error) {
 	if in != nil {
 		// use custom db
-		return in, nil
+		db, err := rbdutil.ResolveDatabase(ctx, cli, namespace, in)
+		if err != nil {
+			return nil, fmt.Errorf("resolve database password: %v", err)
+		}
+		return db, nil
 	}
 
 	secret := &corev1.Secret{}
@@ -301,23 +306,6 @@ func listPods(ctx context.Context, cli client.Client, namespace string, labels m
 	return podList.Items, nil
 }
 
-func isEtcdAvailable(ctx context.Context, cli client.Client, cpt *rainbondv1alpha1.RbdComponent, cluster *rainbondv1alpha1.RainbondCluster) error {
-	if cluster.Spec.EtcdConfig != nil {
-		return nil
-	}
-
-	dbcpt := &rainbondv1alpha1.RbdComponent{}
-	if err := cli.Get(ctx, types.NamespacedName{Namespace: cpt.Namespace, Name: EtcdName}, dbcpt); err != nil {
-		return err
-	}
-
-	if dbcpt.Status.ReadyReplicas == 0 {
-		return errors.New("no ready replicas for rbdcomponent rbd-etcd")
-	}
-
-	return nil
-}
-
 func getStorageRequest(env string, defSize int64) int64 {
 	storageRequest, _ := strconv.ParseInt(os.Getenv(env), 10, 64)
 	if storageRequest == 0 {
@@ -327,8 +315,8 @@ func getStorageRequest(env string, defSize int64) int64 {
 }
 
 func imagePullSecrets(cpt *rainbondv1alpha1.RbdComponent, cluster *rainbondv1alpha1.RainbondCluster) []corev1.LocalObjectReference {
-	// pirority component does not support pulling images with credentials
-	if cpt.Spec.PriorityComponent {
+	// the components installed before the rainbondpackage do not pull images from the local image repository.
+	if InstalledBeforePackage(cpt, cluster) {
 		return nil
 	}
 	if cluster.Status.ImagePullSecret == nil {
@@ -405,3 +393,160 @@ func mergeVolumeMounts(commonMountVolumes, priorityMountVolumes []corev1.VolumeM
 	}
 	return priorityMountVolumes
 }
+
+// mergeStringMap merges the priority map over the common map by key.
+func mergeStringMap(commonMap, priorityMap map[string]string) map[string]string {
+	if len(priorityMap) == 0 {
+		return commonMap
+	}
+	merged := make(map[string]string, len(commonMap)+len(priorityMap))
+	for key, value := range commonMap {
+		merged[key] = value
+	}
+	for key, value := range priorityMap {
+		merged[key] = value
+	}
+	return merged
+}
+
+// mergeTolerations returns the priority tolerations if there are any, otherwise the common ones.
+// They are not merged, or the default tolerations such as the one tolerating every taint could never be removed.
+func mergeTolerations(commonTolerations, priorityTolerations []corev1.Toleration) []corev1.Toleration {
+	if len(priorityTolerations) == 0 {
+		return commonTolerations
+	}
+	return append([]corev1.Toleration(nil), priorityTolerations...)
+}
+
+func mergeAffinity(commonAffinity, priorityAffinity *corev1.Affinity) *corev1.Affinity {
+	if priorityAffinity == nil {
+		return commonAffinity
+	}
+	if commonAffinity == nil {
+		return priorityAffinity
+	}
+	affinity := commonAffinity.DeepCopy()
+	if priorityAffinity.NodeAffinity != nil {
+		affinity.NodeAffinity = priorityAffinity.NodeAffinity
+	}
+	if priorityAffinity.PodAffinity != nil {
+		affinity.PodAffinity = priorityAffinity.PodAffinity
+	}
+	if priorityAffinity.PodAntiAffinity != nil {
+		affinity.PodAntiAffinity = priorityAffinity.PodAntiAffinity
+	}
+	return affinity
+}
+
+func mergeTopologySpreadConstraints(commonConstraints, priorityConstraints []corev1.TopologySpreadConstraint) []corev1.TopologySpreadConstraint {
+	set := make(map[string]struct{})
+	for _, constraint := range priorityConstraints {
+		set[constraint.TopologyKey+"/"+string(constraint.WhenUnsatisfiable)] = struct{}{}
+	}
+	constraints := append([]corev1.TopologySpreadConstraint(nil), priorityConstraints...)
+	for _, constraint := range commonConstraints {
+		if _, ok := set[constraint.TopologyKey+"/"+string(constraint.WhenUnsatisfiable)]; ok {
+			continue
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+// mergeScheduling merges the scheduling controls of the component over the defaults in podSpec.
+func mergeScheduling(podSpec *corev1.PodSpec, component *rainbondv1alpha1.RbdComponent) {
+	podSpec.NodeSelector = mergeStringMap(podSpec.NodeSelector, component.Spec.NodeSelector)
+	podSpec.Tolerations = mergeTolerations(podSpec.Tolerations, component.Spec.Tolerations)
+	podSpec.Affinity = mergeAffinity(podSpec.Affinity, component.Spec.Affinity)
+	podSpec.TopologySpreadConstraints = mergeTopologySpreadConstraints(podSpec.TopologySpreadConstraints, component.Spec.TopologySpreadConstraints)
+	if component.Spec.PriorityClassName != "" {
+		podSpec.PriorityClassName = component.Spec.PriorityClassName
+	}
+}
+
+func mergeContainer(container *corev1.Container, component *rainbondv1alpha1.RbdComponent) {
+	container.Resources = mergeResources(container.Resources, component.Spec.Resources)
+	if component.Spec.LivenessProbe != nil {
+		container.LivenessProbe = component.Spec.LivenessProbe.DeepCopy()
+	}
+	if component.Spec.ReadinessProbe != nil {
+		container.ReadinessProbe = component.Spec.ReadinessProbe.DeepCopy()
+	}
+	if component.Spec.StartupProbe != nil {
+		container.StartupProbe = component.Spec.StartupProbe.DeepCopy()
+	}
+	if component.Spec.SecurityContext != nil {
+		container.SecurityContext = component.Spec.SecurityContext.DeepCopy()
+	}
+}
+
+// mergePodTemplate merges the pod template overrides of the component over the defaults in template,
+// including the scheduling controls, and the resources, probes and security context of the main container,
+// which is named after the component. The sidecars, such as the exporter of rbd-db, keep their own.
+func mergePodTemplate(template *corev1.PodTemplateSpec, component *rainbondv1alpha1.RbdComponent) {
+	template.Annotations = mergeStringMap(template.Annotations, component.Spec.PodAnnotations)
+	if len(component.Spec.PodLabels) > 0 {
+		// the default labels are used by the selector, so they can not be overridden.
+		template.Labels = mergeStringMap(component.Spec.PodLabels, template.Labels)
+	}
+	mergeScheduling(&template.Spec, component)
+	if component.Spec.PodSecurityContext != nil {
+		template.Spec.SecurityContext = component.Spec.PodSecurityContext.DeepCopy()
+	}
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == component.Name {
+			mergeContainer(&template.Spec.Containers[i], component)
+		}
+	}
+}
+
+func resourceUtilizationMetric(name corev1.ResourceName, averageUtilization int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: commonutil.Int32(averageUtilization),
+			},
+		},
+	}
+}
+
+// horizontalPodAutoscaler returns the horizontal pod autoscaler for the deployment of the component,
+// or nil if the autoscaling of the component is not enabled.
+func horizontalPodAutoscaler(component *rainbondv1alpha1.RbdComponent, deployment string, labels map[string]string) client.Object {
+	autoscaling := component.Spec.Autoscaling
+	if autoscaling == nil {
+		return nil
+	}
+
+	var metrics []autoscalingv2beta2.MetricSpec
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, resourceUtilizationMetric(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, resourceUtilizationMetric(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	for _, metric := range autoscaling.Metrics {
+		metrics = append(metrics, *metric.DeepCopy())
+	}
+
+	return &autoscalingv2beta2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      component.Name,
+			Namespace: component.Namespace,
+			Labels:    labels,
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deployment,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+}
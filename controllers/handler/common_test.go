@@ -5,11 +5,20 @@ import (
 	"testing"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	kubeaggregatorv1beta1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -44,6 +53,51 @@ func TestGetDefaultInfo(t *testing.T) {
 	assert.Equal(t, "write", dbInfo.Username)
 }
 
+func TestGetDefaultInfoWithPasswordSecretRef(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := "rbd-system"
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "region-db",
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"password": []byte("foobar"),
+		},
+	}
+	clientset := fake.NewFakeClientWithScheme(scheme, secret)
+
+	in := &rainbondv1alpha1.Database{
+		Host:     "127.0.0.1",
+		Port:     3306,
+		Username: "write",
+		Password: "deprecated",
+		PasswordSecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "region-db"},
+			Key:                  "password",
+		},
+	}
+	dbInfo, err := getDefaultDBInfo(ctx, clientset, in, namespace, DBName)
+	if err != nil {
+		t.Errorf("get db info: %v", err)
+		t.FailNow()
+	}
+	assert.Equal(t, "foobar", dbInfo.Password)
+	assert.Equal(t, "write", dbInfo.Username)
+	// the custom db in spec should not be changed.
+	assert.Equal(t, "deprecated", in.Password)
+
+	in.PasswordSecretRef.Key = "notfound"
+	_, err = getDefaultDBInfo(ctx, clientset, in, namespace, DBName)
+	assert.NotNil(t, err)
+}
+
 func TestStorageClassRWXVolumeNotFound(t *testing.T) {
 	scheme := runtime.NewScheme()
 	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
@@ -277,3 +331,233 @@ func TestMergeArgs(t *testing.T) {
 	args := mergeArgs(commonArgs, priorityArgs)
 	assert.ElementsMatch(t, expectArgs, args)
 }
+
+func TestMergeTolerations(t *testing.T) {
+	commonTolerations := []corev1.Toleration{
+		{Operator: corev1.TolerationOpExists},
+		{Key: "node-role.kubernetes.io/master", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+	priorityTolerations := []corev1.Toleration{
+		{Key: "node-role.kubernetes.io/master", Operator: corev1.TolerationOpEqual, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+	// the tolerations of the component replace the defaults, including the one tolerating every taint.
+	tolerations := mergeTolerations(commonTolerations, priorityTolerations)
+	assert.Equal(t, priorityTolerations, tolerations)
+	// the defaults are used if the component has no tolerations.
+	tolerations = mergeTolerations(commonTolerations, nil)
+	assert.Equal(t, commonTolerations, tolerations)
+}
+
+func TestMergeScheduling(t *testing.T) {
+	defaultAffinity := affinityForRequiredNodes([]string{"node1"})
+	podSpec := &corev1.PodSpec{
+		NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		Affinity:     defaultAffinity,
+	}
+	podAntiAffinity := &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+			{Weight: 100, PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"}},
+		},
+	}
+	component := &rainbondv1alpha1.RbdComponent{
+		Spec: rainbondv1alpha1.RbdComponentSpec{
+			NodeSelector: map[string]string{"gpu": "false"},
+			Affinity:     &corev1.Affinity{PodAntiAffinity: podAntiAffinity},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+				{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+			},
+			PriorityClassName: "system-cluster-critical",
+		},
+	}
+
+	mergeScheduling(podSpec, component)
+
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "linux", "gpu": "false"}, podSpec.NodeSelector)
+	assert.Equal(t, []corev1.Toleration{{Operator: corev1.TolerationOpExists}}, podSpec.Tolerations)
+	assert.Equal(t, defaultAffinity.NodeAffinity, podSpec.Affinity.NodeAffinity)
+	assert.Equal(t, podAntiAffinity, podSpec.Affinity.PodAntiAffinity)
+	assert.Equal(t, component.Spec.TopologySpreadConstraints, podSpec.TopologySpreadConstraints)
+	assert.Equal(t, "system-cluster-critical", podSpec.PriorityClassName)
+	// the default affinity is not changed.
+	assert.Nil(t, defaultAffinity.PodAntiAffinity)
+}
+
+func TestMergePodTemplate(t *testing.T) {
+	livenessProbe := &corev1.Probe{
+		Handler:             corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8080)}},
+		InitialDelaySeconds: 30,
+	}
+	readinessProbe := &corev1.Probe{
+		Handler:       corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(8080)}},
+		PeriodSeconds: 5,
+	}
+	startupProbe := &corev1.Probe{
+		Handler:          corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"true"}}},
+		FailureThreshold: 30,
+	}
+	podSecurityContext := &corev1.PodSecurityContext{RunAsUser: commonutil.Int64(1000), FSGroup: commonutil.Int64(1000)}
+	securityContext := &corev1.SecurityContext{RunAsNonRoot: commonutil.Bool(true)}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeaggregatorv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	dbSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: DBName, Namespace: "rbd-system"},
+		Data: map[string][]byte{
+			mysqlPasswordKey: []byte("foobar"),
+			mysqlUserKey:     []byte("write"),
+		},
+	}
+	etcd := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: EtcdName, Namespace: "rbd-system"},
+		Status:     rainbondv1alpha1.RbdComponentStatus{ReadyReplicas: 1},
+	}
+	volume := &rainbondv1alpha1.RainbondVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondvolumerwx", Namespace: "rbd-system", Labels: rbdutil.LabelsForAccessModeRWX()},
+		Spec:       rainbondv1alpha1.RainbondVolumeSpec{StorageClassName: "rainbondsssc"},
+	}
+
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, client client.Client, component *rainbondv1alpha1.RbdComponent, cluster *rainbondv1alpha1.RainbondCluster) ComponentHandler
+	}{
+		{name: APIName, fn: NewAPI},
+		{name: ChaosName, fn: NewChaos},
+		{name: DashboardMetricsScraperName, fn: NewDashboardMetricsScraper},
+		{name: DBName, fn: NewDB},
+		{name: EtcdName, fn: NewETCD},
+		{name: EventLogName, fn: NewEventLog},
+		{name: GatewayName, fn: NewGateway},
+		{name: HubName, fn: NewHub},
+		{name: KubernetesDashboardName, fn: NewK8sDashboard},
+		{name: MetricsServerName, fn: NewMetricsServer},
+		{name: MonitorName, fn: NewMonitor},
+		{name: MQName, fn: NewMQ},
+		{name: NodeName, fn: NewNode},
+		{name: ResourceProxyName, fn: NewResourceProxy},
+		{name: WorkerName, fn: NewWorker},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			component := &rainbondv1alpha1.RbdComponent{
+				ObjectMeta: metav1.ObjectMeta{Name: tc.name, Namespace: "rbd-system"},
+				Spec: rainbondv1alpha1.RbdComponentSpec{
+					Replicas:           commonutil.Int32(1),
+					Image:              "goodrain.me/" + tc.name + ":v5.3.0",
+					Resources:          resources,
+					NodeSelector:       map[string]string{"gpu": "false"},
+					LivenessProbe:      livenessProbe,
+					ReadinessProbe:     readinessProbe,
+					StartupProbe:       startupProbe,
+					PodSecurityContext: podSecurityContext,
+					SecurityContext:    securityContext,
+					PodAnnotations:     map[string]string{"foo": "bar"},
+					PodLabels:          map[string]string{"foo": "bar", "name": "override"},
+				},
+			}
+			cluster := &rainbondv1alpha1.RainbondCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system"},
+				Spec: rainbondv1alpha1.RainbondClusterSpec{
+					NodesForGateway: []*rainbondv1alpha1.K8sNode{{Name: "node1"}},
+					NodesForChaos:   []*rainbondv1alpha1.K8sNode{{Name: "node1"}},
+					ImageHub:        &rainbondv1alpha1.ImageHub{Domain: constants.DefImageRepository, Username: "admin", Password: "foobar"},
+				},
+			}
+			cli := fake.NewFakeClientWithScheme(scheme, dbSecret.DeepCopy(), etcd.DeepCopy(), volume.DeepCopy())
+			hdl := tc.fn(context.Background(), cli, component, cluster)
+			if err := hdl.Before(); err != nil {
+				// e.g. htpasswd is not installed for rbd-hub, the workloads can be generated all the same.
+				t.Logf("before: %v", err)
+			}
+
+			var templates []*corev1.PodTemplateSpec
+			for _, obj := range hdl.Resources() {
+				switch workload := obj.(type) {
+				case *appsv1.Deployment:
+					templates = append(templates, &workload.Spec.Template)
+				case *appsv1.StatefulSet:
+					templates = append(templates, &workload.Spec.Template)
+				case *appsv1.DaemonSet:
+					templates = append(templates, &workload.Spec.Template)
+				}
+			}
+			if len(templates) == 0 {
+				t.Fatalf("no workloads were returned by %s", tc.name)
+			}
+			for _, template := range templates {
+				assert.Equal(t, "bar", template.Annotations["foo"])
+				assert.Equal(t, "bar", template.Labels["foo"])
+				assert.Equal(t, tc.name, template.Labels["name"], "the default labels can not be overridden")
+				assert.Equal(t, "false", template.Spec.NodeSelector["gpu"])
+				assert.Equal(t, podSecurityContext, template.Spec.SecurityContext)
+				var main bool
+				for _, container := range template.Spec.Containers {
+					if container.Name != tc.name {
+						// the sidecars keep their own probes and resources.
+						assert.NotEqual(t, livenessProbe, container.LivenessProbe, container.Name)
+						assert.NotEqual(t, readinessProbe, container.ReadinessProbe, container.Name)
+						assert.NotEqual(t, startupProbe, container.StartupProbe, container.Name)
+						assert.NotEqual(t, resources.Limits, container.Resources.Limits, container.Name)
+						continue
+					}
+					main = true
+					assert.Equal(t, resources.Limits, container.Resources.Limits)
+					assert.Equal(t, livenessProbe, container.LivenessProbe)
+					assert.Equal(t, readinessProbe, container.ReadinessProbe)
+					assert.Equal(t, startupProbe, container.StartupProbe)
+					assert.Equal(t, securityContext, container.SecurityContext)
+				}
+				assert.True(t, main, "the main container is named after the component")
+			}
+		})
+	}
+}
+
+func TestHorizontalPodAutoscaler(t *testing.T) {
+	component := &rainbondv1alpha1.RbdComponent{
+		ObjectMeta: metav1.ObjectMeta{Name: APIName, Namespace: "rbd-system"},
+	}
+	assert.Nil(t, horizontalPodAutoscaler(component, APIName, nil))
+
+	component.Spec.Autoscaling = &rainbondv1alpha1.AutoscalingSpec{
+		MinReplicas:                       commonutil.Int32(2),
+		MaxReplicas:                       5,
+		TargetCPUUtilizationPercentage:    commonutil.Int32(60),
+		TargetMemoryUtilizationPercentage: commonutil.Int32(80),
+		Metrics: []autoscalingv2beta2.MetricSpec{
+			{
+				Type: autoscalingv2beta2.PodsMetricSourceType,
+				Pods: &autoscalingv2beta2.PodsMetricSource{
+					Metric: autoscalingv2beta2.MetricIdentifier{Name: "http_requests"},
+					Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.AverageValueMetricType, AverageValue: resource.NewQuantity(100, resource.DecimalSI)},
+				},
+			},
+		},
+	}
+	hpa, ok := horizontalPodAutoscaler(component, APIName, nil).(*autoscalingv2beta2.HorizontalPodAutoscaler)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "Deployment", hpa.Spec.ScaleTargetRef.Kind)
+	assert.Equal(t, APIName, hpa.Spec.ScaleTargetRef.Name)
+	assert.Equal(t, int32(2), *hpa.Spec.MinReplicas)
+	assert.Equal(t, int32(5), hpa.Spec.MaxReplicas)
+	if assert.Len(t, hpa.Spec.Metrics, 3) {
+		assert.Equal(t, corev1.ResourceCPU, hpa.Spec.Metrics[0].Resource.Name)
+		assert.Equal(t, int32(60), *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
+		assert.Equal(t, corev1.ResourceMemory, hpa.Spec.Metrics[1].Resource.Name)
+		assert.Equal(t, component.Spec.Autoscaling.Metrics[0], hpa.Spec.Metrics[2])
+	}
+}
@@ -123,6 +123,7 @@ func (k *dashboardMetricsScraper) deploymentForDashboardMetricsScraper() client.
 			},
 		},
 	}
+	mergePodTemplate(&deploy.Spec.Template, k.component)
 
 	return deploy
 }
@@ -11,6 +11,7 @@ import (
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -285,6 +286,7 @@ func (d *db) statefulsetForDB() client.Object {
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{*pvc},
 		},
 	}
+	mergePodTemplate(&sts.Spec.Template, d.component)
 
 	return sts
 }
@@ -408,8 +410,8 @@ skip-name-resolve
 func (d *db) pv() *corev1.PersistentVolume {
 	pv := &corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   DBName,
-			Labels: d.labels,
+			Name:   rbdutil.ClusterScopedName(d.component.Namespace, DBName),
+			Labels: rbdutil.LabelsForClusterScoped(d.component.Namespace, d.labels),
 		},
 	}
 
@@ -453,7 +455,7 @@ func (d *db) pvc() *corev1.PersistentVolumeClaim {
 					corev1.ResourceStorage: *size,
 				},
 			},
-			VolumeName:       DBName,
+			VolumeName:       rbdutil.ClusterScopedName(d.component.Namespace, DBName),
 			StorageClassName: commonutil.String("manual"),
 		},
 	}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// dependencies declares the rbdcomponents each rbdcomponent depends on.
+// A rbdcomponent will not be created until all of its dependencies are ready.
+var dependencies = map[string][]string{
+	APIName:      {DBName, EtcdName},
+	ChaosName:    {DBName, EtcdName},
+	EventLogName: {DBName},
+	GatewayName:  {EtcdName},
+	MQName:       {EtcdName},
+	WorkerName:   {DBName, MQName},
+}
+
+// coreComponents are the rbdcomponents every rainbondcluster expects, unless they are replaced by external services.
+var coreComponents = []string{APIName, ChaosName, DBName, EtcdName, EventLogName, GatewayName, HubName, MQName, NodeName, WorkerName}
+
+// ExpectedComponents returns the rbdcomponents expected by the given cluster, sorted by name.
+func ExpectedComponents(cluster *rainbondv1alpha1.RainbondCluster) []string {
+	var expected []string
+	for _, name := range withoutExternal(coreComponents, cluster) {
+		if name == HubName && useExternalImageHub(cluster) {
+			continue
+		}
+		expected = append(expected, name)
+	}
+	sort.Strings(expected)
+	return expected
+}
+
+// Dependencies returns the rbdcomponents the given rbdcomponent depends on.
+// The rbdcomponents replaced by the external services of the cluster, such as the database and etcd, are left out.
+func Dependencies(name string, cluster *rainbondv1alpha1.RainbondCluster) []string {
+	return withoutExternal(dependencies[name], cluster)
+}
+
+// Dependents returns the rbdcomponents which depend on the given rbdcomponent, regardless of the external services of the cluster.
+func Dependents(name string) []string {
+	var dependents []string
+	for dependent, deps := range dependencies {
+		for _, dep := range deps {
+			if dep == name {
+				dependents = append(dependents, dependent)
+				break
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// IsPackageDependency checks if the given rbdcomponent is needed by the rainbondpackage, directly or indirectly.
+// Such rbdcomponents are created before the rainbondpackage is ready, and their images are not pulled from the local image repository.
+func IsPackageDependency(name string, cluster *rainbondv1alpha1.RainbondCluster) bool {
+	visited := make(map[string]bool)
+	var visit func(names []string) bool
+	visit = func(names []string) bool {
+		for _, dep := range names {
+			if dep == name {
+				return true
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if visit(Dependencies(dep, cluster)) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(packageDependencies(cluster))
+}
+
+// InstalledBeforePackage checks if the given rbdcomponent is created before the rainbondpackage is ready,
+// which is the case for the dependencies of the rainbondpackage, and the deprecated priority components.
+func InstalledBeforePackage(cpt *rainbondv1alpha1.RbdComponent, cluster *rainbondv1alpha1.RainbondCluster) bool {
+	return cpt.Spec.PriorityComponent || IsPackageDependency(cpt.Name, cluster)
+}
+
+// packageDependencies returns the rbdcomponents the rainbondpackage depends on,
+// the images of the package are pushed to rbd-hub through rbd-gateway, unless an external image repository is used.
+func packageDependencies(cluster *rainbondv1alpha1.RainbondCluster) []string {
+	if useExternalImageHub(cluster) {
+		return nil
+	}
+	return []string{HubName, GatewayName}
+}
+
+func useExternalImageHub(cluster *rainbondv1alpha1.RainbondCluster) bool {
+	return cluster.Spec.ImageHub != nil && cluster.Spec.ImageHub.Domain != constants.DefImageRepository
+}
+
+// InstallOrder sorts the given rbdcomponents topologically, so that each rbdcomponent comes after its dependencies.
+// The rbdcomponents without dependencies between them are sorted by name. Dependencies not in the given rbdcomponents are ignored.
+func InstallOrder(names []string, cluster *rainbondv1alpha1.RainbondCluster) ([]string, error) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	indegrees := make(map[string]int, len(set))
+	for name := range set {
+		indegrees[name] = 0
+		for _, dep := range Dependencies(name, cluster) {
+			if set[dep] {
+				indegrees[name]++
+			}
+		}
+	}
+
+	order := make([]string, 0, len(set))
+	for len(indegrees) > 0 {
+		var frontier []string
+		for name, indegree := range indegrees {
+			if indegree == 0 {
+				frontier = append(frontier, name)
+			}
+		}
+		if len(frontier) == 0 {
+			var cycle []string
+			for name := range indegrees {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("circular dependencies between rbdcomponents: %s", strings.Join(cycle, ", "))
+		}
+		sort.Strings(frontier)
+		for _, name := range frontier {
+			delete(indegrees, name)
+			order = append(order, name)
+		}
+		for name := range indegrees {
+			for _, dep := range Dependencies(name, cluster) {
+				for _, installed := range frontier {
+					if dep == installed {
+						indegrees[name]--
+					}
+				}
+			}
+		}
+	}
+	return order, nil
+}
+
+// IsRbdComponentReady checks if all pods of the given rbdcomponent are ready.
+// The pods of the old revision may still be ready during a rollout, so more ready pods than replicas are fine,
+// as in GenerateStatus.
+func IsRbdComponentReady(cpt *rainbondv1alpha1.RbdComponent) bool {
+	_, condition := cpt.Status.GetCondition(rainbondv1alpha1.RbdComponentReady)
+	if condition == nil {
+		return false
+	}
+	return condition.Status == corev1.ConditionTrue && cpt.Status.Replicas > 0 && cpt.Status.ReadyReplicas >= cpt.Status.Replicas
+}
+
+func withoutExternal(names []string, cluster *rainbondv1alpha1.RainbondCluster) []string {
+	var result []string
+	for _, name := range names {
+		if name == DBName && cluster.Spec.RegionDatabase != nil {
+			continue
+		}
+		if name == EtcdName && cluster.Spec.EtcdConfig != nil {
+			continue
+		}
+		result = append(result, name)
+	}
+	return result
+}
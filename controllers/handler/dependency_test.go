@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestInstallOrder(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{}
+	names := []string{WorkerName, APIName, GatewayName, MQName, DBName, EtcdName, HubName, ChaosName, EventLogName}
+
+	order, err := InstallOrder(names, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, names, order)
+	index := make(map[string]int)
+	for i, name := range order {
+		index[name] = i
+	}
+	for _, name := range names {
+		for _, dep := range Dependencies(name, cluster) {
+			assert.Less(t, index[dep], index[name], "%s should be installed before %s", dep, name)
+		}
+	}
+	assert.Equal(t, []string{DBName, EtcdName, HubName}, order[:3])
+}
+
+func TestInstallOrderWithExternalServices(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		Spec: rainbondv1alpha1.RainbondClusterSpec{
+			RegionDatabase: &rainbondv1alpha1.Database{Host: "127.0.0.1"},
+			EtcdConfig:     &rainbondv1alpha1.EtcdConfig{Endpoints: []string{"127.0.0.1:2379"}},
+		},
+	}
+	assert.Empty(t, Dependencies(APIName, cluster))
+	assert.Equal(t, []string{MQName}, Dependencies(WorkerName, cluster))
+
+	// dependencies not in the given rbdcomponents are ignored.
+	order, err := InstallOrder([]string{WorkerName, APIName, MQName}, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{APIName, MQName, WorkerName}, order)
+}
+
+func TestInstallOrderCircularDependencies(t *testing.T) {
+	old := dependencies
+	defer func() { dependencies = old }()
+	dependencies = map[string][]string{
+		APIName:    {WorkerName},
+		WorkerName: {MQName},
+		MQName:     {APIName},
+	}
+
+	_, err := InstallOrder([]string{APIName, WorkerName, MQName, DBName}, &rainbondv1alpha1.RainbondCluster{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rbd-api, rbd-mq, rbd-worker")
+	}
+}
+
+func TestDependents(t *testing.T) {
+	assert.Equal(t, []string{APIName, ChaosName, GatewayName, MQName}, Dependents(EtcdName))
+	assert.Empty(t, Dependents(APIName))
+}
+
+func TestIsPackageDependency(t *testing.T) {
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		Spec: rainbondv1alpha1.RainbondClusterSpec{
+			ImageHub: &rainbondv1alpha1.ImageHub{Domain: constants.DefImageRepository},
+		},
+	}
+	assert.True(t, IsPackageDependency(HubName, cluster))
+	assert.True(t, IsPackageDependency(GatewayName, cluster))
+	assert.True(t, IsPackageDependency(EtcdName, cluster))
+	assert.False(t, IsPackageDependency(DBName, cluster))
+	assert.False(t, IsPackageDependency(APIName, cluster))
+
+	// etcd is replaced by an external one.
+	cluster.Spec.EtcdConfig = &rainbondv1alpha1.EtcdConfig{Endpoints: []string{"127.0.0.1:2379"}}
+	assert.False(t, IsPackageDependency(EtcdName, cluster))
+
+	// images are pushed to an external image repository.
+	cluster.Spec.ImageHub.Domain = "registry.example.com"
+	assert.False(t, IsPackageDependency(HubName, cluster))
+	assert.False(t, IsPackageDependency(GatewayName, cluster))
+
+	priority := &rainbondv1alpha1.RbdComponent{}
+	priority.Name = APIName
+	priority.Spec.PriorityComponent = true
+	assert.True(t, InstalledBeforePackage(priority, cluster))
+}
+
+func TestIsRbdComponentReady(t *testing.T) {
+	tests := []struct {
+		name                    string
+		replicas, readyReplicas int32
+		condition               corev1.ConditionStatus
+		want                    bool
+	}{
+		{name: "ready", replicas: 2, readyReplicas: 2, condition: corev1.ConditionTrue, want: true},
+		{name: "old pods still ready during a rollout", replicas: 2, readyReplicas: 3, condition: corev1.ConditionTrue, want: true},
+		{name: "not all ready", replicas: 2, readyReplicas: 1, condition: corev1.ConditionTrue},
+		{name: "no replicas", condition: corev1.ConditionTrue},
+		{name: "not ready condition", replicas: 1, readyReplicas: 1, condition: corev1.ConditionFalse},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpt := &rainbondv1alpha1.RbdComponent{}
+			cpt.Status.Replicas = tc.replicas
+			cpt.Status.ReadyReplicas = tc.readyReplicas
+			cpt.Status.Conditions = []rainbondv1alpha1.RbdComponentCondition{
+				{Type: rainbondv1alpha1.RbdComponentReady, Status: tc.condition},
+			}
+			assert.Equal(t, tc.want, IsRbdComponentReady(cpt))
+		})
+	}
+}
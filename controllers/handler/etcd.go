@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
@@ -193,6 +194,8 @@ func (e *etcd) statefulsetForEtcd() client.Object {
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{*pvc},
 		},
 	}
+	mergePodTemplate(&sts.Spec.Template, e.component)
+
 	return sts
 }
 
@@ -427,6 +430,8 @@ fi
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{*pvc},
 		},
 	}
+	mergePodTemplate(&sts.Spec.Template, e.component)
+
 	return sts
 }
 
@@ -459,8 +464,8 @@ func (e *etcd) serviceForEtcd() client.Object {
 func (e *etcd) pv() *corev1.PersistentVolume {
 	pv := &corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   EtcdName,
-			Labels: e.labels,
+			Name:   rbdutil.ClusterScopedName(e.component.Namespace, EtcdName),
+			Labels: rbdutil.LabelsForClusterScoped(e.component.Namespace, e.labels),
 		},
 	}
 
@@ -503,7 +508,7 @@ func (e *etcd) pvc() *corev1.PersistentVolumeClaim {
 					corev1.ResourceStorage: *size,
 				},
 			},
-			VolumeName:       EtcdName,
+			VolumeName:       rbdutil.ClusterScopedName(e.component.Namespace, EtcdName),
 			StorageClassName: commonutil.String("manual"),
 		},
 	}
@@ -234,6 +234,7 @@ func (e *eventlog) statefulset() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&sts.Spec.Template, e.component)
 
 	return sts
 }
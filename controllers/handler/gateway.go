@@ -47,10 +47,6 @@ func (g *gateway) Before() error {
 	}
 	g.etcdSecret = secret
 
-	if err := isEtcdAvailable(g.ctx, g.client, g.component, g.cluster); err != nil {
-		return fmt.Errorf("etcd not available: %v", err)
-	}
-
 	return nil
 }
 
@@ -151,6 +147,7 @@ func (g *gateway) daemonset() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, g.component)
 
 	return ds
 }
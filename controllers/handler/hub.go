@@ -68,6 +68,12 @@ func (h *hub) Before() error {
 		return NewIgnoreError("imageHub is empty")
 	}
 
+	password, err := rbdutil.GetImageHubPassword(h.ctx, h.client, h.cluster)
+	if err != nil {
+		return fmt.Errorf("get image hub password: %v", err)
+	}
+	h.password = password
+
 	htpasswd, err := h.generateHtpasswd()
 	if err != nil {
 		return fmt.Errorf("generate htpasswd: %v", err)
@@ -189,6 +195,7 @@ func (h *hub) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, h.component)
 
 	return ds
 }
@@ -321,6 +328,6 @@ func (h *hub) getSecret(name string) (*corev1.Secret, error) {
 }
 
 func (h *hub) generateHtpasswd() ([]byte, error) {
-	cmd := exec.Command("htpasswd", "-Bbn", h.cluster.Spec.ImageHub.Username, h.cluster.Spec.ImageHub.Password)
+	cmd := exec.Command("htpasswd", "-Bbn", h.cluster.Spec.ImageHub.Username, h.password)
 	return cmd.CombinedOutput()
 }
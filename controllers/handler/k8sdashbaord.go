@@ -151,6 +151,7 @@ func (k *k8sdashbaord) deploymentForKubernetesDashboard() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&deploy.Spec.Template, k.component)
 
 	return deploy
 }
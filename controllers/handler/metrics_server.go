@@ -11,6 +11,7 @@ import (
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -56,6 +57,23 @@ func NewMetricsServer(ctx context.Context, client client.Client, component *rain
 	}
 }
 
+// MetricsAPIService returns the APIService of metrics.k8s.io served by the metrics-server in the given namespace,
+// or nil if it does not exist or is served by another metrics-server.
+func MetricsAPIService(ctx context.Context, cli client.Client, namespace string) (*kubeaggregatorv1beta1.APIService, error) {
+	apiservice := &kubeaggregatorv1beta1.APIService{}
+	if err := cli.Get(ctx, types.NamespacedName{Name: metricsGroupAPI}, apiservice); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get apiservice %s: %v", metricsGroupAPI, err)
+	}
+	svc := apiservice.Spec.Service
+	if svc == nil || svc.Name != MetricsServerName || svc.Namespace != namespace {
+		return nil, nil
+	}
+	return apiservice, nil
+}
+
 func (m *metricsServer) Before() error {
 	apiservice := &kubeaggregatorv1beta1.APIService{}
 	if err := m.client.Get(m.ctx, types.NamespacedName{Name: metricsGroupAPI}, apiservice); err != nil {
@@ -229,6 +247,7 @@ func (m *metricsServer) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, m.component)
 
 	return ds
 }
@@ -262,7 +281,8 @@ func (m *metricsServer) serviceForMetricsServer() client.Object {
 func (m *metricsServer) apiserviceForMetricsServer() *kubeaggregatorv1beta1.APIService {
 	return &kubeaggregatorv1beta1.APIService{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: metricsGroupAPI,
+			Name:   metricsGroupAPI,
+			Labels: rbdutil.LabelsForClusterScoped(m.cluster.Namespace, nil),
 		},
 		Spec: kubeaggregatorv1beta1.APIServiceSpec{
 			Service: &kubeaggregatorv1beta1.ServiceReference{
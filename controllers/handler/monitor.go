@@ -115,7 +115,6 @@ func (m *monitor) statefulset() client.Object {
 	}
 
 	env = mergeEnvs(env, m.component.Spec.Env)
-	resources = mergeResources(resources, m.component.Spec.Resources)
 	args = mergeArgs(args, m.component.Spec.Args)
 	volumeMounts = mergeVolumeMounts(volumeMounts, m.component.Spec.VolumeMounts)
 	volumes = mergeVolumes(volumes, m.component.Spec.Volumes)
@@ -160,6 +159,7 @@ func (m *monitor) statefulset() client.Object {
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{*promDataPVC},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, m.component)
 
 	return ds
 }
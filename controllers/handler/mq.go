@@ -51,6 +51,7 @@ func (m *mq) Before() error {
 func (m *mq) Resources() []client.Object {
 	return []client.Object{
 		m.deployment(),
+		horizontalPodAutoscaler(m.component, MQName, m.labels),
 		m.service(),
 	}
 }
@@ -127,6 +128,7 @@ func (m *mq) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, m.component)
 
 	return ds
 }
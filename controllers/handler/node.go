@@ -264,6 +264,7 @@ func (n *node) daemonSetForRainbondNode() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, n.component)
 
 	return ds
 }
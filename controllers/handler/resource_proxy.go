@@ -89,8 +89,6 @@ func (r *resourceProxy) resource() []client.Object {
 		},
 	}
 
-	resources = mergeResources(resources, r.component.Spec.Resources)
-
 	ds := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      ResourceProxyName,
@@ -151,5 +149,7 @@ func (r *resourceProxy) resource() []client.Object {
 			Selector: r.labels,
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, r.component)
+
 	return []client.Object{ds, resourceProxyDataPVC, svc}
 }
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"path"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/commonutil"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SnapshotRoot is the directory in the grdata volume where the snapshots are saved.
+const SnapshotRoot = "/grdata/backups"
+
+// SnapshotComponents returns the stateful rbdcomponents which are snapshotted before an upgrade.
+// The ones replaced by the external services of the cluster are left out.
+func SnapshotComponents(cluster *rainbondv1alpha1.RainbondCluster) []string {
+	return withoutExternal([]string{DBName, EtcdName}, cluster)
+}
+
+// SnapshotJob returns the job which saves a snapshot of the given rbdcomponent into dir of the grdata volume,
+// with the image of the rbdcomponent, and the path of the snapshot.
+func SnapshotJob(cpt *rainbondv1alpha1.RbdComponent, cluster *rainbondv1alpha1.RainbondCluster, name, dir string) (*batchv1.Job, string, error) {
+	var snapshot, command string
+	var env []corev1.EnvVar
+	switch cpt.Name {
+	case DBName:
+		snapshot = path.Join(dir, DBName+".sql")
+		command = fmt.Sprintf("mysqldump -h %s -u \"$MYSQL_USER\" --all-databases --single-transaction > %s", dbhost, snapshot)
+		env = []corev1.EnvVar{
+			{
+				Name: "MYSQL_USER",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: DBName},
+						Key:                  mysqlUserKey,
+					},
+				},
+			},
+			{
+				// read by mysqldump, so that the password is not visible in the command.
+				Name: "MYSQL_PWD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: DBName},
+						Key:                  mysqlPasswordKey,
+					},
+				},
+			},
+		}
+	case EtcdName:
+		snapshot = path.Join(dir, EtcdName+".db")
+		command = fmt.Sprintf("etcdctl --endpoints=http://%s:2379 snapshot save %s", EtcdName, snapshot)
+		env = []corev1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}}
+	default:
+		return nil, "", fmt.Errorf("rbdcomponent %s does not support snapshots", cpt.Name)
+	}
+
+	labels := LabelsForRainbondComponent(cpt)
+	labels["name"] = name
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cpt.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: commonutil.Int32(2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: imagePullSecrets(cpt, cluster),
+					Containers: []corev1.Container{
+						{
+							Name:            "snapshot",
+							Image:           cpt.Spec.Image,
+							ImagePullPolicy: cpt.ImagePullPolicy(),
+							Command:         []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && %s", dir, command)},
+							Env:             env,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "grdata",
+									MountPath: "/grdata",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "grdata",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: constants.GrDataPVC,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return job, snapshot, nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 
@@ -69,6 +70,7 @@ func (w *worker) Before() error {
 func (w *worker) Resources() []client.Object {
 	return []client.Object{
 		w.deployment(),
+		horizontalPodAutoscaler(w.component, WorkerName, w.labels),
 		w.serviceForWorker(),
 		w.serviceMonitorForWorker(),
 	}
@@ -153,10 +155,7 @@ func (w *worker) deployment() client.Object {
 			Name:  "BUILD_IMAGE_REPOSTORY_USER",
 			Value: imageHub.Username,
 		})
-		env = append(env, corev1.EnvVar{
-			Name:  "BUILD_IMAGE_REPOSTORY_PASS",
-			Value: imageHub.Password,
-		})
+		env = append(env, k8sutil.EnvVarFromSecretKeyRef("BUILD_IMAGE_REPOSTORY_PASS", imageHub.Password, imageHub.PasswordSecretRef))
 	}
 
 	args = mergeArgs(args, w.component.Spec.Args)
@@ -203,6 +202,7 @@ func (w *worker) deployment() client.Object {
 			},
 		},
 	}
+	mergePodTemplate(&ds.Spec.Template, w.component)
 
 	return ds
 }
@@ -192,10 +192,8 @@ func (p *aliyunclouddiskPlugin) daemonset() *appsv1.DaemonSet {
 									Name:  "ACCESS_KEY_ID",
 									Value: p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeyID,
 								},
-								{
-									Name:  "ACCESS_KEY_SECRET",
-									Value: p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecret,
-								},
+								k8sutil.EnvVarFromSecretKeyRef("ACCESS_KEY_SECRET",
+									p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecret, p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecretRef),
 								{
 									Name:  "MAX_VOLUMES_PERNODE",
 									Value: "15",
@@ -390,10 +388,8 @@ func (p *aliyunclouddiskPlugin) statefulset() client.Object {
 									Name:  "ACCESS_KEY_ID",
 									Value: p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeyID,
 								},
-								{
-									Name:  "ACCESS_KEY_SECRET",
-									Value: p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecret,
-								},
+								k8sutil.EnvVarFromSecretKeyRef("ACCESS_KEY_SECRET",
+									p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecret, p.volume.Spec.CSIPlugin.AliyunCloudDisk.AccessKeySecretRef),
 								{
 									Name:  "MAX_VOLUMES_PERNODE",
 									Value: "15",
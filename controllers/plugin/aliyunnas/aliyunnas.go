@@ -372,10 +372,8 @@ func (p *aliyunnasPlugin) statefulset() client.Object {
 									Name:  "ACCESS_KEY_ID",
 									Value: p.volume.Spec.CSIPlugin.AliyunNas.AccessKeyID,
 								},
-								{
-									Name:  "ACCESS_KEY_SECRET",
-									Value: p.volume.Spec.CSIPlugin.AliyunNas.AccessKeySecret,
-								},
+								k8sutil.EnvVarFromSecretKeyRef("ACCESS_KEY_SECRET",
+									p.volume.Spec.CSIPlugin.AliyunNas.AccessKeySecret, p.volume.Spec.CSIPlugin.AliyunNas.AccessKeySecretRef),
 							},
 							VolumeMounts: []corev1.VolumeMount{
 								{
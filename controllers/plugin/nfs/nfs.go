@@ -75,8 +75,10 @@ func (p *nfsPlugin) IsPluginReady() bool {
 	return sts.Status.ReadyReplicas == sts.Status.Replicas
 }
 
+// GetProvisioner returns the provisioner name, which is qualified by the namespace of the volume,
+// so that the nfs provisioners in different namespaces do not provision for each other.
 func (p *nfsPlugin) GetProvisioner() string {
-	return provisioner
+	return rbdutil.ClusterScopedName(p.volume.Namespace, provisioner)
 }
 
 func (p *nfsPlugin) GetClusterScopedResources() []client.Object {
@@ -204,7 +206,7 @@ func (p *nfsPlugin) statefulset() client.Object {
 								},
 							},
 							Args: []string{
-								"-provisioner=" + provisioner,
+								"-provisioner=" + p.GetProvisioner(),
 							},
 							SecurityContext: &corev1.SecurityContext{
 								Privileged: commonutil.Bool(true),
@@ -335,8 +337,8 @@ func (p *nfsPlugin) pv() *corev1.PersistentVolume {
 
 	pv := &corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   p.name,
-			Labels: p.labels,
+			Name:   rbdutil.ClusterScopedName(p.volume.Namespace, p.name),
+			Labels: rbdutil.LabelsForClusterScoped(p.volume.Namespace, p.labels),
 		},
 	}
 
@@ -374,7 +376,7 @@ func (p *nfsPlugin) pv() *corev1.PersistentVolume {
 	}
 
 	hostPath := &corev1.HostPathVolumeSource{
-		Path: "/opt/rainbond/data/nfs",
+		Path: rbdutil.ClusterScopedName(p.volume.Namespace, "/opt/rainbond/data/nfs"),
 		Type: k8sutil.HostPath(corev1.HostPathDirectoryOrCreate),
 	}
 	spec.HostPath = hostPath
@@ -400,7 +402,7 @@ func (p *nfsPlugin) pvc() *corev1.PersistentVolumeClaim {
 					corev1.ResourceStorage: *size,
 				},
 			},
-			VolumeName:       p.name,
+			VolumeName:       rbdutil.ClusterScopedName(p.volume.Namespace, p.name),
 			StorageClassName: commonutil.String("manual"),
 		},
 	}
@@ -2,22 +2,28 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	clustermgr "github.com/goodrain/rainbond-operator/controllers/cluster-mgr"
 	"github.com/goodrain/rainbond-operator/util/constants"
-	"github.com/goodrain/rainbond-operator/util/uuidutil"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
 	"github.com/juju/errors"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // RainbondClusterReconciler reconciles a RainbondCluster object
@@ -58,7 +64,25 @@ func (r *RainbondClusterReconciler) Reconcile(ctx context.Context, request ctrl.
 		return reconcile.Result{}, err
 	}
 
-	mgr := clustermgr.NewClusterMgr(ctx, r.Client, reqLogger, rainbondcluster, r.Scheme)
+	mgr := clustermgr.NewClusterMgr(ctx, r.Client, r.Recorder, reqLogger, rainbondcluster, r.Scheme)
+
+	// clean up the resources left by the cluster before it is gone.
+	if !rainbondcluster.DeletionTimestamp.IsZero() {
+		return r.teardown(ctx, rainbondcluster, mgr, reqLogger)
+	}
+	if !controllerutil.ContainsFinalizer(rainbondcluster, constants.Finalizer) {
+		controllerutil.AddFinalizer(rainbondcluster, constants.Finalizer)
+		if err := r.Update(ctx, rainbondcluster); err != nil {
+			reqLogger.Error(err, "add finalizer")
+			return reconcile.Result{}, err
+		}
+	}
+
+	// the password of the default image hub is generated before anything uses it.
+	if err := mgr.CreateImageHubPasswordSecretIfNotExists(); err != nil {
+		reqLogger.Error(err, "create image hub password secret")
+		return reconcile.Result{RequeueAfter: time.Second * 2}, err
+	}
 
 	// generate status for rainbond cluster
 	reqLogger.V(6).Info("start generate status")
@@ -68,6 +92,12 @@ func (r *RainbondClusterReconciler) Reconcile(ctx context.Context, request ctrl.
 		return reconcile.Result{RequeueAfter: time.Second * 2}, err
 	}
 
+	// upgrade the rbdcomponents if the install version changes, the progress is recorded in the status.
+	upgrading, upgradeErr := mgr.Upgrade(status)
+	if upgradeErr != nil {
+		reqLogger.Error(upgradeErr, "upgrade rainbondcluster")
+	}
+
 	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		rc := &rainbondv1alpha1.RainbondCluster{}
 		if err := r.Get(ctx, request.NamespacedName, rc); err != nil {
@@ -81,20 +111,27 @@ func (r *RainbondClusterReconciler) Reconcile(ctx context.Context, request ctrl.
 	}
 	reqLogger.V(6).Info("update status success")
 
-	// setup imageHub if empty
+	// the prechecks have been re-run and the upgrade has been retried as requested,
+	// unless the annotations have been changed since.
+	for _, annotation := range []string{constants.RerunPrechecksAnnotation, constants.RetryUpgradeAnnotation} {
+		if err := r.removeAnnotation(ctx, rainbondcluster, annotation); err != nil {
+			reqLogger.Error(err, "remove annotation", "annotation", annotation)
+			return reconcile.Result{RequeueAfter: time.Second * 2}, err
+		}
+	}
+	if upgradeErr != nil {
+		return reconcile.Result{RequeueAfter: time.Second * 5}, upgradeErr
+	}
+
+	// setup imageHub if empty, in case the defaulting webhook is not enabled.
 	if rainbondcluster.Spec.ImageHub == nil {
 		reqLogger.V(6).Info("create new image hub info")
-		imageHub, err := r.getImageHub(rainbondcluster)
-		if err != nil {
-			reqLogger.V(6).Info(fmt.Sprintf("set image hub info: %v", err))
-			return reconcile.Result{RequeueAfter: time.Second * 1}, nil
-		}
 		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 			rc := &rainbondv1alpha1.RainbondCluster{}
 			if err := r.Get(ctx, request.NamespacedName, rc); err != nil {
 				return err
 			}
-			rc.Spec.ImageHub = imageHub
+			rc.Default()
 			rainbondcluster = rc
 			return r.Update(ctx, rc)
 		}); err != nil {
@@ -107,7 +144,8 @@ func (r *RainbondClusterReconciler) Reconcile(ctx context.Context, request ctrl.
 	}
 
 	// create secret for pulling images.
-	if rainbondcluster.Spec.ImageHub != nil && rainbondcluster.Spec.ImageHub.Username != "" && rainbondcluster.Spec.ImageHub.Password != "" {
+	if rainbondcluster.Spec.ImageHub != nil && rainbondcluster.Spec.ImageHub.Username != "" &&
+		(rainbondcluster.Spec.ImageHub.Password != "" || rainbondcluster.Spec.ImageHub.PasswordSecretRef != nil) {
 		err := mgr.CreateImagePullSecret()
 		if err != nil {
 			return reconcile.Result{}, err
@@ -119,26 +157,103 @@ func (r *RainbondClusterReconciler) Reconcile(ctx context.Context, request ctrl.
 		return reconcile.Result{}, err
 	}
 
+	// wait for the upgraded rbdcomponents to be rolled out.
+	if upgrading {
+		return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
 	for _, con := range rainbondcluster.Status.Conditions {
 		if con.Status != corev1.ConditionTrue {
 			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// re-run the passed prechecks once their intervals elapse.
+	return ctrl.Result{RequeueAfter: mgr.NextPrecheck()}, nil
+}
+
+// teardown cleans up the resources left by the deleted cluster, and removes the finalizer once everything is gone.
+func (r *RainbondClusterReconciler) teardown(ctx context.Context, cluster *rainbondv1alpha1.RainbondCluster, mgr *clustermgr.RainbondClusteMgr, reqLogger logr.Logger) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cluster, constants.Finalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	done, teardownErr := mgr.Teardown()
+	if teardownErr != nil {
+		reqLogger.Error(teardownErr, "teardown rainbondcluster")
+	}
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		rc := &rainbondv1alpha1.RainbondCluster{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, rc); err != nil {
+			return err
+		}
+		rc.Status.Teardown = cluster.Status.Teardown
+		return r.Status().Update(ctx, rc)
+	}); err != nil {
+		reqLogger.Error(err, "update rainbondcluster status")
+		return reconcile.Result{RequeueAfter: time.Second * 2}, err
+	}
+	if teardownErr != nil {
+		return reconcile.Result{RequeueAfter: 5 * time.Second}, teardownErr
+	}
+	if !done {
+		return reconcile.Result{RequeueAfter: 3 * time.Second}, nil
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		rc := &rainbondv1alpha1.RainbondCluster{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, rc); err != nil {
+			return err
+		}
+		controllerutil.RemoveFinalizer(rc, constants.Finalizer)
+		return r.Update(ctx, rc)
+	}); err != nil {
+		reqLogger.Error(err, "remove finalizer")
+		return reconcile.Result{}, err
+	}
+	reqLogger.Info("rainbondcluster has been torn down")
+	return reconcile.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *RainbondClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&rainbondv1alpha1.RainbondCluster{}).
+		Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &rainbondv1alpha1.RbdComponent{}},
+			handler.EnqueueRequestsFromMapFunc(r.rainbondClusterOf),
+			builder.WithPredicates(rbdComponentReadyChangedPredicate())).
 		Complete(r)
 }
 
-func (r *RainbondClusterReconciler) getImageHub(cluster *rainbondv1alpha1.RainbondCluster) (*rainbondv1alpha1.ImageHub, error) {
-	return &rainbondv1alpha1.ImageHub{
-		Domain:   constants.DefImageRepository,
-		Username: "admin",
-		Password: uuidutil.NewUUID()[0:8],
-	}, nil
+// rainbondClusterOf returns the request for the rainbondcluster obj belongs to,
+// whose install progress depends on the readiness of the rbdcomponents.
+func (r *RainbondClusterReconciler) rainbondClusterOf(obj client.Object) []reconcile.Request {
+	cluster, err := rbdutil.GetRainbondCluster(context.Background(), r.Client, obj)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			r.Log.Error(err, "get rainbondcluster", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		}
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}}}
+}
+
+// removeAnnotation removes the annotation from the rainbondcluster, if its value is still the one seen by cluster.
+func (r *RainbondClusterReconciler) removeAnnotation(ctx context.Context, cluster *rainbondv1alpha1.RainbondCluster, annotation string) error {
+	seen, ok := cluster.Annotations[annotation]
+	if !ok {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		rc := &rainbondv1alpha1.RainbondCluster{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, rc); err != nil {
+			return err
+		}
+		if value, ok := rc.Annotations[annotation]; !ok || value != seen {
+			return nil
+		}
+		delete(rc.Annotations, annotation)
+		return r.Update(ctx, rc)
+	})
 }
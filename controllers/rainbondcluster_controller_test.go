@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+)
+
+var _ = Describe("RainbondCluster controller", func() {
+	const (
+		timeout  = time.Second * 30
+		interval = time.Millisecond * 250
+	)
+
+	// the rainbondclusters are named differently from constants.RainbondClusterName on purpose.
+	regions := map[string]string{
+		"rbd-staging":    "staging",
+		"rbd-production": "production",
+	}
+
+	Context("When there are rainbondclusters in different namespaces", func() {
+		It("Should reconcile them side by side", func() {
+			ctx := context.Background()
+
+			By("creating a rainbondcluster and its rbdcomponent in each namespace")
+			for namespace, name := range regions {
+				Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).Should(Succeed())
+				cluster := &rainbondv1alpha1.RainbondCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+					Spec:       rainbondv1alpha1.RainbondClusterSpec{SuffixHTTPHost: name + ".grapps.cn"},
+				}
+				Expect(k8sClient.Create(ctx, cluster)).Should(Succeed())
+				cpt := &rainbondv1alpha1.RbdComponent{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "rbd-etcd",
+						Namespace: namespace,
+						Labels:    map[string]string{constants.ClusterLabelKey: name},
+					},
+				}
+				Expect(k8sClient.Create(ctx, cpt)).Should(Succeed())
+			}
+
+			for namespace, name := range regions {
+				By("waiting for the rainbondcluster in " + namespace + " to be reconciled")
+				Eventually(func() bool {
+					cluster := &rainbondv1alpha1.RainbondCluster{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster); err != nil {
+						return false
+					}
+					if !controllerutil.ContainsFinalizer(cluster, constants.Finalizer) {
+						return false
+					}
+					for _, summary := range cluster.Status.Components {
+						if summary.Name == "rbd-etcd" {
+							return true
+						}
+					}
+					return false
+				}, timeout, interval).Should(BeTrue())
+
+				By("waiting for the rbdcomponent in " + namespace + " to find its rainbondcluster")
+				Eventually(func() string {
+					cpt := &rainbondv1alpha1.RbdComponent{}
+					if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "rbd-etcd"}, cpt); err != nil {
+						return ""
+					}
+					_, condition := cpt.Status.GetCondition(rainbondv1alpha1.ClusterConfigCompeleted)
+					if condition == nil {
+						return ""
+					}
+					return condition.Reason
+				}, timeout, interval).Should(Equal("ConfigNotCompleted"))
+			}
+
+			By("deleting the rainbondcluster in rbd-staging")
+			staging := &rainbondv1alpha1.RainbondCluster{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "rbd-staging", Name: "staging"}, staging)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, staging)).Should(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: "rbd-staging", Name: "staging"}, &rainbondv1alpha1.RainbondCluster{})
+				return k8sErrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: "rbd-staging", Name: "rbd-etcd"}, &rainbondv1alpha1.RbdComponent{})
+				return k8sErrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+
+			By("checking the rainbondcluster in rbd-production is left alone")
+			Consistently(func() error {
+				if err := k8sClient.Get(ctx, types.NamespacedName{Namespace: "rbd-production", Name: "production"}, &rainbondv1alpha1.RainbondCluster{}); err != nil {
+					return err
+				}
+				return k8sClient.Get(ctx, types.NamespacedName{Namespace: "rbd-production", Name: "rbd-etcd"}, &rainbondv1alpha1.RbdComponent{})
+			}, time.Second*3, interval).Should(Succeed())
+		})
+	})
+})
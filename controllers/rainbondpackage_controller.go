@@ -18,26 +18,24 @@ package controllers
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/distribution/reference"
-	dtypes "github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/filters"
-	dclient "github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/go-logr/logr"
 	"github.com/goodrain/rainbond-operator/util/commonutil"
 	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/downloadutil"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
+	"github.com/goodrain/rainbond-operator/util/manifestutil"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/goodrain/rainbond-operator/util/registryutil"
 	"github.com/goodrain/rainbond-operator/util/retryutil"
 	"github.com/goodrain/rainbond-operator/util/tarutil"
 	corev1 "k8s.io/api/core/v1"
@@ -48,8 +46,12 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 )
@@ -98,8 +100,8 @@ func (r *RainbondPackageReconciler) Reconcile(ctx context.Context, request ctrl.
 		return reconcile.Result{}, err
 	}
 
-	cluster := &rainbondv1alpha1.RainbondCluster{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: pkg.Namespace, Name: constants.RainbondClusterName}, cluster); err != nil {
+	cluster, err := rbdutil.GetRainbondCluster(ctx, r.Client, pkg)
+	if err != nil {
 		log.Error(err, "get rainbondcluster.")
 		return reconcile.Result{RequeueAfter: 3 * time.Second}, nil
 	}
@@ -113,6 +115,24 @@ func (r *RainbondPackageReconciler) Reconcile(ctx context.Context, request ctrl.
 	if cluster.Spec.InstallMode == rainbondv1alpha1.InstallationModeFullOnline {
 		log.Info("set package to ready directly", "install mode", cluster.Spec.InstallMode)
 		pkg.Status = initPackageStatus(rainbondv1alpha1.Completed)
+		pkg.Status.Version = cluster.Spec.InstallVersion
+		if err := updateCRStatus(r.Client, pkg); err != nil {
+			log.Error(err, "update package status")
+			return reconcile.Result{RequeueAfter: time.Second * 5}, nil
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// handle the package again if the install version changes, the upgrade waits for the images pushed.
+	// the package handled before the version was recorded is the one of the installed version.
+	pushed := pkg.Status.Version
+	if pushed == "" && len(pkg.Status.Conditions) > 0 {
+		pushed = cluster.Status.InstalledVersion
+	}
+	if pushed != cluster.Spec.InstallVersion {
+		log.Info("handle package of the install version", "pushed version", pushed, "install version", cluster.Spec.InstallVersion)
+		pkg.Status = initPackageStatus(rainbondv1alpha1.Waiting)
+		pkg.Status.Version = cluster.Spec.InstallVersion
 		if err := updateCRStatus(r.Client, pkg); err != nil {
 			log.Error(err, "update package status")
 			return reconcile.Result{RequeueAfter: time.Second * 5}, nil
@@ -163,9 +183,29 @@ func (r *RainbondPackageReconciler) Reconcile(ctx context.Context, request ctrl.
 func (r *RainbondPackageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&rainbondv1alpha1.RainbondPackage{}).
+		Watches(&source.Kind{Type: &rainbondv1alpha1.RainbondCluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.rainbondPackageOf),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
 
+// rainbondPackageOf returns the request for the rainbondpackage of the rainbondcluster obj,
+// which handles the package again once the install version changes.
+func (r *RainbondPackageReconciler) rainbondPackageOf(obj client.Object) []reconcile.Request {
+	cluster, ok := obj.(*rainbondv1alpha1.RainbondCluster)
+	if !ok {
+		return nil
+	}
+	pkg, err := rbdutil.GetRainbondPackage(context.Background(), r.Client, cluster)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			r.Log.Error(err, "get rainbondpackage", "namespace", cluster.Namespace, "name", cluster.Name)
+		}
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: pkg.Namespace, Name: pkg.Name}}}
+}
+
 func initPackageStatus(status rainbondv1alpha1.PackageConditionStatus) rainbondv1alpha1.RainbondPackageStatus {
 	return rainbondv1alpha1.RainbondPackageStatus{
 		Conditions: []rainbondv1alpha1.PackageCondition{
@@ -181,6 +221,12 @@ func initPackageStatus(status rainbondv1alpha1.PackageConditionStatus) rainbondv
 				LastHeartbeatTime:  metav1.Now(),
 				LastTransitionTime: metav1.Now(),
 			},
+			{
+				Type:               rainbondv1alpha1.Verification,
+				Status:             status,
+				LastHeartbeatTime:  metav1.Now(),
+				LastTransitionTime: metav1.Now(),
+			},
 			{
 				Type:               rainbondv1alpha1.UnpackPackage,
 				Status:             status,
@@ -207,7 +253,9 @@ func initPackageStatus(status rainbondv1alpha1.PackageConditionStatus) rainbondv
 //checkStatusCanReturn if pkg status in the working state, straight back
 func checkStatusCanReturn(pkg *rainbondv1alpha1.RainbondPackage) (updateStatus bool, re *reconcile.Result) {
 	if len(pkg.Status.Conditions) == 0 {
+		version := pkg.Status.Version
 		pkg.Status = initPackageStatus(rainbondv1alpha1.Waiting)
+		pkg.Status.Version = version
 		return true, &reconcile.Result{}
 	}
 	completedCount := 0
@@ -233,16 +281,13 @@ func checkStatusCanReturn(pkg *rainbondv1alpha1.RainbondPackage) (updateStatus b
 type pkg struct {
 	ctx              context.Context
 	client           client.Client
-	dcli             *dclient.Client
 	pkg              *rainbondv1alpha1.RainbondPackage
 	cluster          *rainbondv1alpha1.RainbondCluster
 	log              logr.Logger
 	downloadPackage  bool
 	localPackagePath string
-	// Deprecated: no longer download installation package.
-	downloadPackageURL string
-	// Deprecated: no longer download installation package.
-	downloadPackageMD5  string
+	// download is where and how to download the package, only if downloadPackage.
+	download            *rainbondv1alpha1.PackageDownload
 	downloadImageDomain string
 	pushImageDomain     string
 	// Deprecated: no longer download installation package.
@@ -253,16 +298,10 @@ type pkg struct {
 }
 
 func newpkg(ctx context.Context, client client.Client, p *rainbondv1alpha1.RainbondPackage, cluster *rainbondv1alpha1.RainbondCluster, reqLogger logr.Logger) (*pkg, error) {
-	dcli, err := newDockerClient(ctx)
-	if err != nil {
-		reqLogger.Error(err, "failed to create docker client")
-		return nil, err
-	}
 	pkg := &pkg{
 		ctx:    ctx,
 		client: client,
 		pkg:    p.DeepCopy(),
-		dcli:   dcli,
 		// Deprecated: no longer download installation package.
 		totalImageNum: 23,
 		images:        make(map[string]string, 23),
@@ -287,6 +326,10 @@ func (p *pkg) configByCluster(c *rainbondv1alpha1.RainbondCluster) error {
 		p.version = c.Spec.InstallVersion
 	}
 	p.localPackagePath = p.pkg.Spec.PkgPath
+	if download := p.pkg.Spec.Download; download != nil && len(download.URLs) > 0 {
+		p.downloadPackage = true
+		p.download = download
+	}
 	ciVersion := c.Spec.CIVersion
 	if ciVersion == "" {
 		ciVersion = "v5.3.3"
@@ -363,6 +406,8 @@ func (p *pkg) updateConditionStatus(typ3 rainbondv1alpha1.PackageConditionType,
 			p.pkg.Status.Conditions[i].Status = status
 			if status == rainbondv1alpha1.Completed {
 				p.pkg.Status.Conditions[i].Progress = 100
+				p.pkg.Status.Conditions[i].Throughput = ""
+				p.pkg.Status.Conditions[i].ETA = ""
 				p.pkg.Status.Conditions[i].Reason = ""
 				p.pkg.Status.Conditions[i].Message = ""
 			}
@@ -395,6 +440,20 @@ func (p *pkg) updateConditionProgress(typ3 rainbondv1alpha1.PackageConditionType
 	}
 	return false
 }
+func (p *pkg) updateConditionThroughput(typ3 rainbondv1alpha1.PackageConditionType, progress downloadutil.Progress) bool {
+	throughput := fmt.Sprintf("%.1fMiB/s", progress.Throughput/(1<<20))
+	eta := progress.ETA.Round(time.Second).String()
+	for i, condition := range p.pkg.Status.Conditions {
+		if condition.Type == typ3 {
+			if condition.Throughput != throughput || condition.ETA != eta {
+				p.pkg.Status.Conditions[i].Throughput = throughput
+				p.pkg.Status.Conditions[i].ETA = eta
+				return true
+			}
+		}
+	}
+	return false
+}
 func (p *pkg) completeCondition(con *rainbondv1alpha1.PackageCondition) error {
 	if con == nil {
 		return nil
@@ -429,12 +488,61 @@ func (p *pkg) canDownload() bool {
 	return false
 }
 
+func (p *pkg) canVerify() bool {
+	if con := p.findCondition(rainbondv1alpha1.DownloadPackage); con == nil || con.Status != rainbondv1alpha1.Completed {
+		return false
+	}
+	con := p.findCondition(rainbondv1alpha1.Verification)
+	if con == nil {
+		// the package is created before the verification condition is added.
+		p.insertCondition(rainbondv1alpha1.Verification, rainbondv1alpha1.DownloadPackage)
+		con = p.findCondition(rainbondv1alpha1.Verification)
+	}
+	if con.Status == rainbondv1alpha1.Completed {
+		return false
+	}
+	if !p.downloadPackage || p.pkg.Spec.Verification == nil {
+		if err := p.completeCondition(con); err != nil {
+			p.log.Error(err, "complete verification condition because of not need verification failure")
+		}
+		return false
+	}
+	if err := p.runningCondition(con); err != nil {
+		p.log.Error(err, "running verification condition failure")
+	}
+	return true
+}
+
+// insertCondition inserts a waiting condition after the condition of type after.
+func (p *pkg) insertCondition(typ3, after rainbondv1alpha1.PackageConditionType) {
+	condition := rainbondv1alpha1.PackageCondition{
+		Type:               typ3,
+		Status:             rainbondv1alpha1.Waiting,
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.Now(),
+	}
+	conditions := make([]rainbondv1alpha1.PackageCondition, 0, len(p.pkg.Status.Conditions)+1)
+	for _, con := range p.pkg.Status.Conditions {
+		conditions = append(conditions, con)
+		if con.Type == after {
+			conditions = append(conditions, condition)
+		}
+	}
+	if len(conditions) == len(p.pkg.Status.Conditions) {
+		conditions = append(conditions, condition)
+	}
+	p.pkg.Status.Conditions = conditions
+}
+
 func (p *pkg) canUnpack() bool {
 	if con := p.findCondition(rainbondv1alpha1.DownloadPackage); con != nil {
 		//Must conditions are not met
 		if con.Status != rainbondv1alpha1.Completed {
 			return false
 		}
+		if vcon := p.findCondition(rainbondv1alpha1.Verification); vcon != nil && vcon.Status != rainbondv1alpha1.Completed {
+			return false
+		}
 		if uncon := p.findCondition(rainbondv1alpha1.UnpackPackage); uncon != nil {
 			//status is waiting
 			if uncon.Status != rainbondv1alpha1.Completed {
@@ -488,36 +596,47 @@ func (p *pkg) setInitStatus() error {
 
 //donwnloadPackage download package
 func (p *pkg) donwnloadPackage() error {
-	p.log.Info(fmt.Sprintf("start download package from %s", p.downloadPackageURL))
+	retries := downloadutil.DefaultRetries
+	if p.download.Retries != nil {
+		retries = int(*p.download.Retries)
+	}
 	downloadListener := &downloadutil.DownloadWithProgress{
-		URL:       p.downloadPackageURL,
+		URL:       p.download.URLs[0],
+		Mirrors:   p.download.URLs[1:],
 		SavedPath: p.localPackagePath,
-		Wanted:    p.downloadPackageMD5,
-	}
-	// first chack exist file md5
-	file, _ := os.Open(p.localPackagePath)
-	if file != nil {
-		err := downloadListener.CheckMD5(file)
-		_ = file.Close()
-		if err == nil {
-			p.log.Info("rainbond package file is exists")
-			return nil
+		Wanted:    p.download.SHA256,
+		Retries:   retries,
+		Proxy:     p.download.Proxy,
+	}
+	// first chack exist file checksum
+	if p.download.SHA256 != "" {
+		file, _ := os.Open(p.localPackagePath)
+		if file != nil {
+			err := downloadListener.CheckMD5(file)
+			_ = file.Close()
+			if err == nil {
+				p.log.Info("rainbond package file is exists")
+				return nil
+			}
 		}
 	}
-	p.log.Info("rainbond package file does not exists, downloading background ...")
-	var stop = make(chan struct{}, 1)
+	p.log.Info("rainbond package file does not exists, downloading background ...", "urls", p.download.URLs)
+	var stop = make(chan struct{})
+	defer close(stop)
 	go func() {
 		ticker := time.NewTicker(time.Second * 3)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				progress := downloadListener.Percent
+				progress := downloadListener.Progress()
 				//Make time for later in the download process
-				realProgress := int32(progress) - int32(float64(progress)*0.05)
-				if p.updateConditionProgress(rainbondv1alpha1.DownloadPackage, realProgress) {
+				realProgress := int32(progress.Percent) - int32(float64(progress.Percent)*0.05)
+				changed := p.updateConditionProgress(rainbondv1alpha1.DownloadPackage, realProgress)
+				if p.updateConditionThroughput(rainbondv1alpha1.DownloadPackage, progress) || changed {
 					if err := p.updateCRStatus(); err != nil {
 						// ignore error
-						p.log.Info("update number extracted: %v", err)
+						p.log.Info(fmt.Sprintf("update download progress: %v", err))
 					}
 				}
 			case <-stop:
@@ -526,18 +645,10 @@ func (p *pkg) donwnloadPackage() error {
 		}
 	}()
 	if err := downloadListener.Download(); err != nil {
-		p.log.Error(err, "download rainbond package error, will retry")
-		p.updateConditionResion(rainbondv1alpha1.Init, err.Error(), "download rainbond package error, will retry")
-		p.updateCRStatus()
-		err = downloadListener.Download()
-		if err != nil {
-			p.log.Error(err, "download rainbond package error, not retry")
-			return err
-		}
+		p.log.Error(err, "download rainbond package error")
+		return err
 	}
-	//stop watch progress
-	stop <- struct{}{}
-	p.log.Info(fmt.Sprintf("success download package from %s", p.downloadPackageURL))
+	p.log.Info("success download package", "path", p.localPackagePath)
 	return nil
 }
 
@@ -578,6 +689,16 @@ func (p *pkg) handle() error {
 		return p.updateCRStatus()
 	}
 
+	if p.canVerify() {
+		if err := p.verifyPackage(); err != nil {
+			p.failVerification(err)
+			return fmt.Errorf("failed to verify %s: %v", p.pkg.Spec.PkgPath, err)
+		}
+		p.log.Info("handle package verification success")
+		p.updateConditionStatus(rainbondv1alpha1.Verification, rainbondv1alpha1.Completed)
+		return p.updateCRStatus()
+	}
+
 	if p.canUnpack() {
 		//unstar the installation package
 		if err := p.untartar(); err != nil {
@@ -592,7 +713,7 @@ func (p *pkg) handle() error {
 	}
 
 	if p.canPushImage() {
-		// Deprecated: No longer download the installation package
+		// the images are loaded from the downloaded package.
 		if p.downloadPackage {
 			p.log.Info("start load and push images")
 			if err := p.imagesLoadAndPush(); err != nil {
@@ -623,6 +744,23 @@ func (p *pkg) handle() error {
 	return nil
 }
 
+// verifyPackage verifies the signature of the manifest in the package before the package is unpacked.
+func (p *pkg) verifyPackage() error {
+	p.log.Info(fmt.Sprintf("start verifying %s", p.pkg.Spec.PkgPath))
+	manifest, _, err := manifestutil.LoadFromPackage(p.pkg.Spec.PkgPath, p.pkg.Spec.Verification.PublicKey)
+	if err != nil {
+		return err
+	}
+	p.log.Info("the manifest of the package is verified", "images", len(manifest.Images))
+	return nil
+}
+
+func (p *pkg) failVerification(err error) {
+	p.updateConditionStatus(rainbondv1alpha1.Verification, rainbondv1alpha1.Failed)
+	p.updateConditionResion(rainbondv1alpha1.Verification, err.Error(), "verify package failure")
+	p.updateCRStatus()
+}
+
 func (p *pkg) untartar() error {
 	p.log.Info(fmt.Sprintf("start untartaring %s", p.pkg.Spec.PkgPath))
 	f, err := os.Open(p.pkg.Spec.PkgPath)
@@ -639,7 +777,7 @@ func (p *pkg) untartar() error {
 		for {
 			select {
 			case <-ticker.C:
-				num := countImages(pkgDst)
+				num := countImageSources(pkgDst)
 				progress := num * 100 / p.totalImageNum
 				if p.updateConditionProgress(rainbondv1alpha1.UnpackPackage, progress) {
 					if err := p.updateCRStatus(); err != nil {
@@ -659,322 +797,320 @@ func (p *pkg) untartar() error {
 	stop <- struct{}{}
 	return nil
 }
+// defaultPushConcurrency is the number of images pushed at the same time if not set in the spec.
+const defaultPushConcurrency = 4
+
+// pushRetryInterval is the interval between the retries of pushing an image.
+var pushRetryInterval = 2 * time.Second
+
+// imageJob pushes the images from the source, such as a remote image or an image tarball.
+type imageJob struct {
+	source string
+	// name is the image pushed, if it is known before pushed.
+	name string
+	// count is the number of the images pushed from the source.
+	count int32
+	// verify is called before the images are pushed, whose failure is not retried.
+	verify func() error
+	push   func() ([]registryutil.Image, error)
+}
+
 func (p *pkg) imagePullAndPush() error {
-	p.pkg.Status.ImagesNumber = int32(len(p.images))
-	p.pkg.Status.ImagesPushed = nil
-	var count int32
-	handleImgae := func(remoteImage, localImage string) error {
-		return retryutil.Retry(time.Second*2, 3, func() (bool, error) {
-			exists, err := p.checkIfImageExists(remoteImage)
-			if err != nil {
-				return false, fmt.Errorf("check if image exists: %v", err)
-			}
-			if !exists {
-				p.log.V(4).Info("image does not exists, start pulling", "image name", remoteImage)
-				if err := p.imagePull(remoteImage); err != nil {
-					return false, fmt.Errorf("pull image %s failure %s", remoteImage, err.Error())
-				}
-			}
-			if err := p.dcli.ImageTag(p.ctx, remoteImage, localImage); err != nil {
-				return false, fmt.Errorf("change image tag(%s => %s) failure: %v", remoteImage, localImage, err)
-			}
-			if err := p.imagePush(localImage); err != nil {
-				return false, fmt.Errorf("push image %s failure %s", localImage, err.Error())
-			}
-			return true, nil
-		})
+	registry, err := p.registryClient()
+	if err != nil {
+		return err
 	}
-
+	var jobs []imageJob
 	for old, new := range p.images {
 		remoteImage := path.Join(p.downloadImageDomain, old)
 		localImage := path.Join(p.pushImageDomain, new)
-		if err := handleImgae(remoteImage, localImage); err != nil {
-			return err
-		}
-		count++
-		p.pkg.Status.ImagesPushed = append(p.pkg.Status.ImagesPushed, rainbondv1alpha1.RainbondPackageImage{Name: localImage})
-		progress := count * 100 / p.pkg.Status.ImagesNumber
-		if p.updateConditionProgress(rainbondv1alpha1.PushImage, progress) {
-			if err := p.updateCRStatus(); err != nil {
-				return fmt.Errorf("update cr status: %v", err)
-			}
-		}
-		p.log.Info("successfully load image", "image", localImage)
+		jobs = append(jobs, imageJob{
+			source: remoteImage,
+			name:   localImage,
+			count:  1,
+			push: func() ([]registryutil.Image, error) {
+				// copy the image from the registry to the image hub directly, without the docker daemon.
+				digest, err := registry.Copy(p.ctx, remoteImage, localImage)
+				if err != nil {
+					return nil, fmt.Errorf("copy image %s to %s failure: %v", remoteImage, localImage, err)
+				}
+				return []registryutil.Image{{Name: localImage, Digest: digest}}, nil
+			},
+		})
 	}
-	return nil
+	return p.pushImages(jobs)
 }
+
 func (p *pkg) imagesLoadAndPush() error {
-	p.pkg.Status.ImagesNumber = countImages(pkgDst)
-	p.pkg.Status.ImagesPushed = nil
-	var count int32
-	walkFn := func(pstr string, info os.FileInfo, err error) error {
-		l := p.log.WithValues("file", pstr)
+	registry, err := p.registryClient()
+	if err != nil {
+		return err
+	}
+	var manifest *manifestutil.Manifest
+	var manifestDir string
+	if p.pkg.Spec.Verification != nil {
+		manifest, manifestDir, err = manifestutil.Load(pkgDst, p.pkg.Spec.Verification.PublicKey)
 		if err != nil {
-			l.Info(fmt.Sprintf("prevent panic by handling failure accessing a path %q: %v\n", pstr, err))
-			return fmt.Errorf("prevent panic by handling failure accessing a path %q: %v", pstr, err)
+			p.failVerification(err)
+			return fmt.Errorf("verify manifest: %v", err)
 		}
-		if !commonutil.IsFile(pstr) {
-			return nil
+		for _, image := range manifest.Images {
+			if !commonutil.IsFile(filepath.Join(manifestDir, filepath.FromSlash(image.Path))) {
+				err := fmt.Errorf("%s listed in the manifest is not found", image.Path)
+				p.failVerification(err)
+				return err
+			}
 		}
-		if !validateFile(pstr) {
-			l.Info("invalid file, skip it1")
-			return nil
+	}
+	rename := func(image string) (string, error) {
+		newImage := newImageWithNewDomain(image, rbdutil.GetImageRepository(p.cluster))
+		if newImage == "" {
+			return "", fmt.Errorf("parse image name %s failure", image)
 		}
+		return newImage, nil
+	}
 
-		f := func() (bool, error) {
-			image, err := p.imageLoad(pstr)
-			if err != nil {
-				l.Error(err, "load image")
-				return false, fmt.Errorf("load image: %v", err)
-			}
-
-			newImage := newImageWithNewDomain(image, rbdutil.GetImageRepository(p.cluster))
-			if newImage == "" {
-				return false, fmt.Errorf("parse image name failure")
+	var jobs []imageJob
+	err = walkImageSources(pkgDst, func(pstr string, layout bool) error {
+		l := p.log.WithValues("source", pstr)
+		source, err := filepath.Rel(pkgDst, pstr)
+		if err != nil {
+			return err
+		}
+		job := imageJob{source: filepath.ToSlash(source)}
+		// the images are counted by the manifest or the index of the source, rather than the files.
+		var count int
+		if layout {
+			count, err = registryutil.CountLayout(pstr)
+			job.push = func() ([]registryutil.Image, error) {
+				images, err := registry.PushLayout(p.ctx, pstr, rename)
+				if err != nil {
+					return nil, fmt.Errorf("push images in %s: %v", pstr, err)
+				}
+				return images, nil
 			}
-
-			if err := p.dcli.ImageTag(p.ctx, image, newImage); err != nil {
-				l.Error(err, "tag image", "source", image, "target", newImage)
-				return false, fmt.Errorf("tag image: %v", err)
+		} else {
+			count, err = registryutil.CountArchive(pstr)
+			job.push = func() ([]registryutil.Image, error) {
+				// push the images in the tarball to the image hub directly, without the docker daemon.
+				images, err := registry.PushArchive(p.ctx, pstr, rename)
+				if err != nil {
+					return nil, fmt.Errorf("push images in %s: %v", pstr, err)
+				}
+				return images, nil
 			}
-
-			if err = p.imagePush(newImage); err != nil {
-				l.Error(err, "push image", "image", newImage)
-				return false, fmt.Errorf("push image %s: %v", newImage, err)
+		}
+		if err != nil {
+			return fmt.Errorf("count images in %s: %v", pstr, err)
+		}
+		if count == 0 {
+			l.Info("no image found, skip it")
+			return nil
+		}
+		job.count = int32(count)
+		if manifest != nil {
+			// verify the digest before the image is loaded. The blobs of the layout are addressed by their
+			// digests, so it is enough to verify the index.
+			file := pstr
+			if layout {
+				file = filepath.Join(pstr, "index.json")
 			}
-			count++
-			p.pkg.Status.ImagesPushed = append(p.pkg.Status.ImagesPushed, rainbondv1alpha1.RainbondPackageImage{Name: newImage})
-			progress := count * 100 / p.pkg.Status.ImagesNumber
-			if p.updateConditionProgress(rainbondv1alpha1.PushImage, progress) {
-				if err := p.updateCRStatus(); err != nil {
-					return false, fmt.Errorf("update cr status: %v", err)
-				}
+			job.verify = func() error {
+				return manifest.VerifyFile(manifestDir, file)
 			}
-			l.Info("successfully load image", "image", newImage)
-			return true, nil
 		}
-
-		return retryutil.Retry(1*time.Second, 3, f)
+		jobs = append(jobs, job)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	return filepath.Walk(pkgDst, walkFn)
+	return p.pushImages(jobs)
 }
 
-func (p *pkg) imageLoad(file string) (string, error) {
-	p.log.Info("start loading image", "file", file)
-	f, err := os.Open(file)
-	if err != nil {
-		return "", fmt.Errorf("open file %s: %v", file, err)
+// pushImages runs the jobs with at most PushConcurrency of them at the same time, and records the status of
+// every image in ImagesPushed. The sources pushed by the previous attempts are skipped, so that only the ones
+// failed are pushed again.
+func (p *pkg) pushImages(jobs []imageJob) error {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].source < jobs[j].source })
+
+	// the images of a source are pushed only if all of them are pushed.
+	results := make(map[string][]rainbondv1alpha1.RainbondPackageImage)
+	for _, image := range p.pkg.Status.ImagesPushed {
+		results[image.Source] = append(results[image.Source], image)
+	}
+	var pending []imageJob
+	for _, job := range jobs {
+		pushed := len(results[job.source]) > 0
+		for _, image := range results[job.source] {
+			pushed = pushed && image.Status == rainbondv1alpha1.ImagePushed
+		}
+		if pushed {
+			continue
+		}
+		results[job.source] = []rainbondv1alpha1.RainbondPackageImage{
+			{Name: job.name, Source: job.source, Status: rainbondv1alpha1.ImagePending},
+		}
+		pending = append(pending, job)
 	}
-	defer f.Close()
-	res, err := p.dcli.ImageLoad(p.ctx, f, true) // load one, push one.
-	if err != nil {
-		return "", fmt.Errorf("path: %s; failed to load images: %v", file, err)
+	var total, count int32
+	for _, job := range jobs {
+		total += job.count
 	}
-	var imageName string
-	if res.Body != nil {
-		defer res.Body.Close()
-		dec := json.NewDecoder(res.Body)
-		for {
-			select {
-			case <-p.ctx.Done():
-				p.log.Error(p.ctx.Err(), "error form context")
-				return "", p.ctx.Err()
-			default:
-			}
-			var jm jsonmessage.JSONMessage
-			if err := dec.Decode(&jm); err != nil {
-				if err == io.EOF {
-					break
-				}
-				return "", fmt.Errorf("failed to decode json message: %v", err)
-			}
-			if jm.Error != nil {
-				return "", fmt.Errorf("error detail: %v", jm.Error)
-			}
-			msg := jm.Stream
-			//the domain of image in package is goodrain.me,not need change tag
-			image := parseImageName(msg)
-			if image != "" {
-				imageName = image
-			}
-		}
+	count = total
+	for _, job := range pending {
+		count -= job.count
 	}
-	if imageName == "" {
-		return "", fmt.Errorf("not parse image name")
+	p.pkg.Status.ImagesNumber = total
+	p.pkg.Status.ImagesPushed = imagesStatus(jobs, results)
+	if len(pending) == 0 {
+		return nil
 	}
-	p.log.Info("success loading image", "image", imageName)
-	return imageName, nil
-}
+	p.log.Info("start pushing images", "total", total, "pushed", count)
 
-func (p *pkg) imagePush(image string) error {
-	p.log.Info("start push image", "image", image)
-	var pullipo dtypes.ImagePushOptions
-	if p.cluster != nil && p.cluster.Spec.ImageHub != nil && p.cluster.Spec.ImageHub.Username != "" {
-		auth, err := EncodeAuthToBase64(dtypes.AuthConfig{
-			Username: p.cluster.Spec.ImageHub.Username,
-			Password: p.cluster.Spec.ImageHub.Password,
-		})
-		if err != nil {
-			p.log.Error(err, "Encode image hub user and password failure")
-			return err
-		}
-		pullipo = dtypes.ImagePushOptions{
-			RegistryAuth: auth,
-		}
-	} else {
-		pullipo = dtypes.ImagePushOptions{}
+	concurrency := int(p.pkg.Spec.PushConcurrency)
+	if concurrency <= 0 {
+		concurrency = defaultPushConcurrency
 	}
-	ctx, cancel := context.WithCancel(p.ctx)
-	defer cancel()
-	var res io.ReadCloser
-	res, err := p.dcli.ImagePush(ctx, image, pullipo)
-	if err != nil {
-		p.log.Error(err, "failed to push image", "image", image)
-		return err
+	if concurrency > len(pending) {
+		concurrency = len(pending)
 	}
-	if res != nil {
-		defer res.Close()
 
-		dec := json.NewDecoder(res)
-		for {
-			select {
-			case <-ctx.Done():
-				p.log.Error(p.ctx.Err(), "error form context")
-				return p.ctx.Err()
-			default:
-			}
-			var jm jsonmessage.JSONMessage
-			if err := dec.Decode(&jm); err != nil {
-				if err == io.EOF {
-					break
-				}
-				return fmt.Errorf("failed to decode json message: %v", err)
+	var mu sync.Mutex
+	var failed []error
+	var verifyErr error
+	done := func(job imageJob, images []registryutil.Image, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		l := p.log.WithValues("source", job.source)
+		if err != nil {
+			l.Error(err, "push images")
+			failed = append(failed, err)
+			results[job.source] = []rainbondv1alpha1.RainbondPackageImage{
+				{Name: job.name, Source: job.source, Status: rainbondv1alpha1.ImageFailed, Error: err.Error()},
 			}
-			if jm.Error != nil {
-				return fmt.Errorf("error detail: %v", jm.Error)
+		} else {
+			count += job.count
+			var pushed []rainbondv1alpha1.RainbondPackageImage
+			for _, image := range images {
+				pushed = append(pushed, rainbondv1alpha1.RainbondPackageImage{
+					Name: image.Name, Source: job.source, Status: rainbondv1alpha1.ImagePushed, Digest: image.Digest,
+				})
+				l.Info("successfully push image", "image", image.Name, "digest", image.Digest)
 			}
+			results[job.source] = pushed
 		}
-	}
-	p.log.Info("success push image", "image", image)
-	return nil
-}
-
-func (p *pkg) imagePull(image string) error {
-	p.log.Info("start pull image", "image", image)
-	ctx, cancel := context.WithCancel(p.ctx)
-	defer cancel()
-	rf, err := reference.ParseAnyReference(image)
-	if err != nil {
-		p.log.Error(err, "reference image error")
-		return err
-	}
-	var pullipo dtypes.ImagePullOptions
-	if p.pkg.Spec.ImageHubUser != "" {
-		auth, err := EncodeAuthToBase64(dtypes.AuthConfig{Username: p.pkg.Spec.ImageHubUser, Password: p.pkg.Spec.ImageHubPass})
-		if err != nil {
-			p.log.Error(err, "Encode image hub user and password failure")
-			return err
+		p.pkg.Status.ImagesPushed = imagesStatus(jobs, results)
+		if total > 0 {
+			p.updateConditionProgress(rainbondv1alpha1.PushImage, count*100/total)
 		}
-		pullipo = dtypes.ImagePullOptions{
-			RegistryAuth: auth,
+		if err := p.updateCRStatus(); err != nil {
+			// ignore error, the status is updated again once all the images are pushed.
+			l.Info(fmt.Sprintf("update images pushed: %v", err))
 		}
-	} else {
-		pullipo = dtypes.ImagePullOptions{}
 	}
-	res, err := p.dcli.ImagePull(ctx, rf.String(), pullipo)
-	if err != nil {
-		return fmt.Errorf("pull image %s failure %s", image, err.Error())
-	}
-	if res != nil {
-		defer res.Close()
-		dec := json.NewDecoder(res)
-		for {
-			select {
-			case <-ctx.Done():
-				p.log.Error(ctx.Err(), "error form context")
-				return ctx.Err()
-			default:
-			}
-			var jm jsonmessage.JSONMessage
-			if err := dec.Decode(&jm); err != nil {
-				if err == io.EOF {
-					break
+
+	queue := make(chan imageJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if job.verify != nil {
+					if err := job.verify(); err != nil {
+						mu.Lock()
+						if verifyErr == nil {
+							verifyErr = err
+						}
+						mu.Unlock()
+						done(job, nil, fmt.Errorf("verify image: %v", err))
+						continue
+					}
 				}
-				return fmt.Errorf("failed to decode json message: %v", err)
-			}
-			if jm.Error != nil {
-				return fmt.Errorf("error detail: %v", jm.Error)
+				var images []registryutil.Image
+				var lastErr error
+				err := retryutil.Retry(pushRetryInterval, 3, func() (bool, error) {
+					if images, lastErr = job.push(); lastErr != nil {
+						return false, nil
+					}
+					return true, nil
+				})
+				if err != nil && lastErr != nil {
+					err = lastErr
+				}
+				done(job, images, err)
 			}
-		}
+		}()
 	}
-	p.log.Info("success pull image", "image", image)
-	return nil
-}
-
-// EncodeAuthToBase64 serializes the auth configuration as JSON base64 payload
-func EncodeAuthToBase64(authConfig dtypes.AuthConfig) (string, error) {
-	buf, err := json.Marshal(authConfig)
-	if err != nil {
-		return "", err
+	for _, job := range pending {
+		queue <- job
 	}
-	return base64.URLEncoding.EncodeToString(buf), nil
-}
+	close(queue)
+	wg.Wait()
 
-func newDockerClient(ctx context.Context) (*dclient.Client, error) {
-	cli, err := dclient.NewClientWithOpts(dclient.FromEnv)
-	if err != nil {
-		return nil, fmt.Errorf("create new docker client: %v", err)
+	if verifyErr != nil {
+		p.failVerification(verifyErr)
 	}
-	cli.NegotiateAPIVersion(ctx)
-
-	return cli, nil
-}
-
-func parseImageName(str string) string {
-	if !strings.Contains(str, "Loaded image: ") {
-		return ""
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d image sources failed to be pushed, the first is: %v", len(failed), len(jobs), failed[0])
 	}
-	str = strings.Replace(str, "Loaded image: ", "", -1)
-	str = strings.Replace(str, "\n", "", -1)
-	str = trimLatest(str)
-	return str
+	return nil
 }
 
-func trimLatest(str string) string {
-	if !strings.HasSuffix(str, ":latest") {
-		return str
+// imagesStatus returns the status of the images in the order of the jobs.
+func imagesStatus(jobs []imageJob, results map[string][]rainbondv1alpha1.RainbondPackageImage) []rainbondv1alpha1.RainbondPackageImage {
+	images := make([]rainbondv1alpha1.RainbondPackageImage, 0, len(jobs))
+	for _, job := range jobs {
+		images = append(images, results[job.source]...)
 	}
-	return str[:len(str)-len(":latest")]
+	return images
 }
 
-func countImages(dir string) int32 {
-	var count int32
-	_ = filepath.Walk(dir, func(pstr string, info os.FileInfo, err error) error {
+// walkImageSources walks the directory for the sources of the images, which are the image tarballs, gzipped, zstd
+// compressed or not, and the OCI image layouts, and calls fn with every one of them. The format is detected by the
+// content rather than the name.
+func walkImageSources(dir string, fn func(source string, layout bool) error) error {
+	return filepath.Walk(dir, func(pstr string, info os.FileInfo, err error) error {
 		if err != nil {
-			return nil
+			return fmt.Errorf("prevent panic by handling failure accessing a path %q: %v", pstr, err)
 		}
-		if !commonutil.IsFile(pstr) {
+		// the temporary files and directories, such as the archives being extracted, are skipped.
+		if pstr != dir && strings.HasPrefix(info.Name(), "._") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if !validateFile(pstr) {
+		if info.IsDir() {
+			if !registryutil.IsLayout(pstr) {
+				return nil
+			}
+			if err := fn(pstr, true); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
 			return nil
 		}
+		if ok, err := registryutil.IsArchive(pstr); err != nil || !ok {
+			return err
+		}
+		return fn(pstr, false)
+	})
+}
+
+// countImageSources returns the number of the sources of the images in the directory.
+func countImageSources(dir string) int32 {
+	var count int32
+	_ = walkImageSources(dir, func(source string, layout bool) error {
 		count++
 		return nil
 	})
-
 	return count
 }
 
-func validateFile(file string) bool {
-	base := path.Base(file)
-	if path.Ext(base) != ".tgz" || strings.HasPrefix(base, "._") {
-		return false
-	}
-	return true
-}
-
 func newImageWithNewDomain(image string, newDomain string) string {
 	repo, err := reference.Parse(image)
 	if err != nil {
@@ -989,35 +1125,41 @@ func newImageWithNewDomain(image string, newDomain string) string {
 	return path.Join(newDomain, remoteName+":"+tag)
 }
 
-func (p *pkg) checkIfImageExists(image string) (bool, error) {
-	repo, err := reference.Parse(image)
-	if err != nil {
-		p.log.V(6).Info("parse image", "image", image, "error", err)
-		return false, fmt.Errorf("parse image %s: %v", image, err)
-	}
-	named := repo.(reference.Named)
-	tag := "latest"
-	if t, ok := repo.(reference.Tagged); ok {
-		tag = t.Tag()
-	}
-	imageFullName := named.Name() + ":" + tag
-
-	ctx, cancel := context.WithCancel(p.ctx)
-	defer cancel()
-
-	imageSummarys, err := p.dcli.ImageList(ctx, dtypes.ImageListOptions{
-		Filters: filters.NewArgs(filters.KeyValuePair{Key: "reference", Value: imageFullName}),
-	})
-	if err != nil {
-		return false, fmt.Errorf("list images: %v", err)
+// registryClient creates a client to copy the images from the install source image hub, or the package, to the
+// image hub of the cluster.
+func (p *pkg) registryClient() (*registryutil.Client, error) {
+	opts := registryutil.Options{Auths: make(map[string]registryutil.Auth)}
+	if p.pkg.Spec.ImageHubUser != "" {
+		host, err := registryutil.Host(path.Join(p.downloadImageDomain, "image"))
+		if err != nil {
+			return nil, err
+		}
+		password := p.pkg.Spec.ImageHubPass
+		if p.pkg.Spec.ImageHubPassSecretRef != nil {
+			password, err = k8sutil.GetSecretKeyValue(p.ctx, p.client, p.pkg.Namespace, p.pkg.Spec.ImageHubPassSecretRef)
+			if err != nil {
+				return nil, fmt.Errorf("get install source image hub password: %v", err)
+			}
+		}
+		opts.Auths[host] = registryutil.Auth{Username: p.pkg.Spec.ImageHubUser, Password: password}
 	}
-	for _, imageSummary := range imageSummarys {
-		fmt.Printf("%#v", imageSummary.RepoTags)
+	if imageHub := p.cluster.Spec.ImageHub; imageHub != nil {
+		if imageHub.Username != "" {
+			password, err := rbdutil.GetImageHubPassword(p.ctx, p.client, p.cluster)
+			if err != nil {
+				return nil, fmt.Errorf("get image hub password: %v", err)
+			}
+			opts.Auths[imageHub.Domain] = registryutil.Auth{Username: imageHub.Username, Password: password}
+		}
+		if imageHub.Domain == constants.DefImageRepository {
+			// the default image hub is served by the gateway with a self-signed certificate.
+			opts.InsecureRegistries = []string{constants.DefImageRepository}
+			if ip := p.cluster.InnerGatewayIngressIP(); ip != "" {
+				opts.Hosts = map[string]string{constants.DefImageRepository: ip}
+			}
+		}
 	}
-
-	_ = imageSummarys
-
-	return len(imageSummarys) > 0, nil
+	return registryutil.NewClient(opts), nil
 }
 
 func (p *pkg) isImageRepositoryReady() bool {
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/manifestutil"
+	"github.com/goodrain/rainbond-operator/util/registryutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// writeSignedPackage writes a package with the manifest signed by priv.
+func writeSignedPackage(t *testing.T, pkgPath string, priv ed25519.PrivateKey) {
+	manifest, _ := json.Marshal(manifestutil.Manifest{})
+	files := map[string][]byte{
+		manifestutil.ManifestName:  manifest,
+		manifestutil.SignatureName: ed25519.Sign(priv, manifest),
+	}
+	f, err := os.Create(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+}
+
+func TestPackageVerification(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	pkgPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	writeSignedPackage(t, pkgPath, priv)
+
+	// the package is created before the verification condition is added.
+	status := initPackageStatus(rainbondv1alpha1.Waiting)
+	var conditions []rainbondv1alpha1.PackageCondition
+	for _, condition := range status.Conditions {
+		if condition.Type == rainbondv1alpha1.Verification {
+			continue
+		}
+		if condition.Type == rainbondv1alpha1.Init || condition.Type == rainbondv1alpha1.DownloadPackage {
+			condition.Status = rainbondv1alpha1.Completed
+		}
+		conditions = append(conditions, condition)
+	}
+	status.Conditions = conditions
+	rp := &rainbondv1alpha1.RainbondPackage{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondpackage", Namespace: "rbd-system"},
+		Spec: rainbondv1alpha1.RainbondPackageSpec{
+			PkgPath:      pkgPath,
+			Download:     &rainbondv1alpha1.PackageDownload{URLs: []string{"https://pkg.example.com/rainbond.tgz"}},
+			Verification: &rainbondv1alpha1.PackageVerification{PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+		},
+		Status: status,
+	}
+	cli := fake.NewFakeClientWithScheme(scheme, rp)
+	p := &pkg{ctx: context.Background(), client: cli, pkg: rp.DeepCopy(), log: ctrl.Log, downloadPackage: true}
+
+	assert.True(t, p.canVerify())
+	var types []rainbondv1alpha1.PackageConditionType
+	for _, condition := range p.pkg.Status.Conditions {
+		types = append(types, condition.Type)
+	}
+	assert.Equal(t, []rainbondv1alpha1.PackageConditionType{rainbondv1alpha1.Init, rainbondv1alpha1.DownloadPackage,
+		rainbondv1alpha1.Verification, rainbondv1alpha1.UnpackPackage, rainbondv1alpha1.PushImage, rainbondv1alpha1.Ready}, types)
+	// the package can not be unpacked until it is verified.
+	assert.False(t, p.canUnpack())
+	assert.NoError(t, p.verifyPackage())
+
+	// signed by another key.
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	writeSignedPackage(t, pkgPath, other)
+	err = p.verifyPackage()
+	if assert.Error(t, err) {
+		p.failVerification(err)
+		condition := p.findCondition(rainbondv1alpha1.Verification)
+		assert.Equal(t, rainbondv1alpha1.Failed, condition.Status)
+		assert.Equal(t, manifestutil.ErrSignatureMismatch.Error(), condition.Reason)
+	}
+
+	// not verified without the verification.
+	p.pkg.Spec.Verification = nil
+	assert.False(t, p.canVerify())
+	assert.Equal(t, rainbondv1alpha1.Completed, p.findCondition(rainbondv1alpha1.Verification).Status)
+}
+
+func TestReconcilePackageOfNewInstallVersion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &rainbondv1alpha1.RainbondCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system"},
+		Spec: rainbondv1alpha1.RainbondClusterSpec{
+			ConfigCompleted: true,
+			InstallMode:     rainbondv1alpha1.InstallationModeOffline,
+			InstallVersion:  "v5.4.0-release",
+		},
+		Status: rainbondv1alpha1.RainbondClusterStatus{InstalledVersion: "v5.3.0-release"},
+	}
+	// the package of the installed version is handled before the version is recorded.
+	rp := &rainbondv1alpha1.RainbondPackage{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondpackage", Namespace: "rbd-system"},
+		Status:     initPackageStatus(rainbondv1alpha1.Completed),
+	}
+	cli := fake.NewFakeClientWithScheme(scheme, cluster, rp)
+	r := &RainbondPackageReconciler{Client: cli, Log: ctrl.Log, Scheme: scheme}
+
+	key := types.NamespacedName{Namespace: "rbd-system", Name: "rainbondpackage"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	got := &rainbondv1alpha1.RainbondPackage{}
+	if err := cli.Get(context.Background(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "v5.4.0-release", got.Status.Version)
+	for _, condition := range got.Status.Conditions {
+		assert.Equal(t, rainbondv1alpha1.Waiting, condition.Status, string(condition.Type))
+	}
+}
+
+func TestPushImages(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	interval := pushRetryInterval
+	pushRetryInterval = time.Millisecond
+	defer func() { pushRetryInterval = interval }()
+
+	rp := &rainbondv1alpha1.RainbondPackage{
+		ObjectMeta: metav1.ObjectMeta{Name: "rainbondpackage", Namespace: "rbd-system"},
+		Spec:       rainbondv1alpha1.RainbondPackageSpec{PushConcurrency: 2},
+		Status:     initPackageStatus(rainbondv1alpha1.Waiting),
+	}
+	cli := fake.NewFakeClientWithScheme(scheme, rp)
+	p := &pkg{ctx: context.Background(), client: cli, pkg: rp.DeepCopy(), log: ctrl.Log}
+
+	var mu sync.Mutex
+	pushes := make(map[string]int)
+	broken := map[string]bool{"images/rbd-worker.tgz": true}
+	newJobs := func(sources ...string) []imageJob {
+		var jobs []imageJob
+		for _, source := range sources {
+			source := source
+			jobs = append(jobs, imageJob{source: source, count: 1, push: func() ([]registryutil.Image, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				pushes[source]++
+				if broken[source] {
+					return nil, fmt.Errorf("%s is broken", source)
+				}
+				name := "goodrain.me/" + strings.TrimSuffix(filepath.Base(source), ".tgz")
+				return []registryutil.Image{{Name: name, Digest: "sha256:" + source}}, nil
+			}})
+		}
+		return jobs
+	}
+	sources := []string{"images/rbd-worker.tgz", "images/rbd-api.tgz", "images/rbd-chaos.tgz"}
+
+	err := p.pushImages(newJobs(sources...))
+	assert.EqualError(t, err, "1 of 3 image sources failed to be pushed, the first is: images/rbd-worker.tgz is broken")
+	assert.Equal(t, map[string]int{"images/rbd-api.tgz": 1, "images/rbd-chaos.tgz": 1, "images/rbd-worker.tgz": 4}, pushes)
+	assert.Equal(t, int32(3), p.pkg.Status.ImagesNumber)
+	assert.Equal(t, []rainbondv1alpha1.RainbondPackageImage{
+		{Name: "goodrain.me/rbd-api", Source: "images/rbd-api.tgz", Status: rainbondv1alpha1.ImagePushed, Digest: "sha256:images/rbd-api.tgz"},
+		{Name: "goodrain.me/rbd-chaos", Source: "images/rbd-chaos.tgz", Status: rainbondv1alpha1.ImagePushed, Digest: "sha256:images/rbd-chaos.tgz"},
+		{Source: "images/rbd-worker.tgz", Status: rainbondv1alpha1.ImageFailed, Error: "images/rbd-worker.tgz is broken"},
+	}, p.pkg.Status.ImagesPushed)
+
+	// the status is persisted.
+	latest := &rainbondv1alpha1.RainbondPackage{}
+	if err := cli.Get(context.Background(), types.NamespacedName{Namespace: rp.Namespace, Name: rp.Name}, latest); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, latest.Status.ImagesPushed, 3)
+
+	// only the failed image is pushed again.
+	pushes = make(map[string]int)
+	broken = nil
+	p = &pkg{ctx: context.Background(), client: cli, pkg: latest, log: ctrl.Log}
+	assert.NoError(t, p.pushImages(newJobs(sources...)))
+	assert.Equal(t, map[string]int{"images/rbd-worker.tgz": 1}, pushes)
+	for _, image := range p.pkg.Status.ImagesPushed {
+		assert.Equal(t, rainbondv1alpha1.ImagePushed, image.Status, image.Source)
+	}
+	assert.Equal(t, 100, p.findCondition(rainbondv1alpha1.PushImage).Progress)
+}
+
+func TestWalkImageSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, content []byte) {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: 2, Typeflag: tar.TypeReg})
+	tw.Write([]byte("[]"))
+	tw.Close()
+	writeFile("rainbond/images/rbd-api.tar", buf.Bytes())
+	writeFile("rainbond/images/rbd-worker.img", buf.Bytes())
+	writeFile("rainbond/images/layout/oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`))
+	writeFile("rainbond/images/layout/index.json", []byte(`{"schemaVersion":2,"manifests":[]}`))
+	writeFile("rainbond/images/layout/blobs/sha256/foo", buf.Bytes())
+	writeFile("rainbond/images/._rbd-api.tar123/manifest.json", []byte("[]"))
+	writeFile("rainbond/images/._rbd-chaos.tar", buf.Bytes())
+	writeFile("rainbond/manifest.json", []byte(`{"images":[]}`))
+
+	sources := make(map[string]bool)
+	err := walkImageSources(dir, func(source string, layout bool) error {
+		rel, _ := filepath.Rel(dir, source)
+		sources[filepath.ToSlash(rel)] = layout
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"rainbond/images/rbd-api.tar":    false,
+		"rainbond/images/rbd-worker.img": false,
+		"rainbond/images/layout":         true,
+	}, sources)
+	assert.Equal(t, int32(3), countImageSources(dir))
+}
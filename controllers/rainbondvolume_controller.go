@@ -32,11 +32,13 @@ import (
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	"github.com/goodrain/rainbond-operator/controllers/plugin"
+	"github.com/goodrain/rainbond-operator/util/constants"
 	"github.com/goodrain/rainbond-operator/util/k8sutil"
 	"github.com/goodrain/rainbond-operator/util/rbdutil"
 )
@@ -84,6 +86,17 @@ func (r *RainbondVolumeReconciler) Reconcile(ctx context.Context, request ctrl.R
 		return ctrl.Result{}, err
 	}
 
+	// clean up the storage class and the csi plugin before the volume is gone.
+	if !volume.DeletionTimestamp.IsZero() {
+		return r.teardown(ctx, volume)
+	}
+	if !controllerutil.ContainsFinalizer(volume, constants.Finalizer) {
+		controllerutil.AddFinalizer(volume, constants.Finalizer)
+		if err := r.Update(ctx, volume); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
 	useStorageClassName := volume.Spec.StorageClassName != ""
 	if useStorageClassName {
 		if err := r.updateVolumeStatus(ctx, volume); err != nil {
@@ -148,6 +161,129 @@ func (r *RainbondVolumeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
+// teardown deletes the storage class created for the volume, and the cluster-scoped resources of its csi plugin
+// which are not used by other volumes, then removes the finalizer once they are gone.
+func (r *RainbondVolumeReconciler) teardown(ctx context.Context, volume *rainbondv1alpha1.RainbondVolume) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(volume, constants.Finalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	step := rainbondv1alpha1.TeardownStepStorageClass
+	remaining, err := r.deleteStorageClass(ctx, volume)
+	if err == nil && len(remaining) == 0 {
+		step = rainbondv1alpha1.TeardownStepClusterScopedResources
+		remaining, err = r.deleteCSIPluginResources(ctx, volume)
+	}
+	if err != nil || len(remaining) > 0 {
+		volume.Status.Teardown = &rainbondv1alpha1.TeardownStatus{Step: step, Remaining: remaining}
+		if err != nil {
+			volume.Status.Teardown.Message = err.Error()
+		} else {
+			volume.Status.Teardown.Message = fmt.Sprintf("waiting for %d objects to be deleted", len(remaining))
+		}
+		if err := r.updateVolumeStatusRetryOnConflict(ctx, volume); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: 3 * time.Second}, err
+	}
+
+	return reconcile.Result{}, retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		old := &rainbondv1alpha1.RainbondVolume{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: volume.Namespace, Name: volume.Name}, old); err != nil {
+			return err
+		}
+		controllerutil.RemoveFinalizer(old, constants.Finalizer)
+		return r.Update(ctx, old)
+	})
+}
+
+// deleteStorageClass deletes the storage class created by createIfNotExistStorageClass, and returns it if it is not gone yet.
+func (r *RainbondVolumeReconciler) deleteStorageClass(ctx context.Context, volume *rainbondv1alpha1.RainbondVolume) ([]string, error) {
+	sc := &storagev1.StorageClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: rbdutil.ClusterScopedName(volume.Namespace, volume.Name)}, sc); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// the storage class is not created by the operator, or created for the volume in another namespace.
+	if sc.Labels["belongTo"] != rbdutil.LabelsForRainbond(nil)["belongTo"] {
+		return nil, nil
+	}
+	if namespace, ok := sc.Labels[constants.NamespaceLabelKey]; ok && namespace != volume.Namespace {
+		return nil, nil
+	}
+	if sc.DeletionTimestamp.IsZero() {
+		if err := r.Delete(ctx, sc); err != nil && !k8sErrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return []string{"StorageClass/" + sc.Name}, nil
+}
+
+// deleteCSIPluginResources deletes the cluster-scoped resources of the csi plugin, such as CSIDrivers,
+// unless they are used by other volumes, and returns the ones not gone yet.
+func (r *RainbondVolumeReconciler) deleteCSIPluginResources(ctx context.Context, volume *rainbondv1alpha1.RainbondVolume) ([]string, error) {
+	if volume.Spec.CSIPlugin == nil {
+		return nil, nil
+	}
+	csiplugin, err := NewCSIPlugin(ctx, r.Client, volume)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cluster-scoped resources of the csi plugins of the other volumes.
+	volumes := &rainbondv1alpha1.RainbondVolumeList{}
+	if err := r.List(ctx, volumes); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for i := range volumes.Items {
+		other := &volumes.Items[i]
+		if other.UID == volume.UID || !other.DeletionTimestamp.IsZero() || other.Spec.CSIPlugin == nil {
+			continue
+		}
+		p, err := NewCSIPlugin(ctx, r.Client, other)
+		if err != nil {
+			continue
+		}
+		for _, res := range p.GetClusterScopedResources() {
+			if res != nil {
+				used[r.clusterScopedResourceKey(res)] = true
+			}
+		}
+	}
+
+	var remaining []string
+	for _, res := range csiplugin.GetClusterScopedResources() {
+		if res == nil || used[r.clusterScopedResourceKey(res)] {
+			continue
+		}
+		if err := r.Get(ctx, types.NamespacedName{Name: res.GetName()}, res); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if res.GetDeletionTimestamp().IsZero() {
+			if err := r.Delete(ctx, res); err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		remaining = append(remaining, r.clusterScopedResourceKey(res))
+	}
+	return remaining, nil
+}
+
+// clusterScopedResourceKey returns the kind and name of the object, such as CSIDriver/nasplugin.csi.alibabacloud.com.
+func (r *RainbondVolumeReconciler) clusterScopedResourceKey(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return fmt.Sprintf("%T/%s", obj, obj.GetName())
+	}
+	return gvk.Kind + "/" + obj.GetName()
+}
+
 func (r *RainbondVolumeReconciler) applyCSIPlugin(ctx context.Context, plugin plugin.CSIPlugin, volume *rainbondv1alpha1.RainbondVolume) error {
 	if plugin.IsPluginReady() {
 		if volume.Spec.StorageClassParameters == nil {
@@ -251,7 +387,7 @@ func (r *RainbondVolumeReconciler) updateVolumeRetryOnConflict(ctx context.Conte
 func (r *RainbondVolumeReconciler) createIfNotExistStorageClass(ctx context.Context, volume *rainbondv1alpha1.RainbondVolume) (string, error) {
 	old := &storagev1.StorageClass{}
 	// check if the storageclass based on the given sc exists.
-	err := r.Get(ctx, types.NamespacedName{Name: volume.Name}, old)
+	err := r.Get(ctx, types.NamespacedName{Name: rbdutil.ClusterScopedName(volume.Namespace, volume.Name)}, old)
 	if err == nil {
 		return old.Name, nil
 	}
@@ -269,8 +405,8 @@ func (r *RainbondVolumeReconciler) createIfNotExistStorageClass(ctx context.Cont
 func storageClassForRainbondVolume(volume *rainbondv1alpha1.RainbondVolume) *storagev1.StorageClass {
 	class := &storagev1.StorageClass{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   volume.Name,
-			Labels: rbdutil.LabelsForRainbond(nil),
+			Name:   rbdutil.ClusterScopedName(volume.Namespace, volume.Name),
+			Labels: rbdutil.LabelsForClusterScoped(volume.Namespace, nil),
 		},
 		MountOptions:  volume.Spec.StorageClassParameters.MountOptions,
 		Provisioner:   volume.Spec.StorageClassParameters.Provisioner,
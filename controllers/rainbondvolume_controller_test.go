@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	"github.com/stretchr/testify/assert"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newAliyunNasVolume(name string, deleting bool) *rainbondv1alpha1.RainbondVolume {
+	volume := &rainbondv1alpha1.RainbondVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "rbd-system",
+			UID:        types.UID(name),
+			Finalizers: []string{constants.Finalizer},
+		},
+		Spec: rainbondv1alpha1.RainbondVolumeSpec{
+			CSIPlugin: &rainbondv1alpha1.CSIPluginSource{
+				AliyunNas: &rainbondv1alpha1.AliyunNasCSIPluginSource{},
+			},
+		},
+	}
+	if deleting {
+		now := metav1.Now()
+		volume.DeletionTimestamp = &now
+	}
+	return volume
+}
+
+func TestRainbondVolumeTeardown(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	rwx := newAliyunNasVolume("rainbondvolumerwx", true)
+	csiDriver := &storagev1beta1.CSIDriver{ObjectMeta: metav1.ObjectMeta{Name: "nasplugin.csi.alibabacloud.com"}}
+	cli := fake.NewFakeClientWithScheme(scheme,
+		rwx,
+		newAliyunNasVolume("rainbondvolumerwo", false),
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: rwx.Name, Labels: rbdutil.LabelsForRainbond(nil)}},
+		csiDriver,
+	)
+	r := &RainbondVolumeReconciler{Client: cli, Log: ctrl.Log, Scheme: scheme}
+
+	// the storage class is deleted first.
+	if _, err := r.teardown(ctx, rwx); err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, rwx.Status.Teardown) {
+		assert.Equal(t, rainbondv1alpha1.TeardownStepStorageClass, rwx.Status.Teardown.Step)
+		assert.Equal(t, []string{"StorageClass/rainbondvolumerwx"}, rwx.Status.Teardown.Remaining)
+	}
+
+	// the csi driver is still used by the other volume.
+	if _, err := r.teardown(ctx, rwx); err != nil {
+		t.Fatal(err)
+	}
+	got := &rainbondv1alpha1.RainbondVolume{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: "rbd-system", Name: rwx.Name}, got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, got.Finalizers)
+	assert.NoError(t, cli.Get(ctx, types.NamespacedName{Name: csiDriver.Name}, &storagev1beta1.CSIDriver{}))
+
+	rwo := newAliyunNasVolume("rainbondvolumerwo", true)
+	if err := cli.Delete(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.teardown(ctx, rwo); err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, rwo.Status.Teardown) {
+		assert.Equal(t, rainbondv1alpha1.TeardownStepClusterScopedResources, rwo.Status.Teardown.Step)
+		assert.Equal(t, []string{"CSIDriver/nasplugin.csi.alibabacloud.com"}, rwo.Status.Teardown.Remaining)
+	}
+}
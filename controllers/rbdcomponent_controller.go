@@ -19,6 +19,8 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -26,15 +28,23 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	componentmgr "github.com/goodrain/rainbond-operator/controllers/component-mgr"
 	chandler "github.com/goodrain/rainbond-operator/controllers/handler"
-	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -96,15 +106,19 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 		return reconcile.Result{}, nil
 	}
 
-	cluster := &rainbondv1alpha1.RainbondCluster{}
-	if err := r.Get(ctx, types.NamespacedName{Namespace: cpt.Namespace, Name: constants.RainbondClusterName}, cluster); err != nil {
+	cluster, err := rbdutil.GetRainbondCluster(ctx, r.Client, cpt)
+	if err != nil {
 		condition := clusterCondition(err)
 		changed := cpt.Status.UpdateCondition(condition)
 		if changed {
 			r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
-			return reconcile.Result{RequeueAfter: 3 * time.Second}, mgr.UpdateStatus()
+			return reconcile.Result{}, mgr.UpdateStatus()
 		}
-		return reconcile.Result{RequeueAfter: 3 * time.Second}, nil
+		if !k8sErrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		// the creation of rainbondcluster will trigger the reconciliation.
+		return reconcile.Result{}, nil
 	}
 
 	if !cluster.Spec.ConfigCompleted {
@@ -114,24 +128,28 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 		changed := cpt.Status.UpdateCondition(condition)
 		if changed {
 			r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
-			return reconcile.Result{RequeueAfter: 3 * time.Second}, mgr.UpdateStatus()
+			return reconcile.Result{}, mgr.UpdateStatus()
 		}
-		return reconcile.Result{RequeueAfter: 3 * time.Second}, err
+		// the change of rainbondcluster will trigger the reconciliation.
+		return reconcile.Result{}, nil
 	}
 	mgr.SetConfigCompletedCondition()
 
 	var pkg *rainbondv1alpha1.RainbondPackage
 	if cluster.Spec.InstallMode != rainbondv1alpha1.InstallationModeFullOnline {
-		pkg = &rainbondv1alpha1.RainbondPackage{}
-		if err := r.Get(ctx, types.NamespacedName{Namespace: cpt.Namespace, Name: constants.RainbondPackageName}, pkg); err != nil {
+		pkg, err = rbdutil.GetRainbondPackage(ctx, r.Client, cluster)
+		if err != nil {
 			condition := packageCondition(err)
 			changed := cpt.Status.UpdateCondition(condition)
 			if changed {
 				r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
-				return reconcile.Result{RequeueAfter: 3 * time.Second}, mgr.UpdateStatus()
+				return reconcile.Result{}, mgr.UpdateStatus()
 			}
-
-			return reconcile.Result{RequeueAfter: 3 * time.Second}, nil
+			if !k8sErrors.IsNotFound(err) {
+				return reconcile.Result{}, err
+			}
+			// the creation of rainbondpackage will trigger the reconciliation.
+			return reconcile.Result{}, nil
 		}
 	}
 	mgr.SetPackageReadyCondition(pkg)
@@ -142,11 +160,30 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 		changed := cpt.Status.UpdateCondition(condition)
 		if changed {
 			r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
-			return reconcile.Result{RequeueAfter: 3 * time.Second}, mgr.UpdateStatus()
+			return reconcile.Result{}, mgr.UpdateStatus()
 		}
-		return reconcile.Result{RequeueAfter: 3 * time.Second}, nil
+		// the completion of rainbondpackage will trigger the reconciliation.
+		return reconcile.Result{}, nil
 	}
 
+	waiting, err := mgr.WaitingDependencies(cluster)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(waiting) > 0 {
+		log.V(6).Info("waiting for dependencies", "dependencies", waiting)
+		condition := rainbondv1alpha1.NewRbdComponentCondition(rainbondv1alpha1.DependenciesReady, corev1.ConditionFalse,
+			"WaitingForDependencies", fmt.Sprintf("waiting for %s", strings.Join(waiting, ", ")))
+		changed := cpt.Status.UpdateCondition(condition)
+		if changed {
+			r.Recorder.Event(cpt, corev1.EventTypeNormal, condition.Reason, condition.Message)
+			return reconcile.Result{}, mgr.UpdateStatus()
+		}
+		// the dependencies getting ready will trigger the reconciliation.
+		return reconcile.Result{}, nil
+	}
+	mgr.SetDependenciesReadyCondition()
+
 	hdl := fn(ctx, r.Client, cpt, cluster)
 	if err := hdl.Before(); err != nil {
 		// TODO: merge with mgr.checkPrerequisites
@@ -239,6 +276,32 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 	}
 
 	resources := hdl.Resources()
+	if pdb := mgr.PodDisruptionBudget(); pdb != nil && hasWorkload(resources) {
+		resources = append(resources, pdb)
+	} else if err := mgr.DeletePodDisruptionBudget(); err != nil {
+		log.Error(err, "delete pod disruption budget")
+		condition := rainbondv1alpha1.NewRbdComponentCondition(rainbondv1alpha1.RbdComponentReady, corev1.ConditionFalse,
+			"ErrDeleteResource", err.Error())
+		changed := cpt.Status.UpdateCondition(condition)
+		if changed {
+			r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
+			return reconcile.Result{Requeue: true}, mgr.UpdateStatus()
+		}
+		return reconcile.Result{}, err
+	}
+	if !hasHorizontalPodAutoscaler(resources) {
+		if err := mgr.DeleteHorizontalPodAutoscaler(); err != nil {
+			log.Error(err, "delete horizontal pod autoscaler")
+			condition := rainbondv1alpha1.NewRbdComponentCondition(rainbondv1alpha1.RbdComponentReady, corev1.ConditionFalse,
+				"ErrDeleteResource", err.Error())
+			changed := cpt.Status.UpdateCondition(condition)
+			if changed {
+				r.Recorder.Event(cpt, corev1.EventTypeWarning, condition.Reason, condition.Message)
+				return reconcile.Result{Requeue: true}, mgr.UpdateStatus()
+			}
+			return reconcile.Result{}, err
+		}
+	}
 	for _, res := range resources {
 		if res == nil {
 			continue
@@ -299,7 +362,8 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 		log.Error(err, "update rainbond component status failure %s")
 	}
 
-	if !mgr.IsRbdComponentReady() {
+	if !mgr.IsRbdComponentReady() && !hasWorkload(resources) {
+		// the pods are not managed by the owned workloads, whose changes trigger the reconciliation.
 		return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
 	}
 
@@ -310,9 +374,128 @@ func (r *RbdComponentReconciler) Reconcile(ctx context.Context, request ctrl.Req
 func (r *RbdComponentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&rainbondv1alpha1.RbdComponent{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
+		Watches(&source.Kind{Type: &rainbondv1alpha1.RainbondCluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.rbdComponentsInNamespace),
+			builder.WithPredicates(rainbondClusterChangedPredicate())).
+		Watches(&source.Kind{Type: &rainbondv1alpha1.RainbondPackage{}},
+			handler.EnqueueRequestsFromMapFunc(r.rbdComponentsInNamespace),
+			builder.WithPredicates(rainbondPackageReadyChangedPredicate())).
+		Watches(&source.Kind{Type: &rainbondv1alpha1.RbdComponent{}},
+			handler.EnqueueRequestsFromMapFunc(dependentRbdComponents),
+			builder.WithPredicates(rbdComponentReadyChangedPredicate())).
 		Complete(r)
 }
 
+// rbdComponentsInNamespace returns the requests for all rbdcomponents in the namespace of obj,
+// which depend on the rainbondcluster and the rainbondpackage.
+func (r *RbdComponentReconciler) rbdComponentsInNamespace(obj client.Object) []reconcile.Request {
+	cpts := &rainbondv1alpha1.RbdComponentList{}
+	if err := r.List(context.Background(), cpts, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "list rbdcomponents", "namespace", obj.GetNamespace())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(cpts.Items))
+	for _, cpt := range cpts.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cpt.Namespace, Name: cpt.Name}})
+	}
+	return requests
+}
+
+// dependentRbdComponents returns the requests for the rbdcomponents depending on obj.
+func dependentRbdComponents(obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, name := range chandler.Dependents(obj.GetName()) {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}})
+	}
+	return requests
+}
+
+// rainbondClusterChangedPredicate filters the updates of rainbondcluster which have nothing to do with rbdcomponents.
+func rainbondClusterChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCluster, ok := e.ObjectOld.(*rainbondv1alpha1.RainbondCluster)
+			if !ok {
+				return false
+			}
+			newCluster, ok := e.ObjectNew.(*rainbondv1alpha1.RainbondCluster)
+			if !ok {
+				return false
+			}
+			return oldCluster.Generation != newCluster.Generation ||
+				!reflect.DeepEqual(oldCluster.Status.ImagePullSecret, newCluster.Status.ImagePullSecret)
+		},
+	}
+}
+
+// rainbondPackageReadyChangedPredicate filters the updates of rainbondpackage, except the ones changing the ready condition.
+func rainbondPackageReadyChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPkg, ok := e.ObjectOld.(*rainbondv1alpha1.RainbondPackage)
+			if !ok {
+				return false
+			}
+			newPkg, ok := e.ObjectNew.(*rainbondv1alpha1.RainbondPackage)
+			if !ok {
+				return false
+			}
+			_, oldCondition := oldPkg.Status.GetCondition(rainbondv1alpha1.Ready)
+			_, newCondition := newPkg.Status.GetCondition(rainbondv1alpha1.Ready)
+			if oldCondition == nil || newCondition == nil {
+				return oldCondition != newCondition
+			}
+			return oldCondition.Status != newCondition.Status
+		},
+	}
+}
+
+// rbdComponentReadyChangedPredicate filters the updates of rbdcomponent, except the ones changing its readiness.
+func rbdComponentReadyChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCpt, ok := e.ObjectOld.(*rainbondv1alpha1.RbdComponent)
+			if !ok {
+				return false
+			}
+			newCpt, ok := e.ObjectNew.(*rainbondv1alpha1.RbdComponent)
+			if !ok {
+				return false
+			}
+			return chandler.IsRbdComponentReady(oldCpt) != chandler.IsRbdComponentReady(newCpt)
+		},
+	}
+}
+
+// hasWorkload checks if there is a deployment, statefulset or daemonset in the resources.
+func hasWorkload(resources []client.Object) bool {
+	for _, res := range resources {
+		switch res.(type) {
+		case *appsv1.Deployment, *appsv1.StatefulSet, *appsv1.DaemonSet:
+			return true
+		}
+	}
+	return false
+}
+
+// hasHorizontalPodAutoscaler checks if there is a horizontal pod autoscaler in the resources.
+func hasHorizontalPodAutoscaler(resources []client.Object) bool {
+	for _, res := range resources {
+		if _, ok := res.(*autoscalingv2beta2.HorizontalPodAutoscaler); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func clusterCondition(err error) *rainbondv1alpha1.RbdComponentCondition {
 	reason := "ClusterNotFound"
 	msg := "rainbondcluster not found"
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestRainbondClusterChangedPredicate(t *testing.T) {
+	oldCluster := &rainbondv1alpha1.RainbondCluster{}
+	oldCluster.Generation = 1
+
+	// status only
+	newCluster := oldCluster.DeepCopy()
+	newCluster.Status.KubernetesVersoin = "v1.20.1"
+	assert.False(t, rainbondClusterChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldCluster, ObjectNew: newCluster}))
+
+	newCluster = oldCluster.DeepCopy()
+	newCluster.Status.ImagePullSecret = &corev1.LocalObjectReference{Name: "rbd-hub-credentials"}
+	assert.True(t, rainbondClusterChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldCluster, ObjectNew: newCluster}))
+
+	newCluster = oldCluster.DeepCopy()
+	newCluster.Generation = 2
+	assert.True(t, rainbondClusterChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldCluster, ObjectNew: newCluster}))
+}
+
+func TestRainbondPackageReadyChangedPredicate(t *testing.T) {
+	oldPkg := &rainbondv1alpha1.RainbondPackage{}
+	oldPkg.Status.Conditions = []rainbondv1alpha1.PackageCondition{
+		{Type: rainbondv1alpha1.PushImage, Status: rainbondv1alpha1.Running, Progress: 10},
+		{Type: rainbondv1alpha1.Ready, Status: rainbondv1alpha1.Waiting},
+	}
+
+	// progress only
+	newPkg := oldPkg.DeepCopy()
+	newPkg.Status.Conditions[0].Progress = 20
+	assert.False(t, rainbondPackageReadyChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPkg, ObjectNew: newPkg}))
+
+	newPkg = oldPkg.DeepCopy()
+	newPkg.Status.Conditions[1].Status = rainbondv1alpha1.Completed
+	assert.True(t, rainbondPackageReadyChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPkg, ObjectNew: newPkg}))
+
+	newPkg = oldPkg.DeepCopy()
+	newPkg.Status.Conditions = newPkg.Status.Conditions[:1]
+	assert.True(t, rainbondPackageReadyChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPkg, ObjectNew: newPkg}))
+}
+
+func TestRbdComponentReadyChangedPredicate(t *testing.T) {
+	oldCpt := &rainbondv1alpha1.RbdComponent{}
+	oldCpt.Status.Replicas = 1
+	oldCpt.Status.Conditions = []rainbondv1alpha1.RbdComponentCondition{
+		{Type: rainbondv1alpha1.RbdComponentReady, Status: corev1.ConditionFalse},
+	}
+
+	// pods only
+	newCpt := oldCpt.DeepCopy()
+	newCpt.Status.Pods = []corev1.LocalObjectReference{{Name: "rbd-etcd-0"}}
+	assert.False(t, rbdComponentReadyChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldCpt, ObjectNew: newCpt}))
+
+	newCpt = oldCpt.DeepCopy()
+	newCpt.Status.ReadyReplicas = 1
+	newCpt.Status.Conditions[0].Status = corev1.ConditionTrue
+	assert.True(t, rbdComponentReadyChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldCpt, ObjectNew: newCpt}))
+}
+
+func TestDependentRbdComponents(t *testing.T) {
+	etcd := &rainbondv1alpha1.RbdComponent{}
+	etcd.Namespace = "rbd-system"
+	etcd.Name = "rbd-etcd"
+
+	var names []string
+	for _, request := range dependentRbdComponents(etcd) {
+		assert.Equal(t, "rbd-system", request.Namespace)
+		names = append(names, request.Name)
+	}
+	assert.Equal(t, []string{"rbd-api", "rbd-chaos", "rbd-gateway", "rbd-mq"}, names)
+}
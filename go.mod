@@ -15,6 +15,7 @@ require (
 	github.com/go-logr/logr v0.3.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/mock v1.4.1
+	github.com/google/gofuzz v1.1.0
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/juju/errors v0.0.0-20200330140219-3fe23663418f
 	github.com/juju/testing v0.0.0-20201216035041-2be42bba85f3 // indirect
@@ -37,5 +38,6 @@ require (
 	k8s.io/client-go v0.20.1
 	k8s.io/kube-aggregator v0.20.1
 	sigs.k8s.io/controller-runtime v0.7.0
+	sigs.k8s.io/structured-merge-diff/v4 v4.0.2
 	sigs.k8s.io/yaml v1.2.0
 )
@@ -25,6 +25,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	kubeaggregatorv1beta1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1beta1"
@@ -33,7 +34,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	rainbondiov1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	rainbondiov1beta1 "github.com/goodrain/rainbond-operator/api/v1beta1"
 	"github.com/goodrain/rainbond-operator/controllers"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
 	mv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	// +kubebuilder:scaffold:imports
 )
@@ -47,6 +50,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(rainbondiov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(rainbondiov1beta1.AddToScheme(scheme))
 
 	utilruntime.Must(kubeaggregatorv1beta1.AddToScheme(scheme))
 
@@ -83,11 +87,13 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	// the config of the manager also works out of the cluster, unlike the in-cluster config.
+	k8sutil.SetClientSet(kubernetes.NewForConfigOrDie(mgr.GetConfig()))
 	if err = (&controllers.RainbondClusterReconciler{
 		Client:   mgr.GetClient(),
 		Log:      ctrl.Log.WithName("controllers").WithName("RainbondCluster"),
 		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("RainbondPackage"),
+		Recorder: mgr.GetEventRecorderFor("RainbondCluster"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RainbondCluster")
 		os.Exit(1)
@@ -118,6 +124,24 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "RbdComponent")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&rainbondiov1alpha1.RainbondCluster{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RainbondCluster")
+			os.Exit(1)
+		}
+		if err = (&rainbondiov1alpha1.RainbondPackage{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RainbondPackage")
+			os.Exit(1)
+		}
+		if err = (&rainbondiov1alpha1.RainbondVolume{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RainbondVolume")
+			os.Exit(1)
+		}
+		if err = (&rainbondiov1alpha1.RbdComponent{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RbdComponent")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -5,12 +5,16 @@ const (
 	Namespace = "rbd-system"
 	//DefInstallPkgDestPath  Default destination path of the installation package extraction.
 	DefInstallPkgDestPath = "/tmp/DefInstallPkgDestPath"
-	//RainbondClusterName rainbond cluster resource name
+	//RainbondClusterName default name of the rainbond cluster resource
 	RainbondClusterName = "rainbondcluster"
-	//RainbondPackageName rainbond package resource name
+	//RainbondPackageName default name of the rainbond package resource
 	RainbondPackageName = "rainbondpackage"
 	// DefImageRepository is the default domain name of the mirror repository that Rainbond is installed.
 	DefImageRepository = "goodrain.me"
+	// ImageHubPasswordSecretName is the secret holding the generated password of the default image hub.
+	ImageHubPasswordSecretName = "rbd-hub-password"
+	// ImageHubPasswordSecretKey is the key of the password in ImageHubPasswordSecretName.
+	ImageHubPasswordSecretKey = "password"
 	//GrDataPVC -
 	GrDataPVC = "rbd-cpt-grdata"
 	// CachePVC -
@@ -35,4 +39,21 @@ const (
 
 	// ServiceAccountName is the name of service account
 	ServiceAccountName = "rainbond-operator"
+
+	// ClusterLabelKey is the label of the objects belonging to a rainbondcluster, whose value is the name of the rainbondcluster.
+	ClusterLabelKey = "rainbond.io/cluster"
+	// NamespaceLabelKey is the label of the cluster-scoped objects created for a rainbondcluster,
+	// whose value is the namespace of the rainbondcluster.
+	NamespaceLabelKey = "rainbond.io/namespace"
+
+	// RerunPrechecksAnnotation is the annotation to re-run the prechecks of a rainbondcluster,
+	// whose value is a comma-separated list of the prechecks, or empty for all of them.
+	RerunPrechecksAnnotation = "rainbond.io/rerun-prechecks"
+	// RetryUpgradeAnnotation is the annotation to retry the upgrade to the install version of a rainbondcluster,
+	// which failed or was rolled back.
+	RetryUpgradeAnnotation = "rainbond.io/retry-upgrade"
+
+	// Finalizer is the finalizer of rainbondcluster and rainbondvolume, which cleans up the resources
+	// that can not be garbage collected through owner references, such as cluster-scoped ones.
+	Finalizer = "rainbond.io/finalizer"
 )
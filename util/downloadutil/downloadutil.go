@@ -1,106 +1,424 @@
 package downloadutil
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/sirupsen/logrus"
 )
 
-// DownloadWithProgress is the progress listener
+const (
+	// DefaultRetries is the default number of retries of every url.
+	DefaultRetries = 3
+	// defaultBackoff is the default backoff before the first retry, which doubles after every retry.
+	defaultBackoff = time.Second
+	// defaultMaxBackoff is the default maximum backoff between the retries.
+	defaultMaxBackoff = 30 * time.Second
+	// defaultStallTimeout is the default timeout of the download without receiving any data.
+	defaultStallTimeout = time.Minute
+)
+
+// DownloadWithProgress downloads a file from the URL, or its mirrors, resuming from the partial file left by
+// the failed downloads, and reports the progress.
 type DownloadWithProgress struct {
-	TotalRwBytes int64
-	CurrentBytes int64
-	Percent      int
-	Finished     bool
-	URL          string
-	SavedPath    string
-	Wanted       string
+	URL string
+	// Mirrors of the URL, which are tried in order once the retries of the ones before them are used up.
+	Mirrors   []string
+	SavedPath string
+	// Wanted is the sha256 checksum of the file in hex, which is not checked if empty.
+	Wanted string
+	// Retries of every url after its first attempt fails.
+	Retries int
+	// Backoff before the first retry, which doubles after every retry up to MaxBackoff. Defaults to 1s.
+	Backoff time.Duration
+	// MaxBackoff is the maximum backoff between the retries. Defaults to 30s.
+	MaxBackoff time.Duration
+	// Proxy is the url of the proxy, the proxy of the environment is used if empty.
+	Proxy string
+	// StallTimeout is how long the download is retried after receiving no data. Defaults to 1m.
+	StallTimeout time.Duration
+
+	mu sync.Mutex
+	// total bytes of the file, zero if unknown.
+	total int64
+	// current bytes of the partial file.
+	current int64
+	// resumedAt is when the current attempt started, and resumedBytes the bytes of the partial file then.
+	resumedAt    time.Time
+	resumedBytes int64
+}
+
+// Progress is the progress of a download.
+type Progress struct {
+	// Total bytes of the file, zero if unknown.
+	Total int64
+	// Current bytes downloaded, including the ones resumed from.
+	Current int64
+	// Percent of the downloaded bytes.
+	Percent int
+	// Throughput in bytes per second, since the current attempt started.
+	Throughput float64
+	// ETA is the estimated time left, zero if unknown.
+	ETA time.Duration
+}
+
+// statusError is the unexpected status of a response.
+type statusError struct {
+	url    string
+	status string
+	code   int
 }
 
-// Download download
+func (e *statusError) Error() string {
+	return fmt.Sprintf("get %s: %s", e.url, e.status)
+}
+
+// Download downloads the file to the SavedPath, through the partial file SavedPath.progress, which is kept on failure
+// for the next download to resume from. The partial file is resumed with If-Range, if the response it was downloaded
+// from has an ETag or Last-Modified. Otherwise it is resumed only from the same url, or if Wanted is set to check it.
 func (listener *DownloadWithProgress) Download() error {
-	// Get the data
-	resp, err := http.Get(listener.URL)
+	client, err := listener.httpClient()
 	if err != nil {
 		return err
 	}
-	defer func() { _ = resp.Body.Close() }()
 	var tmpPath = listener.SavedPath + ".progress"
-	_, err = os.Stat(path.Dir(tmpPath))
-	if os.IsNotExist(err) {
-		os.MkdirAll(path.Dir(tmpPath), os.ModeDir)
-	}
-	// Create the file
-	out, err := os.Create(tmpPath)
-	defer func() {
-		_ = out.Close()
-		//clear cache file
-		os.Remove(tmpPath)
-	}()
-	if err != nil {
+	if err := os.MkdirAll(path.Dir(tmpPath), os.ModePerm); err != nil {
 		return err
 	}
-	listener.TotalRwBytes = resp.ContentLength
-	logrus.Debugf("package size total is : %d", resp.ContentLength/1024/1024)
 
-	reader := oss.TeeReader(resp.Body, nil, listener.TotalRwBytes, listener, nil)
-	defer func() { _ = reader.Close() }()
-	if _, err = io.Copy(out, reader); err != nil {
-		return err
+	var urls []string
+	for _, u := range append([]string{listener.URL}, listener.Mirrors...) {
+		if u != "" {
+			urls = append(urls, u)
+		}
 	}
-	logrus.Debug("download finished, check md5")
-	target, err := os.Open(tmpPath) // reopen target file for check md5
+	if len(urls) == 0 {
+		return fmt.Errorf("no url to download %s", listener.SavedPath)
+	}
+
+	err = listener.downloadFromMirrors(client, urls, tmpPath)
 	if err != nil {
 		return err
 	}
-	defer target.Close()
-	if err := listener.CheckMD5(target); err != nil {
+
+	logrus.Debug("download finished, check sha256")
+	target, err := os.Open(tmpPath) // reopen target file for check md5
+	if err != nil {
 		return err
 	}
-	logrus.Debug("check md5 finished, move file to ", listener.SavedPath)
-	dir := path.Dir(listener.SavedPath)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+	err = listener.CheckMD5(target)
+	target.Close()
+	if err != nil {
+		// the partial file can not be resumed from, if it is corrupted.
+		removePartial(tmpPath)
 		return err
 	}
-	if err = os.Rename(tmpPath, listener.SavedPath); err != nil {
+	logrus.Debug("check sha256 finished, move file to ", listener.SavedPath)
+	if err := os.Rename(tmpPath, listener.SavedPath); err != nil {
 		return err
 	}
+	os.Remove(sourcePath(tmpPath))
 	return nil
 }
 
-// ProgressChanged handles progress event
-func (listener *DownloadWithProgress) ProgressChanged(event *oss.ProgressEvent) {
-	switch event.EventType {
-	case oss.TransferStartedEvent:
-		logrus.Debug("Transfer Started.\n")
-	case oss.TransferDataEvent:
-		listener.CurrentBytes = event.ConsumedBytes
-		if listener.TotalRwBytes != 0 {
-			listener.Percent = int(100 * listener.CurrentBytes / listener.TotalRwBytes)
+func (listener *DownloadWithProgress) downloadFromMirrors(client *http.Client, urls []string, tmpPath string) error {
+	var err error
+	for _, u := range urls {
+		backoff := listener.Backoff
+		if backoff <= 0 {
+			backoff = defaultBackoff
+		}
+		maxBackoff := listener.MaxBackoff
+		if maxBackoff <= 0 {
+			maxBackoff = defaultMaxBackoff
 		}
-		logrus.Debugf("Transfer Data,TotalBytes: %d This time consumedBytes: %d \n", listener.TotalRwBytes, event.ConsumedBytes)
-	case oss.TransferCompletedEvent:
-		listener.Finished = true
-		logrus.Debugf("Transfer Completed, This time consumedBytes: %d.\n", event.ConsumedBytes)
-	case oss.TransferFailedEvent:
-		logrus.Debugf("Transfer Failed, This time consumedBytes: %d.\n", event.ConsumedBytes)
+		for attempt := 0; ; attempt++ {
+			if err = listener.fetch(client, u, tmpPath); err == nil {
+				return nil
+			}
+			if !retryable(err) || attempt >= listener.Retries {
+				logrus.Warnf("download %s: %v, give up", u, err)
+				break
+			}
+			logrus.Warnf("download %s: %v, retry in %s", u, err, backoff)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+	return err
+}
+
+// fetch downloads the url to the partial file, from where it is left.
+func (listener *DownloadWithProgress) fetch(client *http.Client, u, tmpPath string) error {
+	var offset int64
+	if info, err := os.Stat(tmpPath); err == nil {
+		offset = info.Size()
+	}
+	source := readPartialSource(tmpPath)
+	validator := source.validator()
+	if offset > 0 && validator == "" && source.URL != u && listener.GetWanted() == "" {
+		// the partial file may be of another file, which can not be told without the checksum.
+		logrus.Infof("the partial file is not downloaded from %s, download from the beginning", u)
+		offset = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			// the whole file is responded if it has been changed.
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	var total int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			// download from the beginning the next time.
+			removePartial(tmpPath)
+			return fmt.Errorf("get %s: unexpected content range %q", u, resp.Header.Get("Content-Range"))
+		}
+		if etag := resp.Header.Get("ETag"); source.ETag != "" && etag != "" && etag != source.ETag {
+			// If-Range is ignored.
+			removePartial(tmpPath)
+			return fmt.Errorf("get %s: etag changed from %s to %s", u, source.ETag, etag)
+		}
+		total = size
+	case http.StatusOK:
+		// the range is not supported.
+		flag |= os.O_TRUNC
+		offset = 0
+		if resp.ContentLength > 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, size, _ := parseContentRange(resp.Header.Get("Content-Range"))
+		if size > 0 && size == offset {
+			// the partial file is complete.
+			listener.resume(offset, size)
+			return nil
+		}
+		removePartial(tmpPath)
+		return fmt.Errorf("get %s: %s", u, resp.Status)
 	default:
+		return &statusError{url: u, status: resp.Status, code: resp.StatusCode}
 	}
+
+	source = partialSource{URL: u, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if err := source.write(tmpPath); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(tmpPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+	listener.resume(offset, total)
+	logrus.Debugf("download %s from %d, total %d", u, offset, total)
+
+	stallTimeout := listener.StallTimeout
+	if stallTimeout <= 0 {
+		stallTimeout = defaultStallTimeout
+	}
+	reader := &progressReader{
+		reader:   resp.Body,
+		listener: listener,
+		stall:    time.AfterFunc(stallTimeout, cancel),
+		timeout:  stallTimeout,
+	}
+	defer reader.stall.Stop()
+	if _, err := io.Copy(out, reader); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("get %s: no data received in %s", u, stallTimeout)
+		}
+		return err
+	}
+	if p := listener.Progress(); p.Total > 0 && p.Current != p.Total {
+		return fmt.Errorf("get %s: %v", u, io.ErrUnexpectedEOF)
+	}
+	return out.Close()
+}
+
+// partialSource is where the partial file is downloaded from, which is saved along with the partial file.
+type partialSource struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// sourcePath returns the path of the source of the partial file.
+func sourcePath(tmpPath string) string {
+	return tmpPath + ".source"
+}
+
+// readPartialSource reads the source of the partial file, which is empty if unknown.
+func readPartialSource(tmpPath string) partialSource {
+	var source partialSource
+	data, err := ioutil.ReadFile(sourcePath(tmpPath))
+	if err != nil {
+		return source
+	}
+	if err := json.Unmarshal(data, &source); err != nil {
+		logrus.Warnf("invalid source of the partial file %s: %v", tmpPath, err)
+		return partialSource{}
+	}
+	return source
+}
+
+func (s partialSource) write(tmpPath string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sourcePath(tmpPath), data, 0644)
+}
+
+// validator returns the validator for If-Range, which is the strong ETag, or Last-Modified if there is none.
+func (s partialSource) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// removePartial removes the partial file along with its source.
+func removePartial(tmpPath string) {
+	os.Remove(tmpPath)
+	os.Remove(sourcePath(tmpPath))
+}
+
+func (listener *DownloadWithProgress) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	if listener.Proxy != "" {
+		proxy, err := url.Parse(listener.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy %s: %v", listener.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (listener *DownloadWithProgress) resume(offset, total int64) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.current, listener.total = offset, total
+	listener.resumedAt, listener.resumedBytes = time.Now(), offset
+}
+
+func (listener *DownloadWithProgress) add(n int64) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.current += n
+}
+
+// Progress returns the progress of the download.
+func (listener *DownloadWithProgress) Progress() Progress {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	p := Progress{Total: listener.total, Current: listener.current}
+	if p.Total > 0 {
+		p.Percent = int(100 * p.Current / p.Total)
+	}
+	if elapsed := time.Since(listener.resumedAt).Seconds(); !listener.resumedAt.IsZero() && elapsed > 0 {
+		p.Throughput = float64(p.Current-listener.resumedBytes) / elapsed
+	}
+	if p.Throughput > 0 && p.Total > p.Current {
+		p.ETA = time.Duration(float64(p.Total-p.Current) / p.Throughput * float64(time.Second))
+	}
+	return p
+}
+
+// progressReader counts the bytes read, and resets the stall timer on every read.
+type progressReader struct {
+	reader   io.Reader
+	listener *DownloadWithProgress
+	stall    *time.Timer
+	timeout  time.Duration
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.stall.Reset(r.timeout)
+		r.listener.add(int64(n))
+	}
+	return n, err
+}
+
+// parseContentRange parses the content range, such as bytes 100-199/200 or bytes */200.
+// The size is zero if it is unknown.
+func parseContentRange(contentRange string) (start, size int64, err error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	if parts[1] != "*" {
+		if size, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid content range %q: %v", contentRange, err)
+		}
+	}
+	if parts[0] == "*" {
+		return 0, size, nil
+	}
+	if start, err = strconv.ParseInt(strings.SplitN(parts[0], "-", 2)[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid content range %q: %v", contentRange, err)
+	}
+	return start, size, nil
+}
+
+// retryable tells whether the download may succeed on retry, which is not the case for the client errors,
+// such as 404 Not Found, except for 408 Request Timeout and 429 Too Many Requests.
+func retryable(err error) bool {
+	statusErr, ok := err.(*statusError)
+	if !ok {
+		return true
+	}
+	if statusErr.code == http.StatusRequestTimeout || statusErr.code == http.StatusTooManyRequests {
+		return true
+	}
+	return statusErr.code < 400 || statusErr.code >= 500
 }
 
 //CheckMD5 check md5
 func (listener *DownloadWithProgress) CheckMD5(target *os.File) error {
+	if listener.GetWanted() == "" {
+		return nil
+	}
 	md5hash := sha256.New()
 	if _, err := io.Copy(md5hash, target); err != nil {
-		fmt.Println("Copy", err)
 		return fmt.Errorf("prepare down file md5 error: %s", err.Error())
 	}
 	MD5Str := hex.EncodeToString(md5hash.Sum(nil))
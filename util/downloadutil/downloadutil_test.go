@@ -1 +1,365 @@
 package downloadutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testFile returns the content of a test file with its sha256 checksum.
+func testFile() ([]byte, string) {
+	content := bytes.Repeat([]byte("rainbond"), 64<<10)
+	sum := sha256.Sum256(content)
+	return content, hex.EncodeToString(sum[:])
+}
+
+// flakyServer serves the content with ranges, but breaks the responses of the first failures requests halfway.
+type flakyServer struct {
+	content  []byte
+	failures int
+
+	mu       sync.Mutex
+	requests []*http.Request
+	served   int64
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	broken := len(s.requests) <= s.failures
+	s.mu.Unlock()
+
+	if !broken {
+		http.ServeContent(&countingWriter{ResponseWriter: w, server: s}, req, "rainbond.tgz", time.Time{}, bytes.NewReader(s.content))
+		return
+	}
+	start := 0
+	if rng := req.Header.Get("Range"); rng != "" {
+		start, _ = strconv.Atoi(rng[len("bytes=") : len(rng)-1])
+		w.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(len(s.content)-1)+"/"+strconv.Itoa(len(s.content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)-start))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+	}
+	// the connection is closed before the whole content is written.
+	half := start + (len(s.content)-start)/2
+	n, _ := w.Write(s.content[start:half])
+	s.mu.Lock()
+	s.served += int64(n)
+	s.mu.Unlock()
+}
+
+// stats returns the requests and the bytes served.
+func (s *flakyServer) stats() ([]*http.Request, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.served
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	server *flakyServer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.server.mu.Lock()
+	w.server.served += int64(n)
+	w.server.mu.Unlock()
+	return n, err
+}
+
+func TestDownloadResume(t *testing.T) {
+	content, sum := testFile()
+	server := &flakyServer{content: content, failures: 2}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{
+		URL:       ts.URL,
+		SavedPath: savedPath,
+		Wanted:    sum,
+		Retries:   2,
+		Backoff:   time.Millisecond,
+	}
+	if !assert.NoError(t, listener.Download()) {
+		return
+	}
+
+	got, err := ioutil.ReadFile(savedPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, content, got)
+	}
+	_, err = os.Stat(savedPath + ".progress")
+	assert.True(t, os.IsNotExist(err))
+
+	requests, served := server.stats()
+	if assert.Len(t, requests, 3) {
+		assert.Empty(t, requests[0].Header.Get("Range"))
+		assert.Equal(t, "bytes="+strconv.Itoa(len(content)/2)+"-", requests[1].Header.Get("Range"))
+		assert.Equal(t, "bytes="+strconv.Itoa(len(content)*3/4)+"-", requests[2].Header.Get("Range"))
+	}
+	// nothing is downloaded twice.
+	assert.Equal(t, int64(len(content)), served)
+
+	progress := listener.Progress()
+	assert.Equal(t, int64(len(content)), progress.Total)
+	assert.Equal(t, int64(len(content)), progress.Current)
+	assert.Equal(t, 100, progress.Percent)
+	assert.Zero(t, progress.ETA)
+}
+
+func TestDownloadResumeFromPartialFile(t *testing.T) {
+	content, sum := testFile()
+	server := &flakyServer{content: content}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	// left by the last download.
+	if err := ioutil.WriteFile(savedPath+".progress", content[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath, Wanted: sum}
+	if !assert.NoError(t, listener.Download()) {
+		return
+	}
+	_, served := server.stats()
+	assert.Equal(t, int64(len(content)-1000), served)
+	got, _ := ioutil.ReadFile(savedPath)
+	assert.Equal(t, content, got)
+}
+
+func TestDownloadResumeChangedFile(t *testing.T) {
+	old, _ := testFile()
+	content := bytes.Repeat([]byte("goodrain"), 64<<10)
+	var requests []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(old)))
+			w.Write(old[:len(old)/2])
+			return
+		}
+		// changed since the last download.
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, req, "rainbond.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath, Retries: 1, Backoff: time.Millisecond}
+	if !assert.NoError(t, listener.Download()) {
+		return
+	}
+	if assert.Len(t, requests, 2) {
+		assert.Equal(t, "bytes="+strconv.Itoa(len(old)/2)+"-", requests[1].Header.Get("Range"))
+		assert.Equal(t, `"v1"`, requests[1].Header.Get("If-Range"))
+	}
+	got, _ := ioutil.ReadFile(savedPath)
+	assert.Equal(t, content, got)
+	_, err := os.Stat(savedPath + ".progress.source")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadPartialFileFromOtherSource(t *testing.T) {
+	content, _ := testFile()
+	server := &flakyServer{content: content}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	// left by the last download from another mirror, which can not be told to be the same file.
+	if err := ioutil.WriteFile(savedPath+".progress", []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(savedPath+".progress.source", []byte(`{"url":"http://mirror.invalid/rainbond.tgz"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath}
+	if !assert.NoError(t, listener.Download()) {
+		return
+	}
+	requests, _ := server.stats()
+	if assert.Len(t, requests, 1) {
+		assert.Empty(t, requests[0].Header.Get("Range"))
+	}
+	got, _ := ioutil.ReadFile(savedPath)
+	assert.Equal(t, content, got)
+}
+
+func TestDownloadRangeNotSupported(t *testing.T) {
+	content, sum := testFile()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	if err := ioutil.WriteFile(savedPath+".progress", []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath, Wanted: sum}
+	if !assert.NoError(t, listener.Download()) {
+		return
+	}
+	got, _ := ioutil.ReadFile(savedPath)
+	assert.Equal(t, content, got)
+}
+
+func TestDownloadMirrors(t *testing.T) {
+	content, sum := testFile()
+	var notFound, unavailable int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/not-found":
+			atomic.AddInt32(&notFound, 1)
+			http.NotFound(w, req)
+		case "/unavailable":
+			atomic.AddInt32(&unavailable, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			http.ServeContent(w, req, "rainbond.tgz", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{
+		URL:       ts.URL + "/not-found",
+		Mirrors:   []string{ts.URL + "/unavailable", ts.URL + "/rainbond.tgz"},
+		SavedPath: savedPath,
+		Wanted:    sum,
+		Retries:   2,
+		Backoff:   time.Millisecond,
+	}
+	assert.NoError(t, listener.Download())
+	// the client errors are not retried.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notFound))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&unavailable))
+}
+
+func TestDownloadFailed(t *testing.T) {
+	content, sum := testFile()
+	server := &flakyServer{content: content, failures: 10}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath, Wanted: sum, Retries: 1, Backoff: time.Millisecond}
+	assert.Error(t, listener.Download())
+	requests, _ := server.stats()
+	assert.Len(t, requests, 2)
+	// kept for the next download.
+	info, err := os.Stat(savedPath + ".progress")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(len(content)*3/4), info.Size())
+	}
+
+	server.mu.Lock()
+	server.failures = 0
+	server.mu.Unlock()
+	assert.NoError(t, listener.Download())
+	_, served := server.stats()
+	assert.Equal(t, int64(len(content)), served)
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	content, _ := testFile()
+	ts := httptest.NewServer(&flakyServer{content: content})
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{URL: ts.URL, SavedPath: savedPath, Wanted: "foobar"}
+	assert.Error(t, listener.Download())
+	_, err := os.Stat(savedPath + ".progress")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(savedPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadStalled(t *testing.T) {
+	content, sum := testFile()
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:100])
+			w.(http.Flusher).Flush()
+			<-req.Context().Done()
+			return
+		}
+		http.ServeContent(w, req, "rainbond.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{
+		URL:          ts.URL,
+		SavedPath:    savedPath,
+		Wanted:       sum,
+		Retries:      1,
+		Backoff:      time.Millisecond,
+		StallTimeout: 100 * time.Millisecond,
+	}
+	assert.NoError(t, listener.Download())
+}
+
+func TestDownloadProxy(t *testing.T) {
+	content, sum := testFile()
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = req.URL.String()
+		http.ServeContent(w, req, "rainbond.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer proxy.Close()
+
+	savedPath := filepath.Join(t.TempDir(), "rainbond.tgz")
+	listener := &DownloadWithProgress{
+		URL:       "http://rainbond.invalid/rainbond.tgz",
+		SavedPath: savedPath,
+		Wanted:    sum,
+		Proxy:     proxy.URL,
+	}
+	assert.NoError(t, listener.Download())
+	assert.Equal(t, "http://rainbond.invalid/rainbond.tgz", proxied)
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		start, size  int64
+		wantErr      bool
+	}{
+		{contentRange: "bytes 100-199/200", start: 100, size: 200},
+		{contentRange: "bytes 100-199/*", start: 100},
+		{contentRange: "bytes */200", size: 200},
+		{contentRange: "100-199/200", wantErr: true},
+		{contentRange: "bytes 100-199", wantErr: true},
+	}
+	for _, tc := range tests {
+		start, size, err := parseContentRange(tc.contentRange)
+		if tc.wantErr {
+			assert.Error(t, err, tc.contentRange)
+			continue
+		}
+		assert.NoError(t, err, tc.contentRange)
+		assert.Equal(t, tc.start, start, tc.contentRange)
+		assert.Equal(t, tc.size, size, tc.contentRange)
+	}
+}
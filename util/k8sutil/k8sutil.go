@@ -46,6 +46,13 @@ func GetClientSet() kubernetes.Interface {
 	return clientset
 }
 
+// SetClientSet sets the clientset returned by GetClientSet, instead of the one of the in-cluster config,
+// which is not available if the operator runs out of the cluster.
+func SetClientSet(c kubernetes.Interface) {
+	once.Do(func() {})
+	clientset = c
+}
+
 //MustNewKubeConfig -
 func MustNewKubeConfig(kubeconfigPath string) *rest.Config {
 	if kubeconfigPath != "" {
@@ -237,3 +244,36 @@ func ListNodes(ctx context.Context, c client.Client) ([]corev1.Node, error) {
 	}
 	return nodeList.Items, nil
 }
+
+// GetSecretKeyValue returns the value of the key selected by the given SecretKeySelector.
+func GetSecretKeyValue(ctx context.Context, c client.Client, namespace string, selector *corev1.SecretKeySelector) (string, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: selector.Name}, secret); err != nil {
+		if k8sErrors.IsNotFound(err) && selector.Optional != nil && *selector.Optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("get secret %s/%s: %v", namespace, selector.Name, err)
+	}
+	value, ok := secret.Data[selector.Key]
+	if !ok {
+		if selector.Optional != nil && *selector.Optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("key %s not found in secret %s/%s", selector.Key, namespace, selector.Name)
+	}
+	return string(value), nil
+}
+
+// EnvVarFromSecretKeyRef returns an env var sourced from the given secret key,
+// or one with the plain value if the selector is nil.
+func EnvVarFromSecretKeyRef(name, value string, selector *corev1.SecretKeySelector) corev1.EnvVar {
+	if selector == nil {
+		return corev1.EnvVar{Name: name, Value: value}
+	}
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: selector,
+		},
+	}
+}
@@ -0,0 +1,268 @@
+// Package manifestutil verifies the signed manifest shipped in a rainbond package.
+//
+// A package ships a manifest.json, which lists every image tarball in the package with its digest, and a detached
+// signature manifest.json.sig of the manifest. The signature is made with an ed25519 key, or an ecdsa key such as
+// the one generated by `cosign generate-key-pair`, so `cosign sign-blob --key cosign.key manifest.json` can sign the
+// manifest. The signature is base64 encoded, or the raw bytes.
+package manifestutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/goodrain/rainbond-operator/util/tarutil"
+)
+
+const (
+	// ManifestName is the name of the manifest in the package.
+	ManifestName = "manifest.json"
+	// SignatureName is the name of the detached signature of the manifest in the package.
+	SignatureName = ManifestName + ".sig"
+
+	digestPrefix = "sha256:"
+	// maxManifestSize is the max size of the manifest and the signature read from a package.
+	maxManifestSize = 4 << 20
+)
+
+// ErrSignatureMismatch is returned if the signature does not match the manifest.
+var ErrSignatureMismatch = errors.New("signature of the manifest does not match the public key")
+
+// Manifest lists the image tarballs in a package.
+type Manifest struct {
+	// Images in the package.
+	Images []Image `json:"images"`
+}
+
+// Image is an image tarball in a package.
+type Image struct {
+	// Name of the image, such as goodrain.me/rbd-api:v5.3.3-release, for information only.
+	Name string `json:"name,omitempty"`
+	// Path of the tarball, relative to the manifest.
+	Path string `json:"path"`
+	// Digest of the tarball, such as sha256:<hex>.
+	Digest string `json:"digest"`
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 or ecdsa public key.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %v", err)
+	}
+	switch pub.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key %T, only ed25519 and ecdsa are supported", pub)
+	}
+}
+
+// VerifySignature verifies the detached signature of the data with the public key.
+func VerifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	sig = decodeSignature(sig)
+	var ok bool
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, sum[:], sig)
+	default:
+		return fmt.Errorf("unsupported public key %T", pub)
+	}
+	if !ok {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// decodeSignature decodes the base64 encoded signature, or returns it as is if it is not base64 encoded.
+func decodeSignature(sig []byte) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return sig
+	}
+	return decoded
+}
+
+// Verify verifies the signature of the manifest with the PEM encoded public key, then parses the manifest.
+func Verify(publicKey string, manifest, sig []byte) (*Manifest, error) {
+	pub, err := ParsePublicKey([]byte(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifySignature(pub, manifest, sig); err != nil {
+		return nil, err
+	}
+	return Parse(manifest)
+}
+
+// Parse parses the manifest and validates the images in it.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %v", err)
+	}
+	seen := make(map[string]bool, len(m.Images))
+	for i := range m.Images {
+		image := &m.Images[i]
+		image.Path = path.Clean(image.Path)
+		if image.Path == "." || path.IsAbs(image.Path) || strings.HasPrefix(image.Path, "../") {
+			return nil, fmt.Errorf("invalid path %q of image %d", image.Path, i)
+		}
+		if seen[image.Path] {
+			return nil, fmt.Errorf("duplicate image %s", image.Path)
+		}
+		seen[image.Path] = true
+		hexSum := strings.TrimPrefix(image.Digest, digestPrefix)
+		if b, err := hex.DecodeString(hexSum); err != nil || len(b) != sha256.Size || hexSum == image.Digest {
+			return nil, fmt.Errorf("invalid digest %q of image %s, expected sha256:<hex>", image.Digest, image.Path)
+		}
+	}
+	return &m, nil
+}
+
+// LoadFromPackage reads the manifest and its signature from the gzipped tar package without extracting it, and
+// verifies them with the PEM encoded public key. It also returns the directory of the manifest in the package.
+func LoadFromPackage(pkgPath, publicKey string) (*Manifest, string, error) {
+	files, err := tarutil.ReadFiles(pkgPath, maxManifestSize, func(name string) bool {
+		base := path.Base(name)
+		return base == ManifestName || base == SignatureName
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// the names in the package may start with ./
+	cleaned := make(map[string][]byte, len(files))
+	var names []string
+	for name, content := range files {
+		name = path.Clean(name)
+		cleaned[name] = content
+		names = append(names, name)
+	}
+	files = cleaned
+	name, ok := locate(names)
+	if !ok {
+		return nil, "", fmt.Errorf("no %s found in %s", ManifestName, pkgPath)
+	}
+	dir := path.Dir(name)
+	sig, ok := files[path.Join(dir, SignatureName)]
+	if !ok {
+		return nil, "", fmt.Errorf("no %s found next to %s in %s", SignatureName, name, pkgPath)
+	}
+	m, err := Verify(publicKey, files[name], sig)
+	return m, filepath.FromSlash(dir), err
+}
+
+// Load finds the manifest in the directory the package is extracted to, and verifies it and its signature with
+// the PEM encoded public key. It also returns the directory of the manifest.
+func Load(root, publicKey string) (*Manifest, string, error) {
+	var names []string
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && info.Name() == ManifestName {
+			rel, _ := filepath.Rel(root, file)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	name, ok := locate(names)
+	if !ok {
+		return nil, "", fmt.Errorf("no %s found in %s", ManifestName, root)
+	}
+	dir := filepath.Join(root, filepath.FromSlash(path.Dir(name)))
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, "", fmt.Errorf("read manifest: %v", err)
+	}
+	sig, err := ioutil.ReadFile(filepath.Join(dir, SignatureName))
+	if err != nil {
+		return nil, "", fmt.Errorf("read signature: %v", err)
+	}
+	m, err := Verify(publicKey, manifest, sig)
+	return m, dir, err
+}
+
+// locate returns the manifest nearest to the root of the package among the cleaned, slash separated names.
+func locate(names []string) (string, bool) {
+	var found string
+	for _, name := range names {
+		if path.Base(name) != ManifestName {
+			continue
+		}
+		if found == "" || strings.Count(name, "/") < strings.Count(found, "/") ||
+			strings.Count(name, "/") == strings.Count(found, "/") && name < found {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+// Find returns the image with the path relative to the manifest, or nil if it is not listed.
+func (m *Manifest) Find(rel string) *Image {
+	rel = path.Clean(filepath.ToSlash(rel))
+	for i := range m.Images {
+		if m.Images[i].Path == rel {
+			return &m.Images[i]
+		}
+	}
+	return nil
+}
+
+// VerifyFile verifies the digest of the image tarball file, in the directory dir of the manifest.
+func (m *Manifest) VerifyFile(dir, file string) error {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return err
+	}
+	image := m.Find(rel)
+	if image == nil {
+		return fmt.Errorf("%s is not listed in the manifest", rel)
+	}
+	digest, err := FileDigest(file)
+	if err != nil {
+		return err
+	}
+	if digest != image.Digest {
+		return fmt.Errorf("digest of %s is %s, expected %s", rel, digest, image.Digest)
+	}
+	return nil
+}
+
+// FileDigest returns the sha256 digest of the file, such as sha256:<hex>.
+func FileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("read %s: %v", file, err)
+	}
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,189 @@
+package manifestutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePublicKey(t *testing.T, pub interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writePackage writes a gzipped tar package with the files.
+func writePackage(t *testing.T, pkgPath string, files map[string][]byte) {
+	f, err := os.Create(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	manifest, _ := json.Marshal(Manifest{Images: []Image{{Path: "images/rbd-api.tgz", Digest: digest([]byte("rbd-api"))}}})
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(manifest)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecPriv, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		sig       []byte
+		wantErr   bool
+	}{
+		{name: "ed25519", publicKey: encodePublicKey(t, edPub), sig: ed25519.Sign(edPriv, manifest)},
+		{name: "ed25519 base64", publicKey: encodePublicKey(t, edPub), sig: []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(edPriv, manifest)) + "\n")},
+		{name: "cosign", publicKey: encodePublicKey(t, &ecPriv.PublicKey), sig: []byte(base64.StdEncoding.EncodeToString(ecSig))},
+		{name: "another key", publicKey: encodePublicKey(t, otherPub), sig: ed25519.Sign(edPriv, manifest), wantErr: true},
+		{name: "invalid public key", publicKey: "foobar", sig: ed25519.Sign(edPriv, manifest), wantErr: true},
+	}
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Verify(tc.publicKey, manifest, tc.sig)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Len(t, m.Images, 1)
+			}
+		})
+	}
+
+	// the manifest is changed after signed.
+	tampered, _ := json.Marshal(Manifest{Images: []Image{{Path: "images/rbd-api.tgz", Digest: digest([]byte("foobar"))}}})
+	_, err = Verify(encodePublicKey(t, edPub), tampered, ed25519.Sign(edPriv, manifest))
+	assert.Equal(t, ErrSignatureMismatch, err)
+}
+
+func TestParse(t *testing.T) {
+	valid := digest([]byte("rbd-api"))
+	tests := []struct {
+		name    string
+		images  []Image
+		wantErr bool
+	}{
+		{name: "valid", images: []Image{{Path: "./rbd-api.tgz", Digest: valid}}},
+		{name: "invalid digest", images: []Image{{Path: "rbd-api.tgz", Digest: "sha256:foobar"}}, wantErr: true},
+		{name: "no algorithm", images: []Image{{Path: "rbd-api.tgz", Digest: valid[len("sha256:"):]}}, wantErr: true},
+		{name: "outside the package", images: []Image{{Path: "../rbd-api.tgz", Digest: valid}}, wantErr: true},
+		{name: "duplicate", images: []Image{{Path: "rbd-api.tgz", Digest: valid}, {Path: "./rbd-api.tgz", Digest: valid}}, wantErr: true},
+	}
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := json.Marshal(Manifest{Images: tc.images})
+			_, err := Parse(data)
+			assert.Equal(t, tc.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
+
+func TestLoadFromPackage(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := encodePublicKey(t, pub)
+	manifest, _ := json.Marshal(Manifest{Images: []Image{
+		{Path: "images/rbd-api.tgz", Digest: digest([]byte("rbd-api"))},
+		{Path: "images/rbd-worker.tgz", Digest: digest([]byte("rbd-worker"))},
+	}})
+	files := map[string][]byte{
+		"./rainbond/" + ManifestName:             manifest,
+		"./rainbond/" + SignatureName:            ed25519.Sign(priv, manifest),
+		"./rainbond/images/rbd-api.tgz":          []byte("rbd-api"),
+		"./rainbond/images/rbd-worker.tgz":       []byte("rbd-tampered"),
+		"./rainbond/images/foo/" + ManifestName:  []byte("{}"),
+		"./rainbond/images/foo/" + SignatureName: []byte("foobar"),
+	}
+	dir := t.TempDir()
+	pkgPath := filepath.Join(dir, "rainbond.tgz")
+	writePackage(t, pkgPath, files)
+
+	m, manifestDir, err := LoadFromPackage(pkgPath, publicKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "rainbond", manifestDir)
+	assert.Len(t, m.Images, 2)
+
+	// the package is extracted.
+	root := filepath.Join(dir, "pkg")
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, manifestDir, err = Load(root, publicKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(root, "rainbond"), manifestDir)
+	assert.NoError(t, m.VerifyFile(manifestDir, filepath.Join(manifestDir, "images", "rbd-api.tgz")))
+	assert.EqualError(t, m.VerifyFile(manifestDir, filepath.Join(manifestDir, "images", "rbd-worker.tgz")),
+		"digest of images/rbd-worker.tgz is "+digest([]byte("rbd-tampered"))+", expected "+digest([]byte("rbd-worker")))
+	assert.EqualError(t, m.VerifyFile(manifestDir, filepath.Join(manifestDir, "images", "foo", ManifestName)),
+		"images/foo/manifest.json is not listed in the manifest")
+
+	// no signature.
+	delete(files, "./rainbond/"+SignatureName)
+	writePackage(t, pkgPath, files)
+	_, _, err = LoadFromPackage(pkgPath, publicKey)
+	assert.Error(t, err)
+}
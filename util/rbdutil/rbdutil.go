@@ -1,13 +1,20 @@
 package rbdutil
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"path"
 
 	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
 	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/goodrain/rainbond-operator/util/k8sutil"
 	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // LabelsForRainbond returns labels for resources created by rainbond operator.
@@ -26,6 +33,82 @@ func LabelsForRainbond(labels map[string]string) map[string]string {
 	return rbdLabels
 }
 
+// LabelsForClusterScoped returns labels for the cluster-scoped resources created for the rainbondcluster in the namespace.
+func LabelsForClusterScoped(namespace string, labels map[string]string) map[string]string {
+	rbdLabels := LabelsForRainbond(labels)
+	rbdLabels[constants.NamespaceLabelKey] = namespace
+	return rbdLabels
+}
+
+// ClusterScopedName returns the name of the cluster-scoped resource created for the rainbondcluster in the namespace,
+// so that the resources of the rainbondclusters in different namespaces do not collide.
+// The names are not qualified in the default namespace, to stay compatible with the existing installations.
+func ClusterScopedName(namespace, name string) string {
+	if namespace == "" || namespace == constants.Namespace {
+		return name
+	}
+	return name + "-" + namespace
+}
+
+// ClusterNameOf returns the name of the rainbondcluster the object belongs to, according to its controller reference
+// or the ClusterLabelKey label, or an empty string if the object does not tell.
+func ClusterNameOf(obj metav1.Object) string {
+	if owner := metav1.GetControllerOf(obj); owner != nil && owner.Kind == "RainbondCluster" {
+		if gv, err := schema.ParseGroupVersion(owner.APIVersion); err == nil && gv.Group == rainbondv1alpha1.GroupVersion.Group {
+			return owner.Name
+		}
+	}
+	return obj.GetLabels()[constants.ClusterLabelKey]
+}
+
+// GetRainbondCluster returns the rainbondcluster the object belongs to. If the object does not tell, see ClusterNameOf,
+// the only rainbondcluster in the namespace of the object is returned.
+func GetRainbondCluster(ctx context.Context, c client.Client, obj metav1.Object) (*rainbondv1alpha1.RainbondCluster, error) {
+	if name := ClusterNameOf(obj); name != "" {
+		cluster := &rainbondv1alpha1.RainbondCluster{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}, cluster); err != nil {
+			return nil, err
+		}
+		return cluster, nil
+	}
+
+	clusters := &rainbondv1alpha1.RainbondClusterList{}
+	if err := c.List(ctx, clusters, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil, err
+	}
+	switch len(clusters.Items) {
+	case 0:
+		return nil, k8sErrors.NewNotFound(rainbondv1alpha1.GroupVersion.WithResource("rainbondclusters").GroupResource(), "")
+	case 1:
+		return &clusters.Items[0], nil
+	}
+	return nil, fmt.Errorf("%d rainbondclusters found in namespace %s, label %s/%s with %s to choose one",
+		len(clusters.Items), obj.GetNamespace(), obj.GetNamespace(), obj.GetName(), constants.ClusterLabelKey)
+}
+
+// GetRainbondPackage returns the rainbondpackage of the rainbondcluster, which is the only one in the namespace
+// belonging to the rainbondcluster or not telling which rainbondcluster it belongs to.
+func GetRainbondPackage(ctx context.Context, c client.Client, cluster *rainbondv1alpha1.RainbondCluster) (*rainbondv1alpha1.RainbondPackage, error) {
+	pkgs := &rainbondv1alpha1.RainbondPackageList{}
+	if err := c.List(ctx, pkgs, client.InNamespace(cluster.Namespace)); err != nil {
+		return nil, err
+	}
+	var candidates []*rainbondv1alpha1.RainbondPackage
+	for i := range pkgs.Items {
+		if name := ClusterNameOf(&pkgs.Items[i]); name == "" || name == cluster.Name {
+			candidates = append(candidates, &pkgs.Items[i])
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, k8sErrors.NewNotFound(rainbondv1alpha1.GroupVersion.WithResource("rainbondpackages").GroupResource(), "")
+	case 1:
+		return candidates[0], nil
+	}
+	return nil, fmt.Errorf("%d rainbondpackages found for rainbondcluster %s/%s, label them with %s to choose one",
+		len(candidates), cluster.Namespace, cluster.Name, constants.ClusterLabelKey)
+}
+
 // GetImageRepository returns image repository name based on rainbondcluster.
 func GetImageRepository(cluster *rainbondv1alpha1.RainbondCluster) string {
 	if cluster.Spec.ImageHub == nil {
@@ -34,6 +117,34 @@ func GetImageRepository(cluster *rainbondv1alpha1.RainbondCluster) string {
 	return path.Join(cluster.Spec.ImageHub.Domain, cluster.Spec.ImageHub.Namespace)
 }
 
+// GetImageHubPassword returns the password of the image hub of the given rainbondcluster.
+// PasswordSecretRef takes precedence over the deprecated Password.
+func GetImageHubPassword(ctx context.Context, c client.Client, cluster *rainbondv1alpha1.RainbondCluster) (string, error) {
+	imageHub := cluster.Spec.ImageHub
+	if imageHub == nil {
+		return "", nil
+	}
+	if imageHub.PasswordSecretRef == nil {
+		return imageHub.Password, nil
+	}
+	return k8sutil.GetSecretKeyValue(ctx, c, cluster.Namespace, imageHub.PasswordSecretRef)
+}
+
+// ResolveDatabase returns a copy of the given database with the password
+// from PasswordSecretRef, so that the result can be used to connect.
+func ResolveDatabase(ctx context.Context, c client.Client, namespace string, db *rainbondv1alpha1.Database) (*rainbondv1alpha1.Database, error) {
+	if db == nil || db.PasswordSecretRef == nil {
+		return db, nil
+	}
+	password, err := k8sutil.GetSecretKeyValue(ctx, c, namespace, db.PasswordSecretRef)
+	if err != nil {
+		return nil, err
+	}
+	resolved := db.DeepCopy()
+	resolved.Password = password
+	return resolved, nil
+}
+
 // LabelsForAccessModeRWX returns rainbond labels with access mode rwx.
 func LabelsForAccessModeRWX() map[string]string {
 	return map[string]string{
@@ -48,14 +159,16 @@ func LabelsForAccessModeRWO() map[string]string {
 	}
 }
 
-// FilterNodesWithPortConflicts -
+// GatewayPorts are the host ports used by rbd-gateway.
+var GatewayPorts = []int{80, 443, 10254, 18080, 18081, 8443, 6060, 7070}
+
+// FilterNodesWithPortConflicts filters out the nodes with any of the GatewayPorts in use, by dialing the nodes.
 func FilterNodesWithPortConflicts(nodes []*rainbondv1alpha1.K8sNode) []*rainbondv1alpha1.K8sNode {
 	var result []*rainbondv1alpha1.K8sNode
-	gatewayPorts := []int{80, 443, 10254, 18080, 18081, 8443, 6060, 7070}
 	for idx := range nodes {
 		node := nodes[idx]
 		ok := true
-		for _, port := range gatewayPorts {
+		for _, port := range GatewayPorts {
 			if isPortOccupied(fmt.Sprintf("%s:%d", node.InternalIP, port)) {
 				ok = false
 				break
@@ -0,0 +1,93 @@
+package rbdutil
+
+import (
+	"context"
+	"testing"
+
+	rainbondv1alpha1 "github.com/goodrain/rainbond-operator/api/v1alpha1"
+	"github.com/goodrain/rainbond-operator/util/constants"
+	"github.com/stretchr/testify/assert"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterScopedName(t *testing.T) {
+	assert.Equal(t, "rbd-db", ClusterScopedName(constants.Namespace, "rbd-db"))
+	assert.Equal(t, "rbd-db-rbd-staging", ClusterScopedName("rbd-staging", "rbd-db"))
+	assert.Equal(t, "rainbond.io/nfs-rbd-staging", ClusterScopedName("rbd-staging", "rainbond.io/nfs"))
+}
+
+func TestGetRainbondCluster(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	staging := &rainbondv1alpha1.RainbondCluster{ObjectMeta: metav1.ObjectMeta{Name: "staging", Namespace: "rbd-region"}}
+	production := &rainbondv1alpha1.RainbondCluster{ObjectMeta: metav1.ObjectMeta{Name: "production", Namespace: "rbd-region"}}
+	single := &rainbondv1alpha1.RainbondCluster{ObjectMeta: metav1.ObjectMeta{Name: "rainbondcluster", Namespace: "rbd-system"}}
+	cli := fake.NewFakeClientWithScheme(scheme, staging, production, single)
+	ctx := context.Background()
+
+	// by the controller reference.
+	cpt := &rainbondv1alpha1.RbdComponent{ObjectMeta: metav1.ObjectMeta{Name: "rbd-api", Namespace: "rbd-region"}}
+	controller := true
+	cpt.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: rainbondv1alpha1.GroupVersion.String(), Kind: "RainbondCluster", Name: "staging", Controller: &controller},
+	}
+	cluster, err := GetRainbondCluster(ctx, cli, cpt)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "staging", cluster.Name)
+	}
+
+	// by the label.
+	cpt.OwnerReferences = nil
+	cpt.Labels = map[string]string{constants.ClusterLabelKey: "production"}
+	cluster, err = GetRainbondCluster(ctx, cli, cpt)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "production", cluster.Name)
+	}
+
+	// the rbdcomponent does not tell which one it belongs to.
+	cpt.Labels = nil
+	_, err = GetRainbondCluster(ctx, cli, cpt)
+	assert.Error(t, err)
+	assert.False(t, k8sErrors.IsNotFound(err))
+
+	// the only one in the namespace.
+	cpt.Namespace = "rbd-system"
+	cluster, err = GetRainbondCluster(ctx, cli, cpt)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "rainbondcluster", cluster.Name)
+	}
+
+	cpt.Namespace = "default"
+	_, err = GetRainbondCluster(ctx, cli, cpt)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestGetRainbondPackage(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rainbondv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &rainbondv1alpha1.RainbondCluster{ObjectMeta: metav1.ObjectMeta{Name: "staging", Namespace: "rbd-region"}}
+	cli := fake.NewFakeClientWithScheme(scheme,
+		&rainbondv1alpha1.RainbondPackage{ObjectMeta: metav1.ObjectMeta{
+			Name: "staging", Namespace: "rbd-region", Labels: map[string]string{constants.ClusterLabelKey: "staging"},
+		}},
+		&rainbondv1alpha1.RainbondPackage{ObjectMeta: metav1.ObjectMeta{
+			Name: "production", Namespace: "rbd-region", Labels: map[string]string{constants.ClusterLabelKey: "production"},
+		}},
+	)
+
+	pkg, err := GetRainbondPackage(context.Background(), cli, cluster)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "staging", pkg.Name)
+	}
+
+	cluster.Name = "development"
+	_, err = GetRainbondPackage(context.Background(), cli, cluster)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
@@ -0,0 +1,489 @@
+package registryutil
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// These are the files which tell the format of an image archive.
+const (
+	// dockerArchiveManifest is the manifest of an archive saved by docker save.
+	dockerArchiveManifest = "manifest.json"
+	// ociLayoutIndex is the index of an OCI image layout.
+	ociLayoutIndex = "index.json"
+	// ociLayoutFile marks the directory as an OCI image layout.
+	ociLayoutFile = "oci-layout"
+)
+
+// These are the magic numbers of the compressed tarballs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// maxIndexSize is the max size of the manifest of an archive saved by docker save, or the index of an OCI image layout.
+const maxIndexSize = 4 << 20
+
+// These are the annotations of the names of the images in an OCI image layout.
+const (
+	annotationImageName = "io.containerd.image.name"
+	annotationRefName   = "org.opencontainers.image.ref.name"
+)
+
+// dockerArchiveImage is an image in the manifest of an archive saved by docker save.
+type dockerArchiveImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// PushArchive pushes the images in the tarball file, saved by docker save or in the OCI image layout, and gzipped,
+// zstd compressed or not, to the names returned by rename for their names in the tarball. The blobs which already exist are
+// skipped. The tarball is extracted to a temporary directory next to it.
+func (c *Client) PushArchive(ctx context.Context, file string, rename func(name string) (string, error)) ([]Image, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(file), "._"+filepath.Base(file))
+	if err != nil {
+		return nil, fmt.Errorf("create directory to extract %s: %v", file, err)
+	}
+	defer os.RemoveAll(dir)
+	if err := extract(file, dir); err != nil {
+		return nil, err
+	}
+	return c.PushLayout(ctx, dir, rename)
+}
+
+// PushLayout pushes the images in the directory, which is an extracted archive saved by docker save or an OCI
+// image layout, to the names returned by rename for their names in the directory.
+func (c *Client) PushLayout(ctx context.Context, dir string, rename func(name string) (string, error)) ([]Image, error) {
+	if _, err := os.Stat(filepath.Join(dir, dockerArchiveManifest)); err == nil {
+		return c.pushDockerArchive(ctx, dir, rename)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ociLayoutIndex)); err == nil {
+		return c.pushOCILayout(ctx, dir, rename)
+	}
+	return nil, fmt.Errorf("neither %s nor %s is found in %s", dockerArchiveManifest, ociLayoutIndex, dir)
+}
+
+// IsArchive tells whether the file is a tarball, gzipped, zstd compressed or not, by its content.
+func IsArchive(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r, closer, err := decompress(f)
+	if err != nil {
+		return false, nil
+	}
+	defer closer()
+	// the magic of the tar header is at 257, which is "ustar" for both the POSIX and the GNU format.
+	header := make([]byte, 262)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(header[257:], []byte("ustar")), nil
+}
+
+// IsLayout tells whether the directory is an OCI image layout.
+func IsLayout(dir string) bool {
+	for _, name := range []string{ociLayoutFile, ociLayoutIndex} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+	}
+	return true
+}
+
+// CountArchive returns the number of the images which PushArchive pushes from the tarball file, by its manifest
+// or index. It is 0 if the tarball is not an image archive.
+func CountArchive(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, closer, err := decompress(f)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %v", file, err)
+	}
+	defer closer()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read tar %s: %v", file, err)
+		}
+		name := path.Clean(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || (name != dockerArchiveManifest && name != ociLayoutIndex) {
+			continue
+		}
+		if hdr.Size > maxIndexSize {
+			return 0, fmt.Errorf("%s of %s is larger than %d bytes", name, file, maxIndexSize)
+		}
+		if files[name], err = ioutil.ReadAll(tr); err != nil {
+			return 0, fmt.Errorf("read %s of %s: %v", name, file, err)
+		}
+	}
+	return countImages(files[dockerArchiveManifest], files[ociLayoutIndex])
+}
+
+// CountLayout returns the number of the images which PushLayout pushes from the directory, by its manifest or index.
+// It is 0 if the directory is neither an extracted archive saved by docker save nor an OCI image layout.
+func CountLayout(dir string) (int, error) {
+	files := make(map[string][]byte)
+	for _, name := range []string{dockerArchiveManifest, ociLayoutIndex} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		files[name] = data
+	}
+	return countImages(files[dockerArchiveManifest], files[ociLayoutIndex])
+}
+
+// countImages counts the images by the manifest saved by docker save, which takes precedence as in PushLayout,
+// or the index of the OCI image layout.
+func countImages(dockerManifest, index []byte) (int, error) {
+	if dockerManifest != nil {
+		var archived []dockerArchiveImage
+		if err := json.Unmarshal(dockerManifest, &archived); err != nil {
+			return 0, fmt.Errorf("parse %s: %v", dockerArchiveManifest, err)
+		}
+		var count int
+		for _, image := range archived {
+			count += len(image.RepoTags)
+		}
+		return count, nil
+	}
+	if index != nil {
+		var m manifest
+		if err := json.Unmarshal(index, &m); err != nil {
+			return 0, fmt.Errorf("parse %s: %v", ociLayoutIndex, err)
+		}
+		return len(m.Manifests), nil
+	}
+	return 0, nil
+}
+
+func (c *Client) pushDockerArchive(ctx context.Context, dir string, rename func(name string) (string, error)) ([]Image, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, dockerArchiveManifest))
+	if err != nil {
+		return nil, err
+	}
+	var archived []dockerArchiveImage
+	if err := json.Unmarshal(data, &archived); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", dockerArchiveManifest, err)
+	}
+
+	var images []Image
+	for _, image := range archived {
+		if len(image.RepoTags) == 0 {
+			return nil, fmt.Errorf("image %s has no name", image.Config)
+		}
+		src := &fileSource{dir: dir, files: make(map[string]string)}
+		m, err := src.dockerManifest(image)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range image.RepoTags {
+			pushed, err := c.pushArchived(ctx, src, name, rename, data, m.MediaType)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, pushed)
+		}
+	}
+	return images, nil
+}
+
+func (c *Client) pushOCILayout(ctx context.Context, dir string, rename func(name string) (string, error)) ([]Image, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ociLayoutIndex))
+	if err != nil {
+		return nil, err
+	}
+	var index manifest
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", ociLayoutIndex, err)
+	}
+
+	src := &fileSource{dir: dir}
+	var images []Image
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[annotationImageName]
+		if name == "" {
+			name = desc.Annotations[annotationRefName]
+		}
+		// the ref name may be only a tag.
+		if name == "" || !strings.ContainsAny(name, "/:") {
+			return nil, fmt.Errorf("image %s has no name", desc.Digest)
+		}
+		data, mediaType, err := src.manifest(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		pushed, err := c.pushArchived(ctx, src, name, rename, data, mediaType)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, pushed)
+	}
+	return images, nil
+}
+
+func (c *Client) pushArchived(ctx context.Context, src source, name string, rename func(name string) (string, error),
+	data []byte, mediaType string) (Image, error) {
+	target, err := rename(name)
+	if err != nil {
+		return Image{}, err
+	}
+	dst, err := parseRef(target)
+	if err != nil {
+		return Image{}, err
+	}
+	if err := c.push(ctx, src, dst, data, mediaType); err != nil {
+		return Image{}, err
+	}
+	return Image{Name: target, Digest: sha256Digest(data)}, nil
+}
+
+// fileSource reads the blobs from an extracted archive saved by docker save, or an OCI image layout.
+type fileSource struct {
+	dir string
+	// files are the paths of the blobs by digest, which are in blobs/<algorithm>/<hex> if not found.
+	files map[string]string
+}
+
+func (s *fileSource) path(digest string) (string, error) {
+	if file, ok := s.files[digest]; ok {
+		return file, nil
+	}
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.ContainsAny(parts[1], `/\`) || parts[1] == ".." {
+		return "", fmt.Errorf("invalid digest %s", digest)
+	}
+	return filepath.Join(s.dir, "blobs", parts[0], parts[1]), nil
+}
+
+func (s *fileSource) manifest(ctx context.Context, desc Descriptor) ([]byte, string, error) {
+	file, err := s.path(desc.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("read manifest %s: %v", desc.Digest, err)
+	}
+	if digest := sha256Digest(data); digest != desc.Digest {
+		return nil, "", fmt.Errorf("digest of manifest %s is %s", desc.Digest, digest)
+	}
+	return data, manifestMediaType(data, desc.MediaType), nil
+}
+
+func (s *fileSource) blob(ctx context.Context, desc Descriptor) (io.ReadCloser, error) {
+	file, err := s.path(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(file)
+}
+
+func (s *fileSource) mountFrom(host string) string {
+	return ""
+}
+
+// dockerManifest returns the OCI manifest of the image saved by docker save, whose layers are not compressed.
+func (s *fileSource) dockerManifest(image dockerArchiveImage) (*manifest, error) {
+	configFile, err := s.within(image.Config)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("read config of %s: %v", image.RepoTags[0], err)
+	}
+	var rootfs struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(config, &rootfs); err != nil {
+		return nil, fmt.Errorf("parse config of %s: %v", image.RepoTags[0], err)
+	}
+	if len(rootfs.RootFS.DiffIDs) != len(image.Layers) {
+		return nil, fmt.Errorf("%d layers of %s, but %d diff ids", len(image.Layers), image.RepoTags[0], len(rootfs.RootFS.DiffIDs))
+	}
+
+	m := &manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        &Descriptor{MediaType: MediaTypeOCIConfig, Digest: sha256Digest(config), Size: int64(len(config))},
+	}
+	s.files[m.Config.Digest] = configFile
+	for i, layer := range image.Layers {
+		file, err := s.within(layer)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		// the diff id is the digest of the layer, for it is not compressed.
+		desc := Descriptor{MediaType: MediaTypeOCILayer, Digest: rootfs.RootFS.DiffIDs[i], Size: info.Size()}
+		if compressed, err := isGzipped(file); err != nil {
+			return nil, err
+		} else if compressed {
+			if desc.Digest, err = fileDigest(file); err != nil {
+				return nil, err
+			}
+			desc.MediaType = MediaTypeOCILayerGzip
+		}
+		s.files[desc.Digest] = file
+		m.Layers = append(m.Layers, desc)
+	}
+	return m, nil
+}
+
+// within returns the path of the file in the directory, which must not be outside of it.
+func (s *fileSource) within(name string) (string, error) {
+	file := filepath.Join(s.dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(s.dir, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the archive", name)
+	}
+	return file, nil
+}
+
+func isGzipped(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, gzipMagic), nil
+}
+
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extract extracts the tarball file, gzipped, zstd compressed or not, to the directory. The symbolic links, which
+// docker save makes for the layers shared by the images, must link to the files in the directory.
+func extract(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, closer, err := decompress(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %v", file, err)
+	}
+	defer closer()
+
+	src := &fileSource{dir: dir}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar %s: %v", file, err)
+		}
+		target, err := src.within(hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeFile(target, tr)
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("link %s: %s is absolute", hdr.Name, hdr.Linkname)
+			}
+			if _, err = src.within(filepath.Join(filepath.Dir(hdr.Name), hdr.Linkname)); err != nil {
+				return fmt.Errorf("link %s: %v", hdr.Name, err)
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("extract %s of %s: %v", hdr.Name, file, err)
+		}
+	}
+}
+
+// decompress returns the reader of the content of r, which is decompressed if it is gzipped or zstd compressed.
+func decompress(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read gzip: %v", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	}
+	if magic, err := br.Peek(len(zstdMagic)); err == nil && bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read zstd: %v", err)
+		}
+		return zr, zr.Close, nil
+	}
+	return br, func() {}, nil
+}
+
+func writeFile(file string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
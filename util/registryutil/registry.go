@@ -0,0 +1,718 @@
+// Package registryutil copies images to a registry without the docker daemon, from another registry or from
+// image tarballs, with the registry HTTP API V2.
+package registryutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+)
+
+// These are the media types of the manifests and the blobs.
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIConfig          = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer           = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// dockerHubHost is the host of the registry of the images without a domain, such as nginx:latest.
+const dockerHubHost = "registry-1.docker.io"
+
+var acceptedManifests = []string{MediaTypeDockerManifestList, MediaTypeOCIIndex, MediaTypeDockerManifest, MediaTypeOCIManifest}
+
+// Descriptor describes the content a manifest refers to.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType,omitempty"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// manifest holds the fields of the image manifests and the manifest lists needed to copy them.
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        *Descriptor  `json:"config,omitempty"`
+	Layers        []Descriptor `json:"layers,omitempty"`
+	Manifests     []Descriptor `json:"manifests,omitempty"`
+}
+
+func isManifestList(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// Image is an image pushed.
+type Image struct {
+	// Name of the image, such as goodrain.me/rbd-api:v5.3.3-release.
+	Name string
+	// Digest of the manifest of the image.
+	Digest string
+}
+
+// Auth is the credential of a registry.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// Options of the client.
+type Options struct {
+	// Auths are the credentials of the registries by host, such as goodrain.me or 192.168.0.1:5000.
+	Auths map[string]Auth
+	// InsecureRegistries are accessed without verifying their certificates, or over plain http.
+	InsecureRegistries []string
+	// Hosts maps the hosts of the registries to the ip addresses, the same as the host aliases of a pod.
+	Hosts map[string]string
+	// Timeout of a request without a body, defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Client copies images to the registries.
+type Client struct {
+	opts     Options
+	secure   *http.Client
+	insecure *http.Client
+
+	mu      sync.Mutex
+	schemes map[string]string
+	// tokens are the bearer tokens by host and scope.
+	tokens map[string]string
+	// basic are the hosts which ask for basic authentication.
+	basic map[string]bool
+}
+
+// NewClient creates a new client.
+func NewClient(opts Options) *Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	newTransport := func(insecure bool) *http.Transport {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyFromEnvironment
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(addr); err == nil {
+				if ip, ok := opts.Hosts[host]; ok {
+					addr = net.JoinHostPort(ip, port)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if insecure {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		return transport
+	}
+	return &Client{
+		opts:     opts,
+		secure:   &http.Client{Transport: newTransport(false)},
+		insecure: &http.Client{Transport: newTransport(true)},
+		schemes:  make(map[string]string),
+		tokens:   make(map[string]string),
+		basic:    make(map[string]bool),
+	}
+}
+
+// imageRef is a reference to an image in a registry.
+type imageRef struct {
+	host string
+	repo string
+	// tag or digest.
+	ref string
+}
+
+func (r imageRef) String() string {
+	sep := ":"
+	if strings.Contains(r.ref, ":") {
+		sep = "@"
+	}
+	return r.host + "/" + r.repo + sep + r.ref
+}
+
+func parseRef(image string) (imageRef, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return imageRef{}, fmt.Errorf("parse image %s: %v", image, err)
+	}
+	r := imageRef{host: reference.Domain(named), repo: reference.Path(named), ref: "latest"}
+	if r.host == "docker.io" {
+		r.host = dockerHubHost
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		r.ref = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		r.ref = digested.Digest().String()
+	}
+	return r, nil
+}
+
+func (c *Client) isInsecure(host string) bool {
+	for _, registry := range c.opts.InsecureRegistries {
+		if registry == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) httpClient(host string) *http.Client {
+	if c.isInsecure(host) {
+		return c.insecure
+	}
+	return c.secure
+}
+
+// scheme returns the scheme to access the registry, which is http only if the registry is insecure and does not
+// serve https.
+func (c *Client) scheme(ctx context.Context, host string) string {
+	c.mu.Lock()
+	scheme, ok := c.schemes[host]
+	c.mu.Unlock()
+	if ok {
+		return scheme
+	}
+	scheme = "https"
+	if c.isInsecure(host) {
+		ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/v2/", nil)
+		res, err := c.insecure.Do(req)
+		if err != nil {
+			scheme = "http"
+		} else {
+			res.Body.Close()
+		}
+	}
+	c.mu.Lock()
+	c.schemes[host] = scheme
+	c.mu.Unlock()
+	return scheme
+}
+
+// request is a request to a registry.
+type request struct {
+	method string
+	host   string
+	// path of the request, or the url if it is absolute.
+	path string
+	// scope of the bearer token, such as repository:rbd-api:pull.
+	scope  string
+	header http.Header
+	// body returns a new body of the request, or nil if there is none.
+	body func() (io.ReadCloser, error)
+	size int64
+	// stream tells the response body is streamed, so the request is not timed out like the others without a body.
+	stream bool
+}
+
+// do sends the request, and retries it once with the credential the registry asks for.
+func (c *Client) do(ctx context.Context, r *request) (*http.Response, error) {
+	u := r.path
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		u = c.scheme(ctx, r.host) + "://" + r.host + u
+	}
+	if r.body == nil && !r.stream {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		res, err := c.send(ctx, r, u)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		res.Body = &cancelCloser{ReadCloser: res.Body, cancel: cancel}
+		return res, nil
+	}
+	return c.send(ctx, r, u)
+}
+
+func (c *Client) send(ctx context.Context, r *request, u string) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		req, err := http.NewRequestWithContext(ctx, r.method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range r.header {
+			req.Header[key] = values
+		}
+		if r.body != nil {
+			body, err := r.body()
+			if err != nil {
+				return nil, err
+			}
+			req.Body, req.ContentLength = body, r.size
+		}
+		c.authorize(req, r)
+		res, err := c.httpClient(r.host).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusUnauthorized || retried {
+			return res, nil
+		}
+		challenge := res.Header.Get("WWW-Authenticate")
+		drain(res)
+		if err := c.authenticate(ctx, r, challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) authorize(req *http.Request, r *request) {
+	c.mu.Lock()
+	token, basic := c.tokens[r.host+" "+r.scope], c.basic[r.host]
+	c.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if auth, ok := c.opts.Auths[r.host]; ok && basic {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+}
+
+// authenticate gets the credential the registry asks for in the challenge.
+func (c *Client) authenticate(ctx context.Context, r *request, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if _, ok := c.opts.Auths[r.host]; !ok {
+			return fmt.Errorf("%s asks for basic authentication, but no credential is given", r.host)
+		}
+		c.mu.Lock()
+		c.basic[r.host] = true
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, r, params)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.tokens[r.host+" "+r.scope] = token
+		c.mu.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication %q of %s", challenge, r.host)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, r *request, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid realm %q of %s", params["realm"], r.host)
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if r.scope != "" {
+		query.Set("scope", r.scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth, ok := c.opts.Auths[r.host]; ok {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	res, err := c.httpClient(r.host).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch token of %s: %v", r.host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch token of %s: %s", r.host, res.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode token of %s: %v", r.host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
+
+// parseChallenge parses a challenge such as Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexByte(challenge, ' ')
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value, rest = rest[1:end+1], rest[end+1:]
+			if rest != "" {
+				rest = rest[1:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		params[strings.ToLower(key)] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
+
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func drain(res *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4<<10))
+	res.Body.Close()
+}
+
+// statusError returns the error of an unexpected response.
+func statusError(res *http.Response, action string) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
+	res.Body.Close()
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return fmt.Errorf("%s: %s", action, res.Status)
+	}
+	return fmt.Errorf("%s: %s: %s", action, res.Status, msg)
+}
+
+func scope(repo string, push bool) string {
+	if push {
+		return "repository:" + repo + ":pull,push"
+	}
+	return "repository:" + repo + ":pull"
+}
+
+// getManifest returns the manifest of the reference in the repository, with its media type.
+func (c *Client) getManifest(ctx context.Context, ref imageRef, reference string) ([]byte, string, error) {
+	res, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		host:   ref.host,
+		path:   "/v2/" + ref.repo + "/manifests/" + reference,
+		scope:  scope(ref.repo, false),
+		header: http.Header{"Accept": acceptedManifests},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("get manifest of %s: %v", ref, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", statusError(res, "get manifest of "+ref.String())
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 8<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("read manifest of %s: %v", ref, err)
+	}
+	mediaType := res.Header.Get("Content-Type")
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return data, manifestMediaType(data, mediaType), nil
+}
+
+// manifestMediaType returns the media type of the manifest, which defaults to the given one.
+func manifestMediaType(data []byte, mediaType string) string {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err == nil && m.MediaType != "" {
+		return m.MediaType
+	}
+	return mediaType
+}
+
+// manifestDigest returns the digest of the manifest in the repository, or empty if it does not exist.
+func (c *Client) manifestDigest(ctx context.Context, ref imageRef) (string, error) {
+	res, err := c.do(ctx, &request{
+		method: http.MethodHead,
+		host:   ref.host,
+		path:   "/v2/" + ref.repo + "/manifests/" + ref.ref,
+		scope:  scope(ref.repo, true),
+		header: http.Header{"Accept": acceptedManifests},
+	})
+	if err != nil {
+		return "", fmt.Errorf("head manifest of %s: %v", ref, err)
+	}
+	drain(res)
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Header.Get("Docker-Content-Digest"), nil
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("head manifest of %s: %s", ref, res.Status)
+	}
+}
+
+func (c *Client) putManifest(ctx context.Context, ref imageRef, reference string, data []byte, mediaType string) error {
+	res, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		host:   ref.host,
+		path:   "/v2/" + ref.repo + "/manifests/" + reference,
+		scope:  scope(ref.repo, true),
+		header: http.Header{"Content-Type": {mediaType}},
+		body: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		},
+		size: int64(len(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("put manifest of %s: %v", ref, err)
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return statusError(res, "put manifest of "+ref.String())
+	}
+	drain(res)
+	return nil
+}
+
+func (c *Client) blobExists(ctx context.Context, ref imageRef, digest string) (bool, error) {
+	res, err := c.do(ctx, &request{
+		method: http.MethodHead,
+		host:   ref.host,
+		path:   "/v2/" + ref.repo + "/blobs/" + digest,
+		scope:  scope(ref.repo, true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("head blob %s of %s: %v", digest, ref.repo, err)
+	}
+	drain(res)
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("head blob %s of %s: %s", digest, ref.repo, res.Status)
+	}
+}
+
+func (c *Client) getBlob(ctx context.Context, ref imageRef, desc Descriptor) (io.ReadCloser, error) {
+	res, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		host:   ref.host,
+		path:   "/v2/" + ref.repo + "/blobs/" + desc.Digest,
+		scope:  scope(ref.repo, false),
+		stream: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get blob %s of %s: %v", desc.Digest, ref.repo, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res, fmt.Sprintf("get blob %s of %s", desc.Digest, ref.repo))
+	}
+	return res.Body, nil
+}
+
+// pushBlob pushes the blob to the repository if it does not exist, or mounts it from the repository from, on the
+// same registry, if it is not empty. It returns whether the blob is uploaded.
+func (c *Client) pushBlob(ctx context.Context, ref imageRef, desc Descriptor, from string, open func() (io.ReadCloser, error)) (bool, error) {
+	exists, err := c.blobExists(ctx, ref, desc.Digest)
+	if err != nil || exists {
+		return false, err
+	}
+
+	path := "/v2/" + ref.repo + "/blobs/uploads/"
+	if from != "" {
+		path += "?" + url.Values{"mount": {desc.Digest}, "from": {from}}.Encode()
+	}
+	res, err := c.do(ctx, &request{method: http.MethodPost, host: ref.host, path: path, scope: scope(ref.repo, true)})
+	if err != nil {
+		return false, fmt.Errorf("start uploading blob %s to %s: %v", desc.Digest, ref.repo, err)
+	}
+	switch res.StatusCode {
+	case http.StatusCreated:
+		// mounted
+		drain(res)
+		return false, nil
+	case http.StatusAccepted:
+	default:
+		return false, statusError(res, fmt.Sprintf("start uploading blob %s to %s", desc.Digest, ref.repo))
+	}
+	drain(res)
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil || res.Header.Get("Location") == "" {
+		return false, fmt.Errorf("invalid upload location %q of %s", res.Header.Get("Location"), ref.repo)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	res, err = c.do(ctx, &request{
+		method: http.MethodPut,
+		host:   ref.host,
+		path:   location.String(),
+		scope:  scope(ref.repo, true),
+		header: http.Header{"Content-Type": {"application/octet-stream"}},
+		body:   open,
+		size:   desc.Size,
+	})
+	if err != nil {
+		return false, fmt.Errorf("upload blob %s to %s: %v", desc.Digest, ref.repo, err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		return false, statusError(res, fmt.Sprintf("upload blob %s to %s", desc.Digest, ref.repo))
+	}
+	drain(res)
+	return true, nil
+}
+
+// source is where the images are copied from.
+type source interface {
+	// manifest returns the manifest with its media type.
+	manifest(ctx context.Context, desc Descriptor) ([]byte, string, error)
+	// blob opens the blob.
+	blob(ctx context.Context, desc Descriptor) (io.ReadCloser, error)
+	// mountFrom returns the repository to mount the blobs from if it is on the host, or empty.
+	mountFrom(host string) string
+}
+
+// registrySource copies the images from a repository in a registry.
+type registrySource struct {
+	c   *Client
+	ref imageRef
+}
+
+func (s *registrySource) manifest(ctx context.Context, desc Descriptor) ([]byte, string, error) {
+	data, mediaType, err := s.c.getManifest(ctx, s.ref, desc.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	if digest := sha256Digest(data); digest != desc.Digest {
+		return nil, "", fmt.Errorf("digest of manifest %s of %s is %s", desc.Digest, s.ref.repo, digest)
+	}
+	return data, mediaType, nil
+}
+
+func (s *registrySource) blob(ctx context.Context, desc Descriptor) (io.ReadCloser, error) {
+	return s.c.getBlob(ctx, s.ref, desc)
+}
+
+func (s *registrySource) mountFrom(host string) string {
+	if host == s.ref.host {
+		return s.ref.repo
+	}
+	return ""
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// push pushes the manifest, and the manifests or blobs it refers to, from the source to the reference.
+func (c *Client) push(ctx context.Context, src source, dst imageRef, data []byte, mediaType string) error {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parse manifest of %s: %v", dst, err)
+	}
+	if m.SchemaVersion != 2 {
+		return fmt.Errorf("unsupported manifest schema version %d of %s", m.SchemaVersion, dst)
+	}
+	if isManifestList(mediaType) {
+		for _, desc := range m.Manifests {
+			child, childType, err := src.manifest(ctx, desc)
+			if err != nil {
+				return err
+			}
+			if isManifestList(childType) {
+				return fmt.Errorf("nested manifest list %s of %s is not supported", desc.Digest, dst)
+			}
+			if err := c.push(ctx, src, imageRef{host: dst.host, repo: dst.repo, ref: desc.Digest}, child, childType); err != nil {
+				return err
+			}
+		}
+	} else {
+		blobs := m.Layers
+		if m.Config != nil {
+			blobs = append([]Descriptor{*m.Config}, blobs...)
+		}
+		for _, desc := range blobs {
+			desc := desc
+			open := func() (io.ReadCloser, error) { return src.blob(ctx, desc) }
+			if _, err := c.pushBlob(ctx, dst, desc, src.mountFrom(dst.host), open); err != nil {
+				return err
+			}
+		}
+	}
+	return c.putManifest(ctx, dst, dst.ref, data, mediaType)
+}
+
+// Copy copies the image src in a registry to dst in another or the same registry, including all the platforms if
+// it is a manifest list. The blobs which already exist are skipped. It returns the digest of the manifest.
+func (c *Client) Copy(ctx context.Context, src, dst string) (string, error) {
+	srcRef, err := parseRef(src)
+	if err != nil {
+		return "", err
+	}
+	dstRef, err := parseRef(dst)
+	if err != nil {
+		return "", err
+	}
+	data, mediaType, err := c.getManifest(ctx, srcRef, srcRef.ref)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256Digest(data)
+	if existing, err := c.manifestDigest(ctx, dstRef); err == nil && existing == digest {
+		return digest, nil
+	}
+	return digest, c.push(ctx, &registrySource{c: c, ref: srcRef}, dstRef, data, mediaType)
+}
+
+// Host returns the host of the registry of the image, such as goodrain.me for goodrain.me/rbd-api:v5.3.3, and
+// registry-1.docker.io for rainbond/rbd-api:v5.3.3.
+func Host(image string) (string, error) {
+	ref, err := parseRef(image)
+	if err != nil {
+		return "", err
+	}
+	return ref.host, nil
+}
@@ -0,0 +1,480 @@
+package registryutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+type storedManifest struct {
+	data      []byte
+	mediaType string
+}
+
+// fakeRegistry is an in-process registry, which serves the registry HTTP API V2 used by the client.
+type fakeRegistry struct {
+	// token is the bearer token the registry asks for, if not empty.
+	token string
+	auth  Auth
+
+	mu        sync.Mutex
+	blobs     map[string]map[string][]byte
+	manifests map[string]map[string]storedManifest
+	uploads   map[string]string
+	// uploaded are the digests of the blobs uploaded.
+	uploaded []string
+	mounted  []string
+	server   *httptest.Server
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{
+		blobs:     make(map[string]map[string][]byte),
+		manifests: make(map[string]map[string]storedManifest),
+		uploads:   make(map[string]string),
+	}
+	r.server = httptest.NewServer(r)
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) putBlob(repo string, content []byte) Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := sha256Digest(content)
+	if r.blobs[repo] == nil {
+		r.blobs[repo] = make(map[string][]byte)
+	}
+	r.blobs[repo][digest] = content
+	return Descriptor{Digest: digest, Size: int64(len(content))}
+}
+
+func (r *fakeRegistry) putManifest(repo, ref string, data []byte, mediaType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.manifests[repo] == nil {
+		r.manifests[repo] = make(map[string]storedManifest)
+	}
+	r.manifests[repo][ref] = storedManifest{data: data, mediaType: mediaType}
+	r.manifests[repo][sha256Digest(data)] = storedManifest{data: data, mediaType: mediaType}
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if user, password, _ := req.BasicAuth(); user != r.auth.Username || password != r.auth.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if req.URL.Path == "/v2/" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.Index(path, "/blobs/uploads/")
+		repo, id := path[:i], path[i+len("/blobs/uploads/"):]
+		if r.blobs[repo] == nil {
+			r.blobs[repo] = make(map[string][]byte)
+		}
+		if req.Method == http.MethodPost {
+			if mount, from := req.URL.Query().Get("mount"), req.URL.Query().Get("from"); mount != "" {
+				if content, ok := r.blobs[from][mount]; ok {
+					r.blobs[repo][mount] = content
+					r.mounted = append(r.mounted, mount)
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+			id = fmt.Sprintf("upload-%d", len(r.uploads))
+			r.uploads[id] = repo
+			w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id+"?state=foo")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		content, _ := ioutil.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if r.uploads[id] != repo || req.URL.Query().Get("state") != "foo" || sha256Digest(content) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[repo][digest] = content
+		r.uploaded = append(r.uploaded, digest)
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		i := strings.Index(path, "/blobs/")
+		content, ok := r.blobs[path[:i]][path[i+len("/blobs/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		if req.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case strings.Contains(path, "/manifests/"):
+		i := strings.Index(path, "/manifests/")
+		repo, ref := path[:i], path[i+len("/manifests/"):]
+		if req.Method == http.MethodPut {
+			data, _ := ioutil.ReadAll(req.Body)
+			var m manifest
+			json.Unmarshal(data, &m)
+			// the blobs and the manifests referred must exist.
+			for _, desc := range append(m.Layers, m.Manifests...) {
+				_, blob := r.blobs[repo][desc.Digest]
+				_, child := r.manifests[repo][desc.Digest]
+				if !blob && !child {
+					http.Error(w, desc.Digest+" not found", http.StatusBadRequest)
+					return
+				}
+			}
+			if r.manifests[repo] == nil {
+				r.manifests[repo] = make(map[string]storedManifest)
+			}
+			stored := storedManifest{data: data, mediaType: req.Header.Get("Content-Type")}
+			r.manifests[repo][ref] = stored
+			r.manifests[repo][sha256Digest(data)] = stored
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		stored, ok := r.manifests[repo][ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", stored.mediaType)
+		w.Header().Set("Docker-Content-Digest", sha256Digest(stored.data))
+		if req.Method == http.MethodGet {
+			w.Write(stored.data)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// putImage puts an image with the layers to the registry, and returns its manifest.
+func (r *fakeRegistry) putImage(repo, tag string, layers ...string) []byte {
+	m := manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifest}
+	config := r.putBlob(repo, []byte(`{"architecture":"amd64","os":"linux"}`))
+	m.Config = &config
+	for _, layer := range layers {
+		m.Layers = append(m.Layers, r.putBlob(repo, []byte(layer)))
+	}
+	data, _ := json.Marshal(m)
+	r.putManifest(repo, tag, data, MediaTypeDockerManifest)
+	return data
+}
+
+func (r *fakeRegistry) manifest(repo, ref string) (storedManifest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.manifests[repo][ref]
+	return stored, ok
+}
+
+func (r *fakeRegistry) stats() ([]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.uploaded...), append([]string(nil), r.mounted...)
+}
+
+func TestCopy(t *testing.T) {
+	src, dst := newFakeRegistry(t), newFakeRegistry(t)
+	src.token, src.auth = "foobar", Auth{Username: "admin", Password: "pass"}
+	data := src.putImage("goodrain/rbd-api", "v5.3.3", "layer1", "layer2")
+	// the layer exists.
+	dst.putBlob("goodrain/rbd-api", []byte("layer1"))
+
+	c := NewClient(Options{
+		Auths:              map[string]Auth{src.host(): src.auth},
+		InsecureRegistries: []string{src.host(), dst.host()},
+	})
+	ctx := context.Background()
+	digest, err := c.Copy(ctx, src.host()+"/goodrain/rbd-api:v5.3.3", dst.host()+"/goodrain/rbd-api:v5.3.3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, sha256Digest(data), digest)
+	stored, ok := dst.manifest("goodrain/rbd-api", "v5.3.3")
+	if assert.True(t, ok) {
+		assert.Equal(t, data, stored.data)
+		assert.Equal(t, MediaTypeDockerManifest, stored.mediaType)
+	}
+	uploaded, _ := dst.stats()
+	assert.Len(t, uploaded, 2, "the config and layer2 are uploaded")
+
+	// nothing is uploaded for the same image.
+	_, err = c.Copy(ctx, src.host()+"/goodrain/rbd-api:v5.3.3", dst.host()+"/goodrain/rbd-api:v5.3.3")
+	assert.NoError(t, err)
+	uploaded, _ = dst.stats()
+	assert.Len(t, uploaded, 2)
+
+	// mounted from the repository on the same registry.
+	_, err = c.Copy(ctx, dst.host()+"/goodrain/rbd-api:v5.3.3", dst.host()+"/rainbond/rbd-api:v5.3.3")
+	assert.NoError(t, err)
+	uploaded, mounted := dst.stats()
+	assert.Len(t, uploaded, 2)
+	assert.Len(t, mounted, 3)
+
+	// without the credential.
+	_, err = NewClient(Options{InsecureRegistries: []string{src.host()}}).Copy(ctx, src.host()+"/goodrain/rbd-api:v5.3.3", dst.host()+"/goodrain/rbd-api:v5.3.3")
+	assert.Error(t, err)
+}
+
+func TestCopyManifestList(t *testing.T) {
+	src, dst := newFakeRegistry(t), newFakeRegistry(t)
+	amd64 := src.putImage("goodrain/rbd-api", "amd64", "amd64")
+	arm64 := src.putImage("goodrain/rbd-api", "arm64", "arm64")
+	list := manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifestList, Manifests: []Descriptor{
+		{MediaType: MediaTypeDockerManifest, Digest: sha256Digest(amd64), Size: int64(len(amd64))},
+		{MediaType: MediaTypeDockerManifest, Digest: sha256Digest(arm64), Size: int64(len(arm64))},
+	}}
+	data, _ := json.Marshal(list)
+	src.putManifest("goodrain/rbd-api", "v5.3.3", data, MediaTypeDockerManifestList)
+
+	c := NewClient(Options{InsecureRegistries: []string{src.host(), dst.host()}})
+	digest, err := c.Copy(context.Background(), src.host()+"/goodrain/rbd-api:v5.3.3", dst.host()+"/rainbond/rbd-api:v5.3.3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, sha256Digest(data), digest)
+	for _, child := range [][]byte{amd64, arm64} {
+		stored, ok := dst.manifest("rainbond/rbd-api", sha256Digest(child))
+		if assert.True(t, ok) {
+			assert.Equal(t, child, stored.data)
+		}
+	}
+	stored, _ := dst.manifest("rainbond/rbd-api", "v5.3.3")
+	assert.Equal(t, MediaTypeDockerManifestList, stored.mediaType)
+}
+
+// writeTar writes the files to a gzipped tarball.
+func writeTar(t *testing.T, file string, files map[string][]byte, links map[string]string) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write(content)
+	}
+	for name, linked := range links {
+		tw.WriteHeader(&tar.Header{Name: name, Linkname: linked, Mode: 0777, Typeflag: tar.TypeSymlink})
+	}
+	tw.Close()
+	gz.Close()
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPushDockerArchive(t *testing.T) {
+	dst := newFakeRegistry(t)
+	layer1, layer2 := []byte("layer1"), []byte("layer2")
+	config, _ := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{sha256Digest(layer1), sha256Digest(layer2)}},
+	})
+	archived, _ := json.Marshal([]dockerArchiveImage{
+		{Config: "config.json", RepoTags: []string{"goodrain.me/rbd-api:v5.3.3"}, Layers: []string{"layer1/layer.tar", "layer2/layer.tar"}},
+		{Config: "config.json", RepoTags: []string{"goodrain.me/rbd-worker:v5.3.3"}, Layers: []string{"layer1/layer.tar", "layer3/layer.tar"}},
+	})
+	file := filepath.Join(t.TempDir(), "rbd-api.tgz")
+	writeTar(t, file, map[string][]byte{
+		"manifest.json":    archived,
+		"config.json":      config,
+		"layer1/layer.tar": layer1,
+		"layer2/layer.tar": layer2,
+	}, map[string]string{"layer3/layer.tar": "../layer2/layer.tar"})
+
+	c := NewClient(Options{InsecureRegistries: []string{dst.host()}})
+	images, err := c.PushArchive(context.Background(), file, func(name string) (string, error) {
+		return dst.host() + "/rainbond/" + strings.TrimPrefix(name, "goodrain.me/"), nil
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, images, 2) {
+		return
+	}
+	assert.Equal(t, dst.host()+"/rainbond/rbd-api:v5.3.3", images[0].Name)
+	stored, ok := dst.manifest("rainbond/rbd-api", "v5.3.3")
+	if assert.True(t, ok) {
+		assert.Equal(t, images[0].Digest, sha256Digest(stored.data))
+		assert.Equal(t, MediaTypeOCIManifest, stored.mediaType)
+	}
+	_, ok = dst.manifest("rainbond/rbd-worker", "v5.3.3")
+	assert.True(t, ok)
+	// the temporary directory is removed.
+	files, _ := ioutil.ReadDir(filepath.Dir(file))
+	assert.Len(t, files, 1)
+
+	// the links out of the archive are refused.
+	writeTar(t, file, map[string][]byte{"manifest.json": archived}, map[string]string{"layer1/layer.tar": "../../etc/passwd"})
+	_, err = c.PushArchive(context.Background(), file, func(name string) (string, error) { return name, nil })
+	assert.Error(t, err)
+}
+
+func TestPushOCILayout(t *testing.T) {
+	dst := newFakeRegistry(t)
+	files := make(map[string][]byte)
+	blob := func(content []byte, mediaType string) Descriptor {
+		digest := sha256Digest(content)
+		files["blobs/sha256/"+strings.TrimPrefix(digest, "sha256:")] = content
+		return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+	}
+	config := blob([]byte(`{"architecture":"amd64"}`), MediaTypeOCIConfig)
+	image, _ := json.Marshal(manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest, Config: &config,
+		Layers: []Descriptor{blob([]byte("layer1"), MediaTypeOCILayerGzip)}})
+	imageDesc := blob(image, MediaTypeOCIManifest)
+	index, _ := json.Marshal(manifest{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{imageDesc}})
+	indexDesc := blob(index, MediaTypeOCIIndex)
+	indexDesc.Annotations = map[string]string{annotationImageName: "goodrain.me/rbd-api:v5.3.3", annotationRefName: "v5.3.3"}
+	files[ociLayoutIndex], _ = json.Marshal(manifest{SchemaVersion: 2, Manifests: []Descriptor{indexDesc}})
+	files["oci-layout"] = []byte(`{"imageLayoutVersion":"1.0.0"}`)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rbd-api.tar")
+	writeTar(t, file, files, nil)
+
+	c := NewClient(Options{InsecureRegistries: []string{dst.host()}})
+	images, err := c.PushArchive(context.Background(), file, func(name string) (string, error) {
+		return dst.host() + "/rainbond/" + strings.TrimPrefix(name, "goodrain.me/"), nil
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, images, 1) {
+		return
+	}
+	assert.Equal(t, indexDesc.Digest, images[0].Digest)
+	stored, ok := dst.manifest("rainbond/rbd-api", "v5.3.3")
+	if assert.True(t, ok) {
+		assert.Equal(t, MediaTypeOCIIndex, stored.mediaType)
+	}
+	_, ok = dst.manifest("rainbond/rbd-api", imageDesc.Digest)
+	assert.True(t, ok)
+	_, err = os.Stat(file)
+	assert.NoError(t, err)
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:samalba/my-app:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:samalba/my-app:pull,push",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=Registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "Registry"}, params)
+}
+
+// recompress decompresses the gzipped file, and compresses it with zstd if zstdCompressed.
+func recompress(t *testing.T, file string, zstdCompressed bool) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zstdCompressed {
+		var buf bytes.Buffer
+		zw, _ := zstd.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountArchive(t *testing.T) {
+	dst := newFakeRegistry(t)
+	layer := []byte("layer1")
+	config, _ := json.Marshal(map[string]interface{}{
+		"rootfs": map[string]interface{}{"type": "layers", "diff_ids": []string{sha256Digest(layer)}},
+	})
+	archived, _ := json.Marshal([]dockerArchiveImage{
+		{Config: "config.json", RepoTags: []string{"goodrain.me/rbd-api:v5.3.3", "goodrain.me/rbd-api:latest"}, Layers: []string{"layer1/layer.tar"}},
+		{Config: "config.json", RepoTags: []string{"goodrain.me/rbd-worker:v5.3.3"}, Layers: []string{"layer1/layer.tar"}},
+	})
+	files := map[string][]byte{"./manifest.json": archived, "config.json": config, "layer1/layer.tar": layer}
+	dir := t.TempDir()
+	c := NewClient(Options{InsecureRegistries: []string{dst.host()}})
+
+	for _, name := range []string{"rainbond.tgz", "rainbond.tar", "rainbond.tar.zst"} {
+		file := filepath.Join(dir, name)
+		writeTar(t, file, files, nil)
+		if name != "rainbond.tgz" {
+			recompress(t, file, name == "rainbond.tar.zst")
+		}
+		ok, err := IsArchive(file)
+		assert.NoError(t, err)
+		assert.True(t, ok, name)
+		count, err := CountArchive(file)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, count, name)
+		images, err := c.PushArchive(context.Background(), file, func(name string) (string, error) {
+			return dst.host() + "/rainbond/" + strings.TrimPrefix(name, "goodrain.me/"), nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, images, count, name)
+	}
+
+	// not an image archive.
+	file := filepath.Join(dir, "manifest.json.sig")
+	if err := ioutil.WriteFile(file, []byte("signature"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := IsArchive(file)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	file = filepath.Join(dir, "chart.tgz")
+	writeTar(t, file, map[string][]byte{"rainbond/Chart.yaml": []byte("name: rainbond")}, nil)
+	count, err := CountArchive(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// an extracted OCI image layout.
+	layout := filepath.Join(dir, "layout")
+	assert.False(t, IsLayout(layout))
+	os.MkdirAll(layout, 0755)
+	ioutil.WriteFile(filepath.Join(layout, ociLayoutFile), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	index, _ := json.Marshal(manifest{SchemaVersion: 2, Manifests: []Descriptor{{Digest: sha256Digest(layer)}, {Digest: sha256Digest(config)}}})
+	ioutil.WriteFile(filepath.Join(layout, ociLayoutIndex), index, 0644)
+	assert.True(t, IsLayout(layout))
+	count, err = CountLayout(layout)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
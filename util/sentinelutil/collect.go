@@ -0,0 +1,173 @@
+package sentinelutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tcpListen is the state of the listening sockets in /proc/net/tcp.
+const tcpListen = "0A"
+
+// runtimeSockets are the sockets of the container runtimes, in the order of detection.
+// Docker is detected first, because it runs on containerd.
+var runtimeSockets = []struct {
+	runtime string
+	socket  string
+}{
+	{runtime: ContainerRuntimeDocker, socket: "/var/run/docker.sock"},
+	{runtime: ContainerRuntimeDocker, socket: "/run/docker.sock"},
+	{runtime: ContainerRuntimeCRIO, socket: "/var/run/crio/crio.sock"},
+	{runtime: ContainerRuntimeContainerd, socket: "/run/containerd/containerd.sock"},
+}
+
+// Collector collects the report of the node, whose root is mounted on Root.
+type Collector struct {
+	// Root is where the root of the host is mounted, / in the host.
+	Root string
+	// Node is the name of the node.
+	Node string
+}
+
+// Collect collects the report of the node.
+func (c *Collector) Collect() (*Report, error) {
+	report := &Report{
+		Node: c.Node,
+		Time: time.Now(),
+	}
+
+	release, err := ioutil.ReadFile(c.path("/proc/sys/kernel/osrelease"))
+	if err != nil {
+		return nil, fmt.Errorf("read kernel version: %v", err)
+	}
+	report.KernelVersion = strings.TrimSpace(string(release))
+
+	// the sockets of the host are in the network namespace of its init process.
+	for _, file := range []string{"/proc/1/net/tcp", "/proc/1/net/tcp6"} {
+		ports, err := c.listeningPorts(file)
+		if err != nil {
+			return nil, err
+		}
+		report.ListeningPorts = append(report.ListeningPorts, ports...)
+	}
+	report.ListeningPorts = uniqueSorted(report.ListeningPorts)
+
+	for _, path := range DiskPaths {
+		disk, err := statDisk(c.path(path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("stat disk %s: %v", path, err)
+		}
+		disk.Path = path
+		report.Disks = append(report.Disks, *disk)
+	}
+
+	if report.Modules, err = c.modules(); err != nil {
+		return nil, err
+	}
+
+	for _, rs := range runtimeSockets {
+		if _, err := os.Stat(c.path(rs.socket)); err == nil {
+			report.ContainerRuntime = rs.runtime
+			break
+		}
+	}
+
+	return report, nil
+}
+
+func (c *Collector) path(path string) string {
+	return filepath.Join(c.Root, path)
+}
+
+func (c *Collector) listeningPorts(file string) ([]int, error) {
+	f, err := os.Open(c.path(file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// ipv6 is disabled.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open %s: %v", file, err)
+	}
+	defer f.Close()
+	ports, err := parseListeningPorts(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", file, err)
+	}
+	return ports, nil
+}
+
+// parseListeningPorts parses the ports of the listening sockets in the format of /proc/net/tcp, such as
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23412 1 ...
+func parseListeningPorts(r io.Reader) ([]int, error) {
+	var ports []int
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		if first {
+			// the header.
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != tcpListen {
+			continue
+		}
+		idx := strings.LastIndex(fields[1], ":")
+		if idx == -1 {
+			return nil, fmt.Errorf("unexpected local address %q", fields[1])
+		}
+		port, err := strconv.ParseUint(fields[1][idx+1:], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected local address %q: %v", fields[1], err)
+		}
+		ports = append(ports, int(port))
+	}
+	return ports, scanner.Err()
+}
+
+func (c *Collector) modules() ([]string, error) {
+	f, err := os.Open(c.path("/proc/modules"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the kernel does not support loadable modules.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open /proc/modules: %v", err)
+	}
+	defer f.Close()
+
+	var modules []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			modules = append(modules, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read /proc/modules: %v", err)
+	}
+	sort.Strings(modules)
+	return modules, nil
+}
+
+func uniqueSorted(ports []int) []int {
+	sort.Ints(ports)
+	var result []int
+	for i, port := range ports {
+		if i > 0 && port == ports[i-1] {
+			continue
+		}
+		result = append(result, port)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package sentinelutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23412 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:2710 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23413 1 0000000000000000 100 0 0 10 0
+   2: 0A00020F:0050 0A000210:D4B2 01 00000000:00000000 02:000A7D8B 00000000     0        0 23414 2 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 24123 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 24124 1 0000000000000000 100 0 0 10 0
+`
+
+func writeHostFile(t *testing.T, root, path, content string) {
+	path = filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseListeningPorts(t *testing.T) {
+	ports, err := parseListeningPorts(strings.NewReader(procNetTCP))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{80, 10000}, ports)
+	}
+
+	_, err = parseListeningPorts(strings.NewReader("header\n   0: 00000000 00000000:0000 0A\n"))
+	assert.Error(t, err)
+}
+
+func TestCollect(t *testing.T) {
+	root := t.TempDir()
+	writeHostFile(t, root, "/proc/sys/kernel/osrelease", "3.10.0-1127.el7.x86_64\n")
+	writeHostFile(t, root, "/proc/1/net/tcp", procNetTCP)
+	writeHostFile(t, root, "/proc/1/net/tcp6", procNetTCP6)
+	writeHostFile(t, root, "/proc/modules", "overlay 91659 12 - Live 0xffffffffc0697000\nbr_netfilter 22256 0 - Live 0xffffffffc045b000\n")
+	writeHostFile(t, root, "/opt/rainbond/.keep", "")
+	writeHostFile(t, root, "/run/containerd/containerd.sock", "")
+
+	collector := &Collector{Root: root, Node: "node1"}
+	report, err := collector.Collect()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "node1", report.Node)
+	assert.Equal(t, "3.10.0-1127.el7.x86_64", report.KernelVersion)
+	assert.Equal(t, []int{80, 443, 10000}, report.ListeningPorts)
+	assert.Equal(t, []int{443}, report.PortsInUse(8443, 443))
+	assert.Equal(t, []string{"br_netfilter", "overlay"}, report.Modules)
+	assert.True(t, report.HasModule("overlay"))
+	assert.Equal(t, ContainerRuntimeContainerd, report.ContainerRuntime)
+	if disk := report.Disk("/opt/rainbond"); assert.NotNil(t, disk) {
+		assert.True(t, disk.Total > 0)
+	}
+	assert.Nil(t, report.Disk("/var/lib/docker"))
+
+	// docker is found before containerd.
+	writeHostFile(t, root, "/var/run/docker.sock", "")
+	report, err = collector.Collect()
+	if assert.NoError(t, err) {
+		assert.Equal(t, ContainerRuntimeDocker, report.ContainerRuntime)
+	}
+}
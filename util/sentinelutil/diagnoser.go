@@ -0,0 +1,127 @@
+package sentinelutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goodrain/rainbond-operator/util/rbdutil"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Labels returns the labels of the sentinel pods.
+func Labels() map[string]string {
+	return rbdutil.LabelsForRainbond(map[string]string{
+		"name": Name,
+	})
+}
+
+// Diagnoser gets the diagnostics of the nodes.
+type Diagnoser interface {
+	// Diagnose returns the diagnostics of the nodes by node name, from the running sentinels in the namespace.
+	// The nodes whose sentinel is not running or does not respond are left out, with the errors of the latter.
+	Diagnose(ctx context.Context, namespace string) (map[string]*NodeDiagnostics, map[string]error, error)
+}
+
+type diagnoser struct {
+	client     client.Client
+	httpClient *http.Client
+}
+
+// NewDiagnoser creates a new diagnoser, which requests the sentinels through the container network.
+func NewDiagnoser(client client.Client) Diagnoser {
+	return &diagnoser{
+		client:     client,
+		httpClient: &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+func (d *diagnoser) Diagnose(ctx context.Context, namespace string) (map[string]*NodeDiagnostics, map[string]error, error) {
+	pods := &corev1.PodList{}
+	if err := d.client.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(Labels())); err != nil {
+		return nil, nil, fmt.Errorf("list sentinel pods: %v", err)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	diagnostics := make(map[string]*NodeDiagnostics)
+	errs := make(map[string]error)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.Spec.NodeName == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(node, addr string) {
+			defer wg.Done()
+			diagnostic, err := Get(ctx, d.httpClient, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[node] = err
+				return
+			}
+			diagnostics[node] = diagnostic
+		}(pod.Spec.NodeName, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(Port)))
+	}
+	wg.Wait()
+
+	return diagnostics, errs, nil
+}
+
+// OutdatedError is returned if the sentinel does not serve the diagnostics, which is the case for the sentinels
+// of the images built before the diagnostics.
+type OutdatedError struct {
+	Addr string
+}
+
+func (e *OutdatedError) Error() string {
+	return fmt.Sprintf("the sentinel on %s does not serve the diagnostics, its image is outdated", e.Addr)
+}
+
+// IsOutdated returns true if the error is an OutdatedError.
+func IsOutdated(err error) bool {
+	_, ok := err.(*OutdatedError)
+	return ok
+}
+
+// Get gets the report from the sentinel on the address, and measures the time offset of its node.
+// The time of the node is expected to be collected halfway through the request.
+func Get(ctx context.Context, httpClient *http.Client, addr string) (*NodeDiagnostics, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+DiagnosticsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read diagnostics from %s: %v", addr, err)
+	}
+	end := time.Now()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &OutdatedError{Addr: addr}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get diagnostics from %s: %s: %s", addr, resp.Status, body)
+	}
+
+	diagnostics := &NodeDiagnostics{}
+	if err := json.Unmarshal(body, &diagnostics.Report); err != nil {
+		// the older sentinels respond ok on every path.
+		return nil, &OutdatedError{Addr: addr}
+	}
+	diagnostics.TimeOffset = diagnostics.Time.Sub(start.Add(end.Sub(start) / 2))
+	return diagnostics, nil
+}
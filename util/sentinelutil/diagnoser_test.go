@@ -0,0 +1,74 @@
+package sentinelutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestGet(t *testing.T) {
+	root := t.TempDir()
+	writeHostFile(t, root, "/proc/sys/kernel/osrelease", "5.4.0-42-generic\n")
+	writeHostFile(t, root, "/proc/1/net/tcp", procNetTCP)
+	server := httptest.NewServer(NewHandler(ctrl.Log, &Collector{Root: root, Node: "node1"}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	diagnostics, err := Get(context.Background(), server.Client(), addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "node1", diagnostics.Node)
+	assert.Equal(t, "5.4.0-42-generic", diagnostics.KernelVersion)
+	assert.Equal(t, []int{80, 10000}, diagnostics.ListeningPorts)
+	// the sentinel runs on the same host in the test.
+	assert.True(t, diagnostics.TimeOffset < time.Second && diagnostics.TimeOffset > -time.Second, diagnostics.TimeOffset)
+
+	// the connectivity of the container network is checked on the other paths.
+	resp, err := server.Client().Get(server.URL + "/")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestGetCollectFailed(t *testing.T) {
+	server := httptest.NewServer(NewHandler(ctrl.Log, &Collector{Root: t.TempDir(), Node: "node1"}))
+	defer server.Close()
+
+	_, err := Get(context.Background(), server.Client(), strings.TrimPrefix(server.URL, "http://"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "read kernel version")
+	}
+}
+
+func TestGetOutdated(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name:    "not found",
+			handler: http.NotFound,
+		},
+		{
+			name:    "ok on every path",
+			handler: func(w http.ResponseWriter, req *http.Request) {},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+
+			_, err := Get(context.Background(), server.Client(), strings.TrimPrefix(server.URL, "http://"))
+			assert.True(t, IsOutdated(err), "error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package sentinelutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The kinds of the probe targets.
+const (
+	// ProbeKindPod dials the ip of a sentinel pod.
+	ProbeKindPod = "pod"
+	// ProbeKindService dials the cluster ip of the sentinel service.
+	ProbeKindService = "service"
+	// ProbeKindDNS resolves the domain name of the sentinel service, and dials it.
+	ProbeKindDNS = "dns"
+	// ProbeKindResolve only resolves the domain name in the address, which has no port.
+	ProbeKindResolve = "resolve"
+)
+
+// probeTimeout is the timeout to resolve and dial a target.
+const probeTimeout = time.Second
+
+// ProbeTarget is a target for a sentinel to dial.
+type ProbeTarget struct {
+	// Kind of the target, such as ProbeKindPod.
+	Kind string `json:"kind"`
+	// Name of the target, such as the node of the target sentinel.
+	Name string `json:"name"`
+	// Address to dial, in the form of host:port, where the host may be a domain name.
+	// It is the domain name to resolve for ProbeKindResolve.
+	Address string `json:"address"`
+}
+
+// ProbeResult is the result of dialing a target.
+type ProbeResult struct {
+	ProbeTarget
+	// Addresses the domain name of the target resolved to, only for ProbeKindResolve.
+	Addresses []string `json:"addresses,omitempty"`
+	// Error of resolving or dialing the target, empty if it is reachable.
+	Error string `json:"error,omitempty"`
+}
+
+// ProbeRequest is the request for a sentinel to probe the targets.
+type ProbeRequest struct {
+	Targets []ProbeTarget `json:"targets"`
+}
+
+// ProbeTargets dials the targets in parallel, and returns the results in the order of the targets.
+func ProbeTargets(ctx context.Context, targets []ProbeTarget) []ProbeResult {
+	results := make([]ProbeResult, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].ProbeTarget = targets[i]
+			var err error
+			if targets[i].Kind == ProbeKindResolve {
+				results[i].Addresses, err = resolve(ctx, targets[i].Address)
+			} else {
+				err = probe(ctx, targets[i].Address)
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func probe(ctx context.Context, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) == nil {
+		addrs, err := lookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		host = addrs[0]
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func resolve(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	addrs, err := lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func lookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %v", host, err)
+	}
+	return addrs, nil
+}
+
+// Prober asks the sentinels to probe the targets.
+type Prober interface {
+	// Probe asks the sentinel on the address to probe the targets.
+	Probe(ctx context.Context, addr string, targets []ProbeTarget) ([]ProbeResult, error)
+}
+
+type prober struct {
+	httpClient *http.Client
+}
+
+// NewProber creates a new prober, which requests the sentinels through the container network.
+func NewProber() Prober {
+	return &prober{
+		httpClient: &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+func (p *prober) Probe(ctx context.Context, addr string, targets []ProbeTarget) ([]ProbeResult, error) {
+	body, err := json.Marshal(&ProbeRequest{Targets: targets})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+ProbePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read probe results from %s: %v", addr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("probe from %s: %s: %s", addr, resp.Status, body)
+	}
+
+	var results []ProbeResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("decode probe results from %s: %v", addr, err)
+	}
+	return results, nil
+}
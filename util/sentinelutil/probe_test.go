@@ -0,0 +1,48 @@
+package sentinelutil
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(NewHandler(ctrl.Log, &Collector{Root: t.TempDir(), Node: "node1"}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	_, port, _ := net.SplitHostPort(addr)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	targets := []ProbeTarget{
+		{Kind: ProbeKindPod, Name: "node1", Address: addr},
+		{Kind: ProbeKindPod, Name: "node2", Address: closedAddr},
+		{Kind: ProbeKindDNS, Name: "localhost", Address: net.JoinHostPort("localhost", port)},
+		{Kind: ProbeKindDNS, Name: "foo.invalid", Address: "foo.invalid:" + strconv.Itoa(Port)},
+		{Kind: ProbeKindResolve, Name: "localhost", Address: "127.0.0.1"},
+	}
+	results, err := NewProber().Probe(context.Background(), addr, targets)
+	if !assert.NoError(t, err) || !assert.Len(t, results, len(targets)) {
+		return
+	}
+	for i := range targets {
+		assert.Equal(t, targets[i], results[i].ProbeTarget)
+	}
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[1].Error)
+	assert.Empty(t, results[2].Error)
+	assert.Contains(t, results[3].Error, "resolve foo.invalid")
+	assert.Empty(t, results[4].Error)
+	assert.Equal(t, []string{"127.0.0.1"}, results[4].Addresses)
+}
@@ -0,0 +1,100 @@
+// Package sentinelutil collects the diagnostics of the nodes in the rainbond-operator-sentinel, which runs on every node,
+// and gets them from the sentinels in the operator.
+package sentinelutil
+
+import (
+	"time"
+)
+
+const (
+	// Name of the sentinel DaemonSet.
+	Name = "rainbond-operator-sentinel"
+	// Port the sentinels listen on.
+	Port = 8080
+	// DiagnosticsPath is the path of the diagnostics endpoint.
+	DiagnosticsPath = "/diagnostics"
+	// ProbePath is the path of the endpoint which probes the targets in the request.
+	ProbePath = "/probe"
+	// HostRoot is where the root of the host is mounted in the sentinels.
+	HostRoot = "/host"
+)
+
+// The container runtimes of the nodes.
+const (
+	ContainerRuntimeDocker     = "docker"
+	ContainerRuntimeContainerd = "containerd"
+	ContainerRuntimeCRIO       = "cri-o"
+)
+
+// DiskPaths are the paths on the hosts whose free disk is reported, if they exist.
+var DiskPaths = []string{"/opt/rainbond", "/var/lib/docker", "/var/lib/containerd"}
+
+// Report is the diagnostics of a node, reported by the sentinel on it.
+type Report struct {
+	// Node is the name of the node.
+	Node string `json:"node"`
+	// Time is the time of the node when the report is collected.
+	Time time.Time `json:"time"`
+	// KernelVersion is the release of the kernel, such as 3.10.0-1127.el7.x86_64.
+	KernelVersion string `json:"kernelVersion"`
+	// ContainerRuntime is the container runtime found on the node, empty if none is found.
+	ContainerRuntime string `json:"containerRuntime,omitempty"`
+	// ListeningPorts are the tcp ports listened on the node, in ascending order.
+	ListeningPorts []int `json:"listeningPorts"`
+	// Disks are the usages of the DiskPaths existing on the node.
+	Disks []Disk `json:"disks"`
+	// Modules are the loaded kernel modules.
+	Modules []string `json:"modules"`
+}
+
+// Disk is the usage of the filesystem of a path.
+type Disk struct {
+	// Path on the host.
+	Path string `json:"path"`
+	// Free bytes available to unprivileged users.
+	Free uint64 `json:"free"`
+	// Total bytes.
+	Total uint64 `json:"total"`
+}
+
+// PortsInUse returns the ports listened on the node.
+func (r *Report) PortsInUse(ports ...int) []int {
+	listening := make(map[int]bool, len(r.ListeningPorts))
+	for _, port := range r.ListeningPorts {
+		listening[port] = true
+	}
+	var inUse []int
+	for _, port := range ports {
+		if listening[port] {
+			inUse = append(inUse, port)
+		}
+	}
+	return inUse
+}
+
+// Disk returns the usage of the path, or nil if the path does not exist on the node.
+func (r *Report) Disk(path string) *Disk {
+	for i := range r.Disks {
+		if r.Disks[i].Path == path {
+			return &r.Disks[i]
+		}
+	}
+	return nil
+}
+
+// HasModule tells whether the kernel module is loaded.
+func (r *Report) HasModule(module string) bool {
+	for _, m := range r.Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeDiagnostics is the report of a node, with its time offset measured by the operator.
+type NodeDiagnostics struct {
+	Report
+	// TimeOffset is how far the time of the node is ahead of the operator, negative if it is behind.
+	TimeOffset time.Duration `json:"timeOffset"`
+}
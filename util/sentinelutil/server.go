@@ -0,0 +1,51 @@
+package sentinelutil
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-logr/logr"
+)
+
+// NewHandler returns the handler of the sentinel, serving the report collected by the collector on DiagnosticsPath,
+// and the results of the targets probed from the node on ProbePath.
+// The other paths respond ok, so that the sentinel can be dialed for the connectivity of the container network.
+func NewHandler(log logr.Logger, collector *Collector) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiagnosticsPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := collector.Collect()
+		if err != nil {
+			log.Error(err, "collect diagnostics")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Error(err, "write diagnostics")
+		}
+	})
+	mux.HandleFunc(ProbePath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var probeReq ProbeRequest
+		if err := json.NewDecoder(req.Body).Decode(&probeReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results := ProbeTargets(req.Context(), probeReq.Targets)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			log.Error(err, "write probe results")
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
@@ -0,0 +1,16 @@
+package sentinelutil
+
+import (
+	"syscall"
+)
+
+func statDisk(path string) (*Disk, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+	return &Disk{
+		Free:  stat.Bavail * uint64(stat.Bsize),
+		Total: stat.Blocks * uint64(stat.Bsize),
+	}, nil
+}
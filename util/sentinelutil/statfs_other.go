@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package sentinelutil
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func statDisk(path string) (*Disk, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
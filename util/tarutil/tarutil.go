@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -113,3 +114,41 @@ func Untartar(tarName, xpath string) (err error) {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// ReadFiles reads the regular files whose names are accepted by match from the gzipped tar file tarName, without
+// extracting it. The contents are keyed by the names in the tar file. A file larger than maxSize is an error.
+func ReadFiles(tarName string, maxSize int64, match func(name string) bool) (map[string][]byte, error) {
+	f, err := os.Open(tarName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read gzip %s: %v", tarName, err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar %s: %v", tarName, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !match(hdr.Name) {
+			continue
+		}
+		if hdr.Size > maxSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", hdr.Name, maxSize)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %v", hdr.Name, err)
+		}
+		files[hdr.Name] = content
+	}
+}